@@ -2,26 +2,36 @@ package epublib
 
 import (
 	"context"
+	"fmt"
+	"regexp"
 	"time"
 )
 
 type AuthLevel string
 
 const (
-	AdminLevel AuthLevel = "Admin"
-	UserLevel  AuthLevel = "User"
+	// SuperAdminLevel administers the deployment and its tenants on top of
+	// everything AdminLevel may do within its tenant.
+	SuperAdminLevel AuthLevel = "SuperAdmin"
+	AdminLevel      AuthLevel = "Admin"
+	UserLevel       AuthLevel = "User"
 )
 
 // IsValid checks if an AuthLevel is valid
 func (a AuthLevel) IsValid() bool {
 	switch a {
-	case AdminLevel, UserLevel:
+	case SuperAdminLevel, AdminLevel, UserLevel:
 		return true
 	default:
 		return false
 	}
 }
 
+// IsAdmin reports whether the level may administer its tenant.
+func (a AuthLevel) IsAdmin() bool {
+	return a == AdminLevel || a == SuperAdminLevel
+}
+
 // String returns the string representation of the AuthLevel
 func (a AuthLevel) String() string {
 	return string(a)
@@ -29,7 +39,27 @@ func (a AuthLevel) String() string {
 
 // Values returns all possible AuthLevel values
 func Values() []AuthLevel {
-	return []AuthLevel{AdminLevel, UserLevel}
+	return []AuthLevel{SuperAdminLevel, AdminLevel, UserLevel}
+}
+
+const (
+	MinUsernameLength = 3
+	MaxUsernameLength = 25
+)
+
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// ValidateUsername checks that a username is 3 to 25 characters long, starts
+// with a letter or digit and otherwise only contains letters, digits, dots,
+// underscores and hyphens. Usernames are compared case-insensitively.
+func ValidateUsername(username string) error {
+	if len(username) < MinUsernameLength || len(username) > MaxUsernameLength {
+		return fmt.Errorf("username must be between %d and %d characters", MinUsernameLength, MaxUsernameLength)
+	}
+	if !usernamePattern.MatchString(username) {
+		return fmt.Errorf("username must start with a letter or digit and may only contain letters, digits, '.', '_' and '-'")
+	}
+	return nil
 }
 
 type Auth struct {
@@ -39,6 +69,7 @@ type Auth struct {
 	Password  string    `json:"password"`
 	Email     string    `json:"email"`
 	Level     AuthLevel `json:"level"`
+	Version   int       `json:"version"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 	DeletedAt time.Time `json:"deleted_at"`
@@ -58,17 +89,39 @@ type AuthService interface {
 	// Returns ENOTFOUND if ID does not exist.
 	FindAuthByUserID(ctx context.Context, id string) (*Auth, error)
 
+	// Looks up the authentication objects of several users at once, keyed
+	// by UserID. Users without one are left out.
+	FindAuthsByUserIDs(ctx context.Context, ids []string) (map[string]*Auth, error)
+
+	// Looks up the non-deleted authentication objects using any of the
+	// usernames, ignoring case, or any of the emails.
+	FindAuthsByLogins(ctx context.Context, usernames, emails []string) ([]*Auth, error)
+
 	// Creates a new authentication object
 	// On success, the auth.ID is set to the new authentication ID.
+	// Returns ErrUsernameTaken if the username is not available.
 	CreateAuth(ctx context.Context, auth *Auth) error
 
-	// Permanently deletes an authentication object from the system by ID.
+	// Soft deletes an authentication object from the system by ID.
 	// The parent user object is not removed.
 	DeleteAuth(ctx context.Context, id string) error
 
+	// Restores a soft deleted authentication object.
+	// Returns ErrNotFound if no deleted authentication object has the given ID.
+	RestoreAuth(ctx context.Context, id string) error
+
 	// FindAuthByEmail looks up an authentication object by email.
 	FindAuthByEmail(ctx context.Context, email string) (*Auth, error)
 
+	// FindAuthByUsername looks up a non-deleted authentication object by
+	// username, ignoring case. Returns ENOTFOUND if it does not exist.
+	FindAuthByUsername(ctx context.Context, username string) (*Auth, error)
+
+	// Renames the authentication object. The previous username stays reserved
+	// for the same user for reserveFor. Returns ErrUsernameTaken if username
+	// is used by or reserved for someone else.
+	ChangeUsername(ctx context.Context, id, username string, reserveFor time.Duration) error
+
 	// Resets Auth password
 	ResetAuthPassword(ctx context.Context, id, email, password string) error
 }
@@ -0,0 +1,199 @@
+package epublib
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+)
+
+type ContributorRole string
+
+// Common MARC relator codes of contributors. Other codes are accepted as
+// well.
+const (
+	AuthorRole      ContributorRole = "aut"
+	TranslatorRole  ContributorRole = "trl"
+	IllustratorRole ContributorRole = "ill"
+	EditorRole      ContributorRole = "edt"
+)
+
+// IsValid checks if a ContributorRole is shaped like a MARC relator code
+func (r ContributorRole) IsValid() bool {
+	return relatorPattern.MatchString(string(r))
+}
+
+// Author is a person or organization contributing to books, as author or in
+// any other role. Creators of books are linked to the author whose name or
+// aliases match, see AuthorNameKey.
+type Author struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+
+	// Name used to sort authors, like "Tolkien, J. R. R.".
+	SortName string `json:"sort_name"`
+
+	// Other spellings of the name, like pen names or transliterations.
+	Aliases []string `json:"aliases"`
+
+	Bio string `json:"bio"`
+
+	// Blob key prefix of the photo thumbnails, empty if none was uploaded.
+	PhotoKey string `json:"-"`
+	HasPhoto bool   `json:"has_photo"`
+
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+// Validate checks the fields of an author that clients may set.
+func (a *Author) Validate() error {
+	if a.Name == "" || len(a.Name) > 255 {
+		return fmt.Errorf("name must be between 1 and 255 characters")
+	}
+	if AuthorNameKey(a.Name) == "" {
+		return fmt.Errorf("name must contain letters or digits")
+	}
+	if len(a.SortName) > 255 {
+		return fmt.Errorf("sort_name must be at most 255 characters")
+	}
+	for _, alias := range a.Aliases {
+		if AuthorNameKey(alias) == "" || len(alias) > 255 {
+			return fmt.Errorf("aliases must be between 1 and 255 characters")
+		}
+	}
+	if len(a.Bio) > 10000 {
+		return fmt.Errorf("bio must be at most 10000 characters")
+	}
+	return nil
+}
+
+// BookContributor is the link of a book to an author in a role, in display
+// order.
+type BookContributor struct {
+	AuthorID string          `json:"author_id"`
+	Name     string          `json:"name"`
+	SortName string          `json:"sort_name"`
+	Role     ContributorRole `json:"role"`
+}
+
+// nameTokens splits a name into lowercase words of letters and digits, so
+// punctuation and spacing do not matter: "J.R.R." and "J. R. R." both give
+// j, r and r.
+func nameTokens(name string) []string {
+	return strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// invertName turns "Tolkien, J. R. R." into "J. R. R. Tolkien". Names without
+// a comma are returned as is.
+func invertName(name string) string {
+	if i := strings.Index(name, ","); i >= 0 {
+		return strings.TrimSpace(name[i+1:]) + " " + strings.TrimSpace(name[:i])
+	}
+	return name
+}
+
+// AuthorNameKey returns the key matching spellings of the same name, in
+// display or inverted order and regardless of case, spacing and
+// punctuation: "J. R. R. Tolkien" and "Tolkien, J.R.R." share a key. It is
+// empty for names without letters or digits.
+func AuthorNameKey(name string) string {
+	return strings.Join(nameTokens(invertName(name)), " ")
+}
+
+// AuthorMatchKey returns a looser key than AuthorNameKey, made of the first
+// initial and the last word, for finding authors that may be duplicates,
+// like "John Ronald Reuel Tolkien" and "J. R. R. Tolkien".
+func AuthorMatchKey(name string) string {
+	tokens := nameTokens(invertName(name))
+	if len(tokens) < 2 {
+		return strings.Join(tokens, " ")
+	}
+	return string([]rune(tokens[0])[0]) + " " + tokens[len(tokens)-1]
+}
+
+// AuthorSortName derives the sort name of an author from the name, moving
+// the last word first: "J. R. R. Tolkien" gives "Tolkien, J. R. R.". Names
+// that are already inverted or made of a single word are kept.
+func AuthorSortName(name string) string {
+	name = strings.Join(strings.Fields(name), " ")
+	if strings.Contains(name, ",") {
+		return name
+	}
+	i := strings.LastIndex(name, " ")
+	if i < 0 {
+		return name
+	}
+	return name[i+1:] + ", " + name[:i]
+}
+
+// AuthorService represents a service for managing authors and the links of
+// books to them.
+type AuthorService interface {
+	// Retrieves a non-deleted author by ID.
+	FindAuthorByID(ctx context.Context, id string) (*Author, error)
+
+	// Retrieves a list of authors by filter, by sort name. Also returns
+	// total count of matching authors which may differ from returned results
+	// if filter.Limit is specified.
+	FindAuthors(ctx context.Context, filter AuthorFilter) ([]*Author, int, error)
+
+	// Creates a new author. Returns ErrAuthorNameTaken if the name or an
+	// alias matches another author.
+	CreateAuthor(ctx context.Context, author *Author) error
+
+	// Updates an author. If upd.Version is set, the update is only applied
+	// when it matches the current version, otherwise ErrConflict is
+	// returned. Returns ErrAuthorNameTaken if the name or an alias matches
+	// another author.
+	UpdateAuthor(ctx context.Context, id string, upd AuthorUpdate) (*Author, error)
+
+	// Soft deletes an author and unlinks it from its books.
+	DeleteAuthor(ctx context.Context, id string, version int) error
+
+	// Points an author at new photo thumbnails, or at none if photoKey is
+	// empty.
+	SetAuthorPhoto(ctx context.Context, id, photoKey string) (*Author, error)
+
+	// Merges other authors into an author: their books are linked to it,
+	// their names and aliases become its aliases and they are deleted.
+	MergeAuthors(ctx context.Context, id string, otherIDs []string) (*Author, error)
+
+	// Retrieves groups of authors that may be duplicates, sharing an
+	// AuthorMatchKey.
+	FindDuplicateAuthors(ctx context.Context) ([][]*Author, error)
+
+	// Links a book to the authors matching its creators, creating the
+	// missing ones, and marks the book as linked.
+	LinkBookContributors(ctx context.Context, bookID string, creators []BookCreator) error
+}
+
+// MaxAuthorPageSize caps AuthorFilter.Limit.
+const MaxAuthorPageSize = 100
+
+// AuthorFilter represents a filter passed to FindAuthors().
+type AuthorFilter struct {
+	// Filtering fields. Name matches case-insensitive substrings of the name
+	// and aliases.
+	Name string `json:"name"`
+
+	// Restrict to subset of results.
+	Offset int `json:"offset"`
+	Limit  int `json:"limit"`
+}
+
+// AuthorUpdate represents a set of fields to be updated via UpdateAuthor().
+type AuthorUpdate struct {
+	Name     string   `json:"name"`
+	SortName string   `json:"sort_name"`
+	Aliases  []string `json:"aliases"`
+	Bio      string   `json:"bio"`
+
+	// Expected current version of the author, zero skips the check.
+	Version int `json:"-"`
+}
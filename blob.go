@@ -0,0 +1,27 @@
+package epublib
+
+import (
+	"context"
+	"io"
+)
+
+// BlobStore represents a storage backend for binary objects such as images.
+type BlobStore interface {
+	// Stores size bytes read from r under key, replacing any existing object.
+	PutBlob(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+
+	// Opens the object stored under key.
+	// Returns ErrNotFound if the object does not exist.
+	GetBlob(ctx context.Context, key string) (io.ReadCloser, error)
+
+	// Removes the object stored under key. Missing objects are not an error.
+	DeleteBlob(ctx context.Context, key string) error
+}
+
+// BlobRangeStore is implemented by blob stores that can read parts of an
+// object without transferring all of it.
+type BlobRangeStore interface {
+	// Opens the object stored under key, of the given size, for random
+	// access. Returns ErrNotFound if the object does not exist.
+	OpenBlobAt(ctx context.Context, key string, size int64) (io.ReaderAt, error)
+}
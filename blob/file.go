@@ -0,0 +1,78 @@
+package blob
+
+import (
+	"context"
+	epublib "epublib"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// FileStore represents a blob store backed by the local filesystem.
+type FileStore struct {
+	root string
+}
+
+// NewFileStore returns a new instance of FileStore rooted at dir.
+func NewFileStore(dir string) *FileStore {
+	return &FileStore{root: dir}
+}
+
+// path maps a key onto the filesystem, keeping it inside the store root.
+func (s *FileStore) path(key string) string {
+	return filepath.Join(s.root, filepath.FromSlash(path.Clean("/"+key)))
+}
+
+func (s *FileStore) PutBlob(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	dst := s.path(key)
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		log.Println(err)
+		return err
+	}
+
+	// Write to a temporary file first so readers never see partial objects.
+	tmp, err := os.CreateTemp(filepath.Dir(dst), ".upload-*")
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		log.Println(err)
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		log.Println(err)
+		return err
+	}
+	if err := os.Rename(tmp.Name(), dst); err != nil {
+		log.Println(err)
+		return err
+	}
+	return nil
+}
+
+func (s *FileStore) GetBlob(ctx context.Context, key string) (io.ReadCloser, error) {
+	f, err := os.Open(s.path(key))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, epublib.ErrNotFound
+		}
+		log.Println(err)
+		return nil, err
+	}
+	return f, nil
+}
+
+func (s *FileStore) DeleteBlob(ctx context.Context, key string) error {
+	err := os.Remove(s.path(key))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Println(err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package blob
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// Ranged reads fetch whole blocks and keep the most recent ones, so the
+// small reads of zip and flate readers do not turn into one request each.
+const (
+	rangeBlockSize = 512 << 10
+	rangeMaxBlocks = 16
+)
+
+// OpenBlobAt gives random access to the object stored under key, fetching
+// the parts that are read with ranged requests. The last block is fetched
+// right away since zip readers start at the end of the archive, which also
+// reports missing objects up front.
+func (s *S3Store) OpenBlobAt(ctx context.Context, key string, size int64) (io.ReaderAt, error) {
+	r := &s3RangeReader{store: s, ctx: ctx, key: key, size: size, blocks: map[int64][]byte{}}
+	if size > 0 {
+		if _, err := r.block((size - 1) / rangeBlockSize); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// s3RangeReader reads an S3 object with ranged requests, caching the most
+// recently read blocks.
+type s3RangeReader struct {
+	store *S3Store
+	ctx   context.Context
+	key   string
+	size  int64
+
+	mu     sync.Mutex
+	blocks map[int64][]byte
+	order  []int64
+}
+
+func (r *s3RangeReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("s3: negative offset %d", off)
+	}
+	n := 0
+	for n < len(p) && off < r.size {
+		block, err := r.block(off / rangeBlockSize)
+		if err != nil {
+			return n, err
+		}
+		c := copy(p[n:], block[off%rangeBlockSize:])
+		n += c
+		off += int64(c)
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// block returns the block at index, fetching it if it is not cached.
+func (r *s3RangeReader) block(index int64) ([]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if block, ok := r.blocks[index]; ok {
+		return block, nil
+	}
+	start := index * rangeBlockSize
+	end := start + rangeBlockSize
+	if end > r.size {
+		end = r.size
+	}
+	req, err := r.store.newRequest(r.ctx, http.MethodGet, r.key, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end-1))
+	resp, err := r.store.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusPartialContent {
+		return nil, fmt.Errorf("s3: GET %s: ranged request answered with %s", req.URL.Path, resp.Status)
+	}
+	block := make([]byte, end-start)
+	if _, err := io.ReadFull(resp.Body, block); err != nil {
+		return nil, err
+	}
+
+	// Evict the oldest block once the cache is full
+	if len(r.order) == rangeMaxBlocks {
+		delete(r.blocks, r.order[0])
+		r.order = r.order[1:]
+	}
+	r.blocks[index] = block
+	r.order = append(r.order, index)
+	return block, nil
+}
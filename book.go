@@ -0,0 +1,335 @@
+package epublib
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+type BookStatus string
+
+const (
+	// DraftBook is only visible to admins while it is being prepared.
+	DraftBook     BookStatus = "draft"
+	PublishedBook BookStatus = "published"
+	ArchivedBook  BookStatus = "archived"
+)
+
+// IsValid checks if a BookStatus is valid
+func (s BookStatus) IsValid() bool {
+	switch s {
+	case DraftBook, PublishedBook, ArchivedBook:
+		return true
+	default:
+		return false
+	}
+}
+
+// Book is a title of the catalog.
+type Book struct {
+	ID          string `json:"id"`
+	Title       string `json:"title"`
+	Subtitle    string `json:"subtitle"`
+	Language    string `json:"language"`
+	Description string `json:"description"`
+
+	// ISBN-13 of every edition the book is published as.
+	ISBNs []string `json:"isbns"`
+
+	// Zero if unknown.
+	PublicationDate time.Time `json:"publication_date"`
+
+	Publisher string     `json:"publisher"`
+	PageCount int        `json:"page_count"`
+	Status    BookStatus `json:"status"`
+
+	// Publisher entity the publisher name is linked to, empty if none.
+	PublisherID string `json:"publisher_id"`
+
+	// Authors and other contributors in display order.
+	Creators []BookCreator `json:"creators"`
+
+	// Authors the creators are linked to, in display order.
+	Contributors []BookContributor `json:"contributors"`
+
+	// Series the book is part of, empty if none, and its position in it,
+	// like 1, 1.5 or 2. Books without known position come first.
+	SeriesID       string  `json:"series_id"`
+	SeriesName     string  `json:"series_name"`
+	SeriesPosition float64 `json:"series_position"`
+
+	// Categories the book is classified in, by name.
+	Categories []BookCategory `json:"categories"`
+
+	// Identifiers other than ISBNs, like UUIDs or DOIs.
+	Identifiers []BookIdentifier `json:"identifiers"`
+
+	Subjects []string `json:"subjects"`
+	Rights   string   `json:"rights"`
+
+	// AllowScripts lets the scripts of EPUB 3 content documents declared
+	// as scripted run in the reader. Only for trusted publications.
+	AllowScripts bool `json:"allow_scripts"`
+
+	// Blob key and size of the EPUB file, empty if none was uploaded.
+	FileKey  string `json:"-"`
+	FileSize int64  `json:"file_size"`
+
+	// Revision the EPUB file belongs to, empty for books without file.
+	RevisionID string `json:"revision_id"`
+
+	// Blob key prefix of the cover thumbnails, empty if the book has no
+	// cover.
+	CoverKey string `json:"-"`
+	HasCover bool   `json:"has_cover"`
+
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+// BookCreator is a person or organization that contributed to a book. Role
+// is a MARC relator code like aut, trl or ill.
+type BookCreator struct {
+	Name   string `json:"name"`
+	FileAs string `json:"file_as"`
+	Role   string `json:"role"`
+}
+
+// BookCategory is a category a book is classified in.
+type BookCategory struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// BookIdentifier is an identifier of a book in the given scheme.
+type BookIdentifier struct {
+	Scheme string `json:"scheme"`
+	Value  string `json:"value"`
+}
+
+// languageTagPattern matches BCP 47 language tags like "en", "id" or
+// "pt-BR", which is what dc:language holds.
+var languageTagPattern = regexp.MustCompile(`^[A-Za-z]{2,3}(-[A-Za-z0-9]{1,8})*$`)
+
+// relatorPattern matches MARC relator codes.
+var relatorPattern = regexp.MustCompile(`^[a-z]{3}$`)
+
+// isbnPattern matches ISBN-10 and ISBN-13 as returned by NormalizeISBN.
+var isbnPattern = regexp.MustCompile(`^([0-9]{9}[0-9X]|[0-9]{13})$`)
+
+// isbnPrefixPattern matches the label ISBNs are often printed with, like
+// "ISBN " or "ISBN-13: ".
+var isbnPrefixPattern = regexp.MustCompile(`^ISBN(-1[03])?:?`)
+
+// NormalizeISBN removes the label, hyphens and spaces an ISBN is usually
+// printed with and uppercases the ISBN-10 check digit.
+func NormalizeISBN(isbn string) string {
+	isbn = strings.ToUpper(strings.TrimSpace(isbn))
+	isbn = isbnPrefixPattern.ReplaceAllString(isbn, "")
+	return strings.NewReplacer("-", "", " ", "").Replace(isbn)
+}
+
+// isbnCheckDigit computes the check digit of the first 9 digits of an
+// ISBN-10 or the first 12 of an ISBN-13.
+func isbnCheckDigit(digits string) byte {
+	if len(digits) == 9 {
+		sum := 0
+		for i := 0; i < 9; i++ {
+			sum += int(digits[i]-'0') * (10 - i)
+		}
+		check := (11 - sum%11) % 11
+		if check == 10 {
+			return 'X'
+		}
+		return byte('0' + check)
+	}
+	sum := 0
+	for i := 0; i < 12; i++ {
+		weight := 1
+		if i%2 == 1 {
+			weight = 3
+		}
+		sum += int(digits[i]-'0') * weight
+	}
+	return byte('0' + (10-sum%10)%10)
+}
+
+// ISBN13 returns the ISBN-13 of an ISBN-10 or ISBN-13 as returned by
+// NormalizeISBN, or isbn unchanged if it is not a valid ISBN.
+func ISBN13(isbn string) string {
+	if !IsISBN(isbn) || len(isbn) == 13 {
+		return isbn
+	}
+	digits := "978" + isbn[:9]
+	return digits + string(isbnCheckDigit(digits))
+}
+
+// ISBN10 returns the ISBN-10 of an ISBN-13 in the 978 range, or isbn
+// unchanged if it has none or is not a valid ISBN.
+func ISBN10(isbn string) string {
+	if !IsISBN(isbn) || len(isbn) == 10 || !strings.HasPrefix(isbn, "978") {
+		return isbn
+	}
+	digits := isbn[3:12]
+	return digits + string(isbnCheckDigit(digits))
+}
+
+// IsLanguageTag reports whether tag looks like a BCP 47 language tag.
+func IsLanguageTag(tag string) bool {
+	return len(tag) <= 35 && languageTagPattern.MatchString(tag)
+}
+
+// IsISBN reports whether isbn, as returned by NormalizeISBN, is an ISBN-10
+// or ISBN-13 with a valid check digit.
+func IsISBN(isbn string) bool {
+	if !isbnPattern.MatchString(isbn) {
+		return false
+	}
+	if len(isbn) == 13 && !strings.HasPrefix(isbn, "978") && !strings.HasPrefix(isbn, "979") {
+		return false
+	}
+	return isbnCheckDigit(isbn[:len(isbn)-1]) == isbn[len(isbn)-1]
+}
+
+// Validate checks the fields of a book that clients may set. ISBNs are
+// expected to be normalized.
+func (b *Book) Validate() error {
+	if b.Title == "" || len(b.Title) > 255 {
+		return fmt.Errorf("title must be between 1 and 255 characters")
+	}
+	if len(b.Subtitle) > 255 {
+		return fmt.Errorf("subtitle must be at most 255 characters")
+	}
+	if b.Language != "" && !IsLanguageTag(b.Language) {
+		return fmt.Errorf("language must be a BCP 47 language tag")
+	}
+	for _, isbn := range b.ISBNs {
+		if !IsISBN(isbn) {
+			return fmt.Errorf("invalid ISBN %q", isbn)
+		}
+	}
+	for _, creator := range b.Creators {
+		if creator.Name == "" || len(creator.Name) > 255 {
+			return fmt.Errorf("creator name must be between 1 and 255 characters")
+		}
+		if creator.Role != "" && !relatorPattern.MatchString(creator.Role) {
+			return fmt.Errorf("creator role must be a MARC relator code like aut")
+		}
+	}
+	for _, identifier := range b.Identifiers {
+		if identifier.Value == "" {
+			return fmt.Errorf("identifier value must not be empty")
+		}
+	}
+	if len(b.Publisher) > 255 {
+		return fmt.Errorf("publisher must be at most 255 characters")
+	}
+	if b.PageCount < 0 {
+		return fmt.Errorf("page_count must not be negative")
+	}
+	if b.SeriesPosition < 0 || b.SeriesPosition > 100000 {
+		return fmt.Errorf("series_position must be between 0 and 100000")
+	}
+	if b.SeriesPosition != 0 && b.SeriesID == "" {
+		return fmt.Errorf("series_position requires series_id")
+	}
+	if !b.Status.IsValid() {
+		return fmt.Errorf("status must be one of draft, published or archived")
+	}
+	return nil
+}
+
+// BookService represents a service for managing books.
+type BookService interface {
+	// Retrieves a non-deleted book by ID.
+	FindBookByID(ctx context.Context, id string) (*Book, error)
+
+	// Retrieves a list of books by filter. Also returns total count of
+	// matching books which may differ from returned results if filter.Limit
+	// is specified.
+	FindBooks(ctx context.Context, filter BookFilter) ([]*Book, int, error)
+
+	// Creates a new book.
+	CreateBook(ctx context.Context, book *Book) error
+
+	// Updates a book. If upd.Version is set, the update is only applied when
+	// it matches the current version, otherwise ErrConflict is returned.
+	UpdateBook(ctx context.Context, id string, upd BookUpdate) (*Book, error)
+
+	// Soft deletes a book. If version is set, the book is only deleted when
+	// it matches the current version, otherwise ErrConflict is returned.
+	DeleteBook(ctx context.Context, id string, version int) error
+
+	// Points a book at new cover thumbnails, or at none if coverKey is empty.
+	SetBookCover(ctx context.Context, id, coverKey string) (*Book, error)
+
+	// Retrieves the latest validation report of a book. Returns ErrNotFound
+	// if the book was never validated.
+	FindValidationReport(ctx context.Context, bookID string) (*ValidationReport, error)
+
+	// Stores a validation report, replacing the previous one of the book
+	// and of its active revision.
+	SaveValidationReport(ctx context.Context, report *ValidationReport) error
+}
+
+// MaxBookPageSize caps BookFilter.Limit.
+const MaxBookPageSize = 100
+
+// BookFilter represents a filter passed to FindBooks().
+type BookFilter struct {
+	// Filtering fields. Title matches case-insensitive substrings of the
+	// title and subtitle, Publisher of the publisher. ISBN matches an
+	// ISBN-13 or its ISBN-10 form exactly.
+	Title     string       `json:"title"`
+	Language  string       `json:"language"`
+	Publisher string       `json:"publisher"`
+	ISBN      string       `json:"isbn"`
+	Statuses  []BookStatus `json:"statuses"`
+
+	// AuthorID lists the books of an author, in any role unless Role is
+	// set. PublisherID lists the books of a publisher. SeriesID lists the
+	// volumes of a series, ordered by series position. CategoryID lists the
+	// books of a category or its subcategories.
+	AuthorID    string          `json:"author_id"`
+	Role        ContributorRole `json:"role"`
+	PublisherID string          `json:"publisher_id"`
+	SeriesID    string          `json:"series_id"`
+	CategoryID  string          `json:"category_id"`
+
+	// Unlinked restricts to books not yet linked to authors and publishers.
+	Unlinked bool `json:"unlinked"`
+
+	// Restrict to subset of results.
+	Offset int `json:"offset"`
+	Limit  int `json:"limit"`
+}
+
+// BookUpdate represents a set of fields to be updated via UpdateBook().
+type BookUpdate struct {
+	Title           string     `json:"title"`
+	Subtitle        string     `json:"subtitle"`
+	Language        string     `json:"language"`
+	Description     string     `json:"description"`
+	ISBNs           []string   `json:"isbns"`
+	PublicationDate time.Time  `json:"publication_date"`
+	Publisher       string     `json:"publisher"`
+	PageCount       int        `json:"page_count"`
+	Status          BookStatus `json:"status"`
+
+	Creators    []BookCreator    `json:"creators"`
+	Identifiers []BookIdentifier `json:"identifiers"`
+	Subjects    []string         `json:"subjects"`
+	Rights      string           `json:"rights"`
+
+	SeriesID       string  `json:"series_id"`
+	SeriesPosition float64 `json:"series_position"`
+
+	AllowScripts bool `json:"allow_scripts"`
+
+	// Expected current version of the book, zero skips the check.
+	Version int `json:"-"`
+}
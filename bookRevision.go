@@ -0,0 +1,271 @@
+package epublib
+
+import (
+	"context"
+	"reflect"
+	"time"
+)
+
+// BookRevision is a version of the EPUB file of a book. A book holds every
+// file uploaded for it, or derived from it, and reads the active one.
+type BookRevision struct {
+	ID     string `json:"id"`
+	BookID string `json:"book_id"`
+
+	// Number counts the revisions of a book from 1.
+	Number int `json:"number"`
+
+	// Active is set on the revision the book currently reads.
+	Active bool `json:"active"`
+
+	// Blob key, size and SHA-256 checksum, in hex, of the file. The
+	// checksum is empty until computed for files stored before revisions
+	// were tracked.
+	FileKey  string `json:"-"`
+	FileSize int64  `json:"file_size"`
+	Checksum string `json:"checksum"`
+
+	// User who uploaded the file, empty if unknown.
+	UploaderID string `json:"uploader_id"`
+
+	// Note describing the changes of the revision.
+	Note string `json:"note"`
+
+	// Snapshot of the package document, nil until computed for files stored
+	// before revisions were tracked.
+	Snapshot *RevisionSnapshot `json:"snapshot"`
+
+	// Latest validation report of the file, nil if it was never validated.
+	Validation *ValidationReport `json:"validation"`
+
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// RevisionSnapshot holds the metadata and the reading order of the package
+// document of a revision, to tell revisions apart without opening their
+// files.
+type RevisionSnapshot struct {
+	// Version of the package document, like "2.0" or "3.0".
+	Version string `json:"version"`
+
+	Metadata RevisionMetadata    `json:"metadata"`
+	Spine    []RevisionSpineItem `json:"spine"`
+}
+
+// RevisionMetadata is the metadata of a package document, mapped like the
+// metadata of uploaded books.
+type RevisionMetadata struct {
+	Title           string           `json:"title"`
+	Subtitle        string           `json:"subtitle"`
+	Language        string           `json:"language"`
+	Description     string           `json:"description"`
+	ISBNs           []string         `json:"isbns"`
+	Identifiers     []BookIdentifier `json:"identifiers"`
+	PublicationDate time.Time        `json:"publication_date"`
+	Publisher       string           `json:"publisher"`
+	Creators        []BookCreator    `json:"creators"`
+	Subjects        []string         `json:"subjects"`
+	Rights          string           `json:"rights"`
+	Series          string           `json:"series"`
+	SeriesPosition  float64          `json:"series_position"`
+
+	// Modified is the dcterms:modified value of EPUB 3 publications.
+	Modified string `json:"modified"`
+}
+
+// RevisionSpineItem is an entry of the reading order of a revision.
+type RevisionSpineItem struct {
+	ID        string `json:"id"`
+	Path      string `json:"path"`
+	MediaType string `json:"media_type"`
+	Linear    bool   `json:"linear"`
+
+	// CRC-32 of the content document, in hex, as recorded by the container.
+	Checksum string `json:"checksum"`
+}
+
+// BookRevisionService represents a service for managing the file revisions
+// of books.
+type BookRevisionService interface {
+	// Retrieves a revision of a book by number.
+	FindBookRevision(ctx context.Context, bookID string, number int) (*BookRevision, error)
+
+	// Retrieves a list of revisions by filter, newest first. Also returns
+	// total count of matching revisions which may differ from returned
+	// results if filter.Limit is specified.
+	FindBookRevisions(ctx context.Context, filter BookRevisionFilter) ([]*BookRevision, int, error)
+
+	// Creates a revision numbered after the latest one of its book and
+	// makes it active, pointing the book at its file. The validation report
+	// is stored along by BookService.SaveValidationReport.
+	CreateBookRevision(ctx context.Context, revision *BookRevision) error
+
+	// Makes a revision active, pointing the book at its file and restoring
+	// its validation report. If version is set, the book is only updated
+	// when it matches the current version, otherwise ErrConflict is
+	// returned.
+	ActivateBookRevision(ctx context.Context, bookID string, number int, version int) (*Book, error)
+
+	// Stores the checksum and snapshot computed for a revision.
+	SetBookRevisionContent(ctx context.Context, id, checksum string, snapshot *RevisionSnapshot) error
+}
+
+// MaxBookRevisionPageSize caps BookRevisionFilter.Limit.
+const MaxBookRevisionPageSize = 100
+
+// BookRevisionFilter represents a filter passed to FindBookRevisions().
+type BookRevisionFilter struct {
+	// Filtering fields.
+	BookID string `json:"book_id"`
+
+	// Active restricts to the revision the book reads.
+	Active bool `json:"active"`
+
+	// Uncomputed restricts to revisions whose checksum and snapshot were
+	// not computed yet.
+	Uncomputed bool `json:"uncomputed"`
+
+	// Restrict to subset of results.
+	Offset int `json:"offset"`
+	Limit  int `json:"limit"`
+}
+
+// MetadataChange is a metadata field that differs between two revisions,
+// named like its JSON field.
+type MetadataChange struct {
+	Field string      `json:"field"`
+	From  interface{} `json:"from"`
+	To    interface{} `json:"to"`
+}
+
+type SpineChangeType string
+
+const (
+	SpineItemAdded   SpineChangeType = "added"
+	SpineItemRemoved SpineChangeType = "removed"
+
+	// SpineItemModified is a content document found in both revisions
+	// whose content, media type or linearity changed.
+	SpineItemModified SpineChangeType = "modified"
+)
+
+// SpineChange is an entry of the reading order that differs between two
+// revisions. Indexes are positions in the reading order of each revision,
+// -1 for the revision the entry is not part of.
+type SpineChange struct {
+	Change    SpineChangeType `json:"change"`
+	Path      string          `json:"path"`
+	FromIndex int             `json:"from_index"`
+	ToIndex   int             `json:"to_index"`
+}
+
+// RevisionDiff lists the differences between two revisions of a book.
+type RevisionDiff struct {
+	From int `json:"from"`
+	To   int `json:"to"`
+
+	// FileChanged is unset when both files have the same checksum.
+	FileChanged bool `json:"file_changed"`
+
+	Metadata []MetadataChange `json:"metadata"`
+
+	// Spine changes in reading order, removals at their former position.
+	Spine []SpineChange `json:"spine"`
+}
+
+// DiffRevisions compares the snapshots of two revisions, which must both
+// have been computed.
+func DiffRevisions(from, to *BookRevision) *RevisionDiff {
+	diff := &RevisionDiff{
+		From:        from.Number,
+		To:          to.Number,
+		FileChanged: from.Checksum != to.Checksum,
+		Metadata:    []MetadataChange{},
+		Spine:       []SpineChange{},
+	}
+	a, b := &from.Snapshot.Metadata, &to.Snapshot.Metadata
+	fields := []struct {
+		name     string
+		from, to interface{}
+	}{
+		{"title", a.Title, b.Title},
+		{"subtitle", a.Subtitle, b.Subtitle},
+		{"language", a.Language, b.Language},
+		{"description", a.Description, b.Description},
+		{"isbns", a.ISBNs, b.ISBNs},
+		{"identifiers", a.Identifiers, b.Identifiers},
+		{"publication_date", a.PublicationDate, b.PublicationDate},
+		{"publisher", a.Publisher, b.Publisher},
+		{"creators", a.Creators, b.Creators},
+		{"subjects", a.Subjects, b.Subjects},
+		{"rights", a.Rights, b.Rights},
+		{"series", a.Series, b.Series},
+		{"series_position", a.SeriesPosition, b.SeriesPosition},
+		{"modified", a.Modified, b.Modified},
+	}
+	for _, field := range fields {
+		if !sameValue(field.from, field.to) {
+			diff.Metadata = append(diff.Metadata, MetadataChange{Field: field.name, From: field.from, To: field.to})
+		}
+	}
+	diff.Spine = diffSpines(from.Snapshot.Spine, to.Snapshot.Spine)
+	return diff
+}
+
+// sameValue compares field values, empty slices being equal whether nil or
+// not.
+func sameValue(a, b interface{}) bool {
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	if va.Kind() == reflect.Slice && vb.Kind() == reflect.Slice && va.Len() == 0 && vb.Len() == 0 {
+		return true
+	}
+	if t, ok := a.(time.Time); ok {
+		return t.Equal(b.(time.Time))
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// diffSpines matches the items of two reading orders by path along their
+// longest common subsequence. Unmatched items were removed or added, and
+// matched ones that differ were modified.
+func diffSpines(from, to []RevisionSpineItem) []SpineChange {
+	// lcs[i][j] is the length of the longest common subsequence of from[i:]
+	// and to[j:]
+	lcs := make([][]int, len(from)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(to)+1)
+	}
+	for i := len(from) - 1; i >= 0; i-- {
+		for j := len(to) - 1; j >= 0; j-- {
+			switch {
+			case from[i].Path == to[j].Path:
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				lcs[i][j] = lcs[i+1][j]
+			default:
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	changes := []SpineChange{}
+	i, j := 0, 0
+	for i < len(from) || j < len(to) {
+		switch {
+		case i < len(from) && j < len(to) && from[i].Path == to[j].Path:
+			a, b := from[i], to[j]
+			if a.Checksum != b.Checksum || a.MediaType != b.MediaType || a.Linear != b.Linear {
+				changes = append(changes, SpineChange{Change: SpineItemModified, Path: b.Path, FromIndex: i, ToIndex: j})
+			}
+			i++
+			j++
+		case j == len(to) || (i < len(from) && lcs[i+1][j] >= lcs[i][j+1]):
+			changes = append(changes, SpineChange{Change: SpineItemRemoved, Path: from[i].Path, FromIndex: i, ToIndex: -1})
+			i++
+		default:
+			changes = append(changes, SpineChange{Change: SpineItemAdded, Path: to[j].Path, FromIndex: -1, ToIndex: j})
+			j++
+		}
+	}
+	return changes
+}
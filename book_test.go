@@ -0,0 +1,88 @@
+package epublib
+
+import "testing"
+
+func TestNormalizeISBN(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"978-0-306-40615-7", "9780306406157"},
+		{" 0 306 40615 2 ", "0306406152"},
+		{"ISBN 978-0-306-40615-7", "9780306406157"},
+		{"ISBN-13: 978-0-306-40615-7", "9780306406157"},
+		{"ISBN-10:080442957x", "080442957X"},
+		{"isbn:0306406152", "0306406152"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := NormalizeISBN(tt.in); got != tt.want {
+			t.Errorf("NormalizeISBN(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestIsISBN(t *testing.T) {
+	tests := []struct {
+		isbn string
+		want bool
+	}{
+		{"9780306406157", true},
+		{"0306406152", true},
+		{"080442957X", true},
+		{"9791032300824", true},
+		{"9780306406158", false}, // wrong check digit
+		{"0306406153", false},    // wrong check digit
+		{"9770306406155", false}, // not a 978 or 979 prefix
+		{"030640615X", false},
+		{"97803064061", false},
+		{"978-0306406157", false}, // not normalized
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := IsISBN(tt.isbn); got != tt.want {
+			t.Errorf("IsISBN(%q) = %v, want %v", tt.isbn, got, tt.want)
+		}
+	}
+}
+
+func TestISBN13(t *testing.T) {
+	tests := []struct {
+		isbn, want string
+	}{
+		{"0306406152", "9780306406157"},
+		{"080442957X", "9780804429573"},
+		{"9780306406157", "9780306406157"},
+		{"0306406153", "0306406153"}, // invalid ISBNs are left unchanged
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := ISBN13(tt.isbn); got != tt.want {
+			t.Errorf("ISBN13(%q) = %q, want %q", tt.isbn, got, tt.want)
+		}
+	}
+}
+
+func TestISBN10(t *testing.T) {
+	tests := []struct {
+		isbn, want string
+	}{
+		{"9780306406157", "0306406152"},
+		{"9780804429573", "080442957X"},
+		{"0306406152", "0306406152"},
+		{"9791032300824", "9791032300824"}, // 979 ISBNs have no ISBN-10
+		{"9780306406158", "9780306406158"}, // invalid ISBNs are left unchanged
+	}
+	for _, tt := range tests {
+		if got := ISBN10(tt.isbn); got != tt.want {
+			t.Errorf("ISBN10(%q) = %q, want %q", tt.isbn, got, tt.want)
+		}
+	}
+}
+
+func TestISBNRoundTrip(t *testing.T) {
+	for _, isbn := range []string{"0306406152", "080442957X", "0000000000"} {
+		if got := ISBN10(ISBN13(isbn)); got != isbn {
+			t.Errorf("ISBN10(ISBN13(%q)) = %q", isbn, got)
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package epublib
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+type ClassificationScheme string
+
+const (
+	// BISACScheme codes look like FIC009000.
+	BISACScheme ClassificationScheme = "bisac"
+	// ThemaScheme codes look like FMB or 1DDU-GB-E.
+	ThemaScheme ClassificationScheme = "thema"
+	// DDCScheme codes are Dewey Decimal classes, like 823 or 823.914.
+	DDCScheme ClassificationScheme = "ddc"
+)
+
+// IsValid checks if a ClassificationScheme is valid
+func (s ClassificationScheme) IsValid() bool {
+	switch s {
+	case BISACScheme, ThemaScheme, DDCScheme:
+		return true
+	default:
+		return false
+	}
+}
+
+// classificationCodePatterns matches the codes of each scheme, uppercased.
+var classificationCodePatterns = map[ClassificationScheme]*regexp.Regexp{
+	BISACScheme: regexp.MustCompile(`^[A-Z]{3}[0-9]{6}$`),
+	ThemaScheme: regexp.MustCompile(`^[0-9A-Z][0-9A-Z-]{0,19}$`),
+	DDCScheme:   regexp.MustCompile(`^[0-9]{3}(\.[0-9]+)?$`),
+}
+
+// Category is a node of the subject classification books are browsed by.
+// Categories may be nested below a parent category.
+type Category struct {
+	ID          string `json:"id"`
+	ParentID    string `json:"parent_id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+
+	// Codes of the category in standard classification schemes, used to
+	// suggest it for books whose subjects carry them.
+	Codes []CategoryCode `json:"codes"`
+
+	// Number of books in the category or its subcategories. Only set by
+	// FindCategories.
+	BookCount int `json:"book_count"`
+
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	DeletedAt time.Time `json:"deleted_at"`
+
+	// Set when browsing the category tree.
+	Children []*Category `json:"children,omitempty"`
+}
+
+// CategoryCode is the code of a category in a classification scheme.
+type CategoryCode struct {
+	Scheme ClassificationScheme `json:"scheme"`
+	Code   string               `json:"code"`
+}
+
+// Validate checks the fields of a category that clients may set. Codes are
+// expected to be uppercased.
+func (c *Category) Validate() error {
+	if c.Name == "" || len(c.Name) > 255 {
+		return fmt.Errorf("name must be between 1 and 255 characters")
+	}
+	if CategoryNameKey(c.Name) == "" {
+		return fmt.Errorf("name must contain letters or digits")
+	}
+	if len(c.Description) > 10000 {
+		return fmt.Errorf("description must be at most 10000 characters")
+	}
+	for _, code := range c.Codes {
+		if !code.Scheme.IsValid() {
+			return fmt.Errorf("code scheme must be one of bisac, thema or ddc")
+		}
+		if !classificationCodePatterns[code.Scheme].MatchString(code.Code) {
+			return fmt.Errorf("invalid %s code %q", code.Scheme, code.Code)
+		}
+	}
+	return nil
+}
+
+// CategoryNameKey returns the key matching spellings of the same category
+// name regardless of case, spacing and punctuation. It is empty for names
+// without letters or digits.
+func CategoryNameKey(name string) string {
+	return strings.Join(nameTokens(name), " ")
+}
+
+// CategoryTree nests categories below their parents, ordered as given, and
+// returns the roots. Categories whose parent is not among them are roots.
+func CategoryTree(categories []*Category) []*Category {
+	byID := map[string]*Category{}
+	for _, category := range categories {
+		category.Children = nil
+		byID[category.ID] = category
+	}
+	roots := []*Category{}
+	for _, category := range categories {
+		if parent := byID[category.ParentID]; parent != nil {
+			parent.Children = append(parent.Children, category)
+		} else {
+			roots = append(roots, category)
+		}
+	}
+	return roots
+}
+
+// subjectPathSeparator splits subject headings into the names of nested
+// categories, like "Fiction / Fantasy / Epic" or "Fantasy fiction --
+// History and criticism".
+var subjectPathSeparator = regexp.MustCompile(`\s*(/|--|>)\s*`)
+
+// SuggestCategories returns the categories subjects, like dc:subject values,
+// point at. A subject matches by a code in any scheme, like FIC009000, or
+// by a heading of nested names, like "Fiction / Fantasy / Epic", followed
+// down from a root category as far as the names match. Otherwise the
+// category whose name is the last part of the heading matching a single
+// category is suggested. Each category is suggested once.
+func SuggestCategories(categories []*Category, subjects []string) []*Category {
+	byCode := map[string]*Category{}
+	byName := map[string][]*Category{}
+	children := map[string][]*Category{}
+	byID := map[string]*Category{}
+	for _, category := range categories {
+		byID[category.ID] = category
+	}
+	for _, category := range categories {
+		for _, code := range category.Codes {
+			if byCode[code.Code] == nil {
+				byCode[code.Code] = category
+			}
+		}
+		key := CategoryNameKey(category.Name)
+		byName[key] = append(byName[key], category)
+		parentID := category.ParentID
+		if byID[parentID] == nil {
+			parentID = ""
+		}
+		children[parentID] = append(children[parentID], category)
+	}
+
+	suggested := []*Category{}
+	seen := map[string]bool{}
+	for _, subject := range subjects {
+		subject = strings.TrimSpace(subject)
+		match := byCode[strings.ToUpper(subject)]
+		if match == nil {
+			match = matchCategoryPath(children, subjectPathSeparator.Split(subject, -1))
+		}
+		if match == nil {
+			parts := subjectPathSeparator.Split(subject, -1)
+			if candidates := byName[CategoryNameKey(parts[len(parts)-1])]; len(candidates) == 1 {
+				match = candidates[0]
+			}
+		}
+		if match != nil && !seen[match.ID] {
+			seen[match.ID] = true
+			suggested = append(suggested, match)
+		}
+	}
+	return suggested
+}
+
+// matchCategoryPath follows names down the tree from the root categories and
+// returns the deepest category reached, or nil if the first name matches no
+// root.
+func matchCategoryPath(children map[string][]*Category, names []string) *Category {
+	var match *Category
+	parentID := ""
+	for _, name := range names {
+		key := CategoryNameKey(name)
+		var next *Category
+		for _, child := range children[parentID] {
+			if CategoryNameKey(child.Name) == key {
+				next = child
+				break
+			}
+		}
+		if next == nil {
+			break
+		}
+		match = next
+		parentID = next.ID
+	}
+	return match
+}
+
+// CategoryService represents a service for managing categories and the
+// books classified in them.
+type CategoryService interface {
+	// Retrieves a non-deleted category by ID.
+	FindCategoryByID(ctx context.Context, id string) (*Category, error)
+
+	// Retrieves every category, by name, counting in each the books of one
+	// of statuses in it or its subcategories. Books of every status are
+	// counted if statuses is empty.
+	FindCategories(ctx context.Context, statuses []BookStatus) ([]*Category, error)
+
+	// Creates a new category. Returns ErrNotFound if the parent does not
+	// exist and ErrCategoryNameTaken if a sibling has the same name.
+	CreateCategory(ctx context.Context, category *Category) error
+
+	// Updates a category. If upd.Version is set, the update is only applied
+	// when it matches the current version, otherwise ErrConflict is
+	// returned. Returns ErrCategoryCycle if the new parent is the category
+	// or one of its subcategories and ErrCategoryNameTaken if a sibling has
+	// the same name.
+	UpdateCategory(ctx context.Context, id string, upd CategoryUpdate) (*Category, error)
+
+	// Soft deletes a category and removes its books from it. Returns
+	// ErrCategoryHasSubcategories if it still has subcategories.
+	DeleteCategory(ctx context.Context, id string, version int) error
+
+	// Replaces the categories of a book. Returns ErrNotFound if one of them
+	// does not exist.
+	SetBookCategories(ctx context.Context, bookID string, categoryIDs []string) error
+}
+
+// CategoryUpdate represents a set of fields to be updated via
+// UpdateCategory().
+type CategoryUpdate struct {
+	ParentID    string         `json:"parent_id"`
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	Codes       []CategoryCode `json:"codes"`
+
+	// Expected current version of the category, zero skips the check.
+	Version int `json:"-"`
+}
@@ -1,11 +1,15 @@
 package main
 
 import (
+	"context"
 	"epublib"
+	"epublib/blob"
 	embedServer "epublib/internal/embed"
 	httpAPI "epublib/internal/http"
 	"epublib/mailer"
+	"epublib/metadata"
 	"epublib/postgres"
+	"epublib/sms"
 	"log"
 	"net/http"
 	"os"
@@ -22,10 +26,59 @@ func main() {
 	}
 	api := httpAPI.NewAPI(mux, db)
 	api.Register()
+	api.TenantService = postgres.NewTenantService(db)
 	api.AuthService = postgres.NewAuthService(db)
 	api.UserService = postgres.NewUserService(db)
 	api.ResetTokenService = postgres.NewResetTokenService(db)
+	api.ErasureService = postgres.NewErasureService(db)
+	api.SettingsService = postgres.NewSettingsService(db)
+	api.PhoneVerificationService = postgres.NewPhoneVerificationService(db)
+	api.GroupService = postgres.NewGroupService(db)
+	api.BookService = postgres.NewBookService(db)
+	api.SearchService = postgres.NewSearchService(db)
+	api.AuthorService = postgres.NewAuthorService(db)
+	api.PublisherService = postgres.NewPublisherService(db)
+	api.SeriesService = postgres.NewSeriesService(db)
+	api.CategoryService = postgres.NewCategoryService(db)
+	api.MetadataProposalService = postgres.NewMetadataProposalService(db)
+	api.BookRevisionService = postgres.NewBookRevisionService(db)
 	api.MailerService = mailer.NewMailerService()
+	// Verification codes must never end up in the logs by accident, so the
+	// log sender has to be chosen explicitly
+	switch os.Getenv("SMS_PROVIDER") {
+	case "http":
+		api.SMSService = sms.NewHTTPService(sms.HTTPConfig{
+			URL:    os.Getenv("SMS_HTTP_URL"),
+			Token:  os.Getenv("SMS_HTTP_TOKEN"),
+			Sender: os.Getenv("SMS_SENDER"),
+		})
+	case "log":
+		api.SMSService = sms.NewLogService()
+	default:
+		log.Fatal("SMS_PROVIDER must be set to http or log")
+	}
+	if os.Getenv("METADATA_PROVIDER") == "openlibrary" {
+		api.MetadataProvider = metadata.NewOpenLibraryProvider(metadata.OpenLibraryConfig{
+			URL: os.Getenv("OPENLIBRARY_URL"),
+		})
+	}
+	if os.Getenv("BLOB_STORE") == "s3" {
+		api.BlobStore = blob.NewS3Store(blob.S3Config{
+			Endpoint:  os.Getenv("S3_ENDPOINT"),
+			Region:    os.Getenv("S3_REGION"),
+			Bucket:    os.Getenv("S3_BUCKET"),
+			AccessKey: os.Getenv("S3_ACCESS_KEY"),
+			SecretKey: os.Getenv("S3_SECRET_KEY"),
+			PathStyle: os.Getenv("S3_PATH_STYLE") == "true",
+		})
+	} else {
+		blobDir := os.Getenv("BLOB_DIR")
+		if blobDir == "" {
+			blobDir = "data"
+		}
+		api.BlobStore = blob.NewFileStore(blobDir)
+	}
+	api.StartJobs(context.Background())
 	embedServer.RegisterSwaggerUI(epublib.SwaggerUI, "docs/swaggerui", mux)
 
 	if os.Getenv("TLS") == "true" {
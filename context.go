@@ -16,6 +16,8 @@ const (
 	userContextKey = contextKey(iota + 1)
 	// Stores database tx instance if any
 	txContextKey = contextKey(iota + 1)
+	// Stores the tenant the request is served for.
+	tenantContextKey = contextKey(iota + 1)
 )
 
 // NewContextWithUser returns a new context with the given user.
@@ -48,3 +50,24 @@ func TxFromContext(ctx context.Context) Conn {
 	tx, _ := ctx.Value(txContextKey).(Conn)
 	return tx
 }
+
+// NewContextWithTenant returns a new context with the given tenant. Database
+// access made with the context is restricted to the tenant's records.
+func NewContextWithTenant(ctx context.Context, tenant *Tenant) context.Context {
+	return context.WithValue(ctx, tenantContextKey, tenant)
+}
+
+// TenantFromContext returns the tenant the request is served for.
+func TenantFromContext(ctx context.Context) *Tenant {
+	tenant, _ := ctx.Value(tenantContextKey).(*Tenant)
+	return tenant
+}
+
+// TenantIDFromContext is a helper function that returns the ID of the current
+// tenant. Returns empty if no tenant is set.
+func TenantIDFromContext(ctx context.Context) string {
+	if tenant := TenantFromContext(ctx); tenant != nil {
+		return tenant.ID
+	}
+	return ""
+}
@@ -0,0 +1,34 @@
+package epublib
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+)
+
+// ErrInvalidCursor is returned when a pagination cursor cannot be decoded.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// cursor is the decoded form of an opaque pagination cursor. Key binds the
+// cursor to the ordering it was created for.
+type cursor struct {
+	Key    string   `json:"k"`
+	Values []string `json:"v"`
+}
+
+func encodeCursor(key string, values []string) string {
+	b, _ := json.Marshal(cursor{Key: key, Values: values})
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(s, key string) ([]string, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c cursor
+	if err := json.Unmarshal(b, &c); err != nil || c.Key != key {
+		return nil, ErrInvalidCursor
+	}
+	return c.Values, nil
+}
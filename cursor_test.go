@@ -0,0 +1,66 @@
+package epublib
+
+import (
+	"encoding/base64"
+	"testing"
+	"time"
+)
+
+func TestUserCursorRoundTrip(t *testing.T) {
+	user := &User{
+		ID:        "3f2b8c1e-5d4a-4e6b-9c7d-1a2b3c4d5e6f",
+		Name:      "Siti Rahma",
+		BirthDate: time.Date(1990, 4, 21, 0, 0, 0, 0, time.UTC),
+		CreatedAt: time.Date(2024, 1, 2, 3, 4, 5, 678901000, time.UTC),
+		UpdatedAt: time.Date(2024, 6, 7, 8, 9, 10, 0, time.FixedZone("WIB", 7*3600)),
+	}
+	sorts := []UserSort{
+		{Field: UserSortName},
+		{Field: UserSortBirthDate, Desc: true},
+		{Field: UserSortCreatedAt},
+		{Field: UserSortUpdatedAt, Desc: true},
+	}
+	values, err := ParseUserCursor(NewUserCursor(user, sorts), sorts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"Siti Rahma", "1990-04-21", "2024-01-02T03:04:05.678901Z", "2024-06-07T08:09:10+07:00", user.ID}
+	if len(values) != len(want) {
+		t.Fatalf("got %d values, want %d", len(values), len(want))
+	}
+	for i := range want {
+		if values[i] != want[i] {
+			t.Errorf("value %d = %q, want %q", i, values[i], want[i])
+		}
+	}
+
+	// Without sort terms the cursor only holds the ID
+	values, err = ParseUserCursor(NewUserCursor(user, nil), nil)
+	if err != nil || len(values) != 1 || values[0] != user.ID {
+		t.Errorf("got %v, %v, want [%s]", values, err, user.ID)
+	}
+}
+
+func TestParseUserCursorInvalid(t *testing.T) {
+	id := "3f2b8c1e-5d4a-4e6b-9c7d-1a2b3c4d5e6f"
+	byCreated := []UserSort{{Field: UserSortCreatedAt}}
+	byBirth := []UserSort{{Field: UserSortBirthDate}}
+	tests := []struct {
+		name   string
+		cursor string
+		sorts  []UserSort
+	}{
+		{"not base64", "%%%", nil},
+		{"not JSON", base64.RawURLEncoding.EncodeToString([]byte("nope")), nil},
+		{"other ordering", encodeCursor("name", []string{"a", id}), byCreated},
+		{"missing values", encodeCursor("created_at", []string{id}), byCreated},
+		{"malformed ID", encodeCursor("", []string{"1 OR 1=1"}), nil},
+		{"malformed timestamp", encodeCursor("created_at", []string{"yesterday", id}), byCreated},
+		{"malformed date", encodeCursor("birth_date", []string{"21/04/1990", id}), byBirth},
+	}
+	for _, tt := range tests {
+		if _, err := ParseUserCursor(tt.cursor, tt.sorts); err != ErrInvalidCursor {
+			t.Errorf("%s: got %v, want ErrInvalidCursor", tt.name, err)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package epub
+
+import (
+	"strings"
+)
+
+// Cover sources reported by CoverItem.
+const (
+	CoverFromProperty = "cover-image"
+	CoverFromMeta     = "meta"
+	CoverFromSpine    = "spine"
+)
+
+// coverSpineDocuments bounds how many spine documents are searched for an
+// image when the package declares no cover.
+const coverSpineDocuments = 3
+
+// CoverItem returns the manifest item of the cover image along with how it
+// was found, or nil when there is none. The EPUB 3 cover-image property
+// wins over the EPUB 2 cover meta, and lacking both the first image of the
+// first spine documents is used.
+func (r *Reader) CoverItem() (*Item, string) {
+	if item := r.Package.ItemWithProperty("cover-image"); isImage(item) {
+		return item, CoverFromProperty
+	}
+	for _, meta := range r.Package.Metadata.Metas {
+		if meta.Name != "cover" || meta.Content == "" {
+			continue
+		}
+		// Some tools put the href rather than the ID in the meta
+		item := r.Package.Item(meta.Content)
+		if item == nil {
+			if p, ok := ResolveHref(r.PackagePath, meta.Content); ok {
+				item = r.Package.ItemByPath(p)
+			}
+		}
+		if isImage(item) {
+			return item, CoverFromMeta
+		}
+	}
+	searched := 0
+	for _, ref := range r.Package.Spine.ItemRefs {
+		item := r.Package.Item(ref.IDRef)
+		if item == nil {
+			continue
+		}
+		if isImage(item) {
+			return item, CoverFromSpine
+		}
+		if item.MediaType != xhtmlMediaType && item.MediaType != svgMediaType {
+			continue
+		}
+		if searched == coverSpineDocuments {
+			break
+		}
+		searched++
+		if image := r.firstImage(item); image != nil {
+			return image, CoverFromSpine
+		}
+	}
+	return nil, ""
+}
+
+// firstImage returns the manifest item of the first image referenced by
+// an img element or an SVG image element of a content document, or nil.
+func (r *Reader) firstImage(doc *Item) *Item {
+	root, err := r.readTree(doc)
+	if err != nil {
+		return nil
+	}
+	for _, element := range root.find(func(n *node) bool { return n.Name.Local == "img" || n.Name.Local == "image" }) {
+		href := element.attr("", "src")
+		if element.Name.Local == "image" {
+			href = element.attr("http://www.w3.org/1999/xlink", "href")
+			if href == "" {
+				href = element.attr("", "href")
+			}
+		}
+		if href == "" || isRemote(href) {
+			continue
+		}
+		p, ok := ResolveHref(doc.Path, href)
+		if !ok {
+			continue
+		}
+		if item := r.Package.ItemByPath(p); isImage(item) {
+			return item
+		}
+	}
+	return nil
+}
+
+func isImage(item *Item) bool {
+	return item != nil && strings.HasPrefix(item.MediaType, "image/")
+}
@@ -0,0 +1,217 @@
+// Package epub reads EPUB 2 and EPUB 3 publications: the OCF zip container,
+// its container.xml and the OPF package document it points at.
+package epub
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"strings"
+	"sync/atomic"
+)
+
+// MimeType is the content of the mimetype file of every EPUB container.
+const MimeType = "application/epub+zip"
+
+// PackageMediaType is the media type of OPF package documents.
+const PackageMediaType = "application/oebps-package+xml"
+
+// ContainerPath is the location of the container file listing the package
+// documents of a publication.
+const ContainerPath = "META-INF/container.xml"
+
+// ErrInvalidEPUB is wrapped by every error caused by a malformed
+// publication rather than by reading it.
+var ErrInvalidEPUB = errors.New("invalid EPUB")
+
+// ErrFileNotFound is returned when a path does not exist in the container.
+var ErrFileNotFound = errors.New("file not found in EPUB container")
+
+// Limits on inflating container entries into memory, which keep archives
+// whose entries expand far beyond the size of the file from exhausting it.
+const (
+	// MaxEntrySize caps the uncompressed size of a single entry.
+	MaxEntrySize = 64 << 20
+
+	// MaxInflatedSize caps the bytes inflated by one Reader or validation.
+	MaxInflatedSize = 512 << 20
+)
+
+func invalidf(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrInvalidEPUB, fmt.Sprintf(format, args...))
+}
+
+// Reader gives access to the files and the package document of an EPUB.
+type Reader struct {
+	// Zip is the underlying OCF container.
+	Zip *zip.Reader
+
+	// PackagePath is the container path of the package document.
+	PackagePath string
+
+	// Package is the parsed package document.
+	Package *Package
+
+	files map[string]*zip.File
+	ra    io.ReaderAt
+
+	// inflateBudget is the number of bytes ReadFile may still inflate.
+	inflateBudget atomic.Int64
+}
+
+// NewReader opens the EPUB of the given size read from r. The mimetype file
+// must be present with the EPUB media type; whether it is also the first,
+// uncompressed entry is left to validation since many readers accept
+// publications that get it wrong.
+func NewReader(r io.ReaderAt, size int64) (*Reader, error) {
+	z, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, invalidf("not a zip archive: %v", err)
+	}
+	er := &Reader{Zip: z, files: make(map[string]*zip.File, len(z.File)), ra: r}
+	er.inflateBudget.Store(MaxInflatedSize)
+	for _, f := range z.File {
+		er.files[f.Name] = f
+	}
+
+	// Check the mimetype
+	mimetype, err := er.ReadFile("mimetype")
+	if err != nil {
+		if errors.Is(err, ErrFileNotFound) {
+			return nil, invalidf("mimetype file is missing")
+		}
+		return nil, err
+	}
+	if strings.TrimSpace(string(mimetype)) != MimeType {
+		return nil, invalidf("mimetype must be %s", MimeType)
+	}
+
+	// Find and parse the package document
+	er.PackagePath, err = er.findPackagePath()
+	if err != nil {
+		return nil, err
+	}
+	opf, err := er.ReadFile(er.PackagePath)
+	if err != nil {
+		if errors.Is(err, ErrFileNotFound) {
+			return nil, invalidf("package document %s is missing", er.PackagePath)
+		}
+		return nil, err
+	}
+	er.Package, err = ParsePackage(opf, er.PackagePath)
+	if err != nil {
+		return nil, err
+	}
+	return er, nil
+}
+
+type xmlContainer struct {
+	Rootfiles []struct {
+		FullPath  string `xml:"full-path,attr"`
+		MediaType string `xml:"media-type,attr"`
+	} `xml:"rootfiles>rootfile"`
+}
+
+// findPackagePath returns the path of the first package document listed in
+// container.xml.
+func (r *Reader) findPackagePath() (string, error) {
+	data, err := r.ReadFile(ContainerPath)
+	if err != nil {
+		if errors.Is(err, ErrFileNotFound) {
+			return "", invalidf("%s is missing", ContainerPath)
+		}
+		return "", err
+	}
+	var container xmlContainer
+	if err := xml.Unmarshal(data, &container); err != nil {
+		return "", invalidf("%s: %v", ContainerPath, err)
+	}
+	for _, rootfile := range container.Rootfiles {
+		if rootfile.MediaType == PackageMediaType && rootfile.FullPath != "" {
+			return rootfile.FullPath, nil
+		}
+	}
+	return "", invalidf("%s lists no package document", ContainerPath)
+}
+
+// ReaderAt returns the reader the container is read from, for direct
+// access to the data of stored entries.
+func (r *Reader) ReaderAt() io.ReaderAt {
+	return r.ra
+}
+
+// File returns the zip entry stored under name, or nil.
+func (r *Reader) File(name string) *zip.File {
+	return r.files[name]
+}
+
+// Open opens the file stored under name in the container.
+func (r *Reader) Open(name string) (io.ReadCloser, error) {
+	f := r.files[name]
+	if f == nil {
+		return nil, fmt.Errorf("%w: %s", ErrFileNotFound, name)
+	}
+	return f.Open()
+}
+
+// ReadFile reads the whole file stored under name in the container. Files
+// larger than MaxEntrySize, or beyond MaxInflatedSize read by the Reader so
+// far, are refused as invalid.
+func (r *Reader) ReadFile(name string) ([]byte, error) {
+	f := r.files[name]
+	if f == nil {
+		return nil, fmt.Errorf("%w: %s", ErrFileNotFound, name)
+	}
+	return readEntry(f, &r.inflateBudget)
+}
+
+// readEntry inflates a container entry, taking its size from budget. The
+// declared size is checked before inflating and enforced while reading.
+func readEntry(f *zip.File, budget *atomic.Int64) ([]byte, error) {
+	if f.UncompressedSize64 > MaxEntrySize {
+		return nil, invalidf("%s exceeds %d bytes uncompressed", f.Name, MaxEntrySize)
+	}
+	size := int64(f.UncompressedSize64)
+	if budget.Add(-size) < 0 {
+		return nil, invalidf("container inflates to more than %d bytes", MaxInflatedSize)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(io.LimitReader(rc, size+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > size {
+		return nil, invalidf("%s is larger than its declared size", f.Name)
+	}
+	return data, nil
+}
+
+// ResolveHref resolves an href found in the document at base to a
+// container path. Fragments and queries are dropped. It returns false for
+// absolute URLs and for paths leaving the container.
+func ResolveHref(base, href string) (string, bool) {
+	u, err := url.Parse(href)
+	if err != nil || u.Scheme != "" || u.Host != "" {
+		return "", false
+	}
+	if u.Path == "" {
+		return base, true
+	}
+	p := u.Path
+	if !strings.HasPrefix(p, "/") {
+		p = path.Join(path.Dir(base), p)
+	}
+	p = path.Clean(strings.TrimPrefix(p, "/"))
+	if p == "." || p == ".." || strings.HasPrefix(p, "../") {
+		return "", false
+	}
+	return p, true
+}
@@ -0,0 +1,189 @@
+package epub
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// NCXMediaType is the media type of EPUB 2 NCX documents.
+const NCXMediaType = "application/x-dtbncx+xml"
+
+// Navigation holds the navigation structures of a publication.
+type Navigation struct {
+	// Source is "nav" if read from the EPUB 3 navigation document and
+	// "ncx" if read from the EPUB 2 NCX.
+	Source string `json:"source"`
+
+	TOC       []NavPoint `json:"toc"`
+	PageList  []NavPoint `json:"page_list"`
+	Landmarks []NavPoint `json:"landmarks"`
+}
+
+// NavPoint is an entry of a navigation structure.
+type NavPoint struct {
+	Label string `json:"label"`
+
+	// Path is the container path of the target document and Fragment the
+	// ID of the target element in it, if any. Both are empty for headings
+	// without a target.
+	Path     string `json:"path"`
+	Fragment string `json:"fragment,omitempty"`
+
+	// Type is the epub:type of the link, which landmarks are identified
+	// by, or the guide type in EPUB 2.
+	Type string `json:"type,omitempty"`
+
+	Children []NavPoint `json:"children,omitempty"`
+}
+
+// Navigation reads the navigation document of an EPUB 3 publication, or
+// else its NCX. Landmarks fall back to the EPUB 2 guide.
+func (r *Reader) Navigation() (*Navigation, error) {
+	var nav *Navigation
+	var err error
+	if item := r.Package.ItemWithProperty("nav"); item != nil {
+		nav, err = r.readNavDocument(item)
+	}
+	if nav == nil {
+		item := r.Package.Item(r.Package.Spine.Toc)
+		if item == nil {
+			for i := range r.Package.Manifest {
+				if r.Package.Manifest[i].MediaType == NCXMediaType {
+					item = &r.Package.Manifest[i]
+					break
+				}
+			}
+		}
+		if item != nil {
+			nav, err = r.readNCX(item)
+		}
+	}
+	if nav == nil {
+		if err == nil {
+			err = invalidf("publication has neither a navigation document nor an NCX")
+		}
+		return nil, err
+	}
+	if len(nav.Landmarks) == 0 {
+		for _, ref := range r.Package.Guide {
+			point := NavPoint{Label: ref.Title, Type: ref.Type}
+			point.Path, point.Fragment = resolveTarget(r.PackagePath, ref.Href)
+			nav.Landmarks = append(nav.Landmarks, point)
+		}
+	}
+	return nav, nil
+}
+
+func (r *Reader) readNavDocument(item *Item) (*Navigation, error) {
+	root, err := r.readTree(item)
+	if err != nil {
+		return nil, err
+	}
+	nav := &Navigation{Source: "nav"}
+	for _, n := range root.find(func(n *node) bool { return n.Name.Local == "nav" }) {
+		list := n.first("ol")
+		if list == nil {
+			continue
+		}
+		points := parseNavList(list, item.Path)
+		for _, typ := range strings.Fields(n.attr(OPSNamespace, "type")) {
+			switch typ {
+			case "toc":
+				nav.TOC = points
+			case "page-list":
+				nav.PageList = points
+			case "landmarks":
+				nav.Landmarks = points
+			}
+		}
+	}
+	return nav, nil
+}
+
+// parseNavList parses the li elements of an ol of a navigation document.
+func parseNavList(list *node, base string) []NavPoint {
+	var points []NavPoint
+	for _, li := range list.children("li") {
+		point := NavPoint{}
+		for _, child := range li.Children {
+			switch child.Name.Local {
+			case "a":
+				point.Label = child.text()
+				point.Path, point.Fragment = resolveTarget(base, child.attr("", "href"))
+				point.Type = child.attr(OPSNamespace, "type")
+			case "span":
+				point.Label = child.text()
+			case "ol":
+				point.Children = parseNavList(child, base)
+			}
+		}
+		points = append(points, point)
+	}
+	return points
+}
+
+func (r *Reader) readNCX(item *Item) (*Navigation, error) {
+	root, err := r.readTree(item)
+	if err != nil {
+		return nil, err
+	}
+	nav := &Navigation{Source: "ncx"}
+	if navMap := root.first("navMap"); navMap != nil {
+		nav.TOC = parseNavPoints(navMap.children("navPoint"), item.Path)
+	}
+	if pageList := root.first("pageList"); pageList != nil {
+		nav.PageList = parseNavPoints(pageList.children("pageTarget"), item.Path)
+	}
+	return nav, nil
+}
+
+// parseNavPoints parses NCX navPoint or pageTarget elements.
+func parseNavPoints(elements []*node, base string) []NavPoint {
+	var points []NavPoint
+	for _, e := range elements {
+		point := NavPoint{}
+		if label := e.first("navLabel"); label != nil {
+			point.Label = label.text()
+		}
+		if content := e.first("content"); content != nil {
+			point.Path, point.Fragment = resolveTarget(base, content.attr("", "src"))
+		}
+		point.Children = parseNavPoints(e.children("navPoint"), base)
+		points = append(points, point)
+	}
+	return points
+}
+
+// readTree reads and parses the XML document of a manifest item.
+func (r *Reader) readTree(item *Item) (*node, error) {
+	data, err := r.ReadFile(item.Path)
+	if err != nil {
+		if errors.Is(err, ErrFileNotFound) {
+			return nil, invalidf("%s is declared in the manifest but missing", item.Href)
+		}
+		return nil, err
+	}
+	root, err := parseTree(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrInvalidEPUB, item.Path, err)
+	}
+	return root, nil
+}
+
+// resolveTarget splits a link found in the document at base into the
+// container path and fragment it points at.
+func resolveTarget(base, href string) (string, string) {
+	if href == "" {
+		return "", ""
+	}
+	p, ok := ResolveHref(base, href)
+	if !ok {
+		return "", ""
+	}
+	fragment := ""
+	if i := strings.IndexByte(href, '#'); i >= 0 {
+		fragment = href[i+1:]
+	}
+	return p, fragment
+}
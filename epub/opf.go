@@ -0,0 +1,595 @@
+package epub
+
+import (
+	"encoding/xml"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Package is an OPF package document.
+type Package struct {
+	// Version is "2.0" for EPUB 2 and "3.0" or later for EPUB 3.
+	Version string `json:"version"`
+
+	// UniqueIdentifier is the ID of the identifier that uniquely identifies
+	// the publication.
+	UniqueIdentifier string `json:"unique_identifier"`
+
+	Metadata Metadata `json:"metadata"`
+	Manifest []Item   `json:"manifest"`
+	Spine    Spine    `json:"spine"`
+
+	// Guide lists the EPUB 2 guide references, superseded by the landmarks
+	// of the EPUB 3 navigation document.
+	Guide []Reference `json:"guide"`
+}
+
+// Item is a resource of the publication listed in the manifest.
+type Item struct {
+	ID        string `json:"id"`
+	Href      string `json:"href"`
+	MediaType string `json:"media_type"`
+
+	// Path is the container path Href resolves to, empty if it points
+	// outside the container.
+	Path string `json:"path"`
+
+	// EPUB 3 properties like nav, cover-image or scripted.
+	Properties []string `json:"properties"`
+
+	Fallback     string `json:"fallback,omitempty"`
+	MediaOverlay string `json:"media_overlay,omitempty"`
+}
+
+// HasProperty reports whether the item has the given EPUB 3 property.
+func (item *Item) HasProperty(property string) bool {
+	for _, p := range item.Properties {
+		if p == property {
+			return true
+		}
+	}
+	return false
+}
+
+// Spine is the default reading order of the publication.
+type Spine struct {
+	// Toc is the manifest ID of the EPUB 2 NCX.
+	Toc string `json:"toc,omitempty"`
+
+	PageProgressionDirection string `json:"page_progression_direction,omitempty"`
+
+	ItemRefs []ItemRef `json:"itemrefs"`
+}
+
+// ItemRef is an entry of the spine. Non-linear items, like footnotes or
+// answers, are only reached through links.
+type ItemRef struct {
+	IDRef      string   `json:"idref"`
+	Linear     bool     `json:"linear"`
+	Properties []string `json:"properties"`
+}
+
+// Reference is an EPUB 2 guide reference, like the cover or the start of
+// the text.
+type Reference struct {
+	Type  string `json:"type"`
+	Title string `json:"title"`
+	Href  string `json:"href"`
+}
+
+// IsEPUB3 reports whether the package document uses EPUB 3 or later.
+func (p *Package) IsEPUB3() bool {
+	return p.Version != "" && p.Version[0] >= '3'
+}
+
+// Metadata holds the Dublin Core elements and meta entries of a package
+// document. EPUB 3 refinements are already applied to the elements they
+// refine.
+type Metadata struct {
+	Titles       []Title      `json:"titles"`
+	Creators     []Creator    `json:"creators"`
+	Contributors []Creator    `json:"contributors"`
+	Languages    []string     `json:"languages"`
+	Identifiers  []Identifier `json:"identifiers"`
+	Subjects     []string     `json:"subjects"`
+	Publishers   []string     `json:"publishers"`
+	Dates        []Date       `json:"dates"`
+	Description  string       `json:"description"`
+	Rights       string       `json:"rights"`
+
+	// Modified is the dcterms:modified value of EPUB 3 publications.
+	Modified string `json:"modified"`
+
+	// Collections lists the EPUB 3 belongs-to-collection entries, like the
+	// series or set the publication is part of.
+	Collections []Collection `json:"collections"`
+
+	// Metas lists every meta element, including the refinements.
+	Metas []Meta `json:"metas"`
+}
+
+// Title is a dc:title. Type is the EPUB 3 title-type, like main or
+// subtitle, and empty when not given.
+type Title struct {
+	ID    string `json:"id"`
+	Value string `json:"value"`
+	Type  string `json:"type"`
+}
+
+// Creator is a dc:creator or dc:contributor. Role is a MARC relator code
+// like aut or trl.
+type Creator struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	FileAs string `json:"file_as"`
+	Role   string `json:"role"`
+}
+
+// Identifier is a dc:identifier. Scheme is the EPUB 2 opf:scheme or the
+// EPUB 3 identifier-type, like ISBN or UUID, if given.
+type Identifier struct {
+	ID     string `json:"id"`
+	Value  string `json:"value"`
+	Scheme string `json:"scheme"`
+}
+
+// Collection is an EPUB 3 belongs-to-collection entry. Type is the
+// collection-type, like series or set, and Position the group-position,
+// like "2" or "1.5". Both are empty when not given.
+type Collection struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Position string `json:"position"`
+}
+
+// Date is a dc:date. Event is the EPUB 2 opf:event, like publication or
+// modification.
+type Date struct {
+	Value string `json:"value"`
+	Event string `json:"event"`
+}
+
+// Meta is a meta element, either an EPUB 2 name/content pair or an EPUB 3
+// property with its value.
+type Meta struct {
+	ID       string `json:"id,omitempty"`
+	Name     string `json:"name,omitempty"`
+	Content  string `json:"content,omitempty"`
+	Property string `json:"property,omitempty"`
+	Refines  string `json:"refines,omitempty"`
+	Scheme   string `json:"scheme,omitempty"`
+	Value    string `json:"value,omitempty"`
+}
+
+type xmlPackage struct {
+	Version          string      `xml:"version,attr"`
+	UniqueIdentifier string      `xml:"unique-identifier,attr"`
+	Metadata         xmlMetadata `xml:"metadata"`
+	Manifest         []struct {
+		ID           string `xml:"id,attr"`
+		Href         string `xml:"href,attr"`
+		MediaType    string `xml:"media-type,attr"`
+		Properties   string `xml:"properties,attr"`
+		Fallback     string `xml:"fallback,attr"`
+		MediaOverlay string `xml:"media-overlay,attr"`
+	} `xml:"manifest>item"`
+	Spine struct {
+		Toc                      string `xml:"toc,attr"`
+		PageProgressionDirection string `xml:"page-progression-direction,attr"`
+		ItemRefs                 []struct {
+			IDRef      string `xml:"idref,attr"`
+			Linear     string `xml:"linear,attr"`
+			Properties string `xml:"properties,attr"`
+		} `xml:"itemref"`
+	} `xml:"spine"`
+	Guide []struct {
+		Type  string `xml:"type,attr"`
+		Title string `xml:"title,attr"`
+		Href  string `xml:"href,attr"`
+	} `xml:"guide>reference"`
+}
+
+type xmlMetadata struct {
+	Titles       []xmlDCElement `xml:"http://purl.org/dc/elements/1.1/ title"`
+	Creators     []xmlDCElement `xml:"http://purl.org/dc/elements/1.1/ creator"`
+	Contributors []xmlDCElement `xml:"http://purl.org/dc/elements/1.1/ contributor"`
+	Languages    []xmlDCElement `xml:"http://purl.org/dc/elements/1.1/ language"`
+	Identifiers  []xmlDCElement `xml:"http://purl.org/dc/elements/1.1/ identifier"`
+	Subjects     []xmlDCElement `xml:"http://purl.org/dc/elements/1.1/ subject"`
+	Publishers   []xmlDCElement `xml:"http://purl.org/dc/elements/1.1/ publisher"`
+	Dates        []xmlDCElement `xml:"http://purl.org/dc/elements/1.1/ date"`
+	Descriptions []xmlDCElement `xml:"http://purl.org/dc/elements/1.1/ description"`
+	Rights       []xmlDCElement `xml:"http://purl.org/dc/elements/1.1/ rights"`
+	Metas        []xmlMeta      `xml:"meta"`
+}
+
+// xmlDCElement holds a Dublin Core element along with the EPUB 2 opf:
+// attributes that may qualify it.
+type xmlDCElement struct {
+	ID     string `xml:"id,attr"`
+	Role   string `xml:"role,attr"`
+	FileAs string `xml:"file-as,attr"`
+	Scheme string `xml:"scheme,attr"`
+	Event  string `xml:"event,attr"`
+	Value  string `xml:",chardata"`
+}
+
+type xmlMeta struct {
+	ID       string `xml:"id,attr"`
+	Name     string `xml:"name,attr"`
+	Content  string `xml:"content,attr"`
+	Property string `xml:"property,attr"`
+	Refines  string `xml:"refines,attr"`
+	Scheme   string `xml:"scheme,attr"`
+	Value    string `xml:",chardata"`
+}
+
+// ParsePackage parses the OPF package document stored at packagePath, which
+// manifest hrefs are resolved against.
+func ParsePackage(data []byte, packagePath string) (*Package, error) {
+	var raw xmlPackage
+	if err := xml.Unmarshal(data, &raw); err != nil {
+		return nil, invalidf("package document: %v", err)
+	}
+	pkg := &Package{
+		Version:          strings.TrimSpace(raw.Version),
+		UniqueIdentifier: strings.TrimSpace(raw.UniqueIdentifier),
+	}
+	m := &pkg.Metadata
+	for _, e := range raw.Metadata.Titles {
+		m.Titles = append(m.Titles, Title{ID: e.ID, Value: collapseSpace(e.Value)})
+	}
+	m.Creators = parseCreators(raw.Metadata.Creators)
+	m.Contributors = parseCreators(raw.Metadata.Contributors)
+	m.Languages = values(raw.Metadata.Languages)
+	for _, e := range raw.Metadata.Identifiers {
+		m.Identifiers = append(m.Identifiers, Identifier{ID: e.ID, Value: strings.TrimSpace(e.Value), Scheme: e.Scheme})
+	}
+	m.Subjects = values(raw.Metadata.Subjects)
+	m.Publishers = values(raw.Metadata.Publishers)
+	for _, e := range raw.Metadata.Dates {
+		m.Dates = append(m.Dates, Date{Value: strings.TrimSpace(e.Value), Event: e.Event})
+	}
+	if descriptions := raw.Metadata.Descriptions; len(descriptions) > 0 {
+		m.Description = strings.TrimSpace(descriptions[0].Value)
+	}
+	if rights := values(raw.Metadata.Rights); len(rights) > 0 {
+		m.Rights = rights[0]
+	}
+	for _, e := range raw.Metadata.Metas {
+		m.Metas = append(m.Metas, Meta{
+			ID:       e.ID,
+			Name:     e.Name,
+			Content:  e.Content,
+			Property: e.Property,
+			Refines:  e.Refines,
+			Scheme:   e.Scheme,
+			Value:    collapseSpace(e.Value),
+		})
+		if e.Property == "belongs-to-collection" && e.Refines == "" {
+			m.Collections = append(m.Collections, Collection{ID: e.ID, Name: collapseSpace(e.Value)})
+		}
+	}
+	m.applyRefinements()
+	if len(m.Titles) == 0 {
+		return nil, invalidf("package document has no dc:title")
+	}
+
+	for _, e := range raw.Manifest {
+		item := Item{
+			ID:           e.ID,
+			Href:         e.Href,
+			MediaType:    e.MediaType,
+			Properties:   strings.Fields(e.Properties),
+			Fallback:     e.Fallback,
+			MediaOverlay: e.MediaOverlay,
+		}
+		item.Path, _ = ResolveHref(packagePath, e.Href)
+		pkg.Manifest = append(pkg.Manifest, item)
+	}
+	pkg.Spine.Toc = raw.Spine.Toc
+	pkg.Spine.PageProgressionDirection = raw.Spine.PageProgressionDirection
+	for _, e := range raw.Spine.ItemRefs {
+		pkg.Spine.ItemRefs = append(pkg.Spine.ItemRefs, ItemRef{
+			IDRef:      e.IDRef,
+			Linear:     e.Linear != "no",
+			Properties: strings.Fields(e.Properties),
+		})
+	}
+	for _, e := range raw.Guide {
+		pkg.Guide = append(pkg.Guide, Reference{Type: e.Type, Title: e.Title, Href: e.Href})
+	}
+	return pkg, nil
+}
+
+// Item returns the manifest item with the given ID, or nil.
+func (p *Package) Item(id string) *Item {
+	for i := range p.Manifest {
+		if p.Manifest[i].ID == id {
+			return &p.Manifest[i]
+		}
+	}
+	return nil
+}
+
+// ItemByPath returns the manifest item stored at the given container path,
+// or nil.
+func (p *Package) ItemByPath(path string) *Item {
+	for i := range p.Manifest {
+		if p.Manifest[i].Path == path {
+			return &p.Manifest[i]
+		}
+	}
+	return nil
+}
+
+// SpineItem is an entry of the reading order joined with its manifest item.
+type SpineItem struct {
+	Index      int      `json:"index"`
+	ID         string   `json:"id"`
+	Path       string   `json:"path"`
+	MediaType  string   `json:"media_type"`
+	Linear     bool     `json:"linear"`
+	Properties []string `json:"properties"`
+}
+
+// SpineItems returns the reading order. Itemrefs pointing at no manifest
+// item are skipped.
+func (p *Package) SpineItems() []SpineItem {
+	items := []SpineItem{}
+	for _, ref := range p.Spine.ItemRefs {
+		item := p.Item(ref.IDRef)
+		if item == nil {
+			continue
+		}
+		items = append(items, SpineItem{
+			Index:      len(items),
+			ID:         item.ID,
+			Path:       item.Path,
+			MediaType:  item.MediaType,
+			Linear:     ref.Linear,
+			Properties: ref.Properties,
+		})
+	}
+	return items
+}
+
+// ItemWithProperty returns the first manifest item with the given EPUB 3
+// property, or nil.
+func (p *Package) ItemWithProperty(property string) *Item {
+	for i := range p.Manifest {
+		if p.Manifest[i].HasProperty(property) {
+			return &p.Manifest[i]
+		}
+	}
+	return nil
+}
+
+func parseCreators(elements []xmlDCElement) []Creator {
+	var creators []Creator
+	for _, e := range elements {
+		creators = append(creators, Creator{ID: e.ID, Name: collapseSpace(e.Value), FileAs: e.FileAs, Role: e.Role})
+	}
+	return creators
+}
+
+// values returns the non-empty values of elements.
+func values(elements []xmlDCElement) []string {
+	var values []string
+	for _, e := range elements {
+		if v := collapseSpace(e.Value); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+func collapseSpace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// applyRefinements copies EPUB 3 meta properties onto the elements they
+// refine and picks up dcterms:modified.
+func (m *Metadata) applyRefinements() {
+	for _, meta := range m.Metas {
+		if meta.Property == "dcterms:modified" && meta.Refines == "" {
+			m.Modified = meta.Value
+			continue
+		}
+		id := strings.TrimPrefix(meta.Refines, "#")
+		if id == "" || meta.Property == "" {
+			continue
+		}
+		for i := range m.Titles {
+			if m.Titles[i].ID == id && meta.Property == "title-type" {
+				m.Titles[i].Type = meta.Value
+			}
+		}
+		for _, creators := range [][]Creator{m.Creators, m.Contributors} {
+			for i := range creators {
+				if creators[i].ID != id {
+					continue
+				}
+				switch meta.Property {
+				case "role":
+					creators[i].Role = meta.Value
+				case "file-as":
+					creators[i].FileAs = meta.Value
+				}
+			}
+		}
+		for i := range m.Identifiers {
+			if m.Identifiers[i].ID == id && meta.Property == "identifier-type" {
+				m.Identifiers[i].Scheme = identifierScheme(meta.Scheme, meta.Value)
+			}
+		}
+		for i := range m.Collections {
+			if m.Collections[i].ID != id {
+				continue
+			}
+			switch meta.Property {
+			case "collection-type":
+				m.Collections[i].Type = meta.Value
+			case "group-position":
+				m.Collections[i].Position = meta.Value
+			}
+		}
+	}
+}
+
+// onixIdentifierSchemes names the ONIX codelist 5 product identifier types
+// EPUB 3 identifier-type refinements commonly use.
+var onixIdentifierSchemes = map[string]string{
+	"02": "ISBN",
+	"06": "DOI",
+	"15": "ISBN",
+	"22": "URN",
+}
+
+// identifierScheme returns the scheme named by an identifier-type
+// refinement, translating ONIX codes to their names.
+func identifierScheme(scheme, value string) string {
+	if scheme == "onix:codelist5" {
+		if name, ok := onixIdentifierSchemes[value]; ok {
+			return name
+		}
+	}
+	return value
+}
+
+// Title returns the main title: the title typed main, or else the first.
+func (m *Metadata) Title() string {
+	for _, title := range m.Titles {
+		if title.Type == "main" {
+			return title.Value
+		}
+	}
+	if len(m.Titles) > 0 {
+		return m.Titles[0].Value
+	}
+	return ""
+}
+
+// Subtitle returns the title typed subtitle, if any.
+func (m *Metadata) Subtitle() string {
+	for _, title := range m.Titles {
+		if title.Type == "subtitle" {
+			return title.Value
+		}
+	}
+	return ""
+}
+
+// Language returns the primary language of the publication.
+func (m *Metadata) Language() string {
+	if len(m.Languages) > 0 {
+		return m.Languages[0]
+	}
+	return ""
+}
+
+// Publisher returns the first publisher.
+func (m *Metadata) Publisher() string {
+	if len(m.Publishers) > 0 {
+		return m.Publishers[0]
+	}
+	return ""
+}
+
+// Series returns the name of the series the publication belongs to and its
+// position in it: the collection typed series, or else the first untyped
+// collection, or else the calibre:series meta EPUB 2 publications carry.
+// The name is empty if there is none, the position zero if it is unknown.
+func (m *Metadata) Series() (string, float64) {
+	var series *Collection
+	for i := range m.Collections {
+		collection := &m.Collections[i]
+		if collection.Name == "" {
+			continue
+		}
+		if collection.Type == "series" {
+			series = collection
+			break
+		}
+		if collection.Type == "" && series == nil {
+			series = collection
+		}
+	}
+	if series != nil {
+		return series.Name, seriesPosition(series.Position)
+	}
+	name, position := "", ""
+	for _, meta := range m.Metas {
+		switch meta.Name {
+		case "calibre:series":
+			name = collapseSpace(meta.Content)
+		case "calibre:series_index":
+			position = meta.Content
+		}
+	}
+	if name == "" {
+		return "", 0
+	}
+	return name, seriesPosition(position)
+}
+
+// seriesPosition parses a position in a series, like "2" or "1.5". Values
+// that are not non-negative numbers give zero.
+func seriesPosition(value string) float64 {
+	position, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil || position < 0 || math.IsInf(position, 0) || math.IsNaN(position) {
+		return 0
+	}
+	return position
+}
+
+// ISBNs returns the values of the identifiers that are ISBNs, either by
+// scheme or by urn:isbn: prefix, without that prefix.
+func (m *Metadata) ISBNs() []string {
+	var isbns []string
+	for _, identifier := range m.Identifiers {
+		value := identifier.Value
+		lower := strings.ToLower(value)
+		switch {
+		case strings.HasPrefix(lower, "urn:isbn:"):
+			isbns = append(isbns, value[len("urn:isbn:"):])
+		case strings.HasPrefix(lower, "isbn:"):
+			isbns = append(isbns, value[len("isbn:"):])
+		case strings.EqualFold(identifier.Scheme, "ISBN"):
+			isbns = append(isbns, value)
+		}
+	}
+	return isbns
+}
+
+// PublicationDate returns the dc:date with publication event, or else the
+// first dc:date without event, parsed as far as it is precise. The zero
+// time is returned if there is none or it cannot be parsed.
+func (m *Metadata) PublicationDate() time.Time {
+	value := ""
+	for _, date := range m.Dates {
+		if strings.EqualFold(date.Event, "publication") {
+			value = date.Value
+			break
+		}
+		if date.Event == "" && value == "" {
+			value = date.Value
+		}
+	}
+	t, _ := ParseDate(value)
+	return t
+}
+
+// ParseDate parses a W3C date as used by dc:date: YYYY, YYYY-MM,
+// YYYY-MM-DD or a full timestamp.
+func ParseDate(value string) (time.Time, bool) {
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02", "2006-01", "2006"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
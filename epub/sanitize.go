@@ -0,0 +1,445 @@
+package epub
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// SanitizePolicy configures Sanitize.
+type SanitizePolicy struct {
+	// AllowScripts keeps script elements and event handler attributes, for
+	// EPUB 3 scripted content of trusted publications.
+	AllowScripts bool
+
+	// AllowExternalResources keeps references loading images, styles,
+	// media and frames from outside the publication.
+	AllowExternalResources bool
+
+	// LinkSchemes lists the URL schemes, besides relative references,
+	// allowed in hyperlinks.
+	LinkSchemes []string
+}
+
+// DefaultLinkSchemes are the hyperlink schemes kept when a policy lists
+// none.
+var DefaultLinkSchemes = []string{"http", "https", "mailto", "tel"}
+
+// droppedElements are removed along with their content whatever the
+// policy, since they either run code outside of the script policy or change
+// how the rest of the document is resolved.
+var droppedElements = map[string]bool{
+	"base":     true,
+	"embed":    true,
+	"object":   true,
+	"applet":   true,
+	"frame":    true,
+	"frameset": true,
+}
+
+// voidElements are the HTML elements without content, the only ones written
+// self-closed so the output also parses as HTML.
+var voidElements = map[string]bool{
+	"area":   true,
+	"br":     true,
+	"col":    true,
+	"hr":     true,
+	"img":    true,
+	"input":  true,
+	"link":   true,
+	"meta":   true,
+	"param":  true,
+	"source": true,
+	"track":  true,
+	"wbr":    true,
+}
+
+// resourceAttributes hold URLs the browser loads on its own, as opposed to
+// hyperlinks the reader follows.
+var resourceAttributes = map[string]bool{
+	"src":        true,
+	"srcset":     true,
+	"poster":     true,
+	"background": true,
+	"data":       true,
+	"action":     true,
+	"formaction": true,
+	"manifest":   true,
+	"lowsrc":     true,
+	"dynsrc":     true,
+	"ping":       true,
+}
+
+// animationAttributes hold values SVG animations assign to other
+// attributes, which may be URLs.
+var animationAttributes = map[string]bool{
+	"to":     true,
+	"from":   true,
+	"by":     true,
+	"values": true,
+}
+
+// linkAttributes hold hyperlinks, or resources depending on the element.
+var linkAttributes = map[string]bool{
+	"href":     true,
+	"cite":     true,
+	"longdesc": true,
+	"usemap":   true,
+}
+
+// hyperlinkElements are the elements whose href is followed rather than
+// loaded.
+var hyperlinkElements = map[string]bool{
+	"a":    true,
+	"area": true,
+}
+
+var (
+	cssURLPattern    = regexp.MustCompile(`(?i)url\(\s*(?:"([^"]*)"|'([^']*)'|([^)]*))\s*\)`)
+	cssImportPattern = regexp.MustCompile(`(?i)@import\s+(?:url\(\s*["']?([^"')]*)["']?\s*\)|"([^"]*)"|'([^']*)')[^;]*;?`)
+	cssExprPattern   = regexp.MustCompile(`(?i)(expression|behavior|-moz-binding)\s*[:(]`)
+)
+
+// Sanitize rewrites an XHTML or SVG content document so it can be shown
+// in a web reader: scripts, event handlers, javascript: and similar URLs,
+// and, unless the policy allows them, references to resources outside the
+// publication are removed. Comments and processing instructions other than
+// the XML declaration are dropped, everything else is kept as is.
+func Sanitize(data []byte, policy SanitizePolicy) ([]byte, error) {
+	if len(policy.LinkSchemes) == 0 {
+		policy.LinkSchemes = DefaultLinkSchemes
+	}
+	d := xml.NewDecoder(bytes.NewReader(data))
+	d.Strict = false
+	d.Entity = xml.HTMLEntity
+	d.CharsetReader = charsetReader
+	s := &sanitizer{policy: policy}
+	for {
+		tok, err := d.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		s.token(tok)
+	}
+	s.flush()
+	return s.out.Bytes(), nil
+}
+
+type sanitizer struct {
+	policy SanitizePolicy
+	out    bytes.Buffer
+
+	// skip counts the open elements of a dropped subtree.
+	skip int
+
+	// pending is a start tag not written yet, so a void element can be
+	// self-closed if its end tag follows immediately.
+	pending *xml.StartElement
+
+	// style is set while inside a style element.
+	style bool
+}
+
+func (s *sanitizer) token(tok xml.Token) {
+	if s.skip > 0 {
+		switch tok.(type) {
+		case xml.StartElement:
+			s.skip++
+		case xml.EndElement:
+			s.skip--
+		}
+		return
+	}
+	switch t := tok.(type) {
+	case xml.StartElement:
+		s.flush()
+		if s.dropElement(t) {
+			s.skip = 1
+			return
+		}
+		t.Attr = s.filterAttributes(t)
+		s.pending = &t
+		s.style = strings.EqualFold(t.Name.Local, "style")
+	case xml.EndElement:
+		s.style = false
+		if s.pending != nil && s.pending.Name == t.Name && voidElements[strings.ToLower(t.Name.Local)] {
+			s.writeStart(*s.pending, true)
+			s.pending = nil
+			return
+		}
+		s.flush()
+		s.out.WriteString("</" + rawName(t.Name) + ">")
+	case xml.CharData:
+		s.flush()
+		text := string(t)
+		if s.style {
+			text = s.sanitizeCSS(text)
+		}
+		// Raw text keeps styles readable by HTML parsers too
+		if s.style && !strings.ContainsAny(text, "<&") {
+			s.out.WriteString(text)
+			return
+		}
+		escape(&s.out, text, false)
+	case xml.ProcInst:
+		s.flush()
+		if t.Target == "xml" {
+			// The output is always UTF-8 whatever the input declared
+			s.out.WriteString(`<?xml version="1.0" encoding="UTF-8"?>`)
+		}
+	case xml.Directive:
+		s.flush()
+		// Keep the doctype, but no internal subset that could declare
+		// entities
+		if bytes.HasPrefix(bytes.TrimSpace(t), []byte("DOCTYPE")) && !bytes.ContainsRune(t, '[') {
+			s.out.WriteString("<!" + string(t) + ">")
+		}
+	}
+}
+
+func (s *sanitizer) flush() {
+	if s.pending != nil {
+		s.writeStart(*s.pending, false)
+		s.pending = nil
+	}
+}
+
+func (s *sanitizer) writeStart(t xml.StartElement, selfClose bool) {
+	s.out.WriteString("<" + rawName(t.Name))
+	for _, a := range t.Attr {
+		s.out.WriteString(" " + rawName(a.Name) + `="`)
+		escape(&s.out, a.Value, true)
+		s.out.WriteByte('"')
+	}
+	if selfClose {
+		s.out.WriteString("/>")
+		return
+	}
+	s.out.WriteByte('>')
+}
+
+func (s *sanitizer) dropElement(t xml.StartElement) bool {
+	local := strings.ToLower(t.Name.Local)
+	if droppedElements[local] {
+		return true
+	}
+	if local == "script" {
+		return !s.policy.AllowScripts
+	}
+	if local == "meta" {
+		// Refreshes navigate away and cookies must not be set
+		for _, a := range t.Attr {
+			if strings.EqualFold(a.Name.Local, "http-equiv") {
+				return true
+			}
+		}
+	}
+	if (local == "iframe" || local == "link") && !s.policy.AllowExternalResources {
+		// Frames and stylesheets pointing outside are useless without
+		// their target, so they go entirely
+		for _, a := range t.Attr {
+			name := strings.ToLower(a.Name.Local)
+			if (name == "src" || name == "href") && isExternal(a.Value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// filterAttributes returns the attributes of t the policy allows, with
+// styles sanitized.
+func (s *sanitizer) filterAttributes(t xml.StartElement) []xml.Attr {
+	element := strings.ToLower(t.Name.Local)
+	attrs := make([]xml.Attr, 0, len(t.Attr))
+	for _, a := range t.Attr {
+		name := strings.ToLower(a.Name.Local)
+		if a.Name.Space == "xmlns" || (a.Name.Space == "" && name == "xmlns") {
+			attrs = append(attrs, a)
+			continue
+		}
+		if strings.HasPrefix(name, "on") && !s.policy.AllowScripts {
+			continue
+		}
+		if name == "srcdoc" {
+			continue
+		}
+		urlValued := resourceAttributes[name] || linkAttributes[name] || animationAttributes[name] || name == "style"
+		if urlValued && hasScriptURL(a.Value) {
+			continue
+		}
+		switch {
+		case name == "style":
+			a.Value = s.sanitizeCSS(a.Value)
+		case name == "srcset":
+			if !s.policy.AllowExternalResources && srcsetIsExternal(a.Value) {
+				continue
+			}
+		case resourceAttributes[name]:
+			if !s.resourceAllowed(a.Value) {
+				continue
+			}
+		case linkAttributes[name]:
+			if hyperlinkElements[element] || name != "href" {
+				if !s.linkAllowed(a.Value) {
+					continue
+				}
+			} else if !s.resourceAllowed(a.Value) {
+				continue
+			}
+		}
+		attrs = append(attrs, a)
+	}
+	return attrs
+}
+
+// resourceAllowed reports whether a URL loaded by the browser may stay.
+// Embedded images are fine, other data URLs could carry documents.
+func (s *sanitizer) resourceAllowed(value string) bool {
+	scheme := urlScheme(value)
+	switch {
+	case scheme == "":
+		return !isExternal(value) || s.policy.AllowExternalResources
+	case scheme == "data":
+		return strings.HasPrefix(strings.ToLower(strings.TrimSpace(value)), "data:image/") &&
+			!strings.HasPrefix(strings.ToLower(strings.TrimSpace(value)), "data:image/svg")
+	case scheme == "http" || scheme == "https":
+		return s.policy.AllowExternalResources
+	default:
+		return false
+	}
+}
+
+// linkAllowed reports whether a hyperlink may stay.
+func (s *sanitizer) linkAllowed(value string) bool {
+	scheme := urlScheme(value)
+	if scheme == "" {
+		return true
+	}
+	for _, allowed := range s.policy.LinkSchemes {
+		if scheme == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// sanitizeCSS removes style features that run code or, unless allowed,
+// load resources from outside the publication.
+func (s *sanitizer) sanitizeCSS(css string) string {
+	css = cssExprPattern.ReplaceAllString(css, "x-removed(")
+	css = cssImportPattern.ReplaceAllStringFunc(css, func(rule string) string {
+		m := cssImportPattern.FindStringSubmatch(rule)
+		if s.resourceAllowed(strings.TrimSpace(m[1] + m[2] + m[3])) {
+			return rule
+		}
+		return ""
+	})
+	return cssURLPattern.ReplaceAllStringFunc(css, func(match string) string {
+		m := cssURLPattern.FindStringSubmatch(match)
+		if s.resourceAllowed(strings.TrimSpace(m[1] + m[2] + m[3])) {
+			return match
+		}
+		return "none"
+	})
+}
+
+// urlScheme returns the lower case scheme of a URL, or an empty string for
+// relative references. Control characters and spaces that browsers ignore
+// are removed first so they cannot hide a scheme.
+func urlScheme(value string) string {
+	value = strings.Map(func(r rune) rune {
+		if r <= ' ' || r == 0x7f {
+			return -1
+		}
+		return r
+	}, value)
+	u, err := url.Parse(value)
+	if err != nil {
+		// Unparsable values are treated as having an unknown scheme
+		if i := strings.IndexByte(value, ':'); i > 0 {
+			return strings.ToLower(value[:i])
+		}
+		return "invalid"
+	}
+	return strings.ToLower(u.Scheme)
+}
+
+// isExternal reports whether a URL points outside the publication.
+func isExternal(value string) bool {
+	value = strings.TrimSpace(value)
+	return urlScheme(value) != "" || strings.HasPrefix(value, "//") || strings.HasPrefix(value, `\\`)
+}
+
+// hasScriptURL reports whether value holds a URL running code anywhere, not
+// only at its start, since animation values are lists.
+func hasScriptURL(value string) bool {
+	normalized := strings.ToLower(strings.Map(func(r rune) rune {
+		if r <= ' ' || r == 0x7f {
+			return -1
+		}
+		return r
+	}, value))
+	return strings.Contains(normalized, "javascript:") || strings.Contains(normalized, "vbscript:") ||
+		strings.Contains(normalized, "data:text/html")
+}
+
+func srcsetIsExternal(value string) bool {
+	for _, candidate := range strings.Split(value, ",") {
+		fields := strings.Fields(candidate)
+		if len(fields) > 0 && isExternal(fields[0]) {
+			return true
+		}
+	}
+	return false
+}
+
+// charsetReader converts the single byte encodings found in older
+// publications to UTF-8. Other encodings fail the decoding.
+func charsetReader(charset string, input io.Reader) (io.Reader, error) {
+	switch strings.ToLower(charset) {
+	case "us-ascii", "ascii", "iso-8859-1", "latin1", "l1":
+		data, err := io.ReadAll(input)
+		if err != nil {
+			return nil, err
+		}
+		runes := make([]rune, len(data))
+		for i, c := range data {
+			runes[i] = rune(c)
+		}
+		return strings.NewReader(string(runes)), nil
+	}
+	return nil, fmt.Errorf("unsupported charset %q", charset)
+}
+
+func rawName(name xml.Name) string {
+	if name.Space == "" {
+		return name.Local
+	}
+	return name.Space + ":" + name.Local
+}
+
+// escape writes text with the characters markup needs escaped.
+func escape(b *bytes.Buffer, text string, attr bool) {
+	for _, r := range text {
+		switch {
+		case r == '&':
+			b.WriteString("&amp;")
+		case r == '<':
+			b.WriteString("&lt;")
+		case r == '>':
+			b.WriteString("&gt;")
+		case r == '"' && attr:
+			b.WriteString("&quot;")
+		default:
+			b.WriteRune(r)
+		}
+	}
+}
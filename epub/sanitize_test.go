@@ -0,0 +1,77 @@
+package epub
+
+import "testing"
+
+func TestSanitize(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy SanitizePolicy
+		in     string
+		want   string
+	}{
+		{
+			"scripts and event handlers",
+			SanitizePolicy{},
+			`<p onclick="x()">Hi<script>alert(1)</script></p>`,
+			`<p>Hi</p>`,
+		},
+		{
+			"scripts allowed",
+			SanitizePolicy{AllowScripts: true},
+			`<p onclick="x()">Hi<script>alert(1)</script></p>`,
+			`<p onclick="x()">Hi<script>alert(1)</script></p>`,
+		},
+		{
+			"link schemes",
+			SanitizePolicy{},
+			`<a href="javascript:alert(1)">x</a><a href="ch2.xhtml#a">y</a><a href="mailto:a@example.com">m</a><a href="ftp://example.com">f</a>`,
+			`<a>x</a><a href="ch2.xhtml#a">y</a><a href="mailto:a@example.com">m</a><a>f</a>`,
+		},
+		{
+			"script URLs whatever the policy",
+			SanitizePolicy{AllowScripts: true, LinkSchemes: []string{"javascript"}},
+			`<a href="javascript:alert(1)">x</a>`,
+			`<a>x</a>`,
+		},
+		{
+			"external resources",
+			SanitizePolicy{},
+			`<img src="http://example.com/x.png" alt="a"/><img src="images/a.png"/>`,
+			`<img alt="a"/><img src="images/a.png"/>`,
+		},
+		{
+			"external resources allowed",
+			SanitizePolicy{AllowExternalResources: true},
+			`<img src="http://example.com/x.png" alt="a"/>`,
+			`<img src="http://example.com/x.png" alt="a"/>`,
+		},
+		{
+			"dropped elements",
+			SanitizePolicy{AllowScripts: true, AllowExternalResources: true},
+			`<base href="http://example.com/"/><object data="x"><p>in</p></object><p>after</p>`,
+			`<p>after</p>`,
+		},
+		{
+			"comments and void elements",
+			SanitizePolicy{},
+			`<!-- c --><p>s</p><br></br>`,
+			`<p>s</p><br/>`,
+		},
+		{
+			"external CSS",
+			SanitizePolicy{},
+			`<style>@import url("http://example.com/a.css"); p { color: red }</style><p style="background:url(http://example.com/x)">s</p>`,
+			`<style> p { color: red }</style><p style="background:none">s</p>`,
+		},
+	}
+	for _, tt := range tests {
+		got, err := Sanitize([]byte(tt.in), tt.policy)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if string(got) != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
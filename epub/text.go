@@ -0,0 +1,138 @@
+package epub
+
+import (
+	"strings"
+)
+
+// maxPassageLength is the length, in bytes, past which a passage is closed
+// at the next block boundary.
+const maxPassageLength = 1000
+
+// Passage is a run of consecutive blocks of text of a content document,
+// the unit full-text search indexes and points readers at.
+type Passage struct {
+	// SpineIndex and Path locate the content document, Fragment is the ID
+	// of the closest element at or before the start of the passage, if
+	// any.
+	SpineIndex int    `json:"spine_index"`
+	Path       string `json:"path"`
+	Fragment   string `json:"fragment,omitempty"`
+
+	// Position orders the passages of the publication.
+	Position int    `json:"position"`
+	Text     string `json:"text"`
+}
+
+// blockElements end the text run before and after them.
+var blockElements = map[string]bool{
+	"address": true, "article": true, "aside": true, "blockquote": true, "br": true, "caption": true,
+	"dd": true, "div": true, "dl": true, "dt": true, "figcaption": true, "figure": true,
+	"footer": true, "h1": true, "h2": true, "h3": true, "h4": true, "h5": true,
+	"h6": true, "header": true, "hr": true, "li": true, "main": true, "nav": true,
+	"ol": true, "p": true, "pre": true, "section": true, "table": true, "td": true,
+	"th": true, "tr": true, "ul": true,
+}
+
+// skippedElements hold no readable text.
+var skippedElements = map[string]bool{
+	"head":   true,
+	"script": true,
+	"style":  true,
+	"rt":     true,
+}
+
+// Passages extracts the text of the XHTML documents of the spine, in
+// reading order, split into passages at block boundaries. Documents that
+// are missing or cannot be parsed are skipped.
+func (r *Reader) Passages() []Passage {
+	passages := []Passage{}
+	for _, spineItem := range r.Package.SpineItems() {
+		item := r.Package.Item(spineItem.ID)
+		if item.MediaType != xhtmlMediaType {
+			continue
+		}
+		root, err := r.readTree(item)
+		if err != nil {
+			continue
+		}
+		e := &passageExtractor{spineIndex: spineItem.Index, path: item.Path, position: len(passages)}
+		e.walk(root)
+		e.endBlock()
+		e.flush()
+		passages = append(passages, e.passages...)
+	}
+	return passages
+}
+
+type passageExtractor struct {
+	spineIndex int
+	path       string
+	position   int
+	passages   []Passage
+
+	// anchor is the ID of the last element entered and blockAnchor the
+	// one in effect where the text of the current block starts. block holds
+	// that text and current the passage being built.
+	anchor      string
+	blockAnchor string
+	block       strings.Builder
+	current     *Passage
+}
+
+func (e *passageExtractor) walk(n *node) {
+	if n.Name.Local == "" {
+		if e.block.Len() == 0 && strings.TrimSpace(n.Text) != "" {
+			e.blockAnchor = e.anchor
+		}
+		if e.block.Len() > 0 || strings.TrimSpace(n.Text) != "" {
+			e.block.WriteString(n.Text)
+		}
+		return
+	}
+	local := strings.ToLower(n.Name.Local)
+	if skippedElements[local] {
+		return
+	}
+	if id := n.attr("", "id"); id != "" {
+		e.anchor = id
+	}
+	block := blockElements[local]
+	if block {
+		e.endBlock()
+	}
+	for _, child := range n.Children {
+		e.walk(child)
+	}
+	if block {
+		e.endBlock()
+	}
+}
+
+// endBlock adds the current block to the passage, closing the passage once
+// it is long enough.
+func (e *passageExtractor) endBlock() {
+	text := collapseSpace(e.block.String())
+	e.block.Reset()
+	if text == "" {
+		return
+	}
+	if e.current == nil {
+		e.current = &Passage{SpineIndex: e.spineIndex, Path: e.path, Fragment: e.blockAnchor}
+		e.current.Text = text
+	} else {
+		e.current.Text += "\n" + text
+	}
+	if len(e.current.Text) >= maxPassageLength {
+		e.flush()
+	}
+}
+
+func (e *passageExtractor) flush() {
+	if e.current == nil {
+		return
+	}
+	e.current.Position = e.position
+	e.position++
+	e.passages = append(e.passages, *e.current)
+	e.current = nil
+}
@@ -0,0 +1,459 @@
+package epub
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync/atomic"
+)
+
+type Severity string
+
+const (
+	// Fatal messages stop the validation, the publication cannot be read.
+	Fatal   Severity = "fatal"
+	Error   Severity = "error"
+	Warning Severity = "warning"
+	Info    Severity = "info"
+)
+
+// Message is a finding of Validate.
+type Message struct {
+	Severity Severity `json:"severity"`
+	Code     string   `json:"code"`
+	Message  string   `json:"message"`
+
+	// Path is the container path of the file the finding is about, if any,
+	// and Line the line in it, if known.
+	Path string `json:"path,omitempty"`
+	Line int    `json:"line,omitempty"`
+}
+
+// Report is the outcome of Validate.
+type Report struct {
+	Messages []Message `json:"messages"`
+}
+
+// Valid reports whether the report holds no fatal or error messages.
+func (r *Report) Valid() bool {
+	return r.Count(Fatal) == 0 && r.Count(Error) == 0
+}
+
+// Count returns the number of messages with the given severity.
+func (r *Report) Count(severity Severity) int {
+	n := 0
+	for _, m := range r.Messages {
+		if m.Severity == severity {
+			n++
+		}
+	}
+	return n
+}
+
+func (r *Report) add(severity Severity, code, path string, line int, format string, args ...interface{}) {
+	r.Messages = append(r.Messages, Message{
+		Severity: severity,
+		Code:     code,
+		Message:  fmt.Sprintf(format, args...),
+		Path:     path,
+		Line:     line,
+	})
+}
+
+// xhtmlMediaType and svgMediaType are the content document types allowed in
+// the spine without fallback.
+const (
+	xhtmlMediaType = "application/xhtml+xml"
+	svgMediaType   = "image/svg+xml"
+)
+
+// Validate checks the EPUB of the given size read from r against the OCF
+// and OPF rules most reading systems rely on: container layout, package
+// metadata, manifest and spine consistency, missing or undeclared
+// resources, well-formed content documents and internal links. Unlike
+// NewReader it never fails, problems end up in the report.
+func Validate(r io.ReaderAt, size int64) *Report {
+	report := &Report{Messages: []Message{}}
+	z, err := zip.NewReader(r, size)
+	if err != nil {
+		report.add(Fatal, "OCF-ZIP", "", 0, "file is not a zip archive: %v", err)
+		return report
+	}
+	v := &validator{report: report, zip: z, files: map[string]*zip.File{}}
+	v.inflateBudget.Store(MaxInflatedSize)
+	for _, f := range z.File {
+		v.files[f.Name] = f
+	}
+	if !v.checkMimetype() || !v.checkPackage() {
+		return report
+	}
+	v.checkManifest()
+	v.checkSpine()
+	v.checkNavigation()
+	v.checkContentDocuments()
+	return report
+}
+
+type validator struct {
+	report      *Report
+	zip         *zip.Reader
+	files       map[string]*zip.File
+	packagePath string
+	pkg         *Package
+
+	// ids holds the element IDs of every parsed content document.
+	ids map[string]map[string]bool
+
+	// inflateBudget is the number of bytes read may still inflate.
+	inflateBudget atomic.Int64
+}
+
+func (v *validator) read(name string) ([]byte, error) {
+	f := v.files[name]
+	if f == nil {
+		return nil, fmt.Errorf("%w: %s", ErrFileNotFound, name)
+	}
+	return readEntry(f, &v.inflateBudget)
+}
+
+// checkMimetype checks the mimetype file, which must come first and be
+// stored uncompressed so the type can be sniffed at a fixed offset.
+func (v *validator) checkMimetype() bool {
+	f := v.files["mimetype"]
+	if f == nil {
+		v.report.add(Fatal, "OCF-MIMETYPE-MISSING", "mimetype", 0, "mimetype file is missing")
+		return false
+	}
+	if v.zip.File[0] != f {
+		v.report.add(Error, "OCF-MIMETYPE-FIRST", "mimetype", 0, "mimetype must be the first file of the container")
+	}
+	if f.Method != zip.Store {
+		v.report.add(Error, "OCF-MIMETYPE-COMPRESSED", "mimetype", 0, "mimetype must be stored uncompressed")
+	}
+	if len(f.Extra) > 0 {
+		v.report.add(Warning, "OCF-MIMETYPE-EXTRA", "mimetype", 0, "mimetype entry should have no extra field")
+	}
+	data, err := v.read("mimetype")
+	if err != nil {
+		v.report.add(Fatal, "OCF-MIMETYPE-UNREADABLE", "mimetype", 0, "mimetype cannot be read: %v", err)
+		return false
+	}
+	if string(data) != MimeType {
+		if strings.TrimSpace(string(data)) == MimeType {
+			v.report.add(Error, "OCF-MIMETYPE-WHITESPACE", "mimetype", 0, "mimetype must not contain whitespace or a newline")
+		} else {
+			v.report.add(Fatal, "OCF-MIMETYPE-CONTENT", "mimetype", 0, "mimetype must be %s", MimeType)
+			return false
+		}
+	}
+	return true
+}
+
+// checkPackage finds and parses the package document and checks its
+// required metadata.
+func (v *validator) checkPackage() bool {
+	data, err := v.read(ContainerPath)
+	if errors.Is(err, ErrFileNotFound) {
+		v.report.add(Fatal, "OCF-CONTAINER-MISSING", ContainerPath, 0, "container.xml is missing")
+		return false
+	}
+	if err != nil {
+		v.report.add(Fatal, "OCF-CONTAINER-UNREADABLE", ContainerPath, 0, "container.xml cannot be read: %v", err)
+		return false
+	}
+	var container xmlContainer
+	if err := xml.Unmarshal(data, &container); err != nil {
+		v.report.add(Fatal, "OCF-CONTAINER-XML", ContainerPath, 0, "container.xml is not well-formed: %v", err)
+		return false
+	}
+	for _, rootfile := range container.Rootfiles {
+		if rootfile.MediaType == PackageMediaType && rootfile.FullPath != "" {
+			v.packagePath = rootfile.FullPath
+			break
+		}
+	}
+	if v.packagePath == "" {
+		v.report.add(Fatal, "OCF-ROOTFILE", ContainerPath, 0, "container.xml lists no package document")
+		return false
+	}
+	opf, err := v.read(v.packagePath)
+	if errors.Is(err, ErrFileNotFound) {
+		v.report.add(Fatal, "OPF-MISSING", v.packagePath, 0, "package document is missing")
+		return false
+	}
+	if err != nil {
+		v.report.add(Fatal, "OPF-UNREADABLE", v.packagePath, 0, "package document cannot be read: %v", err)
+		return false
+	}
+	if line, err := checkWellFormed(opf, false); err != nil {
+		v.report.add(Fatal, "OPF-XML", v.packagePath, line, "package document is not well-formed: %v", err)
+		return false
+	}
+	v.pkg, err = ParsePackage(opf, v.packagePath)
+	if err != nil && !errors.Is(err, ErrInvalidEPUB) {
+		v.report.add(Fatal, "OPF-PARSE", v.packagePath, 0, "package document cannot be parsed: %v", err)
+		return false
+	}
+	if v.pkg == nil {
+		// ParsePackage only rejects well-formed documents without title
+		v.report.add(Error, "OPF-TITLE", v.packagePath, 0, "dc:title is required")
+		return false
+	}
+
+	m := &v.pkg.Metadata
+	switch {
+	case v.pkg.Version == "":
+		v.report.add(Error, "OPF-VERSION", v.packagePath, 0, "package version is required")
+	case v.pkg.Version != "2.0" && !v.pkg.IsEPUB3():
+		v.report.add(Error, "OPF-VERSION", v.packagePath, 0, "unsupported package version %s", v.pkg.Version)
+	}
+	if len(m.Identifiers) == 0 {
+		v.report.add(Error, "OPF-IDENTIFIER", v.packagePath, 0, "dc:identifier is required")
+	}
+	if v.pkg.UniqueIdentifier == "" {
+		v.report.add(Error, "OPF-UNIQUE-IDENTIFIER", v.packagePath, 0, "package unique-identifier attribute is required")
+	} else {
+		found := false
+		for _, identifier := range m.Identifiers {
+			found = found || identifier.ID == v.pkg.UniqueIdentifier
+		}
+		if !found {
+			v.report.add(Error, "OPF-UNIQUE-IDENTIFIER", v.packagePath, 0, "unique-identifier %q refers to no dc:identifier", v.pkg.UniqueIdentifier)
+		}
+	}
+	if len(m.Languages) == 0 {
+		v.report.add(Error, "OPF-LANGUAGE", v.packagePath, 0, "dc:language is required")
+	}
+	if v.pkg.IsEPUB3() && m.Modified == "" {
+		v.report.add(Error, "OPF-MODIFIED", v.packagePath, 0, "meta property dcterms:modified is required in EPUB 3")
+	}
+	return true
+}
+
+// checkManifest checks that manifest items are unique, exist and that every
+// file of the container is declared.
+func (v *validator) checkManifest() {
+	if len(v.pkg.Manifest) == 0 {
+		v.report.add(Error, "OPF-MANIFEST-EMPTY", v.packagePath, 0, "manifest is empty")
+	}
+	ids := map[string]bool{}
+	paths := map[string]bool{}
+	for _, item := range v.pkg.Manifest {
+		if item.ID == "" {
+			v.report.add(Error, "OPF-ITEM-ID", v.packagePath, 0, "manifest item %s has no id", item.Href)
+		} else if ids[item.ID] {
+			v.report.add(Error, "OPF-ITEM-ID-DUPLICATE", v.packagePath, 0, "manifest id %s is used more than once", item.ID)
+		}
+		ids[item.ID] = true
+		if item.MediaType == "" {
+			v.report.add(Error, "OPF-ITEM-MEDIA-TYPE", v.packagePath, 0, "manifest item %s has no media-type", item.ID)
+		}
+		if item.Path == "" {
+			if !isRemote(item.Href) {
+				v.report.add(Error, "RSC-OUTSIDE-CONTAINER", v.packagePath, 0, "manifest item %s points outside the container", item.ID)
+			}
+			continue
+		}
+		if paths[item.Path] {
+			v.report.add(Error, "OPF-ITEM-DUPLICATE", v.packagePath, 0, "%s is declared more than once", item.Path)
+		}
+		paths[item.Path] = true
+		if v.files[item.Path] == nil {
+			v.report.add(Error, "RSC-MISSING", item.Path, 0, "resource declared in the manifest is missing from the container")
+		}
+		if item.Fallback != "" && v.pkg.Item(item.Fallback) == nil {
+			v.report.add(Error, "OPF-FALLBACK", v.packagePath, 0, "fallback %s of item %s does not exist", item.Fallback, item.ID)
+		}
+	}
+
+	var undeclared []string
+	for name, f := range v.files {
+		if f.FileInfo().IsDir() || name == "mimetype" || name == v.packagePath || strings.HasPrefix(name, "META-INF/") {
+			continue
+		}
+		if !paths[name] {
+			undeclared = append(undeclared, name)
+		}
+	}
+	sort.Strings(undeclared)
+	for _, name := range undeclared {
+		v.report.add(Warning, "RSC-UNDECLARED", name, 0, "file is not declared in the manifest")
+	}
+}
+
+// checkSpine checks that the spine lists existing content documents once.
+func (v *validator) checkSpine() {
+	if len(v.pkg.Spine.ItemRefs) == 0 {
+		v.report.add(Error, "OPF-SPINE-EMPTY", v.packagePath, 0, "spine is empty")
+		return
+	}
+	seen := map[string]bool{}
+	linear := false
+	for _, ref := range v.pkg.Spine.ItemRefs {
+		item := v.pkg.Item(ref.IDRef)
+		if item == nil {
+			v.report.add(Error, "OPF-SPINE-IDREF", v.packagePath, 0, "spine itemref %s refers to no manifest item", ref.IDRef)
+			continue
+		}
+		if seen[ref.IDRef] {
+			v.report.add(Error, "OPF-SPINE-DUPLICATE", v.packagePath, 0, "spine refers to %s more than once", ref.IDRef)
+		}
+		seen[ref.IDRef] = true
+		linear = linear || ref.Linear
+		if !v.isContentDocument(item, map[string]bool{}) {
+			v.report.add(Error, "OPF-SPINE-MEDIA-TYPE", v.packagePath, 0, "spine item %s is %s without content document fallback", item.ID, item.MediaType)
+		}
+	}
+	if !linear {
+		v.report.add(Error, "OPF-SPINE-LINEAR", v.packagePath, 0, "spine needs at least one linear item")
+	}
+}
+
+// isContentDocument reports whether item, or one of its fallbacks, is an
+// XHTML or SVG content document.
+func (v *validator) isContentDocument(item *Item, visited map[string]bool) bool {
+	if item.MediaType == xhtmlMediaType || item.MediaType == svgMediaType {
+		return true
+	}
+	if item.Fallback == "" || visited[item.ID] {
+		return false
+	}
+	visited[item.ID] = true
+	fallback := v.pkg.Item(item.Fallback)
+	return fallback != nil && v.isContentDocument(fallback, visited)
+}
+
+// checkNavigation checks that the navigation required by the package
+// version is present.
+func (v *validator) checkNavigation() {
+	if v.pkg.IsEPUB3() {
+		var navs []Item
+		for _, item := range v.pkg.Manifest {
+			if item.HasProperty("nav") {
+				navs = append(navs, item)
+			}
+		}
+		switch {
+		case len(navs) == 0:
+			v.report.add(Error, "NAV-MISSING", v.packagePath, 0, "EPUB 3 requires a manifest item with the nav property")
+		case len(navs) > 1:
+			v.report.add(Error, "NAV-DUPLICATE", v.packagePath, 0, "only one manifest item may have the nav property")
+		case navs[0].MediaType != xhtmlMediaType:
+			v.report.add(Error, "NAV-MEDIA-TYPE", navs[0].Path, 0, "navigation document must be %s", xhtmlMediaType)
+		}
+		return
+	}
+	if v.pkg.Spine.Toc == "" {
+		v.report.add(Error, "NCX-MISSING", v.packagePath, 0, "EPUB 2 spine requires a toc attribute referring to the NCX")
+		return
+	}
+	item := v.pkg.Item(v.pkg.Spine.Toc)
+	if item == nil {
+		v.report.add(Error, "NCX-MISSING", v.packagePath, 0, "spine toc %s refers to no manifest item", v.pkg.Spine.Toc)
+	} else if item.MediaType != NCXMediaType {
+		v.report.add(Error, "NCX-MEDIA-TYPE", item.Path, 0, "NCX must be %s", NCXMediaType)
+	}
+}
+
+// checkContentDocuments checks that XHTML documents are well-formed and
+// that their links and embedded resources point at declared resources.
+func (v *validator) checkContentDocuments() {
+	v.ids = map[string]map[string]bool{}
+	type link struct {
+		from, href string
+	}
+	var links []link
+	for _, item := range v.pkg.Manifest {
+		if item.MediaType != xhtmlMediaType || v.files[item.Path] == nil {
+			continue
+		}
+		data, err := v.read(item.Path)
+		if err != nil {
+			v.report.add(Error, "RSC-UNREADABLE", item.Path, 0, "file cannot be read: %v", err)
+			continue
+		}
+		if line, err := checkWellFormed(data, !v.pkg.IsEPUB3()); err != nil {
+			v.report.add(Error, "HTM-XML", item.Path, line, "document is not well-formed: %v", err)
+			continue
+		}
+		root, err := parseTree(data)
+		if err != nil {
+			continue
+		}
+		ids := map[string]bool{}
+		var walk func(n *node)
+		walk = func(n *node) {
+			if id := n.attr("", "id"); id != "" {
+				ids[id] = true
+			}
+			for _, attr := range []string{"href", "src"} {
+				if href := n.attr("", attr); href != "" && n.Name.Local != "" {
+					links = append(links, link{from: item.Path, href: href})
+				}
+			}
+			for _, child := range n.Children {
+				walk(child)
+			}
+		}
+		walk(root)
+		v.ids[item.Path] = ids
+	}
+
+	for _, l := range links {
+		if isRemote(l.href) || strings.HasPrefix(l.href, "data:") {
+			continue
+		}
+		target, fragment := resolveTarget(l.from, l.href)
+		if target == "" {
+			v.report.add(Error, "RSC-LINK-OUTSIDE", l.from, 0, "link %s points outside the container", l.href)
+			continue
+		}
+		if v.pkg.ItemByPath(target) == nil {
+			if v.files[target] == nil {
+				v.report.add(Error, "RSC-LINK-BROKEN", l.from, 0, "link %s points at a missing resource", l.href)
+			} else {
+				v.report.add(Error, "RSC-LINK-UNDECLARED", l.from, 0, "link %s points at a resource not declared in the manifest", l.href)
+			}
+			continue
+		}
+		if ids, ok := v.ids[target]; ok && fragment != "" && !ids[fragment] {
+			v.report.add(Warning, "RSC-FRAGMENT", l.from, 0, "link %s points at a missing element id", l.href)
+		}
+	}
+}
+
+// isRemote reports whether href has a scheme and so points at a remote
+// resource or another application.
+func isRemote(href string) bool {
+	i := strings.IndexByte(href, ':')
+	return i > 0 && !strings.ContainsAny(href[:i], "/?#")
+}
+
+// checkWellFormed strictly parses an XML document and returns the line of
+// the first error. EPUB 2 content documents may use the named entities of
+// the XHTML 1.1 DTD, EPUB 3 ones may not.
+func checkWellFormed(data []byte, htmlEntities bool) (int, error) {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	if htmlEntities {
+		d.Entity = xml.HTMLEntity
+	}
+	for {
+		_, err := d.Token()
+		if err == io.EOF {
+			return 0, nil
+		}
+		if err != nil {
+			var syntaxErr *xml.SyntaxError
+			if errors.As(err, &syntaxErr) {
+				return syntaxErr.Line, errors.New(syntaxErr.Msg)
+			}
+			line, _ := d.InputPos()
+			return line, err
+		}
+	}
+}
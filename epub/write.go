@@ -0,0 +1,574 @@
+package epub
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	dcNamespace  = "http://purl.org/dc/elements/1.1/"
+	opfNamespace = "http://www.idpf.org/2007/opf"
+)
+
+// MetadataUpdate is the metadata RewriteMetadata writes into a package
+// document.
+type MetadataUpdate struct {
+	Title    string
+	Subtitle string
+
+	// Language is the primary language. The languages of the package
+	// document are kept when it is empty, dc:language being required.
+	Language string
+
+	Description string
+	Publisher   string
+	Rights      string
+
+	// Zero if unknown.
+	PublicationDate time.Time
+
+	// Creators are written as dc:creator in the given order, whatever their
+	// role.
+	Creators []Creator
+
+	// ISBNs are written as urn:isbn: identifiers in EPUB 3 and with the ISBN
+	// scheme in EPUB 2. Identifiers that are ISBNs are left out in favor of
+	// them.
+	ISBNs       []string
+	Identifiers []Identifier
+
+	Subjects []string
+
+	// Series the publication belongs to, empty if none, and its position in
+	// it, zero if unknown.
+	Series         string
+	SeriesPosition float64
+
+	// Modified is written as dcterms:modified in EPUB 3 publications.
+	Modified time.Time
+}
+
+// metadataChild is an element directly below the metadata element of a
+// package document, with the byte range it spans.
+type metadataChild struct {
+	name       xml.Name
+	attr       []xml.Attr
+	start, end int64
+}
+
+func (c *metadataChild) attrValue(local string) string {
+	for _, a := range c.attr {
+		if a.Name.Space == "" && a.Name.Local == local {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// regeneratedElements lists the Dublin Core elements RewriteMetadata writes
+// from a MetadataUpdate, replacing those of the package document.
+var regeneratedElements = map[string]bool{
+	"title":       true,
+	"creator":     true,
+	"contributor": true,
+	"identifier":  true,
+	"subject":     true,
+	"publisher":   true,
+	"date":        true,
+	"description": true,
+	"rights":      true,
+}
+
+// metadataLayout locates the metadata element of a package document.
+type metadataLayout struct {
+	// Byte ranges of the start tag and of the end tag.
+	start, startTagEnd, endTagStart, end int64
+
+	children []*metadataChild
+
+	// Whitespace before each child and before the end tag.
+	spaces []string
+
+	// Prefixes declared on the package and metadata elements.
+	namespaces map[string]string
+
+	// IDs used anywhere in the document.
+	ids map[string]bool
+}
+
+// scanMetadata locates the metadata element of a package document and the
+// elements directly below it.
+func scanMetadata(opf []byte) (*metadataLayout, error) {
+	layout := &metadataLayout{start: -1, namespaces: map[string]string{}, ids: map[string]bool{}}
+	d := xml.NewDecoder(bytes.NewReader(opf))
+	depth, metadataDepth := 0, 0
+	var current *metadataChild
+	space := ""
+	for {
+		offset := d.InputOffset()
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, invalidf("package document: %v", err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			depth++
+			for _, a := range t.Attr {
+				if a.Name.Space == "" && a.Name.Local == "id" {
+					layout.ids[a.Value] = true
+				}
+			}
+			switch {
+			case depth == 1:
+				addNamespaces(layout.namespaces, t.Attr)
+			case depth == 2 && t.Name.Local == "metadata" && layout.start < 0:
+				layout.start, layout.startTagEnd = offset, d.InputOffset()
+				metadataDepth = depth
+				addNamespaces(layout.namespaces, t.Attr)
+			case metadataDepth > 0 && depth == metadataDepth+1:
+				current = &metadataChild{name: t.Name, attr: t.Attr, start: offset}
+				layout.spaces = append(layout.spaces, space)
+			}
+			space = ""
+		case xml.EndElement:
+			switch {
+			case metadataDepth > 0 && depth == metadataDepth:
+				layout.endTagStart, layout.end = offset, d.InputOffset()
+				layout.spaces = append(layout.spaces, space)
+				metadataDepth = 0
+			case current != nil && depth == metadataDepth+1:
+				current.end = d.InputOffset()
+				layout.children = append(layout.children, current)
+				current = nil
+			}
+			depth--
+			space = ""
+		case xml.CharData:
+			space = string(t)
+		}
+	}
+	if layout.start < 0 || layout.end == 0 {
+		return nil, invalidf("package document has no metadata")
+	}
+	return layout, nil
+}
+
+// RewriteMetadata returns the package document with its metadata
+// regenerated from upd. Everything outside the metadata element is kept
+// byte for byte, and so are the metadata entries upd does not cover, like
+// the cover meta, links, and the unique identifier of the publication
+// along with its refinements. Comments within the metadata are dropped.
+func RewriteMetadata(opf []byte, upd *MetadataUpdate) ([]byte, error) {
+	pkg, err := ParsePackage(opf, "")
+	if err != nil {
+		return nil, err
+	}
+	layout, err := scanMetadata(opf)
+	if err != nil {
+		return nil, err
+	}
+	children := layout.children
+
+	// Package documents always have a title, so metadata is never written
+	// as an empty element
+	startTag := string(opf[layout.start:layout.startTagEnd])
+	endTag := string(opf[layout.endTagStart:layout.end])
+
+	// Declare the prefixes of the generated elements and attributes
+	required := [][2]string{{"dc", dcNamespace}}
+	if !pkg.IsEPUB3() {
+		required = append(required, [2]string{"opf", opfNamespace})
+	}
+	for _, ns := range required {
+		bound, ok := layout.namespaces[ns[0]]
+		if ok && bound != ns[1] {
+			return nil, invalidf("package document binds the %s prefix to %s", ns[0], bound)
+		}
+		if !ok {
+			startTag = strings.TrimSuffix(startTag, ">") + fmt.Sprintf(` xmlns:%s="%s">`, ns[0], ns[1])
+		}
+	}
+
+	// Drop the entries that are regenerated, and those refining them
+	dropped := map[int]bool{}
+	droppedIDs := map[string]bool{}
+	for i, child := range children {
+		name := child.name
+		switch {
+		case name.Space == dcNamespace && name.Local == "identifier" && pkg.UniqueIdentifier != "" && child.attrValue("id") == pkg.UniqueIdentifier:
+		case name.Space == dcNamespace && regeneratedElements[name.Local]:
+			dropped[i] = true
+		case name.Space == dcNamespace && name.Local == "language" && upd.Language != "":
+			dropped[i] = true
+		case name.Local == "meta" && child.attrValue("refines") == "":
+			switch child.attrValue("property") {
+			case "dcterms:modified", "belongs-to-collection":
+				dropped[i] = true
+			}
+			switch child.attrValue("name") {
+			case "calibre:series", "calibre:series_index":
+				dropped[i] = true
+			}
+		}
+		if dropped[i] {
+			if id := child.attrValue("id"); id != "" {
+				droppedIDs[id] = true
+			}
+		}
+	}
+	for changed := true; changed; {
+		changed = false
+		for i, child := range children {
+			refines := strings.TrimPrefix(child.attrValue("refines"), "#")
+			if dropped[i] || refines == "" || !droppedIDs[refines] {
+				continue
+			}
+			dropped[i] = true
+			changed = true
+			if id := child.attrValue("id"); id != "" {
+				droppedIDs[id] = true
+			}
+		}
+	}
+	for id := range droppedIDs {
+		delete(layout.ids, id)
+	}
+
+	// Assemble the new metadata element
+	w := &metadataWriter{
+		epub3:  pkg.IsEPUB3(),
+		prefix: elementPrefix(startTag),
+		ids:    layout.ids,
+	}
+	w.write(upd, pkg)
+	indent, closingIndent := "\n    ", "\n  "
+	if first := layout.spaces[0]; isSpace(first) && strings.Contains(first, "\n") {
+		indent = first[strings.LastIndex(first, "\n"):]
+	}
+	if last := layout.spaces[len(layout.spaces)-1]; isSpace(last) && strings.Contains(last, "\n") {
+		closingIndent = last[strings.LastIndex(last, "\n"):]
+	}
+	var b bytes.Buffer
+	b.Write(opf[:layout.start])
+	b.WriteString(startTag)
+	for _, line := range w.elements {
+		b.WriteString(indent)
+		b.WriteString(line)
+	}
+	for i, child := range children {
+		if !dropped[i] {
+			b.WriteString(indent)
+			b.Write(opf[child.start:child.end])
+		}
+	}
+	for _, line := range w.metas {
+		b.WriteString(indent)
+		b.WriteString(line)
+	}
+	b.WriteString(closingIndent)
+	b.WriteString(endTag)
+	b.Write(opf[layout.end:])
+	return b.Bytes(), nil
+}
+
+// addNamespaces records the prefixes declared by attrs.
+func addNamespaces(namespaces map[string]string, attrs []xml.Attr) {
+	for _, a := range attrs {
+		if a.Name.Space == "xmlns" {
+			namespaces[a.Name.Local] = a.Value
+		}
+	}
+}
+
+// elementPrefix returns the prefix of the element a start tag opens,
+// including the colon, or an empty string.
+func elementPrefix(startTag string) string {
+	name := strings.TrimPrefix(startTag, "<")
+	if i := strings.IndexAny(name, " \t\r\n/>"); i >= 0 {
+		name = name[:i]
+	}
+	if i := strings.Index(name, ":"); i >= 0 {
+		return name[:i+1]
+	}
+	return ""
+}
+
+func isSpace(s string) bool {
+	return strings.TrimSpace(s) == ""
+}
+
+// metadataWriter renders the entries of a MetadataUpdate. Dublin Core
+// elements and EPUB 3 refinements are collected apart so refinements can
+// follow the entries that are kept.
+type metadataWriter struct {
+	epub3  bool
+	prefix string
+	ids    map[string]bool
+
+	elements []string
+	metas    []string
+}
+
+// id returns an ID starting with base that the package document does not
+// use yet.
+func (w *metadataWriter) id(base string) string {
+	id := base
+	for n := 2; w.ids[id]; n++ {
+		id = base + strconv.Itoa(n)
+	}
+	w.ids[id] = true
+	return id
+}
+
+// element renders an element with the given attributes, passed as name and
+// value pairs. Attributes with empty values are left out.
+func element(name, text string, attrs ...string) string {
+	var b strings.Builder
+	b.WriteString("<" + name)
+	for i := 0; i+1 < len(attrs); i += 2 {
+		if attrs[i+1] == "" {
+			continue
+		}
+		b.WriteString(" " + attrs[i] + `="`)
+		xml.EscapeText(&b, []byte(attrs[i+1]))
+		b.WriteString(`"`)
+	}
+	if text == "" {
+		b.WriteString("/>")
+		return b.String()
+	}
+	b.WriteString(">")
+	xml.EscapeText(&b, []byte(text))
+	b.WriteString("</" + name + ">")
+	return b.String()
+}
+
+func (w *metadataWriter) dc(local, text string, attrs ...string) {
+	w.elements = append(w.elements, element("dc:"+local, text, attrs...))
+}
+
+// refine adds an EPUB 3 meta refining the element with the given ID.
+func (w *metadataWriter) refine(id, property, value string, attrs ...string) {
+	attrs = append([]string{"refines", "#" + id, "property", property}, attrs...)
+	w.metas = append(w.metas, element(w.prefix+"meta", value, attrs...))
+}
+
+func (w *metadataWriter) write(upd *MetadataUpdate, pkg *Package) {
+	// Titles
+	if w.epub3 && upd.Subtitle != "" {
+		id := w.id("title")
+		w.dc("title", upd.Title, "id", id)
+		w.refine(id, "title-type", "main")
+		id = w.id("subtitle")
+		w.dc("title", upd.Subtitle, "id", id)
+		w.refine(id, "title-type", "subtitle")
+	} else {
+		w.dc("title", upd.Title)
+		if upd.Subtitle != "" {
+			w.dc("title", upd.Subtitle)
+		}
+	}
+
+	// Creators
+	for _, creator := range upd.Creators {
+		if creator.Name == "" {
+			continue
+		}
+		if !w.epub3 {
+			w.dc("creator", creator.Name, "opf:role", creator.Role, "opf:file-as", creator.FileAs)
+			continue
+		}
+		if creator.Role == "" && creator.FileAs == "" {
+			w.dc("creator", creator.Name)
+			continue
+		}
+		id := w.id("creator")
+		w.dc("creator", creator.Name, "id", id)
+		if creator.Role != "" {
+			w.refine(id, "role", creator.Role, "scheme", "marc:relators")
+		}
+		if creator.FileAs != "" {
+			w.refine(id, "file-as", creator.FileAs)
+		}
+	}
+
+	if upd.Language != "" {
+		w.dc("language", upd.Language)
+	}
+
+	// Identifiers, except the unique identifier which is kept
+	unique := ""
+	for _, identifier := range pkg.Metadata.Identifiers {
+		if identifier.ID == pkg.UniqueIdentifier {
+			unique = identifier.Value
+		}
+	}
+	for _, isbn := range upd.ISBNs {
+		if w.epub3 {
+			if value := "urn:isbn:" + isbn; value != unique {
+				w.dc("identifier", value)
+			}
+		} else if isbn != unique {
+			w.dc("identifier", isbn, "opf:scheme", "ISBN")
+		}
+	}
+	for _, identifier := range upd.Identifiers {
+		lower := strings.ToLower(identifier.Value)
+		if identifier.Value == "" || identifier.Value == unique || strings.EqualFold(identifier.Scheme, "ISBN") ||
+			strings.HasPrefix(lower, "urn:isbn:") || strings.HasPrefix(lower, "isbn:") {
+			continue
+		}
+		if !w.epub3 {
+			w.dc("identifier", identifier.Value, "opf:scheme", identifier.Scheme)
+			continue
+		}
+		if identifier.Scheme == "" {
+			w.dc("identifier", identifier.Value)
+			continue
+		}
+		id := w.id("identifier")
+		w.dc("identifier", identifier.Value, "id", id)
+		w.refine(id, "identifier-type", identifier.Scheme)
+	}
+
+	if !upd.PublicationDate.IsZero() {
+		date := upd.PublicationDate.Format("2006-01-02")
+		if w.epub3 {
+			w.dc("date", date)
+		} else {
+			w.dc("date", date, "opf:event", "publication")
+		}
+	}
+	if upd.Publisher != "" {
+		w.dc("publisher", upd.Publisher)
+	}
+	if upd.Description != "" {
+		w.dc("description", upd.Description)
+	}
+	for _, subject := range upd.Subjects {
+		w.dc("subject", subject)
+	}
+	if upd.Rights != "" {
+		w.dc("rights", upd.Rights)
+	}
+
+	// Series
+	position := ""
+	if upd.SeriesPosition > 0 {
+		position = strconv.FormatFloat(upd.SeriesPosition, 'f', -1, 64)
+	}
+	if upd.Series != "" && w.epub3 {
+		id := w.id("series")
+		w.metas = append(w.metas, element(w.prefix+"meta", upd.Series, "property", "belongs-to-collection", "id", id))
+		w.refine(id, "collection-type", "series")
+		if position != "" {
+			w.refine(id, "group-position", position)
+		}
+	} else if upd.Series != "" {
+		w.metas = append(w.metas, element(w.prefix+"meta", "", "name", "calibre:series", "content", upd.Series))
+		if position != "" {
+			w.metas = append(w.metas, element(w.prefix+"meta", "", "name", "calibre:series_index", "content", position))
+		}
+	}
+
+	if w.epub3 {
+		modified := upd.Modified
+		if modified.IsZero() {
+			modified = time.Now()
+		}
+		w.metas = append(w.metas, element(w.prefix+"meta", modified.UTC().Format("2006-01-02T15:04:05Z"), "property", "dcterms:modified"))
+	}
+}
+
+// Rewrite writes a copy of the container to w in which the files named in
+// replace have the given content. Files of replace the container does not
+// hold are added at the end. Other entries are copied without being
+// recompressed, so their bytes are preserved, and mimetype is written
+// first, stored and without extra field as OCF requires.
+func (r *Reader) Rewrite(w io.Writer, replace map[string][]byte) error {
+	zw := zip.NewWriter(w)
+	if err := zw.SetComment(r.Zip.Comment); err != nil {
+		return err
+	}
+
+	// The mimetype entry goes first
+	mimetype := []byte(MimeType)
+	header := &zip.FileHeader{
+		Name:               "mimetype",
+		Method:             zip.Store,
+		CRC32:              crc32.ChecksumIEEE(mimetype),
+		CompressedSize64:   uint64(len(mimetype)),
+		UncompressedSize64: uint64(len(mimetype)),
+	}
+	if f := r.files["mimetype"]; f != nil {
+		header.ModifiedTime, header.ModifiedDate = f.ModifiedTime, f.ModifiedDate
+	}
+	mw, err := zw.CreateRaw(header)
+	if err != nil {
+		return err
+	}
+	if _, err := mw.Write(mimetype); err != nil {
+		return err
+	}
+
+	written := map[string]bool{"mimetype": true}
+	for _, f := range r.Zip.File {
+		if written[f.Name] {
+			continue
+		}
+		written[f.Name] = true
+		if data, ok := replace[f.Name]; ok {
+			if err := writeZipFile(zw, &zip.FileHeader{Name: f.Name, Comment: f.Comment, Method: zip.Deflate, Modified: f.Modified}, data); err != nil {
+				return err
+			}
+			continue
+		}
+		fh := f.FileHeader
+		fw, err := zw.CreateRaw(&fh)
+		if err != nil {
+			return err
+		}
+		raw, err := f.OpenRaw()
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(fw, raw); err != nil {
+			return err
+		}
+	}
+
+	// Add the new files in a stable order
+	var added []string
+	for name := range replace {
+		if !written[name] {
+			added = append(added, name)
+		}
+	}
+	sort.Strings(added)
+	for _, name := range added {
+		if err := writeZipFile(zw, &zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Now()}, replace[name]); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+func writeZipFile(zw *zip.Writer, header *zip.FileHeader, data []byte) error {
+	fw, err := zw.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = fw.Write(data)
+	return err
+}
@@ -0,0 +1,249 @@
+package epub
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testContainer = `<?xml version="1.0"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/>
+  </rootfiles>
+</container>`
+
+const testOPF3 = `<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="uid">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:identifier id="uid">urn:uuid:0b7d6f0e-8a4c-4c55-9d3e-3f1c2a9b8e71</dc:identifier>
+    <dc:identifier>urn:isbn:9780306406157</dc:identifier>
+    <dc:title id="t1">Old Title</dc:title>
+    <meta refines="#t1" property="title-type">main</meta>
+    <dc:creator id="c1">Old Author</dc:creator>
+    <meta refines="#c1" property="role" scheme="marc:relators">aut</meta>
+    <dc:language>en</dc:language>
+    <meta name="cover" content="cover-image"/>
+    <meta property="dcterms:modified">2020-01-01T00:00:00Z</meta>
+  </metadata>
+  <manifest>
+    <item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>
+    <item id="ch1" href="ch1.xhtml" media-type="application/xhtml+xml"/>
+  </manifest>
+  <spine>
+    <itemref idref="ch1"/>
+  </spine>
+</package>`
+
+const testOPF2 = `<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="2.0" unique-identifier="uid">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:opf="http://www.idpf.org/2007/opf">
+    <dc:identifier id="uid" opf:scheme="UUID">0b7d6f0e-8a4c-4c55-9d3e-3f1c2a9b8e71</dc:identifier>
+    <dc:title>Old Title</dc:title>
+    <dc:language>en</dc:language>
+    <meta name="calibre:series" content="Old Series"/>
+  </metadata>
+  <manifest>
+    <item id="ch1" href="ch1.xhtml" media-type="application/xhtml+xml"/>
+  </manifest>
+  <spine>
+    <itemref idref="ch1"/>
+  </spine>
+</package>`
+
+// buildEPUB writes a container holding the given files after the mimetype.
+func buildEPUB(t *testing.T, files [][2]string) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store})
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(w, MimeType)
+	for _, f := range files {
+		w, err := zw.Create(f[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(w, f[1])
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// identifierValue returns the value of the identifier with the given ID.
+func identifierValue(m *Metadata, id string) string {
+	for _, identifier := range m.Identifiers {
+		if identifier.ID == id {
+			return identifier.Value
+		}
+	}
+	return ""
+}
+
+func TestRewriteMetadataEPUB3(t *testing.T) {
+	upd := &MetadataUpdate{
+		Title:           "New Title",
+		Subtitle:        "A Subtitle",
+		Language:        "id",
+		Publisher:       "Gramedia",
+		PublicationDate: time.Date(2001, 3, 5, 0, 0, 0, 0, time.UTC),
+		Creators:        []Creator{{Name: "Jane Doe", Role: "aut", FileAs: "Doe, Jane"}, {Name: "John Roe", Role: "trl"}},
+		ISBNs:           []string{"9780804429573"},
+		Identifiers:     []Identifier{{Scheme: "DOI", Value: "10.1000/182"}, {Scheme: "ISBN", Value: "9780306406157"}, {Value: ""}},
+		Subjects:        []string{"Fiction"},
+		Series:          "The Series",
+		SeriesPosition:  2.5,
+		Modified:        time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+	opf, err := RewriteMetadata([]byte(testOPF3), upd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkg, err := ParsePackage(opf, "OEBPS/content.opf")
+	if err != nil {
+		t.Fatalf("%v\n%s", err, opf)
+	}
+	m := &pkg.Metadata
+	if m.Title() != "New Title" || m.Subtitle() != "A Subtitle" || m.Language() != "id" || m.Publisher() != "Gramedia" {
+		t.Errorf("unexpected metadata %+v", m)
+	}
+	if !m.PublicationDate().Equal(upd.PublicationDate) {
+		t.Errorf("publication date = %v", m.PublicationDate())
+	}
+	if len(m.Creators) != 2 || m.Creators[0].Name != "Jane Doe" || m.Creators[0].Role != "aut" || m.Creators[0].FileAs != "Doe, Jane" || m.Creators[1].Role != "trl" {
+		t.Errorf("unexpected creators %+v", m.Creators)
+	}
+	if isbns := m.ISBNs(); len(isbns) != 1 || isbns[0] != "9780804429573" {
+		t.Errorf("ISBNs = %v", isbns)
+	}
+	if series, position := m.Series(); series != "The Series" || position != 2.5 {
+		t.Errorf("series = %q %v", series, position)
+	}
+	if m.Modified != "2024-01-02T03:04:05Z" {
+		t.Errorf("modified = %q", m.Modified)
+	}
+
+	// The unique identifier, the cover meta and everything outside the
+	// metadata are kept as they were
+	if value := identifierValue(m, "uid"); pkg.UniqueIdentifier != "uid" || value != "urn:uuid:0b7d6f0e-8a4c-4c55-9d3e-3f1c2a9b8e71" {
+		t.Errorf("unique identifier lost: %+v", m.Identifiers)
+	}
+	doi := false
+	for _, identifier := range m.Identifiers {
+		doi = doi || identifier.Value == "10.1000/182" && identifier.Scheme == "DOI"
+	}
+	if !doi {
+		t.Errorf("DOI identifier missing: %+v", m.Identifiers)
+	}
+	if !strings.Contains(string(opf), `<meta name="cover" content="cover-image"/>`) {
+		t.Errorf("cover meta lost:\n%s", opf)
+	}
+	for _, dropped := range []string{"Old Title", "Old Author", "2020-01-01", `refines="#t1"`, `refines="#c1"`} {
+		if strings.Contains(string(opf), dropped) {
+			t.Errorf("%s left in:\n%s", dropped, opf)
+		}
+	}
+	end := strings.Index(testOPF3, "</metadata>") + len("</metadata>")
+	if !strings.HasSuffix(string(opf), testOPF3[end:]) {
+		t.Errorf("content after the metadata changed:\n%s", opf)
+	}
+}
+
+func TestRewriteMetadataEPUB2(t *testing.T) {
+	opf, err := RewriteMetadata([]byte(testOPF2), &MetadataUpdate{
+		Title:          "New Title",
+		Creators:       []Creator{{Name: "Jane Doe", Role: "aut"}},
+		ISBNs:          []string{"9780804429573"},
+		Series:         "The Series",
+		SeriesPosition: 3,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`<dc:identifier opf:scheme="ISBN">9780804429573</dc:identifier>`,
+		`<dc:creator opf:role="aut">Jane Doe</dc:creator>`,
+		`<meta name="calibre:series" content="The Series"/>`,
+		`<meta name="calibre:series_index" content="3"/>`,
+		`<dc:language>en</dc:language>`,
+	} {
+		if !strings.Contains(string(opf), want) {
+			t.Errorf("%s missing:\n%s", want, opf)
+		}
+	}
+	if strings.Contains(string(opf), "Old Series") || strings.Contains(string(opf), "dcterms:modified") {
+		t.Errorf("unexpected metadata:\n%s", opf)
+	}
+	pkg, err := ParsePackage(opf, "content.opf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pkg.Metadata.Title() != "New Title" || identifierValue(&pkg.Metadata, "uid") != "0b7d6f0e-8a4c-4c55-9d3e-3f1c2a9b8e71" {
+		t.Errorf("unexpected metadata %+v", pkg.Metadata)
+	}
+}
+
+func TestRewriteMetadataPrefixConflict(t *testing.T) {
+	opf := strings.Replace(testOPF3, `xmlns:dc="http://purl.org/dc/elements/1.1/"`, `xmlns:dc="http://example.com/dc"`, 1)
+	if _, err := RewriteMetadata([]byte(opf), &MetadataUpdate{Title: "T"}); err == nil {
+		t.Error("expected an error for a rebound dc prefix")
+	}
+}
+
+func TestReaderRewrite(t *testing.T) {
+	data := buildEPUB(t, [][2]string{
+		{ContainerPath, testContainer},
+		{"OEBPS/content.opf", testOPF3},
+		{"OEBPS/ch1.xhtml", "<html><body><p>Chapter</p></body></html>"},
+	})
+	r, err := NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	opf, err := RewriteMetadata([]byte(testOPF3), &MetadataUpdate{Title: "New Title"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	err = r.Rewrite(&out, map[string][]byte{
+		r.PackagePath:     opf,
+		"OEBPS/extra.css": []byte("p {}"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rewritten, err := NewReader(bytes.NewReader(out.Bytes()), int64(out.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rewritten.Package.Metadata.Title() != "New Title" {
+		t.Errorf("title = %q", rewritten.Package.Metadata.Title())
+	}
+
+	// mimetype comes first and stored, the other entries keep their bytes
+	// and the added file comes last
+	files := rewritten.Zip.File
+	if files[0].Name != "mimetype" || files[0].Method != zip.Store || len(files[0].Extra) != 0 {
+		t.Errorf("first entry is %s, method %d", files[0].Name, files[0].Method)
+	}
+	if last := files[len(files)-1].Name; last != "OEBPS/extra.css" {
+		t.Errorf("last entry is %s", last)
+	}
+	for _, name := range []string{ContainerPath, "OEBPS/ch1.xhtml"} {
+		before, _ := r.ReadFile(name)
+		after, err := rewritten.ReadFile(name)
+		if err != nil || !bytes.Equal(before, after) {
+			t.Errorf("%s changed: %v", name, err)
+		}
+	}
+	if css, err := rewritten.ReadFile("OEBPS/extra.css"); err != nil || string(css) != "p {}" {
+		t.Errorf("extra.css = %q, %v", css, err)
+	}
+}
@@ -0,0 +1,122 @@
+package epub
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+)
+
+// OPSNamespace is the namespace of the epub:type attribute.
+const OPSNamespace = "http://www.idpf.org/2007/ops"
+
+// node is an element of a parsed XML or XHTML document.
+type node struct {
+	Name     xml.Name
+	Attr     []xml.Attr
+	Children []*node
+
+	// Text holds the character data of text nodes, which have no name.
+	Text string
+}
+
+// parseTree parses an XML document into a tree. It accepts HTML entities
+// and unclosed void elements since publications in the wild often contain
+// them.
+func parseTree(data []byte) (*node, error) {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	d.Strict = false
+	d.AutoClose = xml.HTMLAutoClose
+	d.Entity = xml.HTMLEntity
+	root := &node{}
+	stack := []*node{root}
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		parent := stack[len(stack)-1]
+		switch t := tok.(type) {
+		case xml.StartElement:
+			n := &node{Name: t.Name, Attr: t.Attr}
+			parent.Children = append(parent.Children, n)
+			stack = append(stack, n)
+		case xml.EndElement:
+			if len(stack) > 1 {
+				stack = stack[:len(stack)-1]
+			}
+		case xml.CharData:
+			parent.Children = append(parent.Children, &node{Text: string(t)})
+		}
+	}
+	return root, nil
+}
+
+// attr returns the value of the attribute with the given local name and,
+// unless space is empty, namespace.
+func (n *node) attr(space, local string) string {
+	for _, a := range n.Attr {
+		if a.Name.Local == local && (space == "" || a.Name.Space == space) {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// find returns the elements below n, in document order, for which match
+// returns true. The subtrees of matching elements are not searched.
+func (n *node) find(match func(*node) bool) []*node {
+	var found []*node
+	for _, child := range n.Children {
+		if child.Name.Local == "" {
+			continue
+		}
+		if match(child) {
+			found = append(found, child)
+			continue
+		}
+		found = append(found, child.find(match)...)
+	}
+	return found
+}
+
+// first returns the first element below n with the given local name, or
+// nil.
+func (n *node) first(local string) *node {
+	found := n.find(func(c *node) bool { return c.Name.Local == local })
+	if len(found) == 0 {
+		return nil
+	}
+	return found[0]
+}
+
+// children returns the child elements of n with the given local name.
+func (n *node) children(local string) []*node {
+	var children []*node
+	for _, child := range n.Children {
+		if child.Name.Local == local {
+			children = append(children, child)
+		}
+	}
+	return children
+}
+
+// text returns the character data below n with whitespace collapsed.
+func (n *node) text() string {
+	var b strings.Builder
+	var walk func(*node)
+	walk = func(n *node) {
+		if n.Name.Local == "" {
+			b.WriteString(n.Text)
+			b.WriteByte(' ')
+		}
+		for _, child := range n.Children {
+			walk(child)
+		}
+	}
+	walk(n)
+	return collapseSpace(b.String())
+}
@@ -0,0 +1,53 @@
+package epublib
+
+import (
+	"context"
+	"time"
+)
+
+// ErasureRequest represents a request to erase a user's personal data once
+// its grace period has passed.
+type ErasureRequest struct {
+	ID     string `json:"id"`
+	UserID string `json:"user_id"`
+
+	// Empty when the erasure was started by the retention job.
+	RequestedBy  string    `json:"requested_by"`
+	Reason       string    `json:"reason"`
+	ScheduledFor time.Time `json:"scheduled_for"`
+	CancelledAt  time.Time `json:"cancelled_at"`
+	CompletedAt  time.Time `json:"completed_at"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// IsPending reports whether the request is neither cancelled nor completed.
+func (r *ErasureRequest) IsPending() bool {
+	return r.CancelledAt.IsZero() && r.CompletedAt.IsZero()
+}
+
+// ErasureService represents a service for managing personal data erasure.
+type ErasureService interface {
+	// Creates a new erasure request.
+	// On success, the req.ID is set to the new request ID.
+	CreateErasureRequest(ctx context.Context, req *ErasureRequest) error
+
+	// Retrieves every erasure request of a user, newest first.
+	FindErasureRequestsByUserID(ctx context.Context, userID string) ([]*ErasureRequest, error)
+
+	// Retrieves the pending erasure request of a user.
+	// Returns ErrNotFound if there is none.
+	FindPendingErasureRequest(ctx context.Context, userID string) (*ErasureRequest, error)
+
+	// Retrieves pending erasure requests scheduled at or before t.
+	FindDueErasureRequests(ctx context.Context, t time.Time) ([]*ErasureRequest, error)
+
+	// Cancels a pending erasure request.
+	// Returns ErrNotFound if no pending request has the given ID.
+	CancelErasureRequest(ctx context.Context, id string) error
+
+	// Anonymizes the personal data of the request's user, removes records
+	// that only hold personal data and marks the request completed. The user
+	// and auth rows themselves are kept so references to them stay valid.
+	EraseUser(ctx context.Context, requestID string) error
+}
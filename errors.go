@@ -3,3 +3,54 @@ package epublib
 import "errors"
 
 var ErrNotFound = errors.New("not found")
+
+// ErrConflict is returned when an update or delete is attempted against a
+// stale version of an object.
+var ErrConflict = errors.New("version conflict")
+
+// ErrUsernameTaken is returned when a username is already in use or is
+// still reserved for its previous owner.
+var ErrUsernameTaken = errors.New("username is already taken")
+
+// ErrInvalidPhoneNumber is returned when a phone number cannot be
+// normalized to E.164.
+var ErrInvalidPhoneNumber = errors.New("invalid phone number")
+
+// ErrTenantTaken is returned when a tenant slug or host is already used by
+// another tenant.
+var ErrTenantTaken = errors.New("tenant slug or host is already taken")
+
+// ErrGroupCycle is returned when a group would become its own ancestor.
+var ErrGroupCycle = errors.New("group cannot be nested below itself")
+
+// ErrGroupHasSubgroups is returned when deleting a group that still has
+// subgroups.
+var ErrGroupHasSubgroups = errors.New("group has subgroups")
+
+// ErrAuthorNameTaken is returned when the name or an alias of an author
+// matches another author.
+var ErrAuthorNameTaken = errors.New("author name or alias is already used by another author")
+
+// ErrPublisherNameTaken is returned when the name or an alias of a
+// publisher matches another publisher.
+var ErrPublisherNameTaken = errors.New("publisher name or alias is already used by another publisher")
+
+// ErrSeriesNameTaken is returned when the name of a series matches another
+// series.
+var ErrSeriesNameTaken = errors.New("series name is already used by another series")
+
+// ErrCategoryCycle is returned when a category would become its own
+// ancestor.
+var ErrCategoryCycle = errors.New("category cannot be nested below itself")
+
+// ErrCategoryHasSubcategories is returned when deleting a category that
+// still has subcategories.
+var ErrCategoryHasSubcategories = errors.New("category has subcategories")
+
+// ErrCategoryNameTaken is returned when a category has the same name as a
+// sibling.
+var ErrCategoryNameTaken = errors.New("category name is already used by a sibling category")
+
+// ErrProposalReviewed is returned when reviewing a metadata proposal that
+// was already applied or rejected.
+var ErrProposalReviewed = errors.New("metadata proposal was already reviewed")
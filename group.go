@@ -0,0 +1,153 @@
+package epublib
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+type GroupKind string
+
+const (
+	ClassGroup         GroupKind = "class"
+	DepartmentGroup    GroupKind = "department"
+	ReadingCircleGroup GroupKind = "reading_circle"
+	OtherGroup         GroupKind = "other"
+)
+
+// IsValid checks if a GroupKind is valid
+func (k GroupKind) IsValid() bool {
+	switch k {
+	case ClassGroup, DepartmentGroup, ReadingCircleGroup, OtherGroup:
+		return true
+	default:
+		return false
+	}
+}
+
+// Group is a set of users, like a class or a department. Groups may be
+// nested below a parent group.
+type Group struct {
+	ID          string    `json:"id"`
+	ParentID    string    `json:"parent_id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Kind        GroupKind `json:"kind"`
+	MemberCount int       `json:"member_count"`
+	Version     int       `json:"version"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	DeletedAt   time.Time `json:"deleted_at"`
+}
+
+// Validate checks the fields of a group that clients may set.
+func (g *Group) Validate() error {
+	if g.Name == "" || len(g.Name) > 100 {
+		return fmt.Errorf("name must be between 1 and 100 characters")
+	}
+	if len(g.Description) > 1000 {
+		return fmt.Errorf("description must be at most 1000 characters")
+	}
+	if !g.Kind.IsValid() {
+		return fmt.Errorf("kind must be one of class, department, reading_circle or other")
+	}
+	return nil
+}
+
+type GroupRole string
+
+const (
+	// GroupAdminRole manages the group's members and subgroups.
+	GroupAdminRole  GroupRole = "admin"
+	GroupMemberRole GroupRole = "member"
+)
+
+// IsValid checks if a GroupRole is valid
+func (r GroupRole) IsValid() bool {
+	return r == GroupAdminRole || r == GroupMemberRole
+}
+
+// GroupMember is the membership of a user in a group.
+type GroupMember struct {
+	GroupID   string    `json:"group_id"`
+	UserID    string    `json:"user_id"`
+	Role      GroupRole `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// Set when listing members of a group.
+	User *User `json:"user,omitempty"`
+
+	// Set when listing groups of a user.
+	Group *Group `json:"group,omitempty"`
+}
+
+// GroupService represents a service for managing groups and their members.
+type GroupService interface {
+	// Retrieves a non-deleted group by ID.
+	FindGroupByID(ctx context.Context, id string) (*Group, error)
+
+	// Retrieves a list of groups by filter. Also returns total count of
+	// matching groups which may differ from returned results if filter.Limit
+	// is specified.
+	FindGroups(ctx context.Context, filter GroupFilter) ([]*Group, int, error)
+
+	// Creates a new group. Returns ErrNotFound if the parent does not exist.
+	CreateGroup(ctx context.Context, group *Group) error
+
+	// Updates a group. If upd.Version is set, the update is only applied when
+	// it matches the current version, otherwise ErrConflict is returned.
+	// Returns ErrGroupCycle if the new parent is the group or one of its
+	// subgroups.
+	UpdateGroup(ctx context.Context, id string, upd GroupUpdate) (*Group, error)
+
+	// Soft deletes a group along with its memberships. Returns
+	// ErrGroupHasSubgroups if it still has subgroups.
+	DeleteGroup(ctx context.Context, id string, version int) error
+
+	// Retrieves the members of a group, including the members of its
+	// subgroups if recursive is set. Users in several of those groups are
+	// listed once with their highest role.
+	FindGroupMembers(ctx context.Context, groupID string, recursive bool) ([]*GroupMember, error)
+
+	// Retrieves the groups a user is a direct member of.
+	FindUserGroups(ctx context.Context, userID string) ([]*GroupMember, error)
+
+	// Adds a user to a group or changes its role.
+	SetGroupMember(ctx context.Context, member *GroupMember) error
+
+	// Removes a user from a group.
+	RemoveGroupMember(ctx context.Context, groupID, userID string) error
+
+	// Reports whether a user is admin of the group or of one of its
+	// ancestors.
+	IsGroupAdmin(ctx context.Context, groupID, userID string) (bool, error)
+}
+
+// MaxGroupPageSize caps GroupFilter.Limit.
+const MaxGroupPageSize = 100
+
+// GroupFilter represents a filter passed to FindGroups().
+type GroupFilter struct {
+	// Filtering fields. Name matches case-insensitive substrings. ParentID
+	// lists the subgroups of a group, RootOnly the groups without parent.
+	Name     string    `json:"name"`
+	Kind     GroupKind `json:"kind"`
+	ParentID string    `json:"parent_id"`
+	RootOnly bool      `json:"root_only"`
+
+	// Restrict to subset of results.
+	Offset int `json:"offset"`
+	Limit  int `json:"limit"`
+}
+
+// GroupUpdate represents a set of fields to be updated via UpdateGroup().
+type GroupUpdate struct {
+	ParentID    string    `json:"parent_id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Kind        GroupKind `json:"kind"`
+
+	// Expected current version of the group, zero skips the check.
+	Version int `json:"-"`
+}
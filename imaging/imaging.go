@@ -0,0 +1,164 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"io"
+	"net/http"
+
+	// Register decoders for the formats accepted by Decode.
+	_ "image/gif"
+	_ "image/png"
+)
+
+// ErrUnsupportedFormat is returned when sniffed content is not a supported image.
+var ErrUnsupportedFormat = errors.New("unsupported image format")
+
+// ErrImageTooLarge is returned when an image declares dimensions beyond
+// MaxDimension or MaxPixels.
+var ErrImageTooLarge = errors.New("image dimensions are too large")
+
+// Limits on the declared size of decoded images. Decoders allocate the
+// whole image up front, so a small file declaring huge dimensions would
+// otherwise exhaust memory before any pixel is read.
+const (
+	MaxDimension = 8000
+	MaxPixels    = 40_000_000
+)
+
+// SupportedContentTypes lists the image content types accepted by Decode.
+var SupportedContentTypes = []string{"image/jpeg", "image/png", "image/gif"}
+
+// SniffContentType detects the content type of data using at most its first 512 bytes.
+func SniffContentType(data []byte) string {
+	return http.DetectContentType(data)
+}
+
+// IsSupportedContentType reports whether contentType can be decoded.
+func IsSupportedContentType(contentType string) bool {
+	for _, supported := range SupportedContentTypes {
+		if contentType == supported {
+			return true
+		}
+	}
+	return false
+}
+
+// Decode sniffs and decodes an image, rejecting any format outside
+// SupportedContentTypes regardless of what the client claimed it was, and
+// any image larger than MaxDimension or MaxPixels before decoding it.
+func Decode(data []byte) (image.Image, string, error) {
+	contentType := SniffContentType(data)
+	if !IsSupportedContentType(contentType) {
+		return nil, contentType, ErrUnsupportedFormat
+	}
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, contentType, err
+	}
+	if config.Width > MaxDimension || config.Height > MaxDimension || config.Width*config.Height > MaxPixels {
+		return nil, contentType, ErrImageTooLarge
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, contentType, err
+	}
+	return img, contentType, nil
+}
+
+// CropSquare returns the largest square centred in img.
+func CropSquare(img image.Image) image.Image {
+	b := img.Bounds()
+	side := b.Dx()
+	if b.Dy() < side {
+		side = b.Dy()
+	}
+	x0 := b.Min.X + (b.Dx()-side)/2
+	y0 := b.Min.Y + (b.Dy()-side)/2
+	dst := image.NewRGBA(image.Rect(0, 0, side, side))
+	draw.Draw(dst, dst.Bounds(), img, image.Pt(x0, y0), draw.Src)
+	return dst
+}
+
+// Fit scales img down so that it fits within maxWidth x maxHeight while
+// keeping its aspect ratio. Images that already fit are returned unchanged.
+func Fit(img image.Image, maxWidth, maxHeight int) image.Image {
+	b := img.Bounds()
+	if b.Dx() <= maxWidth && b.Dy() <= maxHeight {
+		return img
+	}
+	width, height := maxWidth, b.Dy()*maxWidth/b.Dx()
+	if height > maxHeight {
+		width, height = b.Dx()*maxHeight/b.Dy(), maxHeight
+	}
+	if width < 1 {
+		width = 1
+	}
+	if height < 1 {
+		height = 1
+	}
+	return Resize(img, width, height)
+}
+
+// Resize scales img to exactly width x height. Each destination pixel is the
+// average of the source pixels it covers, which gives clean downscaling
+// without any third party dependency. Upscaling falls back to nearest pixel.
+func Resize(img image.Image, width, height int) *image.RGBA {
+	src := toRGBA(img)
+	sw, sh := src.Bounds().Dx(), src.Bounds().Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		sy0 := y * sh / height
+		sy1 := (y + 1) * sh / height
+		if sy1 <= sy0 {
+			sy1 = sy0 + 1
+		}
+		for x := 0; x < width; x++ {
+			sx0 := x * sw / width
+			sx1 := (x + 1) * sw / width
+			if sx1 <= sx0 {
+				sx1 = sx0 + 1
+			}
+			var r, g, b, a, n uint32
+			for sy := sy0; sy < sy1; sy++ {
+				off := src.PixOffset(sx0, sy)
+				for sx := sx0; sx < sx1; sx++ {
+					r += uint32(src.Pix[off])
+					g += uint32(src.Pix[off+1])
+					b += uint32(src.Pix[off+2])
+					a += uint32(src.Pix[off+3])
+					off += 4
+					n++
+				}
+			}
+			off := dst.PixOffset(x, y)
+			dst.Pix[off] = uint8(r / n)
+			dst.Pix[off+1] = uint8(g / n)
+			dst.Pix[off+2] = uint8(b / n)
+			dst.Pix[off+3] = uint8(a / n)
+		}
+	}
+	return dst
+}
+
+// EncodeJPEG writes img as a JPEG. Transparent areas are flattened onto white.
+func EncodeJPEG(w io.Writer, img image.Image, quality int) error {
+	flat := image.NewRGBA(img.Bounds())
+	draw.Draw(flat, flat.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(flat, flat.Bounds(), img, img.Bounds().Min, draw.Over)
+	return jpeg.Encode(w, flat, &jpeg.Options{Quality: quality})
+}
+
+// toRGBA returns img as an *image.RGBA anchored at the origin.
+func toRGBA(img image.Image) *image.RGBA {
+	if rgba, ok := img.(*image.RGBA); ok && rgba.Bounds().Min == (image.Point{}) {
+		return rgba
+	}
+	b := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), img, b.Min, draw.Src)
+	return rgba
+}
@@ -0,0 +1,357 @@
+package imaging
+
+import (
+	"container/heap"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/draw"
+	"io"
+)
+
+// maxWebPDimension is the largest width or height a WebP image can have.
+const maxWebPDimension = 1 << 14
+
+// webpPredictorBits is the log2 of the block size of the predictor
+// transform. Every block uses the same predictor, so the blocks are as
+// large as the format allows.
+const webpPredictorBits = 9
+
+// webpPredictor is the predictor applied to every pixel not on the top row
+// or the left column: the average of the left and top pixels.
+const webpPredictor = 7
+
+// codeLengthOrder is the order in which the lengths of the code length code
+// are stored.
+var codeLengthOrder = [19]int{17, 18, 0, 1, 2, 3, 4, 5, 16, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+
+// EncodeWebP writes img as a lossless WebP. Neither the standard library nor
+// golang.org/x/image encode WebP, so this is a small VP8L encoder using the
+// subtract green and predictor transforms and plain prefix codes, without
+// backward references. Files are larger than what libwebp produces but
+// decode in every WebP capable client.
+func EncodeWebP(w io.Writer, img image.Image) error {
+	b := img.Bounds()
+	width, height := b.Dx(), b.Dy()
+	if width < 1 || height < 1 || width > maxWebPDimension || height > maxWebPDimension {
+		return errors.New("imaging: image size not supported by WebP")
+	}
+
+	// WebP stores straight alpha, unlike image.RGBA
+	src := image.NewNRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(src, src.Bounds(), img, b.Min, draw.Src)
+	pixels := make([]uint32, width*height)
+	alphaUsed := false
+	for i := range pixels {
+		p := src.Pix[i*4 : i*4+4]
+		r, g, bl, a := uint32(p[0]), uint32(p[1]), uint32(p[2]), uint32(p[3])
+		if a != 0xff {
+			alphaUsed = true
+		}
+		// Subtract green transform
+		pixels[i] = a<<24 | ((r-g)&0xff)<<16 | g<<8 | (bl-g)&0xff
+	}
+	residuals := predict(pixels, width, height)
+
+	bw := &bitWriter{}
+	bw.writeBits(0x2f, 8)
+	bw.writeBits(uint32(width-1), 14)
+	bw.writeBits(uint32(height-1), 14)
+	if alphaUsed {
+		bw.writeBits(1, 1)
+	} else {
+		bw.writeBits(0, 1)
+	}
+	bw.writeBits(0, 3)
+
+	// Transforms are listed in the order they were applied
+	bw.writeBits(1, 1)
+	bw.writeBits(2, 2)
+	bw.writeBits(1, 1)
+	bw.writeBits(0, 2)
+	bw.writeBits(webpPredictorBits-2, 3)
+	blocksX := (width + 1<<webpPredictorBits - 1) >> webpPredictorBits
+	blocksY := (height + 1<<webpPredictorBits - 1) >> webpPredictorBits
+	modes := make([]uint32, blocksX*blocksY)
+	for i := range modes {
+		modes[i] = 0xff000000 | webpPredictor<<8
+	}
+	writeEntropyCodedImage(bw, modes, false)
+	bw.writeBits(0, 1)
+	writeEntropyCodedImage(bw, residuals, true)
+	data := bw.bytes()
+
+	// RIFF container with a single VP8L chunk, padded to an even size
+	padded := len(data) + len(data)&1
+	header := make([]byte, 20)
+	copy(header[0:], "RIFF")
+	binary.LittleEndian.PutUint32(header[4:], uint32(12+padded))
+	copy(header[8:], "WEBPVP8L")
+	binary.LittleEndian.PutUint32(header[16:], uint32(len(data)))
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	if len(data) != padded {
+		data = append(data, 0)
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+// predict returns the residuals of the predictor transform: every channel
+// of a pixel minus the same channel of its prediction, modulo 256.
+func predict(pixels []uint32, width, height int) []uint32 {
+	residuals := make([]uint32, len(pixels))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			i := y*width + x
+			var prediction uint32
+			switch {
+			case x == 0 && y == 0:
+				prediction = 0xff000000
+			case y == 0:
+				prediction = pixels[i-1]
+			case x == 0:
+				prediction = pixels[i-width]
+			default:
+				prediction = average2(pixels[i-1], pixels[i-width])
+			}
+			residuals[i] = subPixels(pixels[i], prediction)
+		}
+	}
+	return residuals
+}
+
+func average2(a, b uint32) uint32 {
+	return (((a ^ b) & 0xfefefefe) >> 1) + (a & b)
+}
+
+func subPixels(a, b uint32) uint32 {
+	// The 0xff bytes between the channels absorb the borrows
+	alphaGreen := 0x00ff00ff + (a & 0xff00ff00) - (b & 0xff00ff00)
+	redBlue := 0xff00ff00 + (a & 0x00ff00ff) - (b & 0x00ff00ff)
+	return alphaGreen&0xff00ff00 | redBlue&0x00ff00ff
+}
+
+// writeEntropyCodedImage writes pixels with one set of prefix codes and no
+// color cache. main tells whether this is the main image, which also
+// signals the absence of a meta prefix code image.
+func writeEntropyCodedImage(bw *bitWriter, pixels []uint32, main bool) {
+	bw.writeBits(0, 1)
+	if main {
+		bw.writeBits(0, 1)
+	}
+
+	// Green also holds the length prefixes and red, blue, alpha follow it
+	// in that order, the fifth code is for distances
+	histograms := [4][]int{make([]int, 256+24), make([]int, 256), make([]int, 256), make([]int, 256)}
+	for _, p := range pixels {
+		histograms[0][p>>8&0xff]++
+		histograms[1][p>>16&0xff]++
+		histograms[2][p&0xff]++
+		histograms[3][p>>24]++
+	}
+	var codes [4]prefixCode
+	for i, histogram := range histograms {
+		codes[i] = writePrefixCode(bw, histogram)
+	}
+	writePrefixCode(bw, make([]int, 40))
+	for _, p := range pixels {
+		codes[0].write(bw, int(p>>8&0xff))
+		codes[1].write(bw, int(p>>16&0xff))
+		codes[2].write(bw, int(p&0xff))
+		codes[3].write(bw, int(p>>24))
+	}
+}
+
+// prefixCode holds the code length and bit reversed code of each symbol.
+type prefixCode struct {
+	lengths []int
+	codes   []uint32
+}
+
+func (c prefixCode) write(bw *bitWriter, symbol int) {
+	if c.lengths[symbol] > 0 {
+		bw.writeBits(c.codes[symbol], uint(c.lengths[symbol]))
+	}
+}
+
+// writePrefixCode builds a prefix code for histogram and writes its
+// description. A code with a single symbol takes no bits per symbol.
+func writePrefixCode(bw *bitWriter, histogram []int) prefixCode {
+	used := []int{}
+	for symbol, n := range histogram {
+		if n > 0 {
+			used = append(used, symbol)
+		}
+	}
+	if len(used) <= 1 {
+		symbol := 0
+		if len(used) == 1 {
+			symbol = used[0]
+		}
+		// Simple code with one symbol; all symbols here are below 256
+		bw.writeBits(1, 1)
+		bw.writeBits(0, 1)
+		if symbol <= 1 {
+			bw.writeBits(0, 1)
+			bw.writeBits(uint32(symbol), 1)
+		} else {
+			bw.writeBits(1, 1)
+			bw.writeBits(uint32(symbol), 8)
+		}
+		return prefixCode{lengths: make([]int, len(histogram))}
+	}
+
+	// Normal code, its code lengths are themselves prefix coded with
+	// literal lengths only
+	lengths := huffmanLengths(histogram, 15)
+	lengthHistogram := make([]int, 19)
+	for _, length := range lengths {
+		lengthHistogram[length]++
+	}
+	distinct := 0
+	for _, n := range lengthHistogram {
+		if n > 0 {
+			distinct++
+		}
+	}
+	if distinct == 1 {
+		// A code needs two symbols to take any bits
+		if lengthHistogram[0] == 0 {
+			lengthHistogram[0] = 1
+		} else {
+			lengthHistogram[1] = 1
+		}
+	}
+	lengthCode := prefixCode{lengths: huffmanLengths(lengthHistogram, 7)}
+	lengthCode.codes = canonicalCodes(lengthCode.lengths)
+	bw.writeBits(0, 1)
+	bw.writeBits(19-4, 4)
+	for _, symbol := range codeLengthOrder {
+		bw.writeBits(uint32(lengthCode.lengths[symbol]), 3)
+	}
+	bw.writeBits(0, 1)
+	for _, length := range lengths {
+		lengthCode.write(bw, length)
+	}
+	return prefixCode{lengths: lengths, codes: canonicalCodes(lengths)}
+}
+
+// huffmanLengths returns Huffman code lengths of at most maxLength bits for
+// a histogram with at least two used symbols. Deeper trees are avoided by
+// flattening the histogram until the code fits.
+func huffmanLengths(histogram []int, maxLength int) []int {
+	counts := append([]int(nil), histogram...)
+	for {
+		lengths := make([]int, len(counts))
+		h := &huffmanHeap{}
+		for symbol, n := range counts {
+			if n > 0 {
+				*h = append(*h, &huffmanNode{weight: n, symbols: []int{symbol}})
+			}
+		}
+		heap.Init(h)
+		for h.Len() > 1 {
+			a := heap.Pop(h).(*huffmanNode)
+			b := heap.Pop(h).(*huffmanNode)
+			for _, symbol := range a.symbols {
+				lengths[symbol]++
+			}
+			for _, symbol := range b.symbols {
+				lengths[symbol]++
+			}
+			heap.Push(h, &huffmanNode{weight: a.weight + b.weight, symbols: append(a.symbols, b.symbols...)})
+		}
+		fits := true
+		for _, length := range lengths {
+			if length > maxLength {
+				fits = false
+			}
+		}
+		if fits {
+			return lengths
+		}
+		for symbol, n := range counts {
+			if n > 0 {
+				counts[symbol] = (n + 1) / 2
+			}
+		}
+	}
+}
+
+type huffmanNode struct {
+	weight  int
+	symbols []int
+}
+
+type huffmanHeap []*huffmanNode
+
+func (h huffmanHeap) Len() int            { return len(h) }
+func (h huffmanHeap) Less(i, j int) bool  { return h[i].weight < h[j].weight }
+func (h huffmanHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *huffmanHeap) Push(x interface{}) { *h = append(*h, x.(*huffmanNode)) }
+func (h *huffmanHeap) Pop() interface{} {
+	old := *h
+	n := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return n
+}
+
+// canonicalCodes assigns canonical codes to lengths, as in DEFLATE, and
+// returns them bit reversed since the bit stream is least significant bit
+// first.
+func canonicalCodes(lengths []int) []uint32 {
+	var count [16]uint32
+	for _, length := range lengths {
+		if length > 0 {
+			count[length]++
+		}
+	}
+	var next [16]uint32
+	code := uint32(0)
+	for length := 1; length < 16; length++ {
+		code = (code + count[length-1]) << 1
+		next[length] = code
+	}
+	codes := make([]uint32, len(lengths))
+	for symbol, length := range lengths {
+		if length == 0 {
+			continue
+		}
+		c := next[length]
+		next[length]++
+		var reversed uint32
+		for i := 0; i < length; i++ {
+			reversed = reversed<<1 | c>>i&1
+		}
+		codes[symbol] = reversed
+	}
+	return codes
+}
+
+// bitWriter packs bits least significant bit first.
+type bitWriter struct {
+	buf   []byte
+	acc   uint64
+	nbits uint
+}
+
+func (bw *bitWriter) writeBits(v uint32, n uint) {
+	bw.acc |= uint64(v) << bw.nbits
+	bw.nbits += n
+	for bw.nbits >= 8 {
+		bw.buf = append(bw.buf, byte(bw.acc))
+		bw.acc >>= 8
+		bw.nbits -= 8
+	}
+}
+
+func (bw *bitWriter) bytes() []byte {
+	if bw.nbits > 0 {
+		bw.buf = append(bw.buf, byte(bw.acc))
+		bw.acc = 0
+		bw.nbits = 0
+	}
+	return bw.buf
+}
@@ -1,6 +1,7 @@
 package http
 
 import (
+	"context"
 	"encoding/json"
 	"epublib"
 	"fmt"
@@ -14,7 +15,9 @@ import (
 )
 
 type LoginRequest struct {
+	// Either Email or Username identifies the account.
 	Email    string `json:"email"`
+	Username string `json:"username"`
 	Password string `json:"password"`
 }
 type LoginResponseData struct {
@@ -33,7 +36,22 @@ func (api *API) handleLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	ctx := r.Context()
-	auth, err := api.AuthService.FindAuthByEmailPass(ctx, payload.Email, payload.Password)
+
+	// Passwords are salted with the email, so resolve it from the username first
+	email := payload.Email
+	if email == "" && payload.Username != "" {
+		auth, err := api.AuthService.FindAuthByUsername(ctx, payload.Username)
+		if err != nil {
+			if err == epublib.ErrNotFound {
+				api.httpGeneralWrite(http.StatusForbidden, "Incorrect username or password", nil, w)
+				return
+			}
+			api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+			return
+		}
+		email = auth.Email
+	}
+	auth, err := api.AuthService.FindAuthByEmailPass(ctx, email, payload.Password)
 	if err != nil {
 		if err == epublib.ErrNotFound {
 			api.httpGeneralWrite(http.StatusForbidden, "Incorrect email or password", nil, w)
@@ -52,7 +70,7 @@ func (api *API) handleLogin(w http.ResponseWriter, r *http.Request) {
 		Username: auth.Username,
 		Level:    auth.Level.String(),
 	}
-	response.Token, err = createJWT(auth.UserID, 24*time.Hour)
+	response.Token, err = createJWT(auth.UserID, epublib.TenantIDFromContext(ctx), 24*time.Hour)
 	if err != nil {
 		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
 		return
@@ -60,6 +78,56 @@ func (api *API) handleLogin(w http.ResponseWriter, r *http.Request) {
 	api.httpGeneralWrite(http.StatusOK, "Success", response, w)
 }
 
+// isAdmin reports whether the current user has admin or super admin level.
+func (api *API) isAdmin(ctx context.Context) (bool, error) {
+	currentUser := epublib.UserFromContext(ctx)
+	if currentUser == nil {
+		return false, nil
+	}
+	currentUserAuth, err := api.AuthService.FindAuthByUserID(ctx, currentUser.ID)
+	if err != nil {
+		return false, err
+	}
+	return currentUserAuth.Level.IsAdmin(), nil
+}
+
+// isSuperAdmin reports whether the current user has super admin level.
+func (api *API) isSuperAdmin(ctx context.Context) (bool, error) {
+	currentUser := epublib.UserFromContext(ctx)
+	if currentUser == nil {
+		return false, nil
+	}
+	currentUserAuth, err := api.AuthService.FindAuthByUserID(ctx, currentUser.ID)
+	if err != nil {
+		return false, err
+	}
+	return currentUserAuth.Level == epublib.SuperAdminLevel, nil
+}
+
+// isSelfOrAdmin reports whether the current user is the user with the given
+// ID or has admin level.
+func (api *API) isSelfOrAdmin(ctx context.Context, userID string) (bool, error) {
+	if currentUserID := epublib.UserIDFromContext(ctx); currentUserID != "" && currentUserID == userID {
+		return true, nil
+	}
+	return api.isAdmin(ctx)
+}
+
+// requireAdmin writes a forbidden response with message and returns false
+// unless the current user is an admin.
+func (api *API) requireAdmin(w http.ResponseWriter, r *http.Request, message string) bool {
+	isAdmin, err := api.isAdmin(r.Context())
+	if err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return false
+	}
+	if !isAdmin {
+		api.httpGeneralWrite(http.StatusForbidden, message, nil, w)
+		return false
+	}
+	return true
+}
+
 func getJWTKey(token *jwt.Token) (interface{}, error) {
 	jwtKey := os.Getenv("JWT_KEY")
 	if jwtKey == "" {
@@ -67,7 +135,9 @@ func getJWTKey(token *jwt.Token) (interface{}, error) {
 	}
 	return []byte(jwtKey), nil
 }
-func createJWT(subject string, duration time.Duration) (string, error) {
+
+// createJWT issues a token for subject that is only accepted by tenantID.
+func createJWT(subject, tenantID string, duration time.Duration) (string, error) {
 	jwtKey, err := getJWTKey(nil)
 	if err != nil {
 		log.Println(err)
@@ -75,7 +145,7 @@ func createJWT(subject string, duration time.Duration) (string, error) {
 	}
 	now := time.Now()
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
-		Audience:  []string{"epublib"},
+		Audience:  []string{"epublib", tenantID},
 		Subject:   subject,
 		IssuedAt:  jwt.NewNumericDate(now),
 		ExpiresAt: jwt.NewNumericDate(now.Add(duration)),
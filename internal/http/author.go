@@ -0,0 +1,447 @@
+package http
+
+import (
+	"encoding/json"
+	epublib "epublib"
+	"epublib/postgres"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// authorPhotoKeyPrefix prefixes the blob keys of author photos.
+const authorPhotoKeyPrefix = "authors/"
+
+func (api *API) handleGetAuthors(w http.ResponseWriter, r *http.Request) {
+	// Construct filter based on query parameters
+	queryParams := r.URL.Query()
+	offset, _ := strconv.Atoi(queryParams.Get("offset"))
+	limit, _ := strconv.Atoi(queryParams.Get("limit"))
+	if limit <= 0 {
+		limit = 10
+	}
+	if limit > epublib.MaxAuthorPageSize {
+		limit = epublib.MaxAuthorPageSize
+	}
+	filter := epublib.AuthorFilter{
+		Name:   queryParams.Get("name"),
+		Offset: offset,
+		Limit:  limit,
+	}
+
+	// Retrieve authors from the service
+	authors, totalCount, err := api.AuthorService.FindAuthors(r.Context(), filter)
+	if err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+
+	// Prepare the response
+	response := map[string]interface{}{
+		"authors":     authors,
+		"total_count": totalCount,
+	}
+
+	// Send the response
+	api.httpGeneralWrite(http.StatusOK, "Success", response, w)
+}
+
+// findAuthor retrieves the author with the given ID and writes a not found
+// response if it does not exist.
+func (api *API) findAuthor(w http.ResponseWriter, r *http.Request, id string) (*epublib.Author, bool) {
+	author, err := api.AuthorService.FindAuthorByID(r.Context(), id)
+	if err != nil {
+		if err == epublib.ErrNotFound {
+			api.httpGeneralWrite(http.StatusNotFound, "Author not found", nil, w)
+			return nil, false
+		}
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return nil, false
+	}
+	return author, true
+}
+
+func (api *API) handleGetAuthorByID(w http.ResponseWriter, r *http.Request) {
+	// Extract author ID from the URL path
+	author, ok := api.findAuthor(w, r, mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+
+	// Prepare the response
+	response := map[string]interface{}{
+		"author": author,
+	}
+
+	// Send the response
+	w.Header().Set("ETag", versionETag(author.Version))
+	api.httpGeneralWrite(http.StatusOK, "Success", response, w)
+}
+
+// handleGetAuthorBooks lists the books an author contributed to, in any role
+// unless the role query parameter is set.
+func (api *API) handleGetAuthorBooks(w http.ResponseWriter, r *http.Request) {
+	// Extract author ID from the URL path
+	author, ok := api.findAuthor(w, r, mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+
+	// Construct filter based on query parameters
+	filter := parseBookFilter(r)
+	filter.AuthorID = author.ID
+	filter.Role = epublib.ContributorRole(r.URL.Query().Get("role"))
+	if filter.Role != "" && !filter.Role.IsValid() {
+		api.httpGeneralWrite(http.StatusBadRequest, "role must be a MARC relator code like aut", nil, w)
+		return
+	}
+	api.writeBooks(w, r, filter)
+}
+
+type CreateAuthorRequest struct {
+	Name     string   `json:"name"`
+	SortName string   `json:"sort_name"`
+	Aliases  []string `json:"aliases"`
+	Bio      string   `json:"bio"`
+}
+
+func (api *API) handleCreateAuthor(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if !api.requireAdmin(w, r, "Only admin can manage authors") {
+		return
+	}
+
+	// Parse the JSON request body into a CreateAuthorRequest struct
+	var payload CreateAuthorRequest
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		api.httpGeneralWrite(http.StatusBadRequest, "Invalid JSON payload", nil, w)
+		return
+	}
+	author := &epublib.Author{
+		Name:     strings.TrimSpace(payload.Name),
+		SortName: strings.TrimSpace(payload.SortName),
+		Aliases:  payload.Aliases,
+		Bio:      payload.Bio,
+	}
+	if author.SortName == "" {
+		author.SortName = epublib.AuthorSortName(author.Name)
+	}
+
+	// Validate the required fields
+	if err := author.Validate(); err != nil {
+		api.httpGeneralWrite(http.StatusBadRequest, err.Error(), nil, w)
+		return
+	}
+
+	// Create the author using the service
+	if err := api.AuthorService.CreateAuthor(ctx, author); err != nil {
+		if err == epublib.ErrAuthorNameTaken {
+			api.httpGeneralWrite(http.StatusConflict, err.Error(), nil, w)
+			return
+		}
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+
+	// Prepare the response
+	response := map[string]interface{}{
+		"author": author,
+	}
+
+	// Send the response
+	w.Header().Set("ETag", versionETag(author.Version))
+	api.httpGeneralWrite(http.StatusCreated, "Author created successfully", response, w)
+}
+
+// PatchAuthorRequest holds the author fields a PATCH request may change.
+// Omitted fields keep their current value.
+type PatchAuthorRequest struct {
+	Name     *string   `json:"name"`
+	SortName *string   `json:"sort_name"`
+	Aliases  *[]string `json:"aliases"`
+	Bio      *string   `json:"bio"`
+}
+
+func (api *API) handlePatchAuthor(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if !api.requireAdmin(w, r, "Only admin can manage authors") {
+		return
+	}
+	id := mux.Vars(r)["id"]
+	version, ok := api.requireIfMatch(w, r)
+	if !ok {
+		return
+	}
+	var patch PatchAuthorRequest
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		api.httpGeneralWrite(http.StatusBadRequest, "Invalid JSON payload", nil, w)
+		return
+	}
+
+	// Merge the patch onto the current author
+	author, ok := api.findAuthor(w, r, id)
+	if !ok {
+		return
+	}
+	if version != 0 && version != author.Version {
+		api.httpGeneralWrite(http.StatusPreconditionFailed, "Author was modified by another request", nil, w)
+		return
+	}
+	if patch.Name != nil {
+		author.Name = strings.TrimSpace(*patch.Name)
+	}
+	if patch.SortName != nil {
+		author.SortName = strings.TrimSpace(*patch.SortName)
+	}
+	if author.SortName == "" {
+		author.SortName = epublib.AuthorSortName(author.Name)
+	}
+	if patch.Aliases != nil {
+		author.Aliases = *patch.Aliases
+	}
+	if patch.Bio != nil {
+		author.Bio = *patch.Bio
+	}
+	if err := author.Validate(); err != nil {
+		api.httpGeneralWrite(http.StatusBadRequest, err.Error(), nil, w)
+		return
+	}
+
+	// Update the author using the service
+	author, err := api.AuthorService.UpdateAuthor(ctx, id, epublib.AuthorUpdate{
+		Name:     author.Name,
+		SortName: author.SortName,
+		Aliases:  author.Aliases,
+		Bio:      author.Bio,
+		Version:  author.Version,
+	})
+	if err != nil {
+		if err == epublib.ErrNotFound {
+			api.httpGeneralWrite(http.StatusNotFound, "Author not found", nil, w)
+			return
+		}
+		if err == epublib.ErrConflict {
+			api.httpGeneralWrite(http.StatusPreconditionFailed, "Author was modified by another request", nil, w)
+			return
+		}
+		if err == epublib.ErrAuthorNameTaken {
+			api.httpGeneralWrite(http.StatusConflict, err.Error(), nil, w)
+			return
+		}
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+
+	// Prepare the response
+	response := map[string]interface{}{
+		"author": author,
+	}
+
+	// Send the response
+	w.Header().Set("ETag", versionETag(author.Version))
+	api.httpGeneralWrite(http.StatusOK, "Author updated successfully", response, w)
+}
+
+// handleDeleteAuthor deletes an author and unlinks it from its books. The
+// creators of those books keep their names, they are linked to a new author
+// when the book is edited again.
+func (api *API) handleDeleteAuthor(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if !api.requireAdmin(w, r, "Only admin can manage authors") {
+		return
+	}
+	version, ok := api.requireIfMatch(w, r)
+	if !ok {
+		return
+	}
+
+	//Begin transaction
+	txCtx, err := postgres.BeginTx(ctx, api.db)
+	if err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	defer postgres.Rollback(txCtx)
+	if err := api.AuthorService.DeleteAuthor(txCtx, mux.Vars(r)["id"], version); err != nil {
+		if err == epublib.ErrNotFound {
+			api.httpGeneralWrite(http.StatusNotFound, "Author not found", nil, w)
+			return
+		}
+		if err == epublib.ErrConflict {
+			api.httpGeneralWrite(http.StatusPreconditionFailed, "Author was modified by another request", nil, w)
+			return
+		}
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	if err := postgres.Commit(txCtx); err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	api.httpGeneralWrite(http.StatusOK, "Author deleted successfully", nil, w)
+}
+
+type MergeAuthorsRequest struct {
+	AuthorIDs []string `json:"author_ids"`
+}
+
+// handleMergeAuthors merges duplicates into the author of the URL path,
+// which keeps its name and gains theirs as aliases.
+func (api *API) handleMergeAuthors(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if !api.requireAdmin(w, r, "Only admin can manage authors") {
+		return
+	}
+	id := mux.Vars(r)["id"]
+	var payload MergeAuthorsRequest
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		api.httpGeneralWrite(http.StatusBadRequest, "Invalid JSON payload", nil, w)
+		return
+	}
+	if len(payload.AuthorIDs) == 0 {
+		api.httpGeneralWrite(http.StatusBadRequest, "author_ids is required field", nil, w)
+		return
+	}
+	for _, otherID := range payload.AuthorIDs {
+		if otherID == id {
+			api.httpGeneralWrite(http.StatusBadRequest, "author cannot be merged into itself", nil, w)
+			return
+		}
+	}
+
+	//Begin transaction
+	txCtx, err := postgres.BeginTx(ctx, api.db)
+	if err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	defer postgres.Rollback(txCtx)
+	author, err := api.AuthorService.MergeAuthors(txCtx, id, payload.AuthorIDs)
+	if err != nil {
+		if err == epublib.ErrNotFound {
+			api.httpGeneralWrite(http.StatusNotFound, "Author not found", nil, w)
+			return
+		}
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	if err := postgres.Commit(txCtx); err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+
+	// Prepare the response
+	response := map[string]interface{}{
+		"author": author,
+	}
+
+	// Send the response
+	w.Header().Set("ETag", versionETag(author.Version))
+	api.httpGeneralWrite(http.StatusOK, "Authors merged successfully", response, w)
+}
+
+// handleGetDuplicateAuthors lists groups of authors that may be the same
+// person, for admins to merge.
+func (api *API) handleGetDuplicateAuthors(w http.ResponseWriter, r *http.Request) {
+	if !api.requireAdmin(w, r, "Only admin can manage authors") {
+		return
+	}
+
+	// Retrieve duplicates from the service
+	duplicates, err := api.AuthorService.FindDuplicateAuthors(r.Context())
+	if err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+
+	// Prepare the response
+	response := map[string]interface{}{
+		"duplicates": duplicates,
+	}
+
+	// Send the response
+	api.httpGeneralWrite(http.StatusOK, "Success", response, w)
+}
+
+func (api *API) handleUploadAuthorPhoto(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if !api.requireAdmin(w, r, "Only admin can manage authors") {
+		return
+	}
+	img, ok := api.readPicture(w, r, "photo")
+	if !ok {
+		return
+	}
+
+	// Extract author ID from the URL path
+	author, ok := api.findAuthor(w, r, mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+
+	// Store the thumbnails and point the author at them
+	photoKey, err := api.storePicture(ctx, authorPhotoKeyPrefix, img)
+	if err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	updated, err := api.AuthorService.SetAuthorPhoto(ctx, author.ID, photoKey)
+	if err != nil {
+		api.deletePicture(ctx, photoKey)
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	api.deletePicture(ctx, author.PhotoKey)
+
+	// Prepare the response
+	response := map[string]interface{}{
+		"author": updated,
+	}
+
+	// Send the response
+	w.Header().Set("ETag", versionETag(updated.Version))
+	api.httpGeneralWrite(http.StatusOK, "Photo uploaded successfully", response, w)
+}
+
+func (api *API) handleGetAuthorPhoto(w http.ResponseWriter, r *http.Request) {
+	// Extract author ID from the URL path
+	author, ok := api.findAuthor(w, r, mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+	if author.PhotoKey == "" {
+		api.httpGeneralWrite(http.StatusNotFound, "Author has no photo", nil, w)
+		return
+	}
+	api.servePicture(w, r, authorPhotoKeyPrefix, author.PhotoKey)
+}
+
+func (api *API) handleDeleteAuthorPhoto(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if !api.requireAdmin(w, r, "Only admin can manage authors") {
+		return
+	}
+
+	// Extract author ID from the URL path
+	author, ok := api.findAuthor(w, r, mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+	updated, err := api.AuthorService.SetAuthorPhoto(ctx, author.ID, "")
+	if err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	api.deletePicture(ctx, author.PhotoKey)
+
+	// Prepare the response
+	response := map[string]interface{}{
+		"author": updated,
+	}
+
+	// Send the response
+	w.Header().Set("ETag", versionETag(updated.Version))
+	api.httpGeneralWrite(http.StatusOK, "Photo deleted successfully", response, w)
+}
@@ -0,0 +1,234 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	epublib "epublib"
+	"epublib/imaging"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// avatarKeyPrefix prefixes the blob keys of uploaded avatars. img_profile
+// values starting with it are managed by the API, anything else is a
+// client supplied URL kept for backward compatibility.
+const avatarKeyPrefix = "avatars/"
+
+// defaultAvatarMaxBytes caps uploads when AVATAR_MAX_BYTES is not set.
+const defaultAvatarMaxBytes = 5 << 20
+
+// avatarSizes lists the square edge lengths, in pixels, generated for every
+// avatar. The first one is served when no size is requested.
+var avatarSizes = []int{512, 256, 128, 64}
+
+// ownsAvatar reports whether imgProfile is an uploaded avatar of userID.
+func ownsAvatar(userID, imgProfile string) bool {
+	return strings.HasPrefix(imgProfile, avatarKeyPrefix+userID+"/")
+}
+
+// avatarBlobKey returns the key of the thumbnail of the given size.
+func avatarBlobKey(imgProfile string, size int) string {
+	return fmt.Sprintf("%s/%d.jpg", imgProfile, size)
+}
+
+func avatarMaxBytes() int64 {
+	if v, err := strconv.ParseInt(os.Getenv("AVATAR_MAX_BYTES"), 10, 64); err == nil && v > 0 {
+		return v
+	}
+	return defaultAvatarMaxBytes
+}
+
+func (api *API) handleUploadAvatar(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+	ctx := r.Context()
+
+	// Users may only change their own avatar unless they are an admin
+	allowed, err := api.isSelfOrAdmin(ctx, id)
+	if err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	if !allowed {
+		api.httpGeneralWrite(http.StatusForbidden, "Only admin can change other user's avatar", nil, w)
+		return
+	}
+
+	// Read the uploaded file, enforcing the size limit on the whole body
+	maxBytes := avatarMaxBytes()
+	r.Body = http.MaxBytesReader(w, r.Body, maxBytes+1<<20)
+	file, _, err := r.FormFile("avatar")
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			api.httpGeneralWrite(http.StatusRequestEntityTooLarge, "Avatar is too large", nil, w)
+			return
+		}
+		api.httpGeneralWrite(http.StatusBadRequest, "avatar file is required field", nil, w)
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, maxBytes+1))
+	if err != nil {
+		api.httpGeneralWrite(http.StatusBadRequest, err.Error(), nil, w)
+		return
+	}
+	if int64(len(data)) > maxBytes {
+		api.httpGeneralWrite(http.StatusRequestEntityTooLarge, "Avatar is too large", nil, w)
+		return
+	}
+
+	// Decode based on the sniffed content rather than the client's claim
+	img, contentType, err := imaging.Decode(data)
+	if err != nil {
+		if err == imaging.ErrUnsupportedFormat {
+			api.httpGeneralWrite(http.StatusUnsupportedMediaType, "Unsupported image type "+contentType, nil, w)
+			return
+		}
+		api.httpGeneralWrite(http.StatusBadRequest, "Invalid image: "+err.Error(), nil, w)
+		return
+	}
+
+	user, err := api.UserService.FindUserByID(ctx, id)
+	if err != nil {
+		if err == epublib.ErrNotFound {
+			api.httpGeneralWrite(http.StatusNotFound, "User not found", nil, w)
+			return
+		}
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+
+	// Store every thumbnail under a fresh prefix so cached copies of the
+	// previous avatar never get mixed with the new one
+	token := make([]byte, 8)
+	if _, err := rand.Read(token); err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	imgProfile := avatarKeyPrefix + user.ID + "/" + hex.EncodeToString(token)
+	square := imaging.CropSquare(img)
+	for _, size := range avatarSizes {
+		var buf bytes.Buffer
+		if err := imaging.EncodeJPEG(&buf, imaging.Fit(square, size, size), 85); err != nil {
+			api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+			return
+		}
+		err := api.BlobStore.PutBlob(ctx, avatarBlobKey(imgProfile, size), &buf, int64(buf.Len()), "image/jpeg")
+		if err != nil {
+			api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+			return
+		}
+	}
+
+	updated, err := api.UserService.UpdateUser(ctx, id, epublib.UserUpdate{
+		Name:        user.Name,
+		Address:     user.Address,
+		PhoneNumber: user.PhoneNumber,
+		Gender:      user.Gender,
+		BirthDate:   user.BirthDate,
+		ImgProfile:  imgProfile,
+		Version:     user.Version,
+	})
+	if err != nil {
+		api.deleteAvatar(ctx, user.ID, imgProfile)
+		if err == epublib.ErrConflict {
+			api.httpGeneralWrite(http.StatusPreconditionFailed, "User was modified by another request", nil, w)
+			return
+		}
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	api.deleteAvatar(ctx, user.ID, user.ImgProfile)
+
+	response := map[string]interface{}{
+		"user": updated,
+	}
+	w.Header().Set("ETag", versionETag(updated.Version))
+	api.httpGeneralWrite(http.StatusOK, "Avatar uploaded successfully", response, w)
+}
+
+func (api *API) handleGetAvatar(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+	ctx := r.Context()
+
+	size := avatarSizes[0]
+	if v := r.URL.Query().Get("size"); v != "" {
+		size, _ = strconv.Atoi(v)
+		if !containsInt(avatarSizes, size) {
+			api.httpGeneralWrite(http.StatusBadRequest, fmt.Sprintf("size must be one of %v", avatarSizes), nil, w)
+			return
+		}
+	}
+
+	user, err := api.UserService.FindUserByID(ctx, id)
+	if err != nil {
+		if err == epublib.ErrNotFound {
+			api.httpGeneralWrite(http.StatusNotFound, "User not found", nil, w)
+			return
+		}
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	if !ownsAvatar(user.ID, user.ImgProfile) {
+		api.httpGeneralWrite(http.StatusNotFound, "User has no uploaded avatar", nil, w)
+		return
+	}
+
+	// The key changes on every upload, so it doubles as a validator
+	etag := `"` + strings.TrimPrefix(user.ImgProfile, avatarKeyPrefix+user.ID+"/") + "-" + strconv.Itoa(size) + `"`
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "private, max-age=300")
+	if inm := r.Header.Get("If-None-Match"); inm != "" && etagListMatches(inm, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	blob, err := api.BlobStore.GetBlob(ctx, avatarBlobKey(user.ImgProfile, size))
+	if err != nil {
+		if err == epublib.ErrNotFound {
+			api.httpGeneralWrite(http.StatusNotFound, "Avatar not found", nil, w)
+			return
+		}
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	defer blob.Close()
+	w.Header().Set("Content-Type", "image/jpeg")
+	if _, err := io.Copy(w, blob); err != nil {
+		log.Println(err)
+	}
+}
+
+// deleteAvatar removes the stored thumbnails of an uploaded avatar.
+// Failures are only logged since the user record no longer points at them.
+func (api *API) deleteAvatar(ctx context.Context, userID, imgProfile string) {
+	if !ownsAvatar(userID, imgProfile) {
+		return
+	}
+	for _, size := range avatarSizes {
+		if err := api.BlobStore.DeleteBlob(ctx, avatarBlobKey(imgProfile, size)); err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+func containsInt(values []int, v int) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,530 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	epublib "epublib"
+	"epublib/postgres"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// parseBookFilter builds a BookFilter from the query parameters of r.
+func parseBookFilter(r *http.Request) epublib.BookFilter {
+	queryParams := r.URL.Query()
+	offset, _ := strconv.Atoi(queryParams.Get("offset"))
+	limit, _ := strconv.Atoi(queryParams.Get("limit"))
+	if limit <= 0 {
+		limit = 10
+	}
+	if limit > epublib.MaxBookPageSize {
+		limit = epublib.MaxBookPageSize
+	}
+	filter := epublib.BookFilter{
+		Title:     queryParams.Get("title"),
+		Language:  queryParams.Get("language"),
+		Publisher: queryParams.Get("publisher"),
+		ISBN:      epublib.ISBN13(epublib.NormalizeISBN(queryParams.Get("isbn"))),
+		Offset:    offset,
+		Limit:     limit,
+	}
+	if status := queryParams.Get("status"); status != "" {
+		filter.Statuses = []epublib.BookStatus{epublib.BookStatus(status)}
+	}
+	return filter
+}
+
+// normalizeISBNs normalizes isbns, turning valid ISBN-10s into ISBN-13s, and
+// drops empty and duplicate entries.
+func normalizeISBNs(isbns []string) []string {
+	normalized := []string{}
+	seen := map[string]bool{}
+	for _, isbn := range isbns {
+		isbn = epublib.ISBN13(epublib.NormalizeISBN(isbn))
+		if isbn == "" || seen[isbn] {
+			continue
+		}
+		seen[isbn] = true
+		normalized = append(normalized, isbn)
+	}
+	return normalized
+}
+
+// normalizeSubjects trims subjects and drops empty and duplicate entries.
+func normalizeSubjects(subjects []string) []string {
+	normalized := []string{}
+	seen := map[string]bool{}
+	for _, subject := range subjects {
+		subject = strings.TrimSpace(subject)
+		if subject == "" || seen[strings.ToLower(subject)] {
+			continue
+		}
+		seen[strings.ToLower(subject)] = true
+		normalized = append(normalized, subject)
+	}
+	return normalized
+}
+
+// linkBookEntities links a book to the authors and the publisher its
+// creators and publisher name match, creating the missing ones.
+func (api *API) linkBookEntities(ctx context.Context, book *epublib.Book) error {
+	if err := api.PublisherService.LinkBookPublisher(ctx, book.ID, book.Publisher); err != nil {
+		return err
+	}
+	return api.AuthorService.LinkBookContributors(ctx, book.ID, book.Creators)
+}
+
+// processBookLinks links the books created before authors and publishers
+// were tracked, a page at a time.
+func (api *API) processBookLinks(ctx context.Context) error {
+	for {
+		books, _, err := api.BookService.FindBooks(ctx, epublib.BookFilter{Unlinked: true, Limit: epublib.MaxBookPageSize})
+		if err != nil {
+			return err
+		}
+		if len(books) == 0 {
+			return nil
+		}
+		for _, book := range books {
+			txCtx, err := postgres.BeginTx(ctx, api.db)
+			if err != nil {
+				return err
+			}
+			err = api.linkBookEntities(txCtx, book)
+			if err == nil {
+				err = postgres.Commit(txCtx)
+			}
+			postgres.Rollback(txCtx)
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// handleGetBooks lists the catalog. Only admins see draft and archived
+// books.
+func (api *API) handleGetBooks(w http.ResponseWriter, r *http.Request) {
+	// Construct filter based on query parameters
+	api.writeBooks(w, r, parseBookFilter(r))
+}
+
+// writeBooks sends the books matching filter, restricted to published books
+// for users other than admins.
+func (api *API) writeBooks(w http.ResponseWriter, r *http.Request, filter epublib.BookFilter) {
+	ctx := r.Context()
+	for _, status := range filter.Statuses {
+		if !status.IsValid() {
+			api.httpGeneralWrite(http.StatusBadRequest, "invalid book status", nil, w)
+			return
+		}
+	}
+	isAdmin, err := api.isAdmin(ctx)
+	if err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	if !isAdmin {
+		if len(filter.Statuses) > 0 && filter.Statuses[0] != epublib.PublishedBook {
+			api.httpGeneralWrite(http.StatusForbidden, "Only admin can list unpublished books", nil, w)
+			return
+		}
+		filter.Statuses = []epublib.BookStatus{epublib.PublishedBook}
+	}
+
+	// Retrieve books from the service
+	books, totalCount, err := api.BookService.FindBooks(ctx, filter)
+	if err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+
+	// Prepare the response
+	response := map[string]interface{}{
+		"books":       books,
+		"total_count": totalCount,
+	}
+
+	// Send the response
+	api.httpGeneralWrite(http.StatusOK, "Success", response, w)
+}
+
+// findVisibleBook retrieves the book with the given ID and writes a not
+// found response if it does not exist or the current user is not entitled
+// to read it.
+func (api *API) findVisibleBook(w http.ResponseWriter, r *http.Request, id string) (*epublib.Book, bool) {
+	ctx := r.Context()
+	book, err := api.BookService.FindBookByID(ctx, id)
+	if err != nil {
+		if err == epublib.ErrNotFound {
+			api.httpGeneralWrite(http.StatusNotFound, "Book not found", nil, w)
+			return nil, false
+		}
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return nil, false
+	}
+	allowed, err := api.canReadBook(ctx, book)
+	if err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return nil, false
+	}
+	if !allowed {
+		api.httpGeneralWrite(http.StatusNotFound, "Book not found", nil, w)
+		return nil, false
+	}
+	return book, true
+}
+
+func (api *API) handleGetBookByID(w http.ResponseWriter, r *http.Request) {
+	// Extract book ID from the URL path
+	book, ok := api.findVisibleBook(w, r, mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+
+	// Honour conditional requests so clients can revalidate cheaply
+	etag := versionETag(book.Version)
+	w.Header().Set("ETag", etag)
+	if inm := r.Header.Get("If-None-Match"); inm != "" && etagListMatches(inm, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	// Prepare the response
+	response := map[string]interface{}{
+		"book": book,
+	}
+
+	// Send the response
+	api.httpGeneralWrite(http.StatusOK, "Success", response, w)
+}
+
+type CreateBookRequest struct {
+	Title           string             `json:"title"`
+	Subtitle        string             `json:"subtitle"`
+	Language        string             `json:"language"`
+	Description     string             `json:"description"`
+	ISBNs           []string           `json:"isbns"`
+	PublicationDate time.Time          `json:"publication_date"`
+	Publisher       string             `json:"publisher"`
+	PageCount       int                `json:"page_count"`
+	Status          epublib.BookStatus `json:"status"`
+
+	Creators    []epublib.BookCreator    `json:"creators"`
+	Identifiers []epublib.BookIdentifier `json:"identifiers"`
+	Subjects    []string                 `json:"subjects"`
+	Rights      string                   `json:"rights"`
+
+	SeriesID       string  `json:"series_id"`
+	SeriesPosition float64 `json:"series_position"`
+
+	CategoryIDs []string `json:"category_ids"`
+
+	AllowScripts bool `json:"allow_scripts"`
+}
+
+func (api *API) handleCreateBook(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if !api.requireAdmin(w, r, "Only admin can manage books") {
+		return
+	}
+
+	// Parse the JSON request body into a CreateBookRequest struct
+	var payload CreateBookRequest
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		api.httpGeneralWrite(http.StatusBadRequest, "Invalid JSON payload", nil, w)
+		return
+	}
+	book := &epublib.Book{
+		Title:           payload.Title,
+		Subtitle:        payload.Subtitle,
+		Language:        payload.Language,
+		Description:     payload.Description,
+		ISBNs:           normalizeISBNs(payload.ISBNs),
+		PublicationDate: payload.PublicationDate,
+		Publisher:       payload.Publisher,
+		PageCount:       payload.PageCount,
+		Status:          payload.Status,
+		Creators:        payload.Creators,
+		Identifiers:     payload.Identifiers,
+		Subjects:        normalizeSubjects(payload.Subjects),
+		Rights:          payload.Rights,
+		SeriesID:        payload.SeriesID,
+		SeriesPosition:  payload.SeriesPosition,
+		AllowScripts:    payload.AllowScripts,
+	}
+	if book.Status == "" {
+		book.Status = epublib.DraftBook
+	}
+
+	// Validate the required fields
+	if err := book.Validate(); err != nil {
+		api.httpGeneralWrite(http.StatusBadRequest, err.Error(), nil, w)
+		return
+	}
+	if !api.checkBookSeries(w, r, book) {
+		return
+	}
+
+	//Begin transaction
+	txCtx, err := postgres.BeginTx(ctx, api.db)
+	if err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	defer postgres.Rollback(txCtx)
+
+	// Create the book using the service
+	if err := api.BookService.CreateBook(txCtx, book); err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	if err := api.linkBookEntities(txCtx, book); err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	if !api.setBookCategories(txCtx, w, book.ID, payload.CategoryIDs) {
+		return
+	}
+	book, err = api.BookService.FindBookByID(txCtx, book.ID)
+	if err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	if err := postgres.Commit(txCtx); err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+
+	// Prepare the response
+	response := map[string]interface{}{
+		"book": book,
+	}
+
+	// Send the response
+	w.Header().Set("ETag", versionETag(book.Version))
+	api.httpGeneralWrite(http.StatusCreated, "Book created successfully", response, w)
+}
+
+// PatchBookRequest holds the book fields a PATCH request may change.
+// Omitted fields keep their current value.
+type PatchBookRequest struct {
+	Title           *string             `json:"title"`
+	Subtitle        *string             `json:"subtitle"`
+	Language        *string             `json:"language"`
+	Description     *string             `json:"description"`
+	ISBNs           *[]string           `json:"isbns"`
+	PublicationDate *time.Time          `json:"publication_date"`
+	Publisher       *string             `json:"publisher"`
+	PageCount       *int                `json:"page_count"`
+	Status          *epublib.BookStatus `json:"status"`
+
+	Creators    *[]epublib.BookCreator    `json:"creators"`
+	Identifiers *[]epublib.BookIdentifier `json:"identifiers"`
+	Subjects    *[]string                 `json:"subjects"`
+	Rights      *string                   `json:"rights"`
+
+	SeriesID       *string  `json:"series_id"`
+	SeriesPosition *float64 `json:"series_position"`
+
+	CategoryIDs *[]string `json:"category_ids"`
+
+	AllowScripts *bool `json:"allow_scripts"`
+}
+
+func (api *API) handlePatchBook(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if !api.requireAdmin(w, r, "Only admin can manage books") {
+		return
+	}
+	id := mux.Vars(r)["id"]
+	version, ok := api.requireIfMatch(w, r)
+	if !ok {
+		return
+	}
+	var patch PatchBookRequest
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		api.httpGeneralWrite(http.StatusBadRequest, "Invalid JSON payload", nil, w)
+		return
+	}
+
+	// Merge the patch onto the current book
+	book, err := api.BookService.FindBookByID(ctx, id)
+	if err != nil {
+		if err == epublib.ErrNotFound {
+			api.httpGeneralWrite(http.StatusNotFound, "Book not found", nil, w)
+			return
+		}
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	if version != 0 && version != book.Version {
+		api.httpGeneralWrite(http.StatusPreconditionFailed, "Book was modified by another request", nil, w)
+		return
+	}
+	if patch.Title != nil {
+		book.Title = *patch.Title
+	}
+	if patch.Subtitle != nil {
+		book.Subtitle = *patch.Subtitle
+	}
+	previousLanguage := book.Language
+	if patch.Language != nil {
+		book.Language = *patch.Language
+	}
+	if patch.Description != nil {
+		book.Description = *patch.Description
+	}
+	if patch.ISBNs != nil {
+		book.ISBNs = normalizeISBNs(*patch.ISBNs)
+	}
+	if patch.PublicationDate != nil {
+		book.PublicationDate = *patch.PublicationDate
+	}
+	if patch.Publisher != nil {
+		book.Publisher = *patch.Publisher
+	}
+	if patch.PageCount != nil {
+		book.PageCount = *patch.PageCount
+	}
+	wasPublished := book.Status == epublib.PublishedBook
+	if patch.Status != nil {
+		book.Status = *patch.Status
+	}
+	if patch.Creators != nil {
+		book.Creators = *patch.Creators
+	}
+	if patch.Identifiers != nil {
+		book.Identifiers = *patch.Identifiers
+	}
+	if patch.Subjects != nil {
+		book.Subjects = normalizeSubjects(*patch.Subjects)
+	}
+	if patch.Rights != nil {
+		book.Rights = *patch.Rights
+	}
+	if patch.SeriesID != nil {
+		if *patch.SeriesID != book.SeriesID {
+			book.SeriesPosition = 0
+		}
+		book.SeriesID = *patch.SeriesID
+	}
+	if patch.SeriesPosition != nil {
+		book.SeriesPosition = *patch.SeriesPosition
+	}
+	if patch.AllowScripts != nil {
+		book.AllowScripts = *patch.AllowScripts
+	}
+	if err := book.Validate(); err != nil {
+		api.httpGeneralWrite(http.StatusBadRequest, err.Error(), nil, w)
+		return
+	}
+	if patch.SeriesID != nil && !api.checkBookSeries(w, r, book) {
+		return
+	}
+	if !wasPublished && !api.checkPublishable(ctx, w, book) {
+		return
+	}
+
+	//Begin transaction
+	txCtx, err := postgres.BeginTx(ctx, api.db)
+	if err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	defer postgres.Rollback(txCtx)
+	if patch.CategoryIDs != nil && !api.setBookCategories(txCtx, w, id, *patch.CategoryIDs) {
+		return
+	}
+
+	// Update the book using the service
+	book, err = api.BookService.UpdateBook(txCtx, id, epublib.BookUpdate{
+		Title:           book.Title,
+		Subtitle:        book.Subtitle,
+		Language:        book.Language,
+		Description:     book.Description,
+		ISBNs:           book.ISBNs,
+		PublicationDate: book.PublicationDate,
+		Publisher:       book.Publisher,
+		PageCount:       book.PageCount,
+		Status:          book.Status,
+		Creators:        book.Creators,
+		Identifiers:     book.Identifiers,
+		Subjects:        book.Subjects,
+		Rights:          book.Rights,
+		SeriesID:        book.SeriesID,
+		SeriesPosition:  book.SeriesPosition,
+		AllowScripts:    book.AllowScripts,
+		Version:         book.Version,
+	})
+	if err != nil {
+		if err == epublib.ErrNotFound {
+			api.httpGeneralWrite(http.StatusNotFound, "Book not found", nil, w)
+			return
+		}
+		if err == epublib.ErrConflict {
+			api.httpGeneralWrite(http.StatusPreconditionFailed, "Book was modified by another request", nil, w)
+			return
+		}
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	if patch.Creators != nil || patch.Publisher != nil {
+		if err := api.linkBookEntities(txCtx, book); err != nil {
+			api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+			return
+		}
+		if book, err = api.BookService.FindBookByID(txCtx, id); err != nil {
+			api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+			return
+		}
+	}
+	if err := postgres.Commit(txCtx); err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+
+	// Stem the indexed text according to the new language
+	if book.Language != previousLanguage {
+		if err := api.SearchService.SetBookTextLanguage(ctx, book.ID, book.Language); err != nil {
+			log.Println(err)
+		}
+	}
+
+	// Prepare the response
+	response := map[string]interface{}{
+		"book": book,
+	}
+
+	// Send the response
+	w.Header().Set("ETag", versionETag(book.Version))
+	api.httpGeneralWrite(http.StatusOK, "Book updated successfully", response, w)
+}
+
+func (api *API) handleDeleteBook(w http.ResponseWriter, r *http.Request) {
+	if !api.requireAdmin(w, r, "Only admin can manage books") {
+		return
+	}
+	version, ok := api.requireIfMatch(w, r)
+	if !ok {
+		return
+	}
+	if err := api.BookService.DeleteBook(r.Context(), mux.Vars(r)["id"], version); err != nil {
+		if err == epublib.ErrNotFound {
+			api.httpGeneralWrite(http.StatusNotFound, "Book not found", nil, w)
+			return
+		}
+		if err == epublib.ErrConflict {
+			api.httpGeneralWrite(http.StatusPreconditionFailed, "Book was modified by another request", nil, w)
+			return
+		}
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	api.httpGeneralWrite(http.StatusOK, "Book deleted successfully", nil, w)
+}
@@ -0,0 +1,160 @@
+package http
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	epublib "epublib"
+	"epublib/epub"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// canReadBook reports whether the current user is entitled to read book.
+// Published books are open to every user of the tenant, others only to
+// admins.
+func (api *API) canReadBook(ctx context.Context, book *epublib.Book) (bool, error) {
+	if book.Status == epublib.PublishedBook {
+		return true, nil
+	}
+	return api.isAdmin(ctx)
+}
+
+// cleanContentPath validates a container path requested by a client. Only
+// relative paths without dot segments are accepted, so the result can never
+// leave the container even before it is matched against the manifest.
+func cleanContentPath(p string) (string, bool) {
+	if p == "" || strings.HasPrefix(p, "/") || strings.Contains(p, "\\") || strings.ContainsRune(p, 0) {
+		return "", false
+	}
+	for _, segment := range strings.Split(p, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return "", false
+		}
+	}
+	return path.Clean(p), true
+}
+
+// handleGetBookContent streams a resource of the manifest out of the EPUB
+// file of a book, for in-browser readers. Range and conditional requests are
+// answered by http.ServeContent.
+func (api *API) handleGetBookContent(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	w.Header().Set("Content-Security-Policy", contentSecurityPolicy(false))
+	contentPath, ok := cleanContentPath(vars["path"])
+	if !ok {
+		api.httpGeneralWrite(http.StatusBadRequest, "Invalid content path", nil, w)
+		return
+	}
+
+	// Only entitled users may read the book
+	book, ok := api.findVisibleBook(w, r, vars["id"])
+	if !ok {
+		return
+	}
+	if book.FileKey == "" {
+		api.httpGeneralWrite(http.StatusNotFound, "Book has no EPUB file", nil, w)
+		return
+	}
+
+	reader, closer, err := api.openBookEPUB(ctx, book)
+	if err != nil {
+		if err == epublib.ErrNotFound {
+			api.httpGeneralWrite(http.StatusNotFound, "EPUB file not found", nil, w)
+			return
+		}
+		if errors.Is(err, epub.ErrInvalidEPUB) {
+			api.httpGeneralWrite(http.StatusUnprocessableEntity, err.Error(), nil, w)
+			return
+		}
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	defer closer.Close()
+
+	// Serve declared resources only, which also keeps META-INF private
+	item := reader.Package.ItemByPath(contentPath)
+	file := reader.File(contentPath)
+	if item == nil || file == nil {
+		api.httpGeneralWrite(http.StatusNotFound, "Resource not found", nil, w)
+		return
+	}
+	content, err := openZipEntry(reader, file)
+	if err != nil {
+		if errors.Is(err, epub.ErrInvalidEPUB) {
+			api.httpGeneralWrite(http.StatusUnprocessableEntity, err.Error(), nil, w)
+			return
+		}
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+
+	// The file key changes whenever a new file is uploaded and the CRC
+	// tells the resources of one file apart, making the tag strong
+	etag := fmt.Sprintf(`%s-%08x`, strings.TrimSuffix(bookFileETag(book), `"`), file.CRC32)
+
+	// Content documents are rewritten so publisher markup cannot run
+	// scripts or load resources the policy does not allow
+	if policy, ok := contentSanitizePolicy(book, item); ok && sanitizedMediaTypes[item.MediaType] {
+		if file.UncompressedSize64 > epub.MaxEntrySize {
+			api.httpGeneralWrite(http.StatusUnprocessableEntity, "Content document is too large to be sanitized", nil, w)
+			return
+		}
+		data, err := io.ReadAll(content)
+		if err != nil {
+			api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+			return
+		}
+		sanitized, err := epub.Sanitize(data, policy)
+		if err != nil {
+			api.httpGeneralWrite(http.StatusUnprocessableEntity, "Content document could not be sanitized: "+err.Error(), nil, w)
+			return
+		}
+		content = bytes.NewReader(sanitized)
+		etag += "-" + policyTag(policy)
+		w.Header().Set("Content-Security-Policy", contentSecurityPolicy(policy.AllowScripts))
+	} else if isScriptedContent(book, item) {
+		w.Header().Set("Content-Security-Policy", contentSecurityPolicy(true))
+	}
+
+	contentType := item.MediaType
+	if contentType == "" {
+		contentType = mime.TypeByExtension(path.Ext(contentPath))
+	}
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	w.Header().Set("ETag", etag+`"`)
+	w.Header().Set("Cache-Control", "private, max-age=3600")
+	http.ServeContent(w, r, path.Base(contentPath), file.Modified, content)
+}
+
+// openZipEntry returns a seekable reader over the uncompressed content of a
+// container entry. Stored entries are read in place, compressed ones are
+// inflated into memory since they are chapters, styles or images of modest
+// size, up to epub.MaxEntrySize.
+func openZipEntry(reader *epub.Reader, file *zip.File) (io.ReadSeeker, error) {
+	if file.Method == zip.Store {
+		offset, err := file.DataOffset()
+		if err != nil {
+			return nil, err
+		}
+		return io.NewSectionReader(reader.ReaderAt(), offset, int64(file.UncompressedSize64)), nil
+	}
+	data, err := reader.ReadFile(file.Name)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(data), nil
+}
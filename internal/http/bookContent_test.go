@@ -0,0 +1,30 @@
+package http
+
+import "testing"
+
+func TestCleanContentPath(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+		ok   bool
+	}{
+		{"OEBPS/ch1.xhtml", "OEBPS/ch1.xhtml", true},
+		{"images/cover image.jpg", "images/cover image.jpg", true},
+		{"chapter..1.xhtml", "chapter..1.xhtml", true},
+		{"", "", false},
+		{"/OEBPS/ch1.xhtml", "", false},
+		{"../secret", "", false},
+		{"OEBPS/../../secret", "", false},
+		{"OEBPS/./ch1.xhtml", "", false},
+		{"OEBPS//ch1.xhtml", "", false},
+		{"OEBPS/", "", false},
+		{"OEBPS\\ch1.xhtml", "", false},
+		{"OEBPS/ch1.xhtml\x00.png", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := cleanContentPath(tt.path)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("cleanContentPath(%q) = %q, %v, want %q, %v", tt.path, got, ok, tt.want, tt.ok)
+		}
+	}
+}
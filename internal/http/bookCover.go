@@ -0,0 +1,255 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	epublib "epublib"
+	"epublib/epub"
+	"epublib/imaging"
+	"epublib/util"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// coverKeyPrefix prefixes the blob keys of cover thumbnails.
+const coverKeyPrefix = "covers/"
+
+// coverSizes lists the widths, in pixels, of the thumbnails generated for
+// every cover. Heights follow the aspect ratio up to twice the width. The
+// first one is served when no size is requested.
+var coverSizes = []int{600, 300, 150}
+
+// coverFormat is an encoding cover thumbnails are stored in.
+type coverFormat struct {
+	name        string
+	extension   string
+	contentType string
+	encode      func(io.Writer, image.Image) error
+}
+
+// coverFormats lists the encodings of every thumbnail, the first one is
+// served to clients that do not accept the others.
+var coverFormats = []coverFormat{
+	{name: "jpeg", extension: ".jpg", contentType: "image/jpeg", encode: encodeCoverJPEG},
+	{name: "webp", extension: ".webp", contentType: "image/webp", encode: imaging.EncodeWebP},
+}
+
+func encodeCoverJPEG(w io.Writer, img image.Image) error {
+	return imaging.EncodeJPEG(w, img, 85)
+}
+
+// coverBlobKey returns the key of the thumbnail of the given size and format.
+func coverBlobKey(coverKey string, size int, format coverFormat) string {
+	return fmt.Sprintf("%s/%d%s", coverKey, size, format.extension)
+}
+
+// generateCover finds the cover image of an EPUB and stores its thumbnails
+// under a fresh key prefix, which it returns. It returns an empty key when
+// the EPUB has no cover in a format that can be decoded.
+func (api *API) generateCover(ctx context.Context, reader *epub.Reader) (string, error) {
+	item, source := reader.CoverItem()
+	if item == nil {
+		return "", nil
+	}
+	data, err := reader.ReadFile(item.Path)
+	if err != nil {
+		return "", err
+	}
+	img, contentType, err := imaging.Decode(data)
+	if err != nil {
+		log.Printf("cover %s (%s): %s: %v", item.Path, source, contentType, err)
+		return "", nil
+	}
+
+	id, err := util.NewUUID()
+	if err != nil {
+		return "", err
+	}
+	coverKey := coverKeyPrefix + id
+	for _, size := range coverSizes {
+		thumbnail := imaging.Fit(img, size, size*2)
+		for _, format := range coverFormats {
+			var buf bytes.Buffer
+			err := format.encode(&buf, thumbnail)
+			if err == nil {
+				err = api.BlobStore.PutBlob(ctx, coverBlobKey(coverKey, size, format), &buf, int64(buf.Len()), format.contentType)
+			}
+			if err != nil {
+				api.deleteCover(ctx, coverKey)
+				return "", err
+			}
+		}
+	}
+	return coverKey, nil
+}
+
+// deleteCover removes the stored thumbnails of a cover. Failures are only
+// logged since no book points at them anymore.
+func (api *API) deleteCover(ctx context.Context, coverKey string) {
+	if coverKey == "" {
+		return
+	}
+	for _, size := range coverSizes {
+		for _, format := range coverFormats {
+			if err := api.BlobStore.DeleteBlob(ctx, coverBlobKey(coverKey, size, format)); err != nil {
+				log.Println(err)
+			}
+		}
+	}
+}
+
+// negotiateCoverFormat picks the format requested with the format query
+// parameter or, lacking one, the best format the Accept header allows.
+func negotiateCoverFormat(r *http.Request) (coverFormat, bool) {
+	if name := r.URL.Query().Get("format"); name != "" {
+		for _, format := range coverFormats {
+			if format.name == name {
+				return format, true
+			}
+		}
+		return coverFormat{}, false
+	}
+	accept := r.Header.Get("Accept")
+	for _, format := range coverFormats[1:] {
+		if strings.Contains(accept, format.contentType) {
+			return format, true
+		}
+	}
+	return coverFormats[0], true
+}
+
+func (api *API) handleGetBookCover(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	// Parse the thumbnail size and format
+	size := coverSizes[0]
+	if v := r.URL.Query().Get("size"); v != "" {
+		size, _ = strconv.Atoi(v)
+		if !containsInt(coverSizes, size) {
+			api.httpGeneralWrite(http.StatusBadRequest, fmt.Sprintf("size must be one of %v", coverSizes), nil, w)
+			return
+		}
+	}
+	format, ok := negotiateCoverFormat(r)
+	if !ok {
+		api.httpGeneralWrite(http.StatusBadRequest, "format must be jpeg or webp", nil, w)
+		return
+	}
+
+	// Extract the book ID from the URL path
+	book, ok := api.findVisibleBook(w, r, mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+	if book.CoverKey == "" {
+		api.httpGeneralWrite(http.StatusNotFound, "Book has no cover", nil, w)
+		return
+	}
+
+	// The key changes whenever the cover is regenerated, so it doubles as a
+	// validator
+	etag := `"` + strings.TrimPrefix(book.CoverKey, coverKeyPrefix) + "-" + strconv.Itoa(size) + format.extension + `"`
+	w.Header().Set("Vary", "Accept")
+	if inm := r.Header.Get("If-None-Match"); inm != "" && etagListMatches(inm, etag) {
+		setCoverCacheHeaders(w, etag)
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	blob, err := api.BlobStore.GetBlob(ctx, coverBlobKey(book.CoverKey, size, format))
+	if err != nil {
+		if err == epublib.ErrNotFound {
+			api.httpGeneralWrite(http.StatusNotFound, "Cover not found", nil, w)
+			return
+		}
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	defer blob.Close()
+	setCoverCacheHeaders(w, etag)
+	w.Header().Set("Content-Type", format.contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if _, err := io.Copy(w, blob); err != nil {
+		log.Println(err)
+	}
+}
+
+// setCoverCacheHeaders lets clients keep thumbnails for a day. They stay
+// private since unpublished books are access controlled.
+func setCoverCacheHeaders(w http.ResponseWriter, etag string) {
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+}
+
+// handleRegenerateBookCover extracts the cover of a book from its EPUB file
+// again, for instance for books uploaded before covers were supported.
+func (api *API) handleRegenerateBookCover(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if !api.requireAdmin(w, r, "Only admin can manage books") {
+		return
+	}
+
+	// Extract the book ID from the URL path
+	book, err := api.BookService.FindBookByID(ctx, mux.Vars(r)["id"])
+	if err != nil {
+		if err == epublib.ErrNotFound {
+			api.httpGeneralWrite(http.StatusNotFound, "Book not found", nil, w)
+			return
+		}
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	if book.FileKey == "" {
+		api.httpGeneralWrite(http.StatusNotFound, "Book has no EPUB file", nil, w)
+		return
+	}
+	reader, closer, err := api.openBookEPUB(ctx, book)
+	if err != nil {
+		if err == epublib.ErrNotFound {
+			api.httpGeneralWrite(http.StatusNotFound, "EPUB file not found", nil, w)
+			return
+		}
+		if errors.Is(err, epub.ErrInvalidEPUB) {
+			api.httpGeneralWrite(http.StatusUnprocessableEntity, err.Error(), nil, w)
+			return
+		}
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	defer closer.Close()
+
+	// Generate the thumbnails and point the book at them
+	coverKey, err := api.generateCover(ctx, reader)
+	if err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	updated, err := api.BookService.SetBookCover(ctx, book.ID, coverKey)
+	if err != nil {
+		api.deleteCover(ctx, coverKey)
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	api.deleteCover(ctx, book.CoverKey)
+
+	// Prepare the response
+	response := map[string]interface{}{
+		"book": updated,
+	}
+
+	// Send the response
+	w.Header().Set("ETag", versionETag(updated.Version))
+	if coverKey == "" {
+		api.httpGeneralWrite(http.StatusOK, "Book has no cover", response, w)
+		return
+	}
+	api.httpGeneralWrite(http.StatusOK, "Cover generated successfully", response, w)
+}
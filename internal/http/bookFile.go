@@ -0,0 +1,217 @@
+package http
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	epublib "epublib"
+	"epublib/epub"
+	"epublib/postgres"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// metadataUpdateFromBook maps a book onto the metadata written into its
+// package document, the reverse of bookFromMetadata.
+func metadataUpdateFromBook(book *epublib.Book) *epub.MetadataUpdate {
+	upd := &epub.MetadataUpdate{
+		Title:           book.Title,
+		Subtitle:        book.Subtitle,
+		Language:        book.Language,
+		Description:     book.Description,
+		Publisher:       book.Publisher,
+		Rights:          book.Rights,
+		PublicationDate: book.PublicationDate,
+		ISBNs:           book.ISBNs,
+		Subjects:        book.Subjects,
+		Series:          book.SeriesName,
+		SeriesPosition:  book.SeriesPosition,
+		Modified:        time.Now(),
+	}
+	for _, creator := range book.Creators {
+		upd.Creators = append(upd.Creators, epub.Creator{Name: creator.Name, FileAs: creator.FileAs, Role: creator.Role})
+	}
+	for _, identifier := range book.Identifiers {
+		upd.Identifiers = append(upd.Identifiers, epub.Identifier{Scheme: identifier.Scheme, Value: identifier.Value})
+	}
+	return upd
+}
+
+// handleGetBookFile downloads the EPUB file of a book.
+func (api *API) handleGetBookFile(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	// Only entitled users may download the book
+	book, ok := api.findVisibleBook(w, r, mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+	if book.FileKey == "" {
+		api.httpGeneralWrite(http.StatusNotFound, "Book has no EPUB file", nil, w)
+		return
+	}
+	ra, file, err := api.openBookFile(ctx, book)
+	if err != nil {
+		if err == epublib.ErrNotFound {
+			api.httpGeneralWrite(http.StatusNotFound, "EPUB file not found", nil, w)
+			return
+		}
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	defer file.Close()
+
+	// Send the file, http.ServeContent answers range and conditional
+	// requests
+	setBookFileCacheHeaders(w, bookFileETag(book))
+	w.Header().Set("Content-Type", epub.MimeType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": book.Title + ".epub"}))
+	http.ServeContent(w, r, "", book.UpdatedAt, io.NewSectionReader(ra, 0, book.FileSize))
+}
+
+// handleWriteBookMetadata writes the metadata of a book into the package
+// document of its EPUB file. The rewritten file is validated again and
+// stored as a new revision, so the previous file remains available for
+// rollback.
+func (api *API) handleWriteBookMetadata(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if !api.requireAdmin(w, r, "Only admin can manage books") {
+		return
+	}
+	version, ok := api.requireIfMatch(w, r)
+	if !ok {
+		return
+	}
+
+	// Extract the book ID from the URL path
+	book, err := api.BookService.FindBookByID(ctx, mux.Vars(r)["id"])
+	if err != nil {
+		if err == epublib.ErrNotFound {
+			api.httpGeneralWrite(http.StatusNotFound, "Book not found", nil, w)
+			return
+		}
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	if version != 0 && version != book.Version {
+		api.httpGeneralWrite(http.StatusPreconditionFailed, "Book was modified by another request", nil, w)
+		return
+	}
+	if book.FileKey == "" {
+		api.httpGeneralWrite(http.StatusNotFound, "Book has no EPUB file", nil, w)
+		return
+	}
+	reader, closer, err := api.openBookEPUB(ctx, book)
+	if err != nil {
+		if err == epublib.ErrNotFound {
+			api.httpGeneralWrite(http.StatusNotFound, "EPUB file not found", nil, w)
+			return
+		}
+		if errors.Is(err, epub.ErrInvalidEPUB) {
+			api.httpGeneralWrite(http.StatusUnprocessableEntity, err.Error(), nil, w)
+			return
+		}
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	defer closer.Close()
+
+	// Regenerate the package document and copy the container around it
+	opf, err := reader.ReadFile(reader.PackagePath)
+	if err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	opf, err = epub.RewriteMetadata(opf, metadataUpdateFromBook(book))
+	if err != nil {
+		if errors.Is(err, epub.ErrInvalidEPUB) {
+			api.httpGeneralWrite(http.StatusUnprocessableEntity, err.Error(), nil, w)
+			return
+		}
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	tmp, err := os.CreateTemp("", "epublib-rewrite-*.epub")
+	if err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	hash := sha256.New()
+	if err := reader.Rewrite(io.MultiWriter(tmp, hash), map[string][]byte{reader.PackagePath: opf}); err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	size, err := tmp.Seek(0, io.SeekEnd)
+	if err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	report := validateBookFile(book.ID, tmp, size)
+	if !api.checkPublishableReport(w, book, report, "Rewritten EPUB file has validation errors and the book is published") {
+		return
+	}
+	rewritten, err := epub.NewReader(tmp, size)
+	if err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+
+	// Store the file under a fresh key before the book points at it
+	revision := &epublib.BookRevision{
+		BookID:     book.ID,
+		FileSize:   size,
+		Checksum:   hex.EncodeToString(hash.Sum(nil)),
+		UploaderID: epublib.UserIDFromContext(ctx),
+		Note:       "Metadata written from the book record",
+		Snapshot:   revisionSnapshot(rewritten),
+	}
+	revision.FileKey, err = api.storeBookFile(ctx, tmp, size)
+	if err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+
+	//Begin transaction
+	txCtx, err := postgres.BeginTx(ctx, api.db)
+	if err != nil {
+		api.deleteBookFile(ctx, revision.FileKey)
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	defer postgres.Rollback(txCtx)
+	err = api.createBookRevision(txCtx, revision, report)
+	var updated *epublib.Book
+	if err == nil {
+		updated, err = api.BookService.FindBookByID(txCtx, book.ID)
+	}
+	if err == nil {
+		err = postgres.Commit(txCtx)
+	}
+	if err != nil {
+		api.deleteBookFile(ctx, revision.FileKey)
+		if err == epublib.ErrNotFound {
+			api.httpGeneralWrite(http.StatusNotFound, "Book not found", nil, w)
+			return
+		}
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+
+	// Prepare the response
+	response := map[string]interface{}{
+		"book":       updated,
+		"revision":   revision,
+		"validation": report,
+	}
+
+	// Send the response
+	w.Header().Set("ETag", versionETag(updated.Version))
+	api.httpGeneralWrite(http.StatusOK, "Metadata written to the EPUB file successfully", response, w)
+}
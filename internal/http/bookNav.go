@@ -0,0 +1,178 @@
+package http
+
+import (
+	"context"
+	epublib "epublib"
+	"epublib/epub"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// spooledFile is a temporary copy of a blob that is removed on Close.
+type spooledFile struct {
+	*os.File
+}
+
+func (f spooledFile) Close() error {
+	defer os.Remove(f.Name())
+	return f.File.Close()
+}
+
+// nopCloser closes nothing, for readers holding no resources.
+type nopCloser struct{}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+// openBookEPUB opens the EPUB file of book. Stores able to read parts of a
+// blob are read in place, so serving a single resource only transfers the
+// zip directory, the package document and that resource. The returned
+// closer must be closed once the reader is no longer used.
+func (api *API) openBookEPUB(ctx context.Context, book *epublib.Book) (*epub.Reader, io.Closer, error) {
+	var ra io.ReaderAt
+	var file io.Closer = nopCloser{}
+	var err error
+	if store, ok := api.BlobStore.(epublib.BlobRangeStore); ok {
+		ra, err = store.OpenBlobAt(ctx, book.FileKey, book.FileSize)
+	} else {
+		ra, file, err = api.openBookFile(ctx, book)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	reader, err := epub.NewReader(ra, book.FileSize)
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	return reader, file, nil
+}
+
+// openBookFile gives random access to the EPUB file of book. Blobs that
+// already allow it are read in place, others are spooled to a temporary
+// file first. The returned closer must be closed once done reading.
+func (api *API) openBookFile(ctx context.Context, book *epublib.Book) (io.ReaderAt, io.Closer, error) {
+	blob, err := api.BlobStore.GetBlob(ctx, book.FileKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	if ra, ok := blob.(io.ReaderAt); ok {
+		return ra, blob, nil
+	}
+	tmp, err := os.CreateTemp("", "epublib-book-*.epub")
+	if err != nil {
+		blob.Close()
+		return nil, nil, err
+	}
+	_, err = io.Copy(tmp, blob)
+	blob.Close()
+	file := spooledFile{tmp}
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	return tmp, file, nil
+}
+
+// bookFileETag returns an entity tag for responses derived from the EPUB
+// file of book. File keys are never reused, so the key identifies the
+// content.
+func bookFileETag(book *epublib.Book) string {
+	return `"` + strings.TrimSuffix(path.Base(book.FileKey), path.Ext(book.FileKey)) + `"`
+}
+
+// findBookEPUB retrieves the visible book with the ID from the URL path and
+// opens its EPUB file, writing an error response on failure. It also
+// answers conditional requests, in which case it returns false as well.
+func (api *API) findBookEPUB(w http.ResponseWriter, r *http.Request) (*epublib.Book, *epub.Reader, io.Closer, bool) {
+	book, ok := api.findVisibleBook(w, r, mux.Vars(r)["id"])
+	if !ok {
+		return nil, nil, nil, false
+	}
+	if book.FileKey == "" {
+		api.httpGeneralWrite(http.StatusNotFound, "Book has no EPUB file", nil, w)
+		return nil, nil, nil, false
+	}
+	etag := bookFileETag(book)
+	if inm := r.Header.Get("If-None-Match"); inm != "" && etagListMatches(inm, etag) {
+		setBookFileCacheHeaders(w, etag)
+		w.WriteHeader(http.StatusNotModified)
+		return nil, nil, nil, false
+	}
+	reader, closer, err := api.openBookEPUB(r.Context(), book)
+	if err != nil {
+		if err == epublib.ErrNotFound {
+			api.httpGeneralWrite(http.StatusNotFound, "EPUB file not found", nil, w)
+			return nil, nil, nil, false
+		}
+		if errors.Is(err, epub.ErrInvalidEPUB) {
+			api.httpGeneralWrite(http.StatusUnprocessableEntity, err.Error(), nil, w)
+			return nil, nil, nil, false
+		}
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return nil, nil, nil, false
+	}
+	setBookFileCacheHeaders(w, etag)
+	return book, reader, closer, true
+}
+
+// setBookFileCacheHeaders lets clients cache responses derived from an EPUB
+// file. They stay private since unpublished books are access controlled.
+func setBookFileCacheHeaders(w http.ResponseWriter, etag string) {
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "private, max-age=3600")
+}
+
+func (api *API) handleGetBookTOC(w http.ResponseWriter, r *http.Request) {
+	_, reader, closer, ok := api.findBookEPUB(w, r)
+	if !ok {
+		return
+	}
+	defer closer.Close()
+
+	nav, err := reader.Navigation()
+	if err != nil {
+		if errors.Is(err, epub.ErrInvalidEPUB) {
+			api.httpGeneralWrite(http.StatusUnprocessableEntity, err.Error(), nil, w)
+			return
+		}
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+
+	// Prepare the response
+	response := map[string]interface{}{
+		"toc":        nav.TOC,
+		"page_list":  nav.PageList,
+		"landmarks":  nav.Landmarks,
+		"nav_source": nav.Source,
+	}
+
+	// Send the response
+	api.httpGeneralWrite(http.StatusOK, "Success", response, w)
+}
+
+func (api *API) handleGetBookSpine(w http.ResponseWriter, r *http.Request) {
+	_, reader, closer, ok := api.findBookEPUB(w, r)
+	if !ok {
+		return
+	}
+	defer closer.Close()
+
+	// Prepare the response
+	response := map[string]interface{}{
+		"spine":                      reader.Package.SpineItems(),
+		"page_progression_direction": reader.Package.Spine.PageProgressionDirection,
+		"manifest":                   reader.Package.Manifest,
+	}
+
+	// Send the response
+	api.httpGeneralWrite(http.StatusOK, "Success", response, w)
+}
@@ -0,0 +1,576 @@
+package http
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	epublib "epublib"
+	"epublib/epub"
+	"epublib/postgres"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// revisionSnapshot records the metadata and the reading order of an EPUB,
+// mapped like the metadata of uploaded books.
+func revisionSnapshot(reader *epub.Reader) *epublib.RevisionSnapshot {
+	m := &reader.Package.Metadata
+	book := bookFromMetadata(m)
+	series, position := m.Series()
+	snapshot := &epublib.RevisionSnapshot{
+		Version: reader.Package.Version,
+		Metadata: epublib.RevisionMetadata{
+			Title:           book.Title,
+			Subtitle:        book.Subtitle,
+			Language:        book.Language,
+			Description:     book.Description,
+			ISBNs:           book.ISBNs,
+			Identifiers:     []epublib.BookIdentifier{},
+			PublicationDate: book.PublicationDate,
+			Publisher:       book.Publisher,
+			Creators:        []epublib.BookCreator{},
+			Subjects:        book.Subjects,
+			Rights:          book.Rights,
+			Series:          truncate(series, 255),
+			SeriesPosition:  position,
+			Modified:        m.Modified,
+		},
+		Spine: []epublib.RevisionSpineItem{},
+	}
+	snapshot.Metadata.Identifiers = append(snapshot.Metadata.Identifiers, book.Identifiers...)
+	snapshot.Metadata.Creators = append(snapshot.Metadata.Creators, book.Creators...)
+	if snapshot.Metadata.Subjects == nil {
+		snapshot.Metadata.Subjects = []string{}
+	}
+	for _, item := range reader.Package.SpineItems() {
+		spineItem := epublib.RevisionSpineItem{
+			ID:        item.ID,
+			Path:      item.Path,
+			MediaType: item.MediaType,
+			Linear:    item.Linear,
+		}
+		if f := reader.File(item.Path); f != nil {
+			spineItem.Checksum = fmt.Sprintf("%08x", f.CRC32)
+		}
+		snapshot.Spine = append(snapshot.Spine, spineItem)
+	}
+	return snapshot
+}
+
+// createBookRevision makes a stored file the active revision of its book
+// and stores its validation report along.
+func (api *API) createBookRevision(ctx context.Context, revision *epublib.BookRevision, report *epublib.ValidationReport) error {
+	if err := api.BookRevisionService.CreateBookRevision(ctx, revision); err != nil {
+		return err
+	}
+	report.BookID = revision.BookID
+	if err := api.BookService.SaveValidationReport(ctx, report); err != nil {
+		return err
+	}
+	revision.Validation = report
+	return nil
+}
+
+// revisionFile returns a copy of book reading the file of revision, to open
+// it with openBookFile and openBookEPUB.
+func revisionFile(book *epublib.Book, revision *epublib.BookRevision) *epublib.Book {
+	file := *book
+	file.FileKey = revision.FileKey
+	file.FileSize = revision.FileSize
+	return &file
+}
+
+// findActiveRevision retrieves the revision a book reads, or nil if it has
+// no file.
+func (api *API) findActiveRevision(ctx context.Context, book *epublib.Book) (*epublib.BookRevision, error) {
+	if book.RevisionID == "" {
+		return nil, nil
+	}
+	revisions, _, err := api.BookRevisionService.FindBookRevisions(ctx, epublib.BookRevisionFilter{BookID: book.ID, Active: true, Limit: 1})
+	if err != nil || len(revisions) == 0 {
+		return nil, err
+	}
+	return revisions[0], nil
+}
+
+// findBookRevision retrieves the book and the revision named in the URL
+// path and writes a not found response if either does not exist.
+func (api *API) findBookRevision(w http.ResponseWriter, r *http.Request) (*epublib.Book, *epublib.BookRevision, bool) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	book, err := api.BookService.FindBookByID(ctx, vars["id"])
+	if err != nil {
+		if err == epublib.ErrNotFound {
+			api.httpGeneralWrite(http.StatusNotFound, "Book not found", nil, w)
+			return nil, nil, false
+		}
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return nil, nil, false
+	}
+	number, err := strconv.Atoi(vars["number"])
+	if err != nil || number <= 0 {
+		api.httpGeneralWrite(http.StatusNotFound, "Revision not found", nil, w)
+		return nil, nil, false
+	}
+	revision, err := api.BookRevisionService.FindBookRevision(ctx, book.ID, number)
+	if err != nil {
+		if err == epublib.ErrNotFound {
+			api.httpGeneralWrite(http.StatusNotFound, "Revision not found", nil, w)
+			return nil, nil, false
+		}
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return nil, nil, false
+	}
+	return book, revision, true
+}
+
+// handleGetBookRevisions lists the file revisions of a book, newest first.
+func (api *API) handleGetBookRevisions(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if !api.requireAdmin(w, r, "Only admin can manage books") {
+		return
+	}
+
+	// Extract the book ID from the URL path
+	book, err := api.BookService.FindBookByID(ctx, mux.Vars(r)["id"])
+	if err != nil {
+		if err == epublib.ErrNotFound {
+			api.httpGeneralWrite(http.StatusNotFound, "Book not found", nil, w)
+			return
+		}
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+
+	// Construct filter based on query parameters
+	queryParams := r.URL.Query()
+	offset, _ := strconv.Atoi(queryParams.Get("offset"))
+	limit, _ := strconv.Atoi(queryParams.Get("limit"))
+	if limit <= 0 {
+		limit = 10
+	}
+	if limit > epublib.MaxBookRevisionPageSize {
+		limit = epublib.MaxBookRevisionPageSize
+	}
+	filter := epublib.BookRevisionFilter{
+		BookID: book.ID,
+		Offset: offset,
+		Limit:  limit,
+	}
+
+	// Retrieve revisions from the service
+	revisions, totalCount, err := api.BookRevisionService.FindBookRevisions(ctx, filter)
+	if err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+
+	// Prepare the response
+	response := map[string]interface{}{
+		"revisions":   revisions,
+		"total_count": totalCount,
+	}
+
+	// Send the response
+	api.httpGeneralWrite(http.StatusOK, "Success", response, w)
+}
+
+// handleGetBookRevision retrieves a file revision of a book by number.
+func (api *API) handleGetBookRevision(w http.ResponseWriter, r *http.Request) {
+	if !api.requireAdmin(w, r, "Only admin can manage books") {
+		return
+	}
+	_, revision, ok := api.findBookRevision(w, r)
+	if !ok {
+		return
+	}
+
+	// Prepare the response
+	response := map[string]interface{}{
+		"revision": revision,
+	}
+
+	// Send the response
+	api.httpGeneralWrite(http.StatusOK, "Success", response, w)
+}
+
+// handleGetBookRevisionFile downloads the EPUB file of a revision.
+func (api *API) handleGetBookRevisionFile(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if !api.requireAdmin(w, r, "Only admin can manage books") {
+		return
+	}
+	book, revision, ok := api.findBookRevision(w, r)
+	if !ok {
+		return
+	}
+	file := revisionFile(book, revision)
+	ra, closer, err := api.openBookFile(ctx, file)
+	if err != nil {
+		if err == epublib.ErrNotFound {
+			api.httpGeneralWrite(http.StatusNotFound, "EPUB file not found", nil, w)
+			return
+		}
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	defer closer.Close()
+
+	// Send the file, http.ServeContent answers range and conditional
+	// requests
+	filename := fmt.Sprintf("%s (revision %d).epub", book.Title, revision.Number)
+	setBookFileCacheHeaders(w, bookFileETag(file))
+	w.Header().Set("Content-Type", epub.MimeType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	http.ServeContent(w, r, "", revision.CreatedAt, io.NewSectionReader(ra, 0, revision.FileSize))
+}
+
+// handleUploadBookRevision stores a corrected EPUB file as a new revision of
+// a book and makes it active. The text index and the cover follow the new
+// file, while the metadata of the book is left to the admin, who is given
+// the differences with the previously active revision.
+func (api *API) handleUploadBookRevision(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if !api.requireAdmin(w, r, "Only admin can manage books") {
+		return
+	}
+	version, ok := api.requireIfMatch(w, r)
+	if !ok {
+		return
+	}
+
+	// Extract the book ID from the URL path
+	book, err := api.BookService.FindBookByID(ctx, mux.Vars(r)["id"])
+	if err != nil {
+		if err == epublib.ErrNotFound {
+			api.httpGeneralWrite(http.StatusNotFound, "Book not found", nil, w)
+			return
+		}
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	if version != 0 && version != book.Version {
+		api.httpGeneralWrite(http.StatusPreconditionFailed, "Book was modified by another request", nil, w)
+		return
+	}
+	upload, ok := api.receiveBookFile(w, r, book.ID)
+	if !ok {
+		return
+	}
+	defer upload.Close()
+	previous, err := api.findActiveRevision(ctx, book)
+	if err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	if previous != nil && previous.Checksum == upload.checksum {
+		api.httpGeneralWrite(http.StatusConflict, "EPUB file is identical to the active revision", nil, w)
+		return
+	}
+	if !api.checkPublishableReport(w, book, upload.report, "EPUB file has validation errors and the book is published") {
+		return
+	}
+
+	// Store the file under a fresh key before the book points at it
+	revision := &epublib.BookRevision{
+		BookID:     book.ID,
+		FileSize:   upload.size,
+		Checksum:   upload.checksum,
+		UploaderID: epublib.UserIDFromContext(ctx),
+		Note:       strings.TrimSpace(r.FormValue("note")),
+		Snapshot:   revisionSnapshot(upload.reader),
+	}
+	revision.FileKey, err = api.storeBookFile(ctx, upload.file, upload.size)
+	if err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+
+	// A missing or broken cover never fails the upload
+	coverKey, err := api.generateCover(ctx, upload.reader)
+	if err != nil {
+		log.Println(err)
+	}
+
+	//Begin transaction
+	txCtx, err := postgres.BeginTx(ctx, api.db)
+	if err != nil {
+		api.deleteBookFile(ctx, revision.FileKey)
+		api.deleteCover(ctx, coverKey)
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	defer postgres.Rollback(txCtx)
+	updated, err := api.switchBookFile(txCtx, book, coverKey, bookPassages(upload.reader), func(txCtx context.Context) error {
+		return api.createBookRevision(txCtx, revision, upload.report)
+	})
+	if err == nil {
+		err = postgres.Commit(txCtx)
+	}
+	if err != nil {
+		api.deleteBookFile(ctx, revision.FileKey)
+		api.deleteCover(ctx, coverKey)
+		if err == epublib.ErrNotFound {
+			api.httpGeneralWrite(http.StatusNotFound, "Book not found", nil, w)
+			return
+		}
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	api.deleteCover(ctx, book.CoverKey)
+
+	// Prepare the response
+	response := map[string]interface{}{
+		"book":       updated,
+		"revision":   revision,
+		"validation": upload.report,
+		"diff":       nil,
+	}
+	if previous != nil && previous.Snapshot != nil {
+		response["diff"] = epublib.DiffRevisions(previous, revision)
+	}
+
+	// Send the response
+	w.Header().Set("ETag", versionETag(updated.Version))
+	api.httpGeneralWrite(http.StatusCreated, "Revision uploaded successfully", response, w)
+}
+
+// handleActivateBookRevision rolls a book back, or forward, to one of its
+// revisions. The text index and the cover follow the file.
+func (api *API) handleActivateBookRevision(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if !api.requireAdmin(w, r, "Only admin can manage books") {
+		return
+	}
+	version, ok := api.requireIfMatch(w, r)
+	if !ok {
+		return
+	}
+	book, revision, ok := api.findBookRevision(w, r)
+	if !ok {
+		return
+	}
+	if version != 0 && version != book.Version {
+		api.httpGeneralWrite(http.StatusPreconditionFailed, "Book was modified by another request", nil, w)
+		return
+	}
+	if revision.Active {
+		api.httpGeneralWrite(http.StatusConflict, "Revision is already active", nil, w)
+		return
+	}
+	if !api.checkPublishableReport(w, book, revision.Validation, "Revision has validation errors and the book is published") {
+		return
+	}
+	reader, closer, err := api.openBookEPUB(ctx, revisionFile(book, revision))
+	if err != nil {
+		if err == epublib.ErrNotFound {
+			api.httpGeneralWrite(http.StatusNotFound, "EPUB file not found", nil, w)
+			return
+		}
+		if errors.Is(err, epub.ErrInvalidEPUB) {
+			api.httpGeneralWrite(http.StatusUnprocessableEntity, err.Error(), nil, w)
+			return
+		}
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	defer closer.Close()
+
+	// A missing or broken cover never fails the rollback
+	coverKey, err := api.generateCover(ctx, reader)
+	if err != nil {
+		log.Println(err)
+	}
+
+	//Begin transaction
+	txCtx, err := postgres.BeginTx(ctx, api.db)
+	if err != nil {
+		api.deleteCover(ctx, coverKey)
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	defer postgres.Rollback(txCtx)
+	updated, err := api.switchBookFile(txCtx, book, coverKey, bookPassages(reader), func(txCtx context.Context) error {
+		_, err := api.BookRevisionService.ActivateBookRevision(txCtx, book.ID, revision.Number, version)
+		return err
+	})
+	if err == nil {
+		err = postgres.Commit(txCtx)
+	}
+	if err != nil {
+		api.deleteCover(ctx, coverKey)
+		switch err {
+		case epublib.ErrNotFound:
+			api.httpGeneralWrite(http.StatusNotFound, "Book not found", nil, w)
+		case epublib.ErrConflict:
+			api.httpGeneralWrite(http.StatusPreconditionFailed, "Book was modified by another request", nil, w)
+		default:
+			api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		}
+		return
+	}
+	api.deleteCover(ctx, book.CoverKey)
+	revision.Active = true
+
+	// Prepare the response
+	response := map[string]interface{}{
+		"book":     updated,
+		"revision": revision,
+	}
+
+	// Send the response
+	w.Header().Set("ETag", versionETag(updated.Version))
+	api.httpGeneralWrite(http.StatusOK, "Revision activated successfully", response, w)
+}
+
+// switchBookFile points book at another file with activate, then indexes
+// the text of the file and points the book at its cover.
+func (api *API) switchBookFile(ctx context.Context, book *epublib.Book, coverKey string, passages []epublib.TextPassage, activate func(context.Context) error) (*epublib.Book, error) {
+	if err := activate(ctx); err != nil {
+		return nil, err
+	}
+	if err := api.SearchService.IndexBookText(ctx, book.ID, book.Language, passages); err != nil {
+		return nil, err
+	}
+	return api.BookService.SetBookCover(ctx, book.ID, coverKey)
+}
+
+// handleDiffBookRevisions compares the metadata and the reading order of
+// two revisions of a book. The to revision defaults to the active one and
+// the from revision to the one numbered before it.
+func (api *API) handleDiffBookRevisions(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if !api.requireAdmin(w, r, "Only admin can manage books") {
+		return
+	}
+
+	// Extract the book ID from the URL path
+	book, err := api.BookService.FindBookByID(ctx, mux.Vars(r)["id"])
+	if err != nil {
+		if err == epublib.ErrNotFound {
+			api.httpGeneralWrite(http.StatusNotFound, "Book not found", nil, w)
+			return
+		}
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+
+	// Resolve the revisions to compare from the query parameters
+	to, ok := api.findRevisionParam(w, r, book, "to")
+	if !ok {
+		return
+	}
+	if to == nil {
+		to, err = api.findActiveRevision(ctx, book)
+		if err != nil {
+			api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+			return
+		}
+		if to == nil {
+			api.httpGeneralWrite(http.StatusNotFound, "Book has no EPUB file", nil, w)
+			return
+		}
+	}
+	from, ok := api.findRevisionParam(w, r, book, "from")
+	if !ok {
+		return
+	}
+	if from == nil {
+		if to.Number == 1 {
+			api.httpGeneralWrite(http.StatusBadRequest, "from is required when comparing the first revision", nil, w)
+			return
+		}
+		from, err = api.BookRevisionService.FindBookRevision(ctx, book.ID, to.Number-1)
+		if err != nil {
+			api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+			return
+		}
+	}
+	if from.Snapshot == nil || to.Snapshot == nil {
+		api.httpGeneralWrite(http.StatusConflict, "Revision contents are not computed yet", nil, w)
+		return
+	}
+
+	// Prepare the response
+	response := map[string]interface{}{
+		"diff": epublib.DiffRevisions(from, to),
+	}
+
+	// Send the response
+	api.httpGeneralWrite(http.StatusOK, "Success", response, w)
+}
+
+// findRevisionParam retrieves the revision numbered by the query parameter
+// name, or nil if it is not set. It writes an error response if the
+// revision does not exist.
+func (api *API) findRevisionParam(w http.ResponseWriter, r *http.Request, book *epublib.Book, name string) (*epublib.BookRevision, bool) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return nil, true
+	}
+	number, err := strconv.Atoi(value)
+	if err != nil || number <= 0 {
+		api.httpGeneralWrite(http.StatusBadRequest, name+" must be a revision number", nil, w)
+		return nil, false
+	}
+	revision, err := api.BookRevisionService.FindBookRevision(r.Context(), book.ID, number)
+	if err != nil {
+		if err == epublib.ErrNotFound {
+			api.httpGeneralWrite(http.StatusNotFound, "Revision not found", nil, w)
+			return nil, false
+		}
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return nil, false
+	}
+	return revision, true
+}
+
+// processRevisionContent computes the checksum and the snapshot of the
+// revisions created for files stored before revisions were tracked. Files
+// that cannot be read are skipped and retried on the next run.
+func (api *API) processRevisionContent(ctx context.Context) error {
+	offset := 0
+	for {
+		revisions, _, err := api.BookRevisionService.FindBookRevisions(ctx, epublib.BookRevisionFilter{Uncomputed: true, Offset: offset, Limit: epublib.MaxBookRevisionPageSize})
+		if err != nil {
+			return err
+		}
+		if len(revisions) == 0 {
+			return nil
+		}
+		for _, revision := range revisions {
+			if err := api.computeRevisionContent(ctx, revision); err != nil {
+				log.Printf("revision %s: %v", revision.ID, err)
+				offset++
+			}
+		}
+	}
+}
+
+// computeRevisionContent reads the file of a revision and stores its
+// checksum and snapshot.
+func (api *API) computeRevisionContent(ctx context.Context, revision *epublib.BookRevision) error {
+	file := &epublib.Book{FileKey: revision.FileKey, FileSize: revision.FileSize}
+	ra, closer, err := api.openBookFile(ctx, file)
+	if err != nil {
+		return err
+	}
+	defer closer.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, io.NewSectionReader(ra, 0, revision.FileSize)); err != nil {
+		return err
+	}
+	reader, err := epub.NewReader(ra, revision.FileSize)
+	if err != nil {
+		return err
+	}
+	return api.BookRevisionService.SetBookRevisionContent(ctx, revision.ID, hex.EncodeToString(hash.Sum(nil)), revisionSnapshot(reader))
+}
@@ -0,0 +1,86 @@
+package http
+
+import (
+	epublib "epublib"
+	"epublib/epub"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"strings"
+)
+
+// sanitizedMediaTypes lists the media types of content documents that are
+// sanitized before being served, since browsers run their scripts.
+var sanitizedMediaTypes = map[string]bool{
+	"application/xhtml+xml": true,
+	"image/svg+xml":         true,
+	"text/html":             true,
+}
+
+// contentSanitizePolicy returns the sanitizer policy for a content document
+// of book, or false when sanitizing is disabled with CONTENT_SANITIZE=false.
+// Scripts are only kept for books allowing them, in documents the manifest
+// declares as scripted.
+func contentSanitizePolicy(book *epublib.Book, item *epub.Item) (epub.SanitizePolicy, bool) {
+	if os.Getenv("CONTENT_SANITIZE") == "false" {
+		return epub.SanitizePolicy{}, false
+	}
+	policy := epub.SanitizePolicy{
+		AllowScripts:           isScriptedContent(book, item),
+		AllowExternalResources: os.Getenv("CONTENT_ALLOW_EXTERNAL_RESOURCES") == "true",
+	}
+	for _, scheme := range strings.Split(os.Getenv("CONTENT_LINK_SCHEMES"), ",") {
+		if scheme = strings.ToLower(strings.TrimSpace(scheme)); scheme != "" {
+			policy.LinkSchemes = append(policy.LinkSchemes, scheme)
+		}
+	}
+	return policy, true
+}
+
+func isScriptedContent(book *epublib.Book, item *epub.Item) bool {
+	return book.AllowScripts && item.HasProperty("scripted")
+}
+
+// policyTag fingerprints a policy for entity tags, so cached documents are
+// revalidated when the configuration or the book changes.
+func policyTag(policy epub.SanitizePolicy) string {
+	return fmt.Sprintf("%08x", crc32.ChecksumIEEE([]byte(fmt.Sprintf("%v", policy))))
+}
+
+// contentSecurityPolicy returns the Content-Security-Policy of content
+// served from a book. Resources may only come from the publication itself
+// unless external resources are allowed, and scripts never run except in
+// scripted documents of books allowing them. Those are sandboxed into an
+// opaque origin so they cannot reach the API with the reader's
+// credentials. CONTENT_FRAME_ANCESTORS lists the origins allowed to embed
+// the content, by default the API origin only.
+func contentSecurityPolicy(scripted bool) string {
+	sources, frames := "'self' data:", "'self'"
+	if os.Getenv("CONTENT_ALLOW_EXTERNAL_RESOURCES") == "true" {
+		sources += " https:"
+		frames += " https:"
+	}
+	frameAncestors := os.Getenv("CONTENT_FRAME_ANCESTORS")
+	if frameAncestors == "" {
+		frameAncestors = "'self'"
+	}
+	directives := []string{
+		"default-src 'self'",
+		"img-src " + sources,
+		"media-src " + sources,
+		"font-src " + sources,
+		"style-src 'unsafe-inline' " + sources,
+		"frame-src " + frames,
+		"object-src 'none'",
+		"base-uri 'none'",
+		"form-action 'none'",
+		"connect-src 'none'",
+		"frame-ancestors " + frameAncestors,
+	}
+	if scripted {
+		directives = append(directives, "script-src 'self' 'unsafe-inline'", "sandbox allow-scripts allow-popups")
+	} else {
+		directives = append(directives, "script-src 'none'")
+	}
+	return strings.Join(directives, "; ")
+}
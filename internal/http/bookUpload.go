@@ -0,0 +1,330 @@
+package http
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	epublib "epublib"
+	"epublib/epub"
+	"epublib/postgres"
+	"epublib/util"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// bookKeyPrefix prefixes the blob keys of uploaded EPUB files.
+const bookKeyPrefix = "books/"
+
+// defaultBookMaxBytes caps uploads when BOOK_MAX_BYTES is not set.
+const defaultBookMaxBytes = 200 << 20
+
+func bookMaxBytes() int64 {
+	if v, err := strconv.ParseInt(os.Getenv("BOOK_MAX_BYTES"), 10, 64); err == nil && v > 0 {
+		return v
+	}
+	return defaultBookMaxBytes
+}
+
+// bookUpload is an EPUB posted in the file field of a multipart form,
+// spooled to a temporary file.
+type bookUpload struct {
+	file     *os.File
+	size     int64
+	checksum string
+	filename string
+
+	// Parsed container and its validation report.
+	reader *epub.Reader
+	report *epublib.ValidationReport
+}
+
+// Close removes the temporary file.
+func (u *bookUpload) Close() error {
+	defer os.Remove(u.file.Name())
+	return u.file.Close()
+}
+
+// receiveBookFile spools the EPUB posted in the file field of a multipart
+// form, checks its conformance and parses its package document. Only files
+// that cannot be read at all are refused, in which case an error response
+// is written and false returned. The upload must be closed once stored.
+func (api *API) receiveBookFile(w http.ResponseWriter, r *http.Request, bookID string) (*bookUpload, bool) {
+	// Spool the upload to disk since zip needs random access
+	maxBytes := bookMaxBytes()
+	r.Body = http.MaxBytesReader(w, r.Body, maxBytes+1<<20)
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			api.httpGeneralWrite(http.StatusRequestEntityTooLarge, "EPUB file is too large", nil, w)
+			return nil, false
+		}
+		api.httpGeneralWrite(http.StatusBadRequest, "file is required field", nil, w)
+		return nil, false
+	}
+	defer file.Close()
+	tmp, err := os.CreateTemp("", "epublib-upload-*.epub")
+	if err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return nil, false
+	}
+	upload := &bookUpload{file: tmp, filename: header.Filename}
+	hash := sha256.New()
+	upload.size, err = io.Copy(io.MultiWriter(tmp, hash), io.LimitReader(file, maxBytes+1))
+	if err != nil {
+		upload.Close()
+		api.httpGeneralWrite(http.StatusBadRequest, err.Error(), nil, w)
+		return nil, false
+	}
+	if upload.size > maxBytes {
+		upload.Close()
+		api.httpGeneralWrite(http.StatusRequestEntityTooLarge, "EPUB file is too large", nil, w)
+		return nil, false
+	}
+	upload.checksum = hex.EncodeToString(hash.Sum(nil))
+
+	// Check conformance, only files that cannot be read at all are refused
+	upload.report = validateBookFile(bookID, tmp, upload.size)
+	for _, m := range upload.report.Messages {
+		if m.Severity == epublib.FatalSeverity {
+			upload.Close()
+			response := map[string]interface{}{
+				"validation": upload.report,
+			}
+			api.httpGeneralWrite(http.StatusUnprocessableEntity, m.Message, response, w)
+			return nil, false
+		}
+	}
+
+	// Parse the container and the package document
+	upload.reader, err = epub.NewReader(tmp, upload.size)
+	if err != nil {
+		upload.Close()
+		if errors.Is(err, epub.ErrInvalidEPUB) {
+			response := map[string]interface{}{
+				"validation": upload.report,
+			}
+			api.httpGeneralWrite(http.StatusUnprocessableEntity, err.Error(), response, w)
+			return nil, false
+		}
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return nil, false
+	}
+	return upload, true
+}
+
+// storeBookFile stores an EPUB file under a fresh key, which it returns.
+// Keys are never reused so they identify the content of the file.
+func (api *API) storeBookFile(ctx context.Context, file io.ReadSeeker, size int64) (string, error) {
+	id, err := util.NewUUID()
+	if err != nil {
+		return "", err
+	}
+	key := bookKeyPrefix + id + ".epub"
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	if err := api.BlobStore.PutBlob(ctx, key, file, size, epub.MimeType); err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+// handleUploadBook creates a draft book from an uploaded EPUB, filling its
+// metadata from the package document.
+func (api *API) handleUploadBook(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if !api.requireAdmin(w, r, "Only admin can manage books") {
+		return
+	}
+	upload, ok := api.receiveBookFile(w, r, "")
+	if !ok {
+		return
+	}
+	defer upload.Close()
+	reader, report := upload.reader, upload.report
+	book := bookFromMetadata(&reader.Package.Metadata)
+	if book.Title == "" {
+		book.Title = truncate(strings.TrimSuffix(path.Base(upload.filename), path.Ext(upload.filename)), 255)
+	}
+	if err := book.Validate(); err != nil {
+		api.httpGeneralWrite(http.StatusUnprocessableEntity, err.Error(), nil, w)
+		return
+	}
+
+	// Store the file under a fresh key before the book points at it
+	var err error
+	book.FileKey, err = api.storeBookFile(ctx, upload.file, upload.size)
+	if err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	book.FileSize = upload.size
+
+	// A missing or broken cover never fails the upload
+	book.CoverKey, err = api.generateCover(ctx, reader)
+	if err != nil {
+		log.Println(err)
+	}
+	book.HasCover = book.CoverKey != ""
+
+	// Create the book, its first revision and the search index using the
+	// services
+	revision := &epublib.BookRevision{
+		FileKey:    book.FileKey,
+		FileSize:   upload.size,
+		Checksum:   upload.checksum,
+		UploaderID: epublib.UserIDFromContext(ctx),
+		Snapshot:   revisionSnapshot(reader),
+	}
+	series, position := reader.Package.Metadata.Series()
+	if err := api.createUploadedBook(ctx, book, revision, report, bookPassages(reader), truncate(series, 255), position); err != nil {
+		api.deleteBookFile(ctx, book.FileKey)
+		api.deleteCover(ctx, book.CoverKey)
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+
+	// Categories are only suggested, admins classify the book when they
+	// review it
+	suggestions, err := api.suggestBookCategories(ctx, book)
+	if err != nil {
+		log.Println(err)
+		suggestions = []*epublib.Category{}
+	}
+
+	// Catalog metadata is only proposed, a failing lookup never fails the
+	// upload
+	var proposal *epublib.MetadataProposal
+	if api.MetadataProvider != nil && len(book.ISBNs) > 0 {
+		proposal, err = api.proposeBookMetadata(ctx, book, book.ISBNs[0])
+		if err != nil && err != epublib.ErrNotFound {
+			log.Println(err)
+		}
+	}
+
+	// Prepare the response
+	response := map[string]interface{}{
+		"book":                 book,
+		"revision":             revision,
+		"package":              reader.Package,
+		"validation":           report,
+		"category_suggestions": suggestions,
+		"metadata_proposal":    proposal,
+	}
+
+	// Send the response
+	w.Header().Set("ETag", versionETag(book.Version))
+	api.httpGeneralWrite(http.StatusCreated, "Book uploaded successfully", response, w)
+}
+
+// createUploadedBook creates book together with the first revision of its
+// file, the validation report and the search index, and links it to its
+// authors, publisher and the series named in its metadata, if any.
+func (api *API) createUploadedBook(ctx context.Context, book *epublib.Book, revision *epublib.BookRevision, report *epublib.ValidationReport, passages []epublib.TextPassage, series string, position float64) error {
+	//Begin transaction
+	txCtx, err := postgres.BeginTx(ctx, api.db)
+	if err != nil {
+		return err
+	}
+	defer postgres.Rollback(txCtx)
+	if err := api.BookService.CreateBook(txCtx, book); err != nil {
+		return err
+	}
+	revision.BookID = book.ID
+	if err := api.createBookRevision(txCtx, revision, report); err != nil {
+		return err
+	}
+	if err := api.SearchService.IndexBookText(txCtx, book.ID, book.Language, passages); err != nil {
+		return err
+	}
+	if err := api.linkBookEntities(txCtx, book); err != nil {
+		return err
+	}
+	if series != "" {
+		if err := api.SeriesService.LinkBookSeries(txCtx, book.ID, series, position); err != nil {
+			return err
+		}
+	}
+	linked, err := api.BookService.FindBookByID(txCtx, book.ID)
+	if err != nil {
+		return err
+	}
+	*book = *linked
+	return postgres.Commit(txCtx)
+}
+
+// bookFromMetadata maps the metadata of a package document onto a draft
+// book. Values the catalog cannot hold, like malformed language tags, ISBNs
+// or relator codes and empty identifiers, are left out rather than failing
+// the upload.
+func bookFromMetadata(m *epub.Metadata) *epublib.Book {
+	book := &epublib.Book{
+		Title:           truncate(m.Title(), 255),
+		Subtitle:        truncate(m.Subtitle(), 255),
+		Description:     m.Description,
+		PublicationDate: m.PublicationDate(),
+		Publisher:       truncate(m.Publisher(), 255),
+		Subjects:        normalizeSubjects(m.Subjects),
+		Rights:          m.Rights,
+		Status:          epublib.DraftBook,
+		ISBNs:           []string{},
+	}
+	if language := m.Language(); epublib.IsLanguageTag(language) {
+		book.Language = language
+	}
+	for _, isbn := range normalizeISBNs(m.ISBNs()) {
+		if epublib.IsISBN(isbn) {
+			book.ISBNs = append(book.ISBNs, isbn)
+		}
+	}
+	for _, identifier := range m.Identifiers {
+		if identifier.Value == "" {
+			continue
+		}
+		book.Identifiers = append(book.Identifiers, epublib.BookIdentifier{Scheme: identifier.Scheme, Value: identifier.Value})
+	}
+	for _, creators := range [][]epub.Creator{m.Creators, m.Contributors} {
+		for _, creator := range creators {
+			if creator.Name == "" {
+				continue
+			}
+			role := epublib.ContributorRole(strings.ToLower(creator.Role))
+			if !role.IsValid() {
+				role = ""
+			}
+			book.Creators = append(book.Creators, epublib.BookCreator{
+				Name:   truncate(creator.Name, 255),
+				FileAs: creator.FileAs,
+				Role:   string(role),
+			})
+		}
+	}
+	return book
+}
+
+// truncate shortens s to at most n bytes without splitting a character.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// deleteBookFile removes an uploaded EPUB file. Failures are only logged
+// since no book points at it.
+func (api *API) deleteBookFile(ctx context.Context, key string) {
+	if err := api.BlobStore.DeleteBlob(ctx, key); err != nil {
+		log.Println(err)
+	}
+}
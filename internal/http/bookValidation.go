@@ -0,0 +1,151 @@
+package http
+
+import (
+	"context"
+	epublib "epublib"
+	"epublib/epub"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/gorilla/mux"
+)
+
+// validationBlocksPublication reports whether books with validation errors
+// are kept from being published. BOOK_VALIDATION_BLOCKS_PUBLICATION=false
+// turns the check off.
+func validationBlocksPublication() bool {
+	return os.Getenv("BOOK_VALIDATION_BLOCKS_PUBLICATION") != "false"
+}
+
+// validateBookFile validates the EPUB file of the given size read from r
+// and returns the report to store for the book.
+func validateBookFile(bookID string, r io.ReaderAt, size int64) *epublib.ValidationReport {
+	result := epub.Validate(r, size)
+	report := &epublib.ValidationReport{
+		BookID:       bookID,
+		Valid:        result.Valid(),
+		ErrorCount:   result.Count(epub.Fatal) + result.Count(epub.Error),
+		WarningCount: result.Count(epub.Warning),
+		Messages:     make([]epublib.ValidationMessage, 0, len(result.Messages)),
+	}
+	for _, m := range result.Messages {
+		report.Messages = append(report.Messages, epublib.ValidationMessage{
+			Severity: epublib.ValidationSeverity(m.Severity),
+			Code:     m.Code,
+			Message:  m.Message,
+			Path:     m.Path,
+			Line:     m.Line,
+		})
+	}
+	return report
+}
+
+// checkPublishable writes a conflict response and returns false when book is
+// about to be published while its stored validation report has errors.
+// Books that were never validated, like those without a file, pass.
+func (api *API) checkPublishable(ctx context.Context, w http.ResponseWriter, book *epublib.Book) bool {
+	if book.Status != epublib.PublishedBook || !validationBlocksPublication() {
+		return true
+	}
+	report, err := api.BookService.FindValidationReport(ctx, book.ID)
+	if err == epublib.ErrNotFound {
+		return true
+	}
+	if err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return false
+	}
+	return api.checkPublishableReport(w, book, report, "Book has validation errors and cannot be published")
+}
+
+// checkPublishableReport writes a conflict response with message and returns
+// false when report has errors while book is published, for files about to
+// replace the one a published book reads. Nil reports pass.
+func (api *API) checkPublishableReport(w http.ResponseWriter, book *epublib.Book, report *epublib.ValidationReport, message string) bool {
+	if book.Status != epublib.PublishedBook || !validationBlocksPublication() || report == nil || report.Valid {
+		return true
+	}
+	response := map[string]interface{}{
+		"validation": report,
+	}
+	api.httpGeneralWrite(http.StatusConflict, message, response, w)
+	return false
+}
+
+func (api *API) handleGetBookValidation(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if !api.requireAdmin(w, r, "Only admin can manage books") {
+		return
+	}
+
+	// Extract the book ID from the URL path
+	id := mux.Vars(r)["id"]
+	report, err := api.BookService.FindValidationReport(ctx, id)
+	if err != nil {
+		if err == epublib.ErrNotFound {
+			api.httpGeneralWrite(http.StatusNotFound, "Book has not been validated", nil, w)
+			return
+		}
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+
+	// Prepare the response
+	response := map[string]interface{}{
+		"validation": report,
+	}
+
+	// Send the response
+	api.httpGeneralWrite(http.StatusOK, "Success", response, w)
+}
+
+// handleValidateBook validates the stored EPUB file of a book again, for
+// instance after the rules were extended, and replaces its report.
+func (api *API) handleValidateBook(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if !api.requireAdmin(w, r, "Only admin can manage books") {
+		return
+	}
+
+	// Extract the book ID from the URL path
+	id := mux.Vars(r)["id"]
+	book, err := api.BookService.FindBookByID(ctx, id)
+	if err != nil {
+		if err == epublib.ErrNotFound {
+			api.httpGeneralWrite(http.StatusNotFound, "Book not found", nil, w)
+			return
+		}
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	if book.FileKey == "" {
+		api.httpGeneralWrite(http.StatusNotFound, "Book has no EPUB file", nil, w)
+		return
+	}
+	ra, file, err := api.openBookFile(ctx, book)
+	if err != nil {
+		if err == epublib.ErrNotFound {
+			api.httpGeneralWrite(http.StatusNotFound, "EPUB file not found", nil, w)
+			return
+		}
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	defer file.Close()
+
+	// Validate the file and store the report
+	report := validateBookFile(book.ID, ra, book.FileSize)
+	if err := api.BookService.SaveValidationReport(ctx, report); err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+
+	// Prepare the response
+	response := map[string]interface{}{
+		"validation": report,
+	}
+
+	// Send the response
+	api.httpGeneralWrite(http.StatusOK, "Book validated successfully", response, w)
+}
@@ -0,0 +1,373 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	epublib "epublib"
+	"epublib/postgres"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// normalizeCategoryCodes trims and uppercases codes so they match the way
+// subjects carry them.
+func normalizeCategoryCodes(codes []epublib.CategoryCode) []epublib.CategoryCode {
+	normalized := []epublib.CategoryCode{}
+	for _, code := range codes {
+		normalized = append(normalized, epublib.CategoryCode{
+			Scheme: epublib.ClassificationScheme(strings.ToLower(strings.TrimSpace(string(code.Scheme)))),
+			Code:   strings.ToUpper(strings.TrimSpace(code.Code)),
+		})
+	}
+	return normalized
+}
+
+// withoutChildren returns copies of categories that do not carry their
+// subtrees, for flat lists.
+func withoutChildren(categories []*epublib.Category) []*epublib.Category {
+	flat := []*epublib.Category{}
+	for _, category := range categories {
+		c := *category
+		c.Children = nil
+		flat = append(flat, &c)
+	}
+	return flat
+}
+
+// suggestBookCategories returns the categories the subjects of a book
+// point at.
+func (api *API) suggestBookCategories(ctx context.Context, book *epublib.Book) ([]*epublib.Category, error) {
+	categories, err := api.CategoryService.FindCategories(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	return withoutChildren(epublib.SuggestCategories(categories, book.Subjects)), nil
+}
+
+// setBookCategories replaces the categories of a book and writes a response
+// if one of them does not exist.
+func (api *API) setBookCategories(ctx context.Context, w http.ResponseWriter, bookID string, categoryIDs []string) bool {
+	if err := api.CategoryService.SetBookCategories(ctx, bookID, categoryIDs); err != nil {
+		if err == epublib.ErrNotFound {
+			api.httpGeneralWrite(http.StatusBadRequest, "category_ids must refer to existing categories", nil, w)
+			return false
+		}
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return false
+	}
+	return true
+}
+
+// handleGetCategories sends the category tree with the number of books the
+// user may read in each category and its subcategories.
+func (api *API) handleGetCategories(w http.ResponseWriter, r *http.Request) {
+	statuses, err := api.visibleStatuses(r)
+	if err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+
+	// Retrieve categories from the service
+	categories, err := api.CategoryService.FindCategories(r.Context(), statuses)
+	if err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+
+	// Prepare the response
+	response := map[string]interface{}{
+		"categories": epublib.CategoryTree(categories),
+	}
+
+	// Send the response
+	api.httpGeneralWrite(http.StatusOK, "Success", response, w)
+}
+
+// handleGetCategoryByID sends a category with its subtree and the path of
+// its ancestors from the root, with book counts like handleGetCategories.
+func (api *API) handleGetCategoryByID(w http.ResponseWriter, r *http.Request) {
+	// Extract category ID from the URL path
+	id := mux.Vars(r)["id"]
+	statuses, err := api.visibleStatuses(r)
+	if err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	categories, err := api.CategoryService.FindCategories(r.Context(), statuses)
+	if err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	epublib.CategoryTree(categories)
+	byID := map[string]*epublib.Category{}
+	for _, category := range categories {
+		byID[category.ID] = category
+	}
+	category := byID[id]
+	if category == nil {
+		api.httpGeneralWrite(http.StatusNotFound, "Category not found", nil, w)
+		return
+	}
+	path := []*epublib.Category{}
+	for parent := byID[category.ParentID]; parent != nil && len(path) < len(categories); parent = byID[parent.ParentID] {
+		path = append([]*epublib.Category{parent}, path...)
+	}
+
+	// Prepare the response
+	response := map[string]interface{}{
+		"category": category,
+		"path":     withoutChildren(path),
+	}
+
+	// Send the response
+	w.Header().Set("ETag", versionETag(category.Version))
+	api.httpGeneralWrite(http.StatusOK, "Success", response, w)
+}
+
+// handleGetCategoryBooks lists the books of a category and its
+// subcategories.
+func (api *API) handleGetCategoryBooks(w http.ResponseWriter, r *http.Request) {
+	// Extract category ID from the URL path
+	category, err := api.CategoryService.FindCategoryByID(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		if err == epublib.ErrNotFound {
+			api.httpGeneralWrite(http.StatusNotFound, "Category not found", nil, w)
+			return
+		}
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+
+	// Construct filter based on query parameters
+	filter := parseBookFilter(r)
+	filter.CategoryID = category.ID
+	api.writeBooks(w, r, filter)
+}
+
+// handleGetBookCategorySuggestions sends the categories the subjects of a
+// book point at, for admins to classify it.
+func (api *API) handleGetBookCategorySuggestions(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if !api.requireAdmin(w, r, "Only admin can manage books") {
+		return
+	}
+
+	// Extract book ID from the URL path
+	book, err := api.BookService.FindBookByID(ctx, mux.Vars(r)["id"])
+	if err != nil {
+		if err == epublib.ErrNotFound {
+			api.httpGeneralWrite(http.StatusNotFound, "Book not found", nil, w)
+			return
+		}
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	suggestions, err := api.suggestBookCategories(ctx, book)
+	if err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+
+	// Prepare the response
+	response := map[string]interface{}{
+		"categories": suggestions,
+	}
+
+	// Send the response
+	api.httpGeneralWrite(http.StatusOK, "Success", response, w)
+}
+
+type CreateCategoryRequest struct {
+	ParentID    string                 `json:"parent_id"`
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	Codes       []epublib.CategoryCode `json:"codes"`
+}
+
+func (api *API) handleCreateCategory(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if !api.requireAdmin(w, r, "Only admin can manage categories") {
+		return
+	}
+
+	// Parse the JSON request body into a CreateCategoryRequest struct
+	var payload CreateCategoryRequest
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		api.httpGeneralWrite(http.StatusBadRequest, "Invalid JSON payload", nil, w)
+		return
+	}
+	category := &epublib.Category{
+		ParentID:    payload.ParentID,
+		Name:        strings.TrimSpace(payload.Name),
+		Description: payload.Description,
+		Codes:       normalizeCategoryCodes(payload.Codes),
+	}
+
+	// Validate the required fields
+	if err := category.Validate(); err != nil {
+		api.httpGeneralWrite(http.StatusBadRequest, err.Error(), nil, w)
+		return
+	}
+
+	// Create the category using the service
+	if err := api.CategoryService.CreateCategory(ctx, category); err != nil {
+		if err == epublib.ErrNotFound {
+			api.httpGeneralWrite(http.StatusBadRequest, "Parent category not found", nil, w)
+			return
+		}
+		if err == epublib.ErrCategoryNameTaken {
+			api.httpGeneralWrite(http.StatusConflict, err.Error(), nil, w)
+			return
+		}
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+
+	// Prepare the response
+	response := map[string]interface{}{
+		"category": category,
+	}
+
+	// Send the response
+	w.Header().Set("ETag", versionETag(category.Version))
+	api.httpGeneralWrite(http.StatusCreated, "Category created successfully", response, w)
+}
+
+// PatchCategoryRequest holds the category fields a PATCH request may change.
+// Omitted fields keep their current value.
+type PatchCategoryRequest struct {
+	ParentID    *string                 `json:"parent_id"`
+	Name        *string                 `json:"name"`
+	Description *string                 `json:"description"`
+	Codes       *[]epublib.CategoryCode `json:"codes"`
+}
+
+func (api *API) handlePatchCategory(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if !api.requireAdmin(w, r, "Only admin can manage categories") {
+		return
+	}
+	id := mux.Vars(r)["id"]
+	version, ok := api.requireIfMatch(w, r)
+	if !ok {
+		return
+	}
+	var patch PatchCategoryRequest
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		api.httpGeneralWrite(http.StatusBadRequest, "Invalid JSON payload", nil, w)
+		return
+	}
+
+	// Merge the patch onto the current category
+	category, err := api.CategoryService.FindCategoryByID(ctx, id)
+	if err != nil {
+		if err == epublib.ErrNotFound {
+			api.httpGeneralWrite(http.StatusNotFound, "Category not found", nil, w)
+			return
+		}
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	if version != 0 && version != category.Version {
+		api.httpGeneralWrite(http.StatusPreconditionFailed, "Category was modified by another request", nil, w)
+		return
+	}
+	if patch.ParentID != nil {
+		category.ParentID = *patch.ParentID
+	}
+	if patch.Name != nil {
+		category.Name = strings.TrimSpace(*patch.Name)
+	}
+	if patch.Description != nil {
+		category.Description = *patch.Description
+	}
+	if patch.Codes != nil {
+		category.Codes = normalizeCategoryCodes(*patch.Codes)
+	}
+	if err := category.Validate(); err != nil {
+		api.httpGeneralWrite(http.StatusBadRequest, err.Error(), nil, w)
+		return
+	}
+
+	// Update the category using the service
+	category, err = api.CategoryService.UpdateCategory(ctx, id, epublib.CategoryUpdate{
+		ParentID:    category.ParentID,
+		Name:        category.Name,
+		Description: category.Description,
+		Codes:       category.Codes,
+		Version:     category.Version,
+	})
+	if err != nil {
+		if err == epublib.ErrNotFound {
+			api.httpGeneralWrite(http.StatusNotFound, "Category or parent category not found", nil, w)
+			return
+		}
+		if err == epublib.ErrConflict {
+			api.httpGeneralWrite(http.StatusPreconditionFailed, "Category was modified by another request", nil, w)
+			return
+		}
+		if err == epublib.ErrCategoryCycle {
+			api.httpGeneralWrite(http.StatusBadRequest, "A category cannot be moved below itself or its subcategories", nil, w)
+			return
+		}
+		if err == epublib.ErrCategoryNameTaken {
+			api.httpGeneralWrite(http.StatusConflict, err.Error(), nil, w)
+			return
+		}
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+
+	// Prepare the response
+	response := map[string]interface{}{
+		"category": category,
+	}
+
+	// Send the response
+	w.Header().Set("ETag", versionETag(category.Version))
+	api.httpGeneralWrite(http.StatusOK, "Category updated successfully", response, w)
+}
+
+// handleDeleteCategory deletes a category without subcategories and removes
+// its books from it.
+func (api *API) handleDeleteCategory(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if !api.requireAdmin(w, r, "Only admin can manage categories") {
+		return
+	}
+	version, ok := api.requireIfMatch(w, r)
+	if !ok {
+		return
+	}
+
+	//Begin transaction
+	txCtx, err := postgres.BeginTx(ctx, api.db)
+	if err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	defer postgres.Rollback(txCtx)
+	if err := api.CategoryService.DeleteCategory(txCtx, mux.Vars(r)["id"], version); err != nil {
+		if err == epublib.ErrNotFound {
+			api.httpGeneralWrite(http.StatusNotFound, "Category not found", nil, w)
+			return
+		}
+		if err == epublib.ErrConflict {
+			api.httpGeneralWrite(http.StatusPreconditionFailed, "Category was modified by another request", nil, w)
+			return
+		}
+		if err == epublib.ErrCategoryHasSubcategories {
+			api.httpGeneralWrite(http.StatusConflict, "Category still has subcategories", nil, w)
+			return
+		}
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	if err := postgres.Commit(txCtx); err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	api.httpGeneralWrite(http.StatusOK, "Category deleted successfully", nil, w)
+}
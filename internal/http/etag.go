@@ -0,0 +1,60 @@
+package http
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// versionETag returns the strong entity tag for a versioned resource.
+func versionETag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// etagVersion parses an entity tag produced by versionETag.
+// Returns false if the tag is weak or malformed.
+func etagVersion(etag string) (int, bool) {
+	etag = strings.TrimSpace(etag)
+	if len(etag) < 2 || etag[0] != '"' || etag[len(etag)-1] != '"' {
+		return 0, false
+	}
+	version, err := strconv.Atoi(etag[1 : len(etag)-1])
+	if err != nil {
+		return 0, false
+	}
+	return version, true
+}
+
+// etagListMatches reports whether a comma separated If-Match/If-None-Match
+// header value contains etag or the "*" wildcard. Weak comparison is used,
+// so W/ prefixes in the header are ignored.
+func etagListMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// requireIfMatch extracts the expected version from the If-Match header of a
+// write request. A "*" wildcard yields version zero, which skips the check.
+// It writes a 428 response and returns false if the header is missing or
+// does not hold a single version tag.
+func (api *API) requireIfMatch(w http.ResponseWriter, r *http.Request) (int, bool) {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	if header == "" {
+		api.httpGeneralWrite(http.StatusPreconditionRequired, "If-Match header is required", nil, w)
+		return 0, false
+	}
+	if header == "*" {
+		return 0, true
+	}
+	version, ok := etagVersion(header)
+	if !ok {
+		api.httpGeneralWrite(http.StatusPreconditionRequired, "If-Match header must hold a single ETag", nil, w)
+		return 0, false
+	}
+	return version, true
+}
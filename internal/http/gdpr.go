@@ -0,0 +1,269 @@
+package http
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	epublib "epublib"
+	"epublib/postgres"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// defaultErasureGraceDays is used when ERASURE_GRACE_DAYS is not set.
+const defaultErasureGraceDays = 30
+
+func erasureGracePeriod() time.Duration {
+	days := defaultErasureGraceDays
+	if v, err := strconv.Atoi(os.Getenv("ERASURE_GRACE_DAYS")); err == nil && v >= 0 {
+		days = v
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+func (api *API) handleExportMyData(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user := epublib.UserFromContext(ctx)
+
+	// Gather every record before streaming so failures can still be reported
+	auth, err := api.AuthService.FindAuthByUserID(ctx, user.ID)
+	if err != nil && err != epublib.ErrNotFound {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	if auth != nil {
+		// The hash is useless to the user and only helps offline attacks
+		auth.Password = ""
+	}
+	erasureRequests, err := api.ErasureService.FindErasureRequestsByUserID(ctx, user.ID)
+	if err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	settings, err := api.SettingsService.FindUserSettings(ctx, user.ID)
+	if err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	groups, err := api.GroupService.FindUserGroups(ctx, user.ID)
+	if err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	records := []struct {
+		name string
+		data interface{}
+	}{
+		{"user.json", user},
+		{"account.json", auth},
+		{"erasure_requests.json", erasureRequests},
+		{"settings.json", settings},
+		{"groups.json", groups},
+	}
+
+	filename := fmt.Sprintf("epublib-data-%s.zip", time.Now().Format("20060102"))
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	archive := zip.NewWriter(w)
+	for _, record := range records {
+		f, err := archive.Create(record.name)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		encoder := json.NewEncoder(f)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(record.data); err != nil {
+			log.Println(err)
+			return
+		}
+	}
+	if ownsAvatar(user.ID, user.ImgProfile) {
+		if err := api.addBlobToArchive(ctx, archive, "avatar.jpg", avatarBlobKey(user.ImgProfile, avatarSizes[0])); err != nil {
+			log.Println(err)
+			return
+		}
+	}
+	if err := archive.Close(); err != nil {
+		log.Println(err)
+	}
+}
+
+// addBlobToArchive copies a stored blob into archive. Missing blobs are skipped.
+func (api *API) addBlobToArchive(ctx context.Context, archive *zip.Writer, name, key string) error {
+	blob, err := api.BlobStore.GetBlob(ctx, key)
+	if err == epublib.ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer blob.Close()
+	f, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, blob)
+	return err
+}
+
+type ErasureRequestPayload struct {
+	Reason string `json:"reason"`
+}
+
+func (api *API) handleRequestMyErasure(w http.ResponseWriter, r *http.Request) {
+	api.requestErasure(w, r, epublib.UserIDFromContext(r.Context()))
+}
+
+func (api *API) handleRequestUserErasure(w http.ResponseWriter, r *http.Request) {
+	isAdmin, err := api.isAdmin(r.Context())
+	if err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	if !isAdmin {
+		api.httpGeneralWrite(http.StatusForbidden, "Only admin can request erasure of other users", nil, w)
+		return
+	}
+	api.requestErasure(w, r, mux.Vars(r)["id"])
+}
+
+// requestErasure schedules the erasure of userID after the grace period.
+func (api *API) requestErasure(w http.ResponseWriter, r *http.Request, userID string) {
+	ctx := r.Context()
+	var payload ErasureRequestPayload
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			api.httpGeneralWrite(http.StatusBadRequest, "Invalid JSON payload", nil, w)
+			return
+		}
+	}
+
+	if _, err := api.UserService.FindUserByID(ctx, userID); err != nil {
+		if err == epublib.ErrNotFound {
+			api.httpGeneralWrite(http.StatusNotFound, "User not found", nil, w)
+			return
+		}
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	if pending, err := api.ErasureService.FindPendingErasureRequest(ctx, userID); err == nil {
+		response := map[string]interface{}{
+			"erasure_request": pending,
+		}
+		api.httpGeneralWrite(http.StatusConflict, "Erasure is already scheduled", response, w)
+		return
+	} else if err != epublib.ErrNotFound {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+
+	req := &epublib.ErasureRequest{
+		UserID:       userID,
+		RequestedBy:  epublib.UserIDFromContext(ctx),
+		Reason:       payload.Reason,
+		ScheduledFor: time.Now().Add(erasureGracePeriod()),
+	}
+	if err := api.ErasureService.CreateErasureRequest(ctx, req); err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+
+	response := map[string]interface{}{
+		"erasure_request": req,
+	}
+	api.httpGeneralWrite(http.StatusAccepted, "Erasure scheduled successfully", response, w)
+}
+
+func (api *API) handleGetMyErasure(w http.ResponseWriter, r *http.Request) {
+	reqs, err := api.ErasureService.FindErasureRequestsByUserID(r.Context(), epublib.UserIDFromContext(r.Context()))
+	if err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	response := map[string]interface{}{
+		"erasure_requests": reqs,
+	}
+	api.httpGeneralWrite(http.StatusOK, "Success", response, w)
+}
+
+func (api *API) handleCancelMyErasure(w http.ResponseWriter, r *http.Request) {
+	api.cancelErasure(w, r, epublib.UserIDFromContext(r.Context()))
+}
+
+func (api *API) handleCancelUserErasure(w http.ResponseWriter, r *http.Request) {
+	isAdmin, err := api.isAdmin(r.Context())
+	if err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	if !isAdmin {
+		api.httpGeneralWrite(http.StatusForbidden, "Only admin can cancel erasure of other users", nil, w)
+		return
+	}
+	api.cancelErasure(w, r, mux.Vars(r)["id"])
+}
+
+// cancelErasure cancels the pending erasure of userID, if any.
+func (api *API) cancelErasure(w http.ResponseWriter, r *http.Request, userID string) {
+	ctx := r.Context()
+	pending, err := api.ErasureService.FindPendingErasureRequest(ctx, userID)
+	if err == nil {
+		err = api.ErasureService.CancelErasureRequest(ctx, pending.ID)
+	}
+	if err != nil {
+		if err == epublib.ErrNotFound {
+			api.httpGeneralWrite(http.StatusNotFound, "No erasure is scheduled", nil, w)
+			return
+		}
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	api.httpGeneralWrite(http.StatusOK, "Erasure cancelled successfully", nil, w)
+}
+
+// processErasures erases every user whose grace period has passed.
+func (api *API) processErasures(ctx context.Context) error {
+	reqs, err := api.ErasureService.FindDueErasureRequests(ctx, time.Now())
+	if err != nil {
+		return err
+	}
+	for _, req := range reqs {
+		if err := api.eraseUser(ctx, req); err != nil {
+			log.Printf("erasure %s of user %s: %v", req.ID, req.UserID, err)
+		}
+	}
+	return nil
+}
+
+func (api *API) eraseUser(ctx context.Context, req *epublib.ErasureRequest) error {
+	user, err := api.UserService.FindUserByID(ctx, req.UserID)
+	if err != nil {
+		return err
+	}
+
+	//Begin transaction
+	txCtx, err := postgres.BeginTx(ctx, api.db)
+	if err != nil {
+		return err
+	}
+	defer postgres.Rollback(txCtx)
+	if err := api.ErasureService.EraseUser(txCtx, req.ID); err != nil {
+		return err
+	}
+	if err := postgres.Commit(txCtx); err != nil {
+		return err
+	}
+
+	// Stored files go last, the database no longer points at them
+	api.deleteAvatar(ctx, user.ID, user.ImgProfile)
+	log.Printf("erased personal data of user %s (request %s)", req.UserID, req.ID)
+	return nil
+}
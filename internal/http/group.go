@@ -0,0 +1,471 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	epublib "epublib"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// canManageGroup reports whether the current user may manage the group with
+// the given ID, either as tenant admin or as admin of the group or one of
+// its ancestors.
+func (api *API) canManageGroup(ctx context.Context, groupID string) (bool, error) {
+	isAdmin, err := api.isAdmin(ctx)
+	if err != nil || isAdmin {
+		return isAdmin, err
+	}
+	currentUserID := epublib.UserIDFromContext(ctx)
+	if currentUserID == "" {
+		return false, nil
+	}
+	return api.GroupService.IsGroupAdmin(ctx, groupID, currentUserID)
+}
+
+func (api *API) handleGetGroups(w http.ResponseWriter, r *http.Request) {
+	// Construct filter based on query parameters
+	queryParams := r.URL.Query()
+	offset, _ := strconv.Atoi(queryParams.Get("offset"))
+	limit, _ := strconv.Atoi(queryParams.Get("limit"))
+	if limit <= 0 {
+		limit = 10
+	}
+	if limit > epublib.MaxGroupPageSize {
+		limit = epublib.MaxGroupPageSize
+	}
+	filter := epublib.GroupFilter{
+		Name:     queryParams.Get("name"),
+		Kind:     epublib.GroupKind(queryParams.Get("kind")),
+		ParentID: queryParams.Get("parent_id"),
+		RootOnly: queryParams.Get("root") == "true",
+		Offset:   offset,
+		Limit:    limit,
+	}
+	if filter.Kind != "" && !filter.Kind.IsValid() {
+		api.httpGeneralWrite(http.StatusBadRequest, "invalid group kind", nil, w)
+		return
+	}
+
+	// Retrieve groups from the service
+	groups, totalCount, err := api.GroupService.FindGroups(r.Context(), filter)
+	if err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+
+	// Prepare the response
+	response := map[string]interface{}{
+		"groups":      groups,
+		"total_count": totalCount,
+	}
+
+	// Send the response
+	api.httpGeneralWrite(http.StatusOK, "Success", response, w)
+}
+
+func (api *API) handleGetGroupByID(w http.ResponseWriter, r *http.Request) {
+	// Extract group ID from the URL path
+	id := mux.Vars(r)["id"]
+
+	// Retrieve group by ID from the service
+	group, err := api.GroupService.FindGroupByID(r.Context(), id)
+	if err != nil {
+		if err == epublib.ErrNotFound {
+			api.httpGeneralWrite(http.StatusNotFound, "Group not found", nil, w)
+			return
+		}
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+
+	// Prepare the response
+	response := map[string]interface{}{
+		"group": group,
+	}
+
+	// Send the response
+	w.Header().Set("ETag", versionETag(group.Version))
+	api.httpGeneralWrite(http.StatusOK, "Success", response, w)
+}
+
+type CreateGroupRequest struct {
+	ParentID    string            `json:"parent_id"`
+	Name        string            `json:"name"`
+	Description string            `json:"description"`
+	Kind        epublib.GroupKind `json:"kind"`
+}
+
+// handleCreateGroup creates a group. Root groups are created by tenant
+// admins, subgroups also by admins of the parent group.
+func (api *API) handleCreateGroup(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	// Parse the JSON request body into a CreateGroupRequest struct
+	var payload CreateGroupRequest
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		api.httpGeneralWrite(http.StatusBadRequest, "Invalid JSON payload", nil, w)
+		return
+	}
+	group := &epublib.Group{
+		ParentID:    payload.ParentID,
+		Name:        payload.Name,
+		Description: payload.Description,
+		Kind:        payload.Kind,
+	}
+	if group.Kind == "" {
+		group.Kind = epublib.OtherGroup
+	}
+
+	// Validate the required fields
+	if err := group.Validate(); err != nil {
+		api.httpGeneralWrite(http.StatusBadRequest, err.Error(), nil, w)
+		return
+	}
+
+	// Check permission to create the group
+	var allowed bool
+	var err error
+	if group.ParentID == "" {
+		allowed, err = api.isAdmin(ctx)
+	} else {
+		allowed, err = api.canManageGroup(ctx, group.ParentID)
+	}
+	if err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	if !allowed {
+		api.httpGeneralWrite(http.StatusForbidden, "You are not allowed to create this group", nil, w)
+		return
+	}
+
+	// Create the group using the service
+	if err := api.GroupService.CreateGroup(ctx, group); err != nil {
+		if err == epublib.ErrNotFound {
+			api.httpGeneralWrite(http.StatusBadRequest, "Parent group not found", nil, w)
+			return
+		}
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+
+	// Prepare the response
+	response := map[string]interface{}{
+		"group": group,
+	}
+
+	// Send the response
+	w.Header().Set("ETag", versionETag(group.Version))
+	api.httpGeneralWrite(http.StatusCreated, "Group created successfully", response, w)
+}
+
+// PatchGroupRequest holds the group fields a PATCH request may change.
+// Omitted fields keep their current value, an empty parent_id turns the
+// group into a root group.
+type PatchGroupRequest struct {
+	ParentID    *string            `json:"parent_id"`
+	Name        *string            `json:"name"`
+	Description *string            `json:"description"`
+	Kind        *epublib.GroupKind `json:"kind"`
+}
+
+func (api *API) handlePatchGroup(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id := mux.Vars(r)["id"]
+	version, ok := api.requireIfMatch(w, r)
+	if !ok {
+		return
+	}
+	var patch PatchGroupRequest
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		api.httpGeneralWrite(http.StatusBadRequest, "Invalid JSON payload", nil, w)
+		return
+	}
+
+	// Merge the patch onto the current group
+	group, err := api.GroupService.FindGroupByID(ctx, id)
+	if err != nil {
+		if err == epublib.ErrNotFound {
+			api.httpGeneralWrite(http.StatusNotFound, "Group not found", nil, w)
+			return
+		}
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	if version != 0 && version != group.Version {
+		api.httpGeneralWrite(http.StatusPreconditionFailed, "Group was modified by another request", nil, w)
+		return
+	}
+
+	// Group admins may edit their group, moving it in the hierarchy is
+	// left to tenant admins
+	allowed, err := api.canManageGroup(ctx, id)
+	if err == nil && allowed && patch.ParentID != nil && *patch.ParentID != group.ParentID {
+		allowed, err = api.isAdmin(ctx)
+	}
+	if err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	if !allowed {
+		api.httpGeneralWrite(http.StatusForbidden, "You are not allowed to update this group", nil, w)
+		return
+	}
+	if patch.ParentID != nil {
+		group.ParentID = *patch.ParentID
+	}
+	if patch.Name != nil {
+		group.Name = *patch.Name
+	}
+	if patch.Description != nil {
+		group.Description = *patch.Description
+	}
+	if patch.Kind != nil {
+		group.Kind = *patch.Kind
+	}
+	if err := group.Validate(); err != nil {
+		api.httpGeneralWrite(http.StatusBadRequest, err.Error(), nil, w)
+		return
+	}
+
+	// Update the group using the service
+	group, err = api.GroupService.UpdateGroup(ctx, id, epublib.GroupUpdate{
+		ParentID:    group.ParentID,
+		Name:        group.Name,
+		Description: group.Description,
+		Kind:        group.Kind,
+		Version:     group.Version,
+	})
+	if err != nil {
+		if err == epublib.ErrNotFound {
+			api.httpGeneralWrite(http.StatusNotFound, "Group or parent group not found", nil, w)
+			return
+		}
+		if err == epublib.ErrConflict {
+			api.httpGeneralWrite(http.StatusPreconditionFailed, "Group was modified by another request", nil, w)
+			return
+		}
+		if err == epublib.ErrGroupCycle {
+			api.httpGeneralWrite(http.StatusBadRequest, "A group cannot be moved below itself or its subgroups", nil, w)
+			return
+		}
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+
+	// Prepare the response
+	response := map[string]interface{}{
+		"group": group,
+	}
+
+	// Send the response
+	w.Header().Set("ETag", versionETag(group.Version))
+	api.httpGeneralWrite(http.StatusOK, "Group updated successfully", response, w)
+}
+
+// handleDeleteGroup deletes a group without subgroups. Root groups are
+// deleted by tenant admins, subgroups also by admins of the parent group.
+func (api *API) handleDeleteGroup(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id := mux.Vars(r)["id"]
+	version, ok := api.requireIfMatch(w, r)
+	if !ok {
+		return
+	}
+	group, err := api.GroupService.FindGroupByID(ctx, id)
+	if err != nil {
+		if err == epublib.ErrNotFound {
+			api.httpGeneralWrite(http.StatusNotFound, "Group not found", nil, w)
+			return
+		}
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	var allowed bool
+	if group.ParentID == "" {
+		allowed, err = api.isAdmin(ctx)
+	} else {
+		allowed, err = api.canManageGroup(ctx, group.ParentID)
+	}
+	if err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	if !allowed {
+		api.httpGeneralWrite(http.StatusForbidden, "You are not allowed to delete this group", nil, w)
+		return
+	}
+	if err := api.GroupService.DeleteGroup(ctx, id, version); err != nil {
+		if err == epublib.ErrNotFound {
+			api.httpGeneralWrite(http.StatusNotFound, "Group not found", nil, w)
+			return
+		}
+		if err == epublib.ErrConflict {
+			api.httpGeneralWrite(http.StatusPreconditionFailed, "Group was modified by another request", nil, w)
+			return
+		}
+		if err == epublib.ErrGroupHasSubgroups {
+			api.httpGeneralWrite(http.StatusConflict, "Group still has subgroups", nil, w)
+			return
+		}
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	api.httpGeneralWrite(http.StatusOK, "Group deleted successfully", nil, w)
+}
+
+func (api *API) handleGetGroupMembers(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id := mux.Vars(r)["id"]
+	if _, err := api.GroupService.FindGroupByID(ctx, id); err != nil {
+		if err == epublib.ErrNotFound {
+			api.httpGeneralWrite(http.StatusNotFound, "Group not found", nil, w)
+			return
+		}
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	members, err := api.GroupService.FindGroupMembers(ctx, id, r.URL.Query().Get("recursive") == "true")
+	if err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+
+	// Prepare the response
+	response := map[string]interface{}{
+		"members": members,
+	}
+
+	// Send the response
+	api.httpGeneralWrite(http.StatusOK, "Success", response, w)
+}
+
+type SetGroupMemberRequest struct {
+	Role epublib.GroupRole `json:"role"`
+}
+
+func (api *API) handleSetGroupMember(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	groupID, userID := vars["id"], vars["userId"]
+
+	var payload SetGroupMemberRequest
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		api.httpGeneralWrite(http.StatusBadRequest, "Invalid JSON payload", nil, w)
+		return
+	}
+	if payload.Role == "" {
+		payload.Role = epublib.GroupMemberRole
+	}
+	if !payload.Role.IsValid() {
+		api.httpGeneralWrite(http.StatusBadRequest, "role must be admin or member", nil, w)
+		return
+	}
+
+	// Check the group and the user exist before granting anything
+	if _, err := api.GroupService.FindGroupByID(ctx, groupID); err != nil {
+		if err == epublib.ErrNotFound {
+			api.httpGeneralWrite(http.StatusNotFound, "Group not found", nil, w)
+			return
+		}
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	allowed, err := api.canManageGroup(ctx, groupID)
+	if err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	if !allowed {
+		api.httpGeneralWrite(http.StatusForbidden, "Only admins of the group can manage its members", nil, w)
+		return
+	}
+	user, err := api.UserService.FindUserByID(ctx, userID)
+	if err != nil {
+		if err == epublib.ErrNotFound {
+			api.httpGeneralWrite(http.StatusNotFound, "User not found", nil, w)
+			return
+		}
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+
+	member := &epublib.GroupMember{
+		GroupID: groupID,
+		UserID:  userID,
+		Role:    payload.Role,
+	}
+	if err := api.GroupService.SetGroupMember(ctx, member); err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	member.User = user
+
+	// Prepare the response
+	response := map[string]interface{}{
+		"member": member,
+	}
+
+	// Send the response
+	api.httpGeneralWrite(http.StatusOK, "Member saved successfully", response, w)
+}
+
+// handleRemoveGroupMember removes a member from a group. Members may always
+// leave a group themselves.
+func (api *API) handleRemoveGroupMember(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	groupID, userID := vars["id"], vars["userId"]
+
+	allowed := userID == epublib.UserIDFromContext(ctx)
+	if !allowed {
+		var err error
+		allowed, err = api.canManageGroup(ctx, groupID)
+		if err != nil {
+			api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+			return
+		}
+	}
+	if !allowed {
+		api.httpGeneralWrite(http.StatusForbidden, "Only admins of the group can manage its members", nil, w)
+		return
+	}
+	if err := api.GroupService.RemoveGroupMember(ctx, groupID, userID); err != nil {
+		if err == epublib.ErrNotFound {
+			api.httpGeneralWrite(http.StatusNotFound, "Member not found", nil, w)
+			return
+		}
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	api.httpGeneralWrite(http.StatusOK, "Member removed successfully", nil, w)
+}
+
+func (api *API) handleGetUserGroups(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id := mux.Vars(r)["id"]
+	if _, err := api.UserService.FindUserByID(ctx, id); err != nil {
+		if err == epublib.ErrNotFound {
+			api.httpGeneralWrite(http.StatusNotFound, "User not found", nil, w)
+			return
+		}
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	groups, err := api.GroupService.FindUserGroups(ctx, id)
+	if err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+
+	// Prepare the response
+	response := map[string]interface{}{
+		"groups": groups,
+	}
+
+	// Send the response
+	api.httpGeneralWrite(http.StatusOK, "Success", response, w)
+}
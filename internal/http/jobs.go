@@ -0,0 +1,60 @@
+package http
+
+import (
+	"context"
+	epublib "epublib"
+	"log"
+	"os"
+	"time"
+)
+
+// defaultJobInterval is how often maintenance jobs run when JOB_INTERVAL is not set.
+const defaultJobInterval = time.Hour
+
+// StartJobs runs the periodic maintenance jobs in the background until ctx
+// is cancelled. The interval can be tuned with JOB_INTERVAL, e.g. "15m".
+func (api *API) StartJobs(ctx context.Context) {
+	interval := defaultJobInterval
+	if v, err := time.ParseDuration(os.Getenv("JOB_INTERVAL")); err == nil && v > 0 {
+		interval = v
+	}
+	go runPeriodically(ctx, interval, "erasure", api.forEachTenant(api.processErasures))
+	go runPeriodically(ctx, interval, "retention", api.forEachTenant(api.processRetention))
+	go runPeriodically(ctx, interval, "book links", api.forEachTenant(api.processBookLinks))
+	go runPeriodically(ctx, interval, "revision content", api.forEachTenant(api.processRevisionContent))
+}
+
+// forEachTenant wraps job so it runs once for every tenant, with database
+// access restricted to that tenant's records. A failing tenant does not
+// keep the job from running for the others.
+func (api *API) forEachTenant(job func(context.Context) error) func(context.Context) error {
+	return func(ctx context.Context) error {
+		tenants, err := api.TenantService.FindTenants(ctx)
+		if err != nil {
+			return err
+		}
+		for _, tenant := range tenants {
+			if err := job(epublib.NewContextWithTenant(ctx, tenant)); err != nil {
+				log.Printf("tenant %s: %v", tenant.Slug, err)
+			}
+		}
+		return nil
+	}
+}
+
+// runPeriodically calls job right away and then every interval. Errors are
+// logged and the job is retried on the next tick.
+func runPeriodically(ctx context.Context, interval time.Duration, name string, job func(context.Context) error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := job(ctx); err != nil {
+			log.Printf("job %s: %v", name, err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,354 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	epublib "epublib"
+	"epublib/postgres"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// proposeBookMetadata looks a book up by ISBN-13 in the metadata provider
+// and proposes the fields it fills. No proposal is made, and nil returned,
+// when the catalog knows nothing the book is missing.
+func (api *API) proposeBookMetadata(ctx context.Context, book *epublib.Book, isbn string) (*epublib.MetadataProposal, error) {
+	m, err := api.MetadataProvider.LookupISBN(ctx, isbn)
+	if err != nil {
+		return nil, err
+	}
+	fields := epublib.MissingMetadataFields(book, m)
+	if len(fields) == 0 {
+		return nil, nil
+	}
+	proposal := &epublib.MetadataProposal{
+		BookID:   book.ID,
+		Provider: api.MetadataProvider.Name(),
+		Fields:   fields,
+		Metadata: *m,
+	}
+	if err := api.MetadataProposalService.CreateMetadataProposal(ctx, proposal); err != nil {
+		return nil, err
+	}
+	return proposal, nil
+}
+
+type LookupBookMetadataRequest struct {
+	ISBN string `json:"isbn"`
+}
+
+// handleLookupBookMetadata looks a book up in the metadata provider, by the
+// given ISBN or else its first one, and proposes the fields it is missing.
+func (api *API) handleLookupBookMetadata(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if !api.requireAdmin(w, r, "Only admin can manage books") {
+		return
+	}
+	if api.MetadataProvider == nil {
+		api.httpGeneralWrite(http.StatusServiceUnavailable, "No metadata provider is configured", nil, w)
+		return
+	}
+	var payload LookupBookMetadataRequest
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil && err != io.EOF {
+		api.httpGeneralWrite(http.StatusBadRequest, "Invalid JSON payload", nil, w)
+		return
+	}
+
+	// Extract book ID from the URL path
+	book, err := api.BookService.FindBookByID(ctx, mux.Vars(r)["id"])
+	if err != nil {
+		if err == epublib.ErrNotFound {
+			api.httpGeneralWrite(http.StatusNotFound, "Book not found", nil, w)
+			return
+		}
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	isbn := epublib.NormalizeISBN(payload.ISBN)
+	if isbn == "" && len(book.ISBNs) > 0 {
+		isbn = book.ISBNs[0]
+	}
+	if isbn == "" {
+		api.httpGeneralWrite(http.StatusBadRequest, "isbn is required field for books without ISBN", nil, w)
+		return
+	}
+	if !epublib.IsISBN(isbn) {
+		api.httpGeneralWrite(http.StatusBadRequest, "isbn must be a valid ISBN-10 or ISBN-13", nil, w)
+		return
+	}
+
+	// Look the book up and propose what it is missing
+	proposal, err := api.proposeBookMetadata(ctx, book, epublib.ISBN13(isbn))
+	if err != nil {
+		if err == epublib.ErrNotFound {
+			api.httpGeneralWrite(http.StatusNotFound, "ISBN not found in the catalog", nil, w)
+			return
+		}
+		api.httpGeneralWrite(http.StatusBadGateway, "Metadata provider failed: "+err.Error(), nil, w)
+		return
+	}
+
+	// Prepare the response
+	response := map[string]interface{}{
+		"proposal": proposal,
+	}
+
+	// Send the response
+	if proposal == nil {
+		api.httpGeneralWrite(http.StatusOK, "Book has no missing metadata the catalog knows", response, w)
+		return
+	}
+	api.httpGeneralWrite(http.StatusCreated, "Metadata proposal created successfully", response, w)
+}
+
+func (api *API) handleGetMetadataProposals(w http.ResponseWriter, r *http.Request) {
+	if !api.requireAdmin(w, r, "Only admin can review metadata proposals") {
+		return
+	}
+
+	// Construct filter based on query parameters
+	queryParams := r.URL.Query()
+	offset, _ := strconv.Atoi(queryParams.Get("offset"))
+	limit, _ := strconv.Atoi(queryParams.Get("limit"))
+	if limit <= 0 {
+		limit = 10
+	}
+	if limit > epublib.MaxMetadataProposalPageSize {
+		limit = epublib.MaxMetadataProposalPageSize
+	}
+	filter := epublib.MetadataProposalFilter{
+		BookID: queryParams.Get("book_id"),
+		Status: epublib.ProposalStatus(queryParams.Get("status")),
+		Offset: offset,
+		Limit:  limit,
+	}
+	if filter.Status != "" && !filter.Status.IsValid() {
+		api.httpGeneralWrite(http.StatusBadRequest, "status must be one of pending, applied or rejected", nil, w)
+		return
+	}
+
+	// Retrieve proposals from the service
+	proposals, totalCount, err := api.MetadataProposalService.FindMetadataProposals(r.Context(), filter)
+	if err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+
+	// Prepare the response
+	response := map[string]interface{}{
+		"proposals":   proposals,
+		"total_count": totalCount,
+	}
+
+	// Send the response
+	api.httpGeneralWrite(http.StatusOK, "Success", response, w)
+}
+
+// findMetadataProposal retrieves a proposal together with its book and
+// writes a not found response if either does not exist.
+func (api *API) findMetadataProposal(ctx context.Context, w http.ResponseWriter, id string) (*epublib.MetadataProposal, *epublib.Book, bool) {
+	proposal, err := api.MetadataProposalService.FindMetadataProposalByID(ctx, id)
+	if err == nil {
+		var book *epublib.Book
+		if book, err = api.BookService.FindBookByID(ctx, proposal.BookID); err == nil {
+			return proposal, book, true
+		}
+	}
+	if err == epublib.ErrNotFound {
+		api.httpGeneralWrite(http.StatusNotFound, "Metadata proposal not found", nil, w)
+		return nil, nil, false
+	}
+	api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+	return nil, nil, false
+}
+
+// handleGetMetadataProposalByID sends a proposal with the current book, for
+// admins to compare both before applying it.
+func (api *API) handleGetMetadataProposalByID(w http.ResponseWriter, r *http.Request) {
+	if !api.requireAdmin(w, r, "Only admin can review metadata proposals") {
+		return
+	}
+
+	// Extract proposal ID from the URL path
+	proposal, book, ok := api.findMetadataProposal(r.Context(), w, mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+
+	// Prepare the response
+	response := map[string]interface{}{
+		"proposal": proposal,
+		"book":     book,
+	}
+
+	// Send the response
+	api.httpGeneralWrite(http.StatusOK, "Success", response, w)
+}
+
+type ApplyMetadataProposalRequest struct {
+	// Subset of the proposal fields to apply, all of them if omitted.
+	Fields *[]string `json:"fields"`
+}
+
+// handleApplyMetadataProposal copies the accepted fields of a pending
+// proposal onto its book.
+func (api *API) handleApplyMetadataProposal(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if !api.requireAdmin(w, r, "Only admin can review metadata proposals") {
+		return
+	}
+	var payload ApplyMetadataProposalRequest
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil && err != io.EOF {
+		api.httpGeneralWrite(http.StatusBadRequest, "Invalid JSON payload", nil, w)
+		return
+	}
+
+	// Extract proposal ID from the URL path
+	proposal, book, ok := api.findMetadataProposal(ctx, w, mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+	if proposal.Status != epublib.PendingProposal {
+		api.httpGeneralWrite(http.StatusConflict, "Metadata proposal was already reviewed", nil, w)
+		return
+	}
+	fields := proposal.Fields
+	if payload.Fields != nil {
+		proposed := map[string]bool{}
+		for _, field := range proposal.Fields {
+			proposed[field] = true
+		}
+		fields = []string{}
+		for _, field := range *payload.Fields {
+			if !proposed[field] {
+				api.httpGeneralWrite(http.StatusBadRequest, "fields must be a subset of the proposal fields", nil, w)
+				return
+			}
+			fields = append(fields, field)
+		}
+	}
+
+	// Merge the accepted fields onto the current book
+	previousLanguage := book.Language
+	epublib.ApplyMetadata(book, &proposal.Metadata, fields)
+	book.Subjects = normalizeSubjects(book.Subjects)
+	if err := book.Validate(); err != nil {
+		api.httpGeneralWrite(http.StatusBadRequest, err.Error(), nil, w)
+		return
+	}
+
+	//Begin transaction
+	txCtx, err := postgres.BeginTx(ctx, api.db)
+	if err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	defer postgres.Rollback(txCtx)
+
+	// Update the book using the service
+	book, err = api.BookService.UpdateBook(txCtx, book.ID, epublib.BookUpdate{
+		Title:           book.Title,
+		Subtitle:        book.Subtitle,
+		Language:        book.Language,
+		Description:     book.Description,
+		ISBNs:           book.ISBNs,
+		PublicationDate: book.PublicationDate,
+		Publisher:       book.Publisher,
+		PageCount:       book.PageCount,
+		Status:          book.Status,
+		Creators:        book.Creators,
+		Identifiers:     book.Identifiers,
+		Subjects:        book.Subjects,
+		Rights:          book.Rights,
+		SeriesID:        book.SeriesID,
+		SeriesPosition:  book.SeriesPosition,
+		AllowScripts:    book.AllowScripts,
+		Version:         book.Version,
+	})
+	if err != nil {
+		if err == epublib.ErrNotFound {
+			api.httpGeneralWrite(http.StatusNotFound, "Book not found", nil, w)
+			return
+		}
+		if err == epublib.ErrConflict {
+			api.httpGeneralWrite(http.StatusConflict, "Book was modified by another request", nil, w)
+			return
+		}
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	if err := api.linkBookEntities(txCtx, book); err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	if book, err = api.BookService.FindBookByID(txCtx, book.ID); err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	userID := epublib.UserIDFromContext(ctx)
+	proposal, err = api.MetadataProposalService.ReviewMetadataProposal(txCtx, proposal.ID, epublib.AppliedProposal, fields, userID)
+	if err != nil {
+		if err == epublib.ErrProposalReviewed {
+			api.httpGeneralWrite(http.StatusConflict, "Metadata proposal was already reviewed", nil, w)
+			return
+		}
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	if err := postgres.Commit(txCtx); err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+
+	// Stem the indexed text according to the new language
+	if book.Language != previousLanguage {
+		if err := api.SearchService.SetBookTextLanguage(ctx, book.ID, book.Language); err != nil {
+			log.Println(err)
+		}
+	}
+
+	// Prepare the response
+	response := map[string]interface{}{
+		"proposal": proposal,
+		"book":     book,
+	}
+
+	// Send the response
+	w.Header().Set("ETag", versionETag(book.Version))
+	api.httpGeneralWrite(http.StatusOK, "Metadata proposal applied successfully", response, w)
+}
+
+func (api *API) handleRejectMetadataProposal(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if !api.requireAdmin(w, r, "Only admin can review metadata proposals") {
+		return
+	}
+
+	// Reject the proposal using the service
+	userID := epublib.UserIDFromContext(ctx)
+	proposal, err := api.MetadataProposalService.ReviewMetadataProposal(ctx, mux.Vars(r)["id"], epublib.RejectedProposal, nil, userID)
+	if err != nil {
+		if err == epublib.ErrNotFound {
+			api.httpGeneralWrite(http.StatusNotFound, "Metadata proposal not found", nil, w)
+			return
+		}
+		if err == epublib.ErrProposalReviewed {
+			api.httpGeneralWrite(http.StatusConflict, "Metadata proposal was already reviewed", nil, w)
+			return
+		}
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+
+	// Prepare the response
+	response := map[string]interface{}{
+		"proposal": proposal,
+	}
+
+	// Send the response
+	api.httpGeneralWrite(http.StatusOK, "Metadata proposal rejected", response, w)
+}
@@ -4,12 +4,12 @@ import (
 	epublib "epublib"
 	"errors"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"strings"
 
 	"github.com/golang-jwt/jwt/v4"
-	"github.com/jackc/pgx/v4"
 )
 
 // authenticate is middleware for loading session data from a cookie or API key header.
@@ -38,10 +38,15 @@ func (api *API) authenticate(next http.Handler) http.Handler {
 			if !ok {
 				log.Println(err)
 			}
+			// Tokens are only valid for the tenant they were issued by
+			if !claims.VerifyAudience(epublib.TenantIDFromContext(r.Context()), true) {
+				api.httpGeneralWrite(http.StatusForbidden, "Token was issued for another tenant", nil, w)
+				return
+			}
 			// Find authenticated user data
 			user, err := api.UserService.FindUserByID(r.Context(), claims.Subject)
 			if err != nil {
-				if errors.Is(err, pgx.ErrNoRows) {
+				if errors.Is(err, epublib.ErrNotFound) {
 					api.httpGeneralWrite(http.StatusForbidden, err.Error(), nil, w)
 					return
 				} else {
@@ -63,10 +68,62 @@ func (api *API) authenticate(next http.Handler) http.Handler {
 	})
 }
 
+// resolveTenant is middleware for loading the tenant a request is served
+// for. The tenant is named by slug in the X-Tenant header, or found by host
+// name, either listed in the tenant's hosts or as a subdomain of
+// TENANT_BASE_DOMAIN. Other requests are served for DEFAULT_TENANT, if set.
+func (api *API) resolveTenant(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		tenant, err := api.findRequestTenant(r)
+		if err != nil {
+			if err == epublib.ErrNotFound {
+				api.httpGeneralWrite(http.StatusNotFound, "Unknown tenant", nil, w)
+				return
+			}
+			api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+			return
+		}
+
+		// Every database access made for the request is now restricted to the tenant
+		r = r.WithContext(epublib.NewContextWithTenant(ctx, tenant))
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (api *API) findRequestTenant(r *http.Request) (*epublib.Tenant, error) {
+	ctx := r.Context()
+	if slug := r.Header.Get("X-Tenant"); slug != "" {
+		return api.TenantService.FindTenantBySlug(ctx, slug)
+	}
+
+	host := strings.ToLower(r.Host)
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	tenant, err := api.TenantService.FindTenantByHost(ctx, host)
+	if err != epublib.ErrNotFound {
+		return tenant, err
+	}
+	if base := os.Getenv("TENANT_BASE_DOMAIN"); base != "" {
+		if slug := strings.TrimSuffix(host, "."+strings.ToLower(base)); slug != host && !strings.Contains(slug, ".") {
+			tenant, err := api.TenantService.FindTenantBySlug(ctx, slug)
+			if err != epublib.ErrNotFound {
+				return tenant, err
+			}
+		}
+	}
+	if slug := os.Getenv("DEFAULT_TENANT"); slug != "" {
+		return api.TenantService.FindTenantBySlug(ctx, slug)
+	}
+	return nil, epublib.ErrNotFound
+}
+
 func (api *API) handleCors(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if os.Getenv("CORS_ALLOW_ALL") == "true" {
 			w.Header().Set("Access-Control-Allow-Origin", "*")
+			w.Header().Set("Access-Control-Expose-Headers", "ETag, Link")
 		}
 		if r.Method == http.MethodOptions {
 			w.Header().Set("Access-Control-Allow-Methods", r.Header.Get("Access-Control-Request-Method"))
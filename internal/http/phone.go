@@ -0,0 +1,227 @@
+package http
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	epublib "epublib"
+	"epublib/postgres"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// defaultPhoneCountryCode is used for national numbers when
+// PHONE_DEFAULT_COUNTRY_CODE is not set.
+const defaultPhoneCountryCode = "62"
+
+// Defaults used when PHONE_VERIFICATION_TTL_MINUTES,
+// PHONE_VERIFICATION_RESEND_SECONDS and PHONE_VERIFICATION_DAILY_LIMIT are
+// not set.
+const (
+	defaultPhoneVerificationTTL        = 10 * time.Minute
+	defaultPhoneVerificationResend     = time.Minute
+	defaultPhoneVerificationDailyLimit = 5
+)
+
+const invalidPhoneNumberMessage = "Phone number must be a valid international number, e.g. +6281234567890"
+
+// normalizePhoneNumber converts number to E.164, reading national numbers as
+// numbers of PHONE_DEFAULT_COUNTRY_CODE.
+func normalizePhoneNumber(number string) (string, error) {
+	countryCode := os.Getenv("PHONE_DEFAULT_COUNTRY_CODE")
+	if countryCode == "" {
+		countryCode = defaultPhoneCountryCode
+	}
+	return epublib.NormalizePhoneNumber(number, countryCode)
+}
+
+func phoneVerificationTTL() time.Duration {
+	if v, err := strconv.Atoi(os.Getenv("PHONE_VERIFICATION_TTL_MINUTES")); err == nil && v > 0 {
+		return time.Duration(v) * time.Minute
+	}
+	return defaultPhoneVerificationTTL
+}
+
+func phoneVerificationResend() time.Duration {
+	if v, err := strconv.Atoi(os.Getenv("PHONE_VERIFICATION_RESEND_SECONDS")); err == nil && v >= 0 {
+		return time.Duration(v) * time.Second
+	}
+	return defaultPhoneVerificationResend
+}
+
+// phoneVerificationDailyLimit is how many codes may be sent to a user, or to
+// a phone number, within 24 hours.
+func phoneVerificationDailyLimit() int {
+	if v, err := strconv.Atoi(os.Getenv("PHONE_VERIFICATION_DAILY_LIMIT")); err == nil && v > 0 {
+		return v
+	}
+	return defaultPhoneVerificationDailyLimit
+}
+
+// generateOTP returns a random numeric code of the given length.
+func generateOTP(length int) (string, error) {
+	max := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(length)), nil)
+	n, err := rand.Int(rand.Reader, max)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%0*d", length, n), nil
+}
+
+func (api *API) handleSendPhoneVerification(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user := epublib.UserFromContext(ctx)
+	if user.PhoneNumber == "" {
+		api.httpGeneralWrite(http.StatusBadRequest, "Phone number is not set", nil, w)
+		return
+	}
+	if !user.PhoneVerifiedAt.IsZero() {
+		api.httpGeneralWrite(http.StatusConflict, "Phone number is already verified", nil, w)
+		return
+	}
+
+	// Limit how often codes are sent to the same user, whether or not the
+	// last one can still be used
+	latest, err := api.PhoneVerificationService.FindLatestPhoneVerification(ctx, user.ID)
+	if err != nil && err != epublib.ErrNotFound {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	if latest != nil {
+		if wait := time.Until(latest.CreatedAt.Add(phoneVerificationResend())); wait > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+			api.httpGeneralWrite(http.StatusTooManyRequests, "Verification code was sent recently", nil, w)
+			return
+		}
+	}
+
+	// Limit how many codes are sent per day to the same user or number
+	sent, err := api.PhoneVerificationService.CountPhoneVerificationsSince(ctx, user.ID, user.PhoneNumber, time.Now().Add(-24*time.Hour))
+	if err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	if sent >= phoneVerificationDailyLimit() {
+		api.httpGeneralWrite(http.StatusTooManyRequests, "Too many verification codes were sent today", nil, w)
+		return
+	}
+
+	code, err := generateOTP(6)
+	if err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	verification := &epublib.PhoneVerification{
+		UserID:      user.ID,
+		PhoneNumber: user.PhoneNumber,
+		ExpiresAt:   time.Now().Add(phoneVerificationTTL()),
+		Code:        code,
+	}
+
+	//Begin transaction
+	ctx, err = postgres.BeginTx(ctx, api.db)
+	if err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	defer postgres.Rollback(ctx)
+	if err := api.PhoneVerificationService.CreatePhoneVerification(ctx, verification); err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+
+	// Only keep the verification if the code actually went out
+	err = api.SMSService.SendSMS(ctx, epublib.SMS{
+		To:   user.PhoneNumber,
+		Body: fmt.Sprintf("Your %s verification code is %s. It expires in %d minutes.", libraryName(ctx), code, int(phoneVerificationTTL().Minutes())),
+	})
+	if err != nil {
+		api.httpGeneralWrite(http.StatusBadGateway, "Failed to send verification code", nil, w)
+		return
+	}
+	if err := postgres.Commit(ctx); err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+
+	// Prepare the response
+	response := map[string]interface{}{
+		"phone_verification": verification,
+	}
+
+	// Send the response
+	api.httpGeneralWrite(http.StatusAccepted, "Verification code sent", response, w)
+}
+
+type ConfirmPhoneVerificationRequest struct {
+	Code string `json:"code"`
+}
+
+func (api *API) handleConfirmPhoneVerification(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var payload ConfirmPhoneVerificationRequest
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		api.httpGeneralWrite(http.StatusBadRequest, "Invalid JSON payload", nil, w)
+		return
+	}
+	if payload.Code == "" {
+		api.httpGeneralWrite(http.StatusBadRequest, "Code is required", nil, w)
+		return
+	}
+
+	userID := epublib.UserIDFromContext(ctx)
+	pending, err := api.PhoneVerificationService.FindPendingPhoneVerification(ctx, userID)
+	if err != nil {
+		if err == epublib.ErrNotFound {
+			api.httpGeneralWrite(http.StatusNotFound, "No verification is pending", nil, w)
+			return
+		}
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+
+	//Begin transaction
+	txCtx, err := postgres.BeginTx(ctx, api.db)
+	if err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	defer postgres.Rollback(txCtx)
+	verified, err := api.PhoneVerificationService.VerifyPhone(txCtx, pending.ID, payload.Code)
+	if err != nil {
+		if err == epublib.ErrNotFound {
+			api.httpGeneralWrite(http.StatusNotFound, "No verification is pending", nil, w)
+			return
+		}
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+
+	// Commit even when the code is wrong so the attempt is counted
+	if err := postgres.Commit(txCtx); err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	if !verified {
+		api.httpGeneralWrite(http.StatusBadRequest, "Invalid verification code", nil, w)
+		return
+	}
+
+	user, err := api.UserService.FindUserByID(ctx, userID)
+	if err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+
+	// Prepare the response
+	response := map[string]interface{}{
+		"user": user,
+	}
+
+	// Send the response
+	w.Header().Set("ETag", versionETag(user.Version))
+	api.httpGeneralWrite(http.StatusOK, "Phone number verified successfully", response, w)
+}
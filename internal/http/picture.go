@@ -0,0 +1,146 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	epublib "epublib"
+	"epublib/imaging"
+	"epublib/util"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// pictureSizes lists the widths, in pixels, of the thumbnails generated for
+// author photos and publisher logos. Heights follow the aspect ratio up to
+// twice the width. The first one is served when no size is requested.
+var pictureSizes = []int{400, 200, 100}
+
+// pictureBlobKey returns the key of the thumbnail of the given size.
+func pictureBlobKey(pictureKey string, size int) string {
+	return fmt.Sprintf("%s/%d.jpg", pictureKey, size)
+}
+
+// readPicture decodes the image uploaded in the given form field. Uploads
+// are capped like avatars. It writes an error response and returns false if
+// the image is missing, too large or cannot be decoded.
+func (api *API) readPicture(w http.ResponseWriter, r *http.Request, field string) (image.Image, bool) {
+	maxBytes := avatarMaxBytes()
+	r.Body = http.MaxBytesReader(w, r.Body, maxBytes+1<<20)
+	file, _, err := r.FormFile(field)
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			api.httpGeneralWrite(http.StatusRequestEntityTooLarge, "Image is too large", nil, w)
+			return nil, false
+		}
+		api.httpGeneralWrite(http.StatusBadRequest, field+" file is required field", nil, w)
+		return nil, false
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, maxBytes+1))
+	if err != nil {
+		api.httpGeneralWrite(http.StatusBadRequest, err.Error(), nil, w)
+		return nil, false
+	}
+	if int64(len(data)) > maxBytes {
+		api.httpGeneralWrite(http.StatusRequestEntityTooLarge, "Image is too large", nil, w)
+		return nil, false
+	}
+
+	// Decode based on the sniffed content rather than the client's claim
+	img, contentType, err := imaging.Decode(data)
+	if err != nil {
+		if err == imaging.ErrUnsupportedFormat {
+			api.httpGeneralWrite(http.StatusUnsupportedMediaType, "Unsupported image type "+contentType, nil, w)
+			return nil, false
+		}
+		api.httpGeneralWrite(http.StatusBadRequest, "Invalid image: "+err.Error(), nil, w)
+		return nil, false
+	}
+	return img, true
+}
+
+// storePicture stores the thumbnails of img under a fresh key with the
+// given prefix, which it returns.
+func (api *API) storePicture(ctx context.Context, prefix string, img image.Image) (string, error) {
+	id, err := util.NewUUID()
+	if err != nil {
+		return "", err
+	}
+	pictureKey := prefix + id
+	for _, size := range pictureSizes {
+		var buf bytes.Buffer
+		err := imaging.EncodeJPEG(&buf, imaging.Fit(img, size, size*2), 85)
+		if err == nil {
+			err = api.BlobStore.PutBlob(ctx, pictureBlobKey(pictureKey, size), &buf, int64(buf.Len()), "image/jpeg")
+		}
+		if err != nil {
+			api.deletePicture(ctx, pictureKey)
+			return "", err
+		}
+	}
+	return pictureKey, nil
+}
+
+// deletePicture removes the stored thumbnails of a picture. Failures are
+// only logged since nothing points at them anymore.
+func (api *API) deletePicture(ctx context.Context, pictureKey string) {
+	if pictureKey == "" {
+		return
+	}
+	for _, size := range pictureSizes {
+		if err := api.BlobStore.DeleteBlob(ctx, pictureBlobKey(pictureKey, size)); err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+// servePicture writes the thumbnail of the size requested with the size
+// query parameter. The key changes on every upload, so it doubles as a
+// validator.
+func (api *API) servePicture(w http.ResponseWriter, r *http.Request, prefix, pictureKey string) {
+	size := pictureSizes[0]
+	if v := r.URL.Query().Get("size"); v != "" {
+		size, _ = strconv.Atoi(v)
+		if !containsInt(pictureSizes, size) {
+			api.httpGeneralWrite(http.StatusBadRequest, fmt.Sprintf("size must be one of %v", pictureSizes), nil, w)
+			return
+		}
+	}
+
+	etag := `"` + strings.TrimPrefix(pictureKey, prefix) + "-" + strconv.Itoa(size) + `"`
+	if inm := r.Header.Get("If-None-Match"); inm != "" && etagListMatches(inm, etag) {
+		setPictureCacheHeaders(w, etag)
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	blob, err := api.BlobStore.GetBlob(r.Context(), pictureBlobKey(pictureKey, size))
+	if err != nil {
+		if err == epublib.ErrNotFound {
+			api.httpGeneralWrite(http.StatusNotFound, "Image not found", nil, w)
+			return
+		}
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	defer blob.Close()
+	setPictureCacheHeaders(w, etag)
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if _, err := io.Copy(w, blob); err != nil {
+		log.Println(err)
+	}
+}
+
+// setPictureCacheHeaders lets clients keep thumbnails for a day.
+func setPictureCacheHeaders(w http.ResponseWriter, etag string) {
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+}
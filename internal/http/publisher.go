@@ -0,0 +1,448 @@
+package http
+
+import (
+	"encoding/json"
+	epublib "epublib"
+	"epublib/postgres"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// publisherLogoKeyPrefix prefixes the blob keys of publisher logos.
+const publisherLogoKeyPrefix = "publishers/"
+
+func (api *API) handleGetPublishers(w http.ResponseWriter, r *http.Request) {
+	// Construct filter based on query parameters
+	queryParams := r.URL.Query()
+	offset, _ := strconv.Atoi(queryParams.Get("offset"))
+	limit, _ := strconv.Atoi(queryParams.Get("limit"))
+	if limit <= 0 {
+		limit = 10
+	}
+	if limit > epublib.MaxPublisherPageSize {
+		limit = epublib.MaxPublisherPageSize
+	}
+	filter := epublib.PublisherFilter{
+		Name:   queryParams.Get("name"),
+		Offset: offset,
+		Limit:  limit,
+	}
+
+	// Retrieve publishers from the service
+	publishers, totalCount, err := api.PublisherService.FindPublishers(r.Context(), filter)
+	if err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+
+	// Prepare the response
+	response := map[string]interface{}{
+		"publishers":  publishers,
+		"total_count": totalCount,
+	}
+
+	// Send the response
+	api.httpGeneralWrite(http.StatusOK, "Success", response, w)
+}
+
+// findPublisher retrieves the publisher with the given ID and writes a not found
+// response if it does not exist.
+func (api *API) findPublisher(w http.ResponseWriter, r *http.Request, id string) (*epublib.Publisher, bool) {
+	publisher, err := api.PublisherService.FindPublisherByID(r.Context(), id)
+	if err != nil {
+		if err == epublib.ErrNotFound {
+			api.httpGeneralWrite(http.StatusNotFound, "Publisher not found", nil, w)
+			return nil, false
+		}
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return nil, false
+	}
+	return publisher, true
+}
+
+func (api *API) handleGetPublisherByID(w http.ResponseWriter, r *http.Request) {
+	// Extract publisher ID from the URL path
+	publisher, ok := api.findPublisher(w, r, mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+
+	// Prepare the response
+	response := map[string]interface{}{
+		"publisher": publisher,
+	}
+
+	// Send the response
+	w.Header().Set("ETag", versionETag(publisher.Version))
+	api.httpGeneralWrite(http.StatusOK, "Success", response, w)
+}
+
+// handleGetPublisherBooks lists the books of a publisher.
+func (api *API) handleGetPublisherBooks(w http.ResponseWriter, r *http.Request) {
+	// Extract publisher ID from the URL path
+	publisher, ok := api.findPublisher(w, r, mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+
+	// Construct filter based on query parameters
+	filter := parseBookFilter(r)
+	filter.PublisherID = publisher.ID
+	api.writeBooks(w, r, filter)
+}
+
+type CreatePublisherRequest struct {
+	Name        string   `json:"name"`
+	SortName    string   `json:"sort_name"`
+	Aliases     []string `json:"aliases"`
+	Description string   `json:"description"`
+	Website     string   `json:"website"`
+}
+
+func (api *API) handleCreatePublisher(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if !api.requireAdmin(w, r, "Only admin can manage publishers") {
+		return
+	}
+
+	// Parse the JSON request body into a CreatePublisherRequest struct
+	var payload CreatePublisherRequest
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		api.httpGeneralWrite(http.StatusBadRequest, "Invalid JSON payload", nil, w)
+		return
+	}
+	publisher := &epublib.Publisher{
+		Name:        strings.TrimSpace(payload.Name),
+		SortName:    strings.TrimSpace(payload.SortName),
+		Aliases:     payload.Aliases,
+		Description: payload.Description,
+		Website:     strings.TrimSpace(payload.Website),
+	}
+	if publisher.SortName == "" {
+		publisher.SortName = epublib.PublisherSortName(publisher.Name)
+	}
+
+	// Validate the required fields
+	if err := publisher.Validate(); err != nil {
+		api.httpGeneralWrite(http.StatusBadRequest, err.Error(), nil, w)
+		return
+	}
+
+	// Create the publisher using the service
+	if err := api.PublisherService.CreatePublisher(ctx, publisher); err != nil {
+		if err == epublib.ErrPublisherNameTaken {
+			api.httpGeneralWrite(http.StatusConflict, err.Error(), nil, w)
+			return
+		}
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+
+	// Prepare the response
+	response := map[string]interface{}{
+		"publisher": publisher,
+	}
+
+	// Send the response
+	w.Header().Set("ETag", versionETag(publisher.Version))
+	api.httpGeneralWrite(http.StatusCreated, "Publisher created successfully", response, w)
+}
+
+// PatchPublisherRequest holds the publisher fields a PATCH request may change.
+// Omitted fields keep their current value.
+type PatchPublisherRequest struct {
+	Name        *string   `json:"name"`
+	SortName    *string   `json:"sort_name"`
+	Aliases     *[]string `json:"aliases"`
+	Description *string   `json:"description"`
+	Website     *string   `json:"website"`
+}
+
+func (api *API) handlePatchPublisher(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if !api.requireAdmin(w, r, "Only admin can manage publishers") {
+		return
+	}
+	id := mux.Vars(r)["id"]
+	version, ok := api.requireIfMatch(w, r)
+	if !ok {
+		return
+	}
+	var patch PatchPublisherRequest
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		api.httpGeneralWrite(http.StatusBadRequest, "Invalid JSON payload", nil, w)
+		return
+	}
+
+	// Merge the patch onto the current publisher
+	publisher, ok := api.findPublisher(w, r, id)
+	if !ok {
+		return
+	}
+	if version != 0 && version != publisher.Version {
+		api.httpGeneralWrite(http.StatusPreconditionFailed, "Publisher was modified by another request", nil, w)
+		return
+	}
+	if patch.Name != nil {
+		publisher.Name = strings.TrimSpace(*patch.Name)
+	}
+	if patch.SortName != nil {
+		publisher.SortName = strings.TrimSpace(*patch.SortName)
+	}
+	if publisher.SortName == "" {
+		publisher.SortName = epublib.PublisherSortName(publisher.Name)
+	}
+	if patch.Aliases != nil {
+		publisher.Aliases = *patch.Aliases
+	}
+	if patch.Description != nil {
+		publisher.Description = *patch.Description
+	}
+	if patch.Website != nil {
+		publisher.Website = strings.TrimSpace(*patch.Website)
+	}
+	if err := publisher.Validate(); err != nil {
+		api.httpGeneralWrite(http.StatusBadRequest, err.Error(), nil, w)
+		return
+	}
+
+	// Update the publisher using the service
+	publisher, err := api.PublisherService.UpdatePublisher(ctx, id, epublib.PublisherUpdate{
+		Name:        publisher.Name,
+		SortName:    publisher.SortName,
+		Aliases:     publisher.Aliases,
+		Description: publisher.Description,
+		Website:     publisher.Website,
+		Version:     publisher.Version,
+	})
+	if err != nil {
+		if err == epublib.ErrNotFound {
+			api.httpGeneralWrite(http.StatusNotFound, "Publisher not found", nil, w)
+			return
+		}
+		if err == epublib.ErrConflict {
+			api.httpGeneralWrite(http.StatusPreconditionFailed, "Publisher was modified by another request", nil, w)
+			return
+		}
+		if err == epublib.ErrPublisherNameTaken {
+			api.httpGeneralWrite(http.StatusConflict, err.Error(), nil, w)
+			return
+		}
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+
+	// Prepare the response
+	response := map[string]interface{}{
+		"publisher": publisher,
+	}
+
+	// Send the response
+	w.Header().Set("ETag", versionETag(publisher.Version))
+	api.httpGeneralWrite(http.StatusOK, "Publisher updated successfully", response, w)
+}
+
+// handleDeletePublisher deletes a publisher and unlinks it from its books.
+// Those books keep the publisher name, they are linked to a new publisher
+// when the book is edited again.
+func (api *API) handleDeletePublisher(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if !api.requireAdmin(w, r, "Only admin can manage publishers") {
+		return
+	}
+	version, ok := api.requireIfMatch(w, r)
+	if !ok {
+		return
+	}
+
+	//Begin transaction
+	txCtx, err := postgres.BeginTx(ctx, api.db)
+	if err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	defer postgres.Rollback(txCtx)
+	if err := api.PublisherService.DeletePublisher(txCtx, mux.Vars(r)["id"], version); err != nil {
+		if err == epublib.ErrNotFound {
+			api.httpGeneralWrite(http.StatusNotFound, "Publisher not found", nil, w)
+			return
+		}
+		if err == epublib.ErrConflict {
+			api.httpGeneralWrite(http.StatusPreconditionFailed, "Publisher was modified by another request", nil, w)
+			return
+		}
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	if err := postgres.Commit(txCtx); err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	api.httpGeneralWrite(http.StatusOK, "Publisher deleted successfully", nil, w)
+}
+
+type MergePublishersRequest struct {
+	PublisherIDs []string `json:"publisher_ids"`
+}
+
+// handleMergePublishers merges duplicates into the publisher of the URL path,
+// which keeps its name and gains theirs as aliases.
+func (api *API) handleMergePublishers(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if !api.requireAdmin(w, r, "Only admin can manage publishers") {
+		return
+	}
+	id := mux.Vars(r)["id"]
+	var payload MergePublishersRequest
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		api.httpGeneralWrite(http.StatusBadRequest, "Invalid JSON payload", nil, w)
+		return
+	}
+	if len(payload.PublisherIDs) == 0 {
+		api.httpGeneralWrite(http.StatusBadRequest, "publisher_ids is required field", nil, w)
+		return
+	}
+	for _, otherID := range payload.PublisherIDs {
+		if otherID == id {
+			api.httpGeneralWrite(http.StatusBadRequest, "publisher cannot be merged into itself", nil, w)
+			return
+		}
+	}
+
+	//Begin transaction
+	txCtx, err := postgres.BeginTx(ctx, api.db)
+	if err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	defer postgres.Rollback(txCtx)
+	publisher, err := api.PublisherService.MergePublishers(txCtx, id, payload.PublisherIDs)
+	if err != nil {
+		if err == epublib.ErrNotFound {
+			api.httpGeneralWrite(http.StatusNotFound, "Publisher not found", nil, w)
+			return
+		}
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	if err := postgres.Commit(txCtx); err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+
+	// Prepare the response
+	response := map[string]interface{}{
+		"publisher": publisher,
+	}
+
+	// Send the response
+	w.Header().Set("ETag", versionETag(publisher.Version))
+	api.httpGeneralWrite(http.StatusOK, "Publishers merged successfully", response, w)
+}
+
+// handleGetDuplicatePublishers lists groups of publishers that may be the same
+// publishing house, for admins to merge.
+func (api *API) handleGetDuplicatePublishers(w http.ResponseWriter, r *http.Request) {
+	if !api.requireAdmin(w, r, "Only admin can manage publishers") {
+		return
+	}
+
+	// Retrieve duplicates from the service
+	duplicates, err := api.PublisherService.FindDuplicatePublishers(r.Context())
+	if err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+
+	// Prepare the response
+	response := map[string]interface{}{
+		"duplicates": duplicates,
+	}
+
+	// Send the response
+	api.httpGeneralWrite(http.StatusOK, "Success", response, w)
+}
+
+func (api *API) handleUploadPublisherLogo(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if !api.requireAdmin(w, r, "Only admin can manage publishers") {
+		return
+	}
+	img, ok := api.readPicture(w, r, "logo")
+	if !ok {
+		return
+	}
+
+	// Extract publisher ID from the URL path
+	publisher, ok := api.findPublisher(w, r, mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+
+	// Store the thumbnails and point the publisher at them
+	logoKey, err := api.storePicture(ctx, publisherLogoKeyPrefix, img)
+	if err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	updated, err := api.PublisherService.SetPublisherLogo(ctx, publisher.ID, logoKey)
+	if err != nil {
+		api.deletePicture(ctx, logoKey)
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	api.deletePicture(ctx, publisher.LogoKey)
+
+	// Prepare the response
+	response := map[string]interface{}{
+		"publisher": updated,
+	}
+
+	// Send the response
+	w.Header().Set("ETag", versionETag(updated.Version))
+	api.httpGeneralWrite(http.StatusOK, "Logo uploaded successfully", response, w)
+}
+
+func (api *API) handleGetPublisherLogo(w http.ResponseWriter, r *http.Request) {
+	// Extract publisher ID from the URL path
+	publisher, ok := api.findPublisher(w, r, mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+	if publisher.LogoKey == "" {
+		api.httpGeneralWrite(http.StatusNotFound, "Publisher has no logo", nil, w)
+		return
+	}
+	api.servePicture(w, r, publisherLogoKeyPrefix, publisher.LogoKey)
+}
+
+func (api *API) handleDeletePublisherLogo(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if !api.requireAdmin(w, r, "Only admin can manage publishers") {
+		return
+	}
+
+	// Extract publisher ID from the URL path
+	publisher, ok := api.findPublisher(w, r, mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+	updated, err := api.PublisherService.SetPublisherLogo(ctx, publisher.ID, "")
+	if err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	api.deletePicture(ctx, publisher.LogoKey)
+
+	// Prepare the response
+	response := map[string]interface{}{
+		"publisher": updated,
+	}
+
+	// Send the response
+	w.Header().Set("ETag", versionETag(updated.Version))
+	api.httpGeneralWrite(http.StatusOK, "Logo deleted successfully", response, w)
+}
@@ -1,6 +1,7 @@
 package http
 
 import (
+	"context"
 	"encoding/json"
 	epublib "epublib"
 	"fmt"
@@ -47,7 +48,7 @@ func (api *API) handleResetPasswordRequest(w http.ResponseWriter, r *http.Reques
 		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
 		return
 	}
-	mail, err := buildMailForToken(auth, token)
+	mail, err := buildMailForToken(ctx, auth, token)
 	if err != nil {
 		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
 		return
@@ -114,14 +115,24 @@ func (api *API) handleResetPassword(w http.ResponseWriter, r *http.Request) {
 	api.httpGeneralWrite(http.StatusOK, "Success", nil, w)
 }
 
-func buildMailForToken(auth *epublib.Auth, token *epublib.ResetToken) (*epublib.Mail, error) {
-	templateFilePath := os.Getenv("TEMPLATE_FILE_PATH")
+func buildMailForToken(ctx context.Context, auth *epublib.Auth, token *epublib.ResetToken) (*epublib.Mail, error) {
+	return buildTokenMail(ctx, "TEMPLATE_FILE_PATH", "Reset Password", auth, token)
+}
+
+// buildTokenMail renders the template named by the templateEnv environment
+// variable with the reset token variables and addresses it to auth. The mail
+// is sent from the tenant's sender when it has one.
+func buildTokenMail(ctx context.Context, templateEnv, subject string, auth *epublib.Auth, token *epublib.ResetToken) (*epublib.Mail, error) {
+	templateFilePath := os.Getenv(templateEnv)
 	if templateFilePath == "" {
-		err := fmt.Errorf("TEMPLATE_FILE_PATH environment variable not set")
+		err := fmt.Errorf("%s environment variable not set", templateEnv)
 		log.Println(err)
 		return nil, err
 	}
 	senderAddr := os.Getenv("SMTP_SENDER_ADDR")
+	if tenant := epublib.TenantFromContext(ctx); tenant != nil && tenant.Config.MailSender != "" {
+		senderAddr = tenant.Config.MailSender
+	}
 	if senderAddr == "" {
 		err := fmt.Errorf("SMTP_SENDER_ADDR environment variable not set")
 		log.Println(err)
@@ -136,13 +147,14 @@ func buildMailForToken(auth *epublib.Auth, token *epublib.ResetToken) (*epublib.
 		"RESET_TOKEN_ID": token.ID,
 		"TOKEN":          token.Token,
 		"USERNAME":       auth.Username,
+		"LIBRARY_NAME":   libraryName(ctx),
 	}
 	emailContent := generateEmailContent(string(content), variablesMap)
 	return &epublib.Mail{
 		Channel:     "email",
 		From:        senderAddr,
 		To:          auth.Email,
-		Subject:     "Reset Password",
+		Subject:     subject,
 		ContentType: "text/html",
 		Body:        emailContent,
 	}, nil
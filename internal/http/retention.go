@@ -0,0 +1,131 @@
+package http
+
+import (
+	"context"
+	epublib "epublib"
+	"epublib/postgres"
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	// defaultUserRetentionDays is used when USER_RETENTION_DAYS is not set.
+	defaultUserRetentionDays = 365
+
+	// defaultResetTokenRetentionDays is used when RESET_TOKEN_RETENTION_DAYS is not set.
+	defaultResetTokenRetentionDays = 7
+)
+
+// retentionDays reads a retention window in days from the environment.
+// Negative values disable the purge.
+func retentionDays(key string, def int) int {
+	if v, err := strconv.Atoi(os.Getenv(key)); err == nil {
+		return v
+	}
+	return def
+}
+
+// processRetention cleans up soft deleted users and reset tokens once they
+// have been deleted for longer than their retention window. Users are
+// anonymized, or hard deleted when USER_RETENTION_MODE is "delete".
+func (api *API) processRetention(ctx context.Context) error {
+	if days := retentionDays("RESET_TOKEN_RETENTION_DAYS", defaultResetTokenRetentionDays); days >= 0 {
+		expired, err := api.ResetTokenService.ExpireResetTokens(ctx)
+		if err != nil {
+			return err
+		}
+		purged, err := api.ResetTokenService.PurgeResetTokens(ctx, time.Now().AddDate(0, 0, -days))
+		if err != nil {
+			return err
+		}
+		if expired > 0 || purged > 0 {
+			log.Printf("retention: expired %d and purged %d reset tokens", expired, purged)
+		}
+	}
+
+	days := retentionDays("USER_RETENTION_DAYS", defaultUserRetentionDays)
+	if days < 0 {
+		return nil
+	}
+	hardDelete := os.Getenv("USER_RETENTION_MODE") == "delete"
+	filter := epublib.UserFilter{
+		OnlyDeleted:   true,
+		DeletedBefore: time.Now().AddDate(0, 0, -days),
+		Limit:         epublib.MaxUserPageSize,
+	}
+
+	// Anonymized users stay soft deleted, skip them rather than revisiting
+	// every one of them on each run
+	if !hardDelete {
+		filter.NotErased = true
+	}
+	for {
+		users, _, err := api.UserService.FindUsers(ctx, filter)
+		if err != nil {
+			return err
+		}
+		for _, user := range users {
+			if hardDelete {
+				err = api.purgeUser(ctx, user)
+			} else {
+				err = api.anonymizeUser(ctx, user)
+			}
+			if err != nil {
+				log.Printf("retention of user %s: %v", user.ID, err)
+			}
+		}
+		if len(users) < filter.Limit {
+			return nil
+		}
+		filter.After = epublib.NewUserCursor(users[len(users)-1], filter.Sort)
+	}
+}
+
+// anonymizeUser erases a deleted user through the regular erasure workflow
+// so the erasure is recorded, unless it has been erased already.
+func (api *API) anonymizeUser(ctx context.Context, user *epublib.User) error {
+	erasures, err := api.ErasureService.FindErasureRequestsByUserID(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	for _, erasure := range erasures {
+		if !erasure.CompletedAt.IsZero() {
+			return nil
+		}
+		if erasure.IsPending() {
+			if err := api.ErasureService.CancelErasureRequest(ctx, erasure.ID); err != nil {
+				return err
+			}
+		}
+	}
+	req := &epublib.ErasureRequest{
+		UserID:       user.ID,
+		Reason:       "retention period of deleted user expired",
+		ScheduledFor: time.Now(),
+	}
+	if err := api.ErasureService.CreateErasureRequest(ctx, req); err != nil {
+		return err
+	}
+	return api.eraseUser(ctx, req)
+}
+
+// purgeUser permanently deletes a deleted user and its stored files.
+func (api *API) purgeUser(ctx context.Context, user *epublib.User) error {
+	//Begin transaction
+	txCtx, err := postgres.BeginTx(ctx, api.db)
+	if err != nil {
+		return err
+	}
+	defer postgres.Rollback(txCtx)
+	if err := api.UserService.PurgeUser(txCtx, user.ID); err != nil {
+		return err
+	}
+	if err := postgres.Commit(txCtx); err != nil {
+		return err
+	}
+	api.deleteAvatar(ctx, user.ID, user.ImgProfile)
+	log.Printf("retention: purged user %s", user.ID)
+	return nil
+}
@@ -9,8 +9,10 @@ import (
 
 func (api *API) Register() {
 	api.Router.Use(api.handleCors)
+	api.Router.HandleFunc("/api/v1/swagger-spec", byteHandler(epublib.SwaggerSpec)).Methods("GET")
 	router := api.Router.PathPrefix("/api/v1").Subrouter()
-	router.HandleFunc("/swagger-spec", byteHandler(epublib.SwaggerSpec)).Methods("GET")
+	router.HandleFunc("/tenant", api.handleGetCurrentTenant).Methods("GET")
+	router.Use(api.resolveTenant)
 	router.Use(api.authenticate)
 	router.Use(api.handleCors)
 
@@ -33,10 +35,119 @@ func (api *API) Register() {
 		r.Use(api.requireAuth)
 
 		r.HandleFunc("/users", api.handleGetUsers).Methods("GET")
+		r.HandleFunc("/users/export", api.handleExportUsers).Methods("GET")
+		r.HandleFunc("/users/import", api.handleImportUsers).Methods("POST")
 		r.HandleFunc("/users/{id}", api.handleGetUserByID).Methods("GET")
+		r.HandleFunc("/users/by-username/{username}", api.handleGetUserByUsername).Methods("GET")
 		r.HandleFunc("/users", api.handleCreateUser).Methods("POST")
 		r.HandleFunc("/users/{id}", api.handleUpdateUser).Methods("PUT")
+		r.HandleFunc("/users/{id}", api.handlePatchUser).Methods("PATCH")
 		r.HandleFunc("/users/{id}", api.handleDeleteUser).Methods("DELETE")
+		r.HandleFunc("/users/{id}/restore", api.handleRestoreUser).Methods("POST")
+		r.HandleFunc("/users/{id}/username", api.handleChangeUsername).Methods("PUT")
+		r.HandleFunc("/users/{id}/avatar", api.handleUploadAvatar).Methods("POST")
+		r.HandleFunc("/users/{id}/avatar", api.handleGetAvatar).Methods("GET")
+		r.HandleFunc("/users/{id}/erasure", api.handleRequestUserErasure).Methods("POST")
+		r.HandleFunc("/users/{id}/erasure", api.handleCancelUserErasure).Methods("DELETE")
+		r.HandleFunc("/users/{id}/groups", api.handleGetUserGroups).Methods("GET")
+
+		r.HandleFunc("/groups", api.handleGetGroups).Methods("GET")
+		r.HandleFunc("/groups", api.handleCreateGroup).Methods("POST")
+		r.HandleFunc("/groups/{id}", api.handleGetGroupByID).Methods("GET")
+		r.HandleFunc("/groups/{id}", api.handlePatchGroup).Methods("PATCH")
+		r.HandleFunc("/groups/{id}", api.handleDeleteGroup).Methods("DELETE")
+		r.HandleFunc("/groups/{id}/members", api.handleGetGroupMembers).Methods("GET")
+		r.HandleFunc("/groups/{id}/members/{userId}", api.handleSetGroupMember).Methods("PUT")
+		r.HandleFunc("/groups/{id}/members/{userId}", api.handleRemoveGroupMember).Methods("DELETE")
+
+		r.HandleFunc("/tenant", api.handlePatchCurrentTenant).Methods("PATCH")
+		r.HandleFunc("/tenants", api.handleGetTenants).Methods("GET")
+		r.HandleFunc("/tenants", api.handleCreateTenant).Methods("POST")
+		r.HandleFunc("/tenants/{id}", api.handleGetTenantByID).Methods("GET")
+		r.HandleFunc("/tenants/{id}", api.handlePatchTenant).Methods("PATCH")
+		r.HandleFunc("/tenants/{id}", api.handleDeleteTenant).Methods("DELETE")
+
+		r.HandleFunc("/books", api.handleGetBooks).Methods("GET")
+		r.HandleFunc("/books", api.handleCreateBook).Methods("POST")
+		r.HandleFunc("/books/upload", api.handleUploadBook).Methods("POST")
+		r.HandleFunc("/books/{id}", api.handleGetBookByID).Methods("GET")
+		r.HandleFunc("/books/{id}", api.handlePatchBook).Methods("PATCH")
+		r.HandleFunc("/books/{id}", api.handleDeleteBook).Methods("DELETE")
+		r.HandleFunc("/books/{id}/file", api.handleGetBookFile).Methods("GET")
+		r.HandleFunc("/books/{id}/file/metadata", api.handleWriteBookMetadata).Methods("POST")
+		r.HandleFunc("/books/{id}/revisions", api.handleGetBookRevisions).Methods("GET")
+		r.HandleFunc("/books/{id}/revisions", api.handleUploadBookRevision).Methods("POST")
+		r.HandleFunc("/books/{id}/revisions/diff", api.handleDiffBookRevisions).Methods("GET")
+		r.HandleFunc("/books/{id}/revisions/{number}", api.handleGetBookRevision).Methods("GET")
+		r.HandleFunc("/books/{id}/revisions/{number}/file", api.handleGetBookRevisionFile).Methods("GET")
+		r.HandleFunc("/books/{id}/revisions/{number}/activate", api.handleActivateBookRevision).Methods("POST")
+		r.HandleFunc("/books/{id}/validation", api.handleGetBookValidation).Methods("GET")
+		r.HandleFunc("/books/{id}/validation", api.handleValidateBook).Methods("POST")
+		r.HandleFunc("/books/{id}/cover", api.handleGetBookCover).Methods("GET")
+		r.HandleFunc("/books/{id}/cover", api.handleRegenerateBookCover).Methods("POST")
+		r.HandleFunc("/books/{id}/next", api.handleGetNextInSeries).Methods("GET")
+		r.HandleFunc("/books/{id}/categories/suggestions", api.handleGetBookCategorySuggestions).Methods("GET")
+		r.HandleFunc("/books/{id}/metadata/lookup", api.handleLookupBookMetadata).Methods("POST")
+		r.HandleFunc("/books/{id}/search", api.handleSearchBook).Methods("GET")
+		r.HandleFunc("/books/{id}/search/index", api.handleIndexBookText).Methods("POST")
+		r.HandleFunc("/books/{id}/toc", api.handleGetBookTOC).Methods("GET")
+		r.HandleFunc("/books/{id}/spine", api.handleGetBookSpine).Methods("GET")
+		r.HandleFunc("/books/{id}/content/{path:.+}", api.handleGetBookContent).Methods("GET")
+
+		r.HandleFunc("/authors", api.handleGetAuthors).Methods("GET")
+		r.HandleFunc("/authors", api.handleCreateAuthor).Methods("POST")
+		r.HandleFunc("/authors/duplicates", api.handleGetDuplicateAuthors).Methods("GET")
+		r.HandleFunc("/authors/{id}", api.handleGetAuthorByID).Methods("GET")
+		r.HandleFunc("/authors/{id}", api.handlePatchAuthor).Methods("PATCH")
+		r.HandleFunc("/authors/{id}", api.handleDeleteAuthor).Methods("DELETE")
+		r.HandleFunc("/authors/{id}/books", api.handleGetAuthorBooks).Methods("GET")
+		r.HandleFunc("/authors/{id}/merge", api.handleMergeAuthors).Methods("POST")
+		r.HandleFunc("/authors/{id}/photo", api.handleGetAuthorPhoto).Methods("GET")
+		r.HandleFunc("/authors/{id}/photo", api.handleUploadAuthorPhoto).Methods("POST")
+		r.HandleFunc("/authors/{id}/photo", api.handleDeleteAuthorPhoto).Methods("DELETE")
+
+		r.HandleFunc("/publishers", api.handleGetPublishers).Methods("GET")
+		r.HandleFunc("/publishers", api.handleCreatePublisher).Methods("POST")
+		r.HandleFunc("/publishers/duplicates", api.handleGetDuplicatePublishers).Methods("GET")
+		r.HandleFunc("/publishers/{id}", api.handleGetPublisherByID).Methods("GET")
+		r.HandleFunc("/publishers/{id}", api.handlePatchPublisher).Methods("PATCH")
+		r.HandleFunc("/publishers/{id}", api.handleDeletePublisher).Methods("DELETE")
+		r.HandleFunc("/publishers/{id}/books", api.handleGetPublisherBooks).Methods("GET")
+		r.HandleFunc("/publishers/{id}/merge", api.handleMergePublishers).Methods("POST")
+		r.HandleFunc("/publishers/{id}/logo", api.handleGetPublisherLogo).Methods("GET")
+		r.HandleFunc("/publishers/{id}/logo", api.handleUploadPublisherLogo).Methods("POST")
+		r.HandleFunc("/publishers/{id}/logo", api.handleDeletePublisherLogo).Methods("DELETE")
+		r.HandleFunc("/series", api.handleGetSeries).Methods("GET")
+		r.HandleFunc("/series", api.handleCreateSeries).Methods("POST")
+		r.HandleFunc("/series/{id}", api.handleGetSeriesByID).Methods("GET")
+		r.HandleFunc("/series/{id}", api.handlePatchSeries).Methods("PATCH")
+		r.HandleFunc("/series/{id}", api.handleDeleteSeries).Methods("DELETE")
+		r.HandleFunc("/series/{id}/books", api.handleGetSeriesBooks).Methods("GET")
+		r.HandleFunc("/categories", api.handleGetCategories).Methods("GET")
+		r.HandleFunc("/categories", api.handleCreateCategory).Methods("POST")
+		r.HandleFunc("/categories/{id}", api.handleGetCategoryByID).Methods("GET")
+		r.HandleFunc("/categories/{id}", api.handlePatchCategory).Methods("PATCH")
+		r.HandleFunc("/categories/{id}", api.handleDeleteCategory).Methods("DELETE")
+		r.HandleFunc("/categories/{id}/books", api.handleGetCategoryBooks).Methods("GET")
+
+		r.HandleFunc("/metadata-proposals", api.handleGetMetadataProposals).Methods("GET")
+		r.HandleFunc("/metadata-proposals/{id}", api.handleGetMetadataProposalByID).Methods("GET")
+		r.HandleFunc("/metadata-proposals/{id}/apply", api.handleApplyMetadataProposal).Methods("POST")
+		r.HandleFunc("/metadata-proposals/{id}/reject", api.handleRejectMetadataProposal).Methods("POST")
+
+		r.HandleFunc("/settings/schema", api.handleGetSettingsSchema).Methods("GET")
+		r.HandleFunc("/settings/defaults", api.handleGetSettingDefaults).Methods("GET")
+		r.HandleFunc("/settings/defaults", api.handleUpdateSettingDefaults).Methods("PATCH")
+
+		r.HandleFunc("/search", api.handleSearch).Methods("GET")
+		r.HandleFunc("/me/settings", api.handleGetMySettings).Methods("GET")
+		r.HandleFunc("/me/settings", api.handleUpdateMySettings).Methods("PATCH")
+		r.HandleFunc("/me/phone/verification", api.handleSendPhoneVerification).Methods("POST")
+		r.HandleFunc("/me/phone/verification/confirm", api.handleConfirmPhoneVerification).Methods("POST")
+		r.HandleFunc("/me/data-export", api.handleExportMyData).Methods("GET")
+		r.HandleFunc("/me/erasure", api.handleGetMyErasure).Methods("GET")
+		r.HandleFunc("/me/erasure", api.handleRequestMyErasure).Methods("POST")
+		r.HandleFunc("/me/erasure", api.handleCancelMyErasure).Methods("DELETE")
 	}
 }
 
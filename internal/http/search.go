@@ -0,0 +1,184 @@
+package http
+
+import (
+	epublib "epublib"
+	"epublib/epub"
+	"epublib/postgres"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// bookPassages converts the passages of an EPUB for the search index.
+func bookPassages(reader *epub.Reader) []epublib.TextPassage {
+	passages := []epublib.TextPassage{}
+	for _, p := range reader.Passages() {
+		passages = append(passages, epublib.TextPassage{
+			SpineIndex: p.SpineIndex,
+			Path:       p.Path,
+			Fragment:   p.Fragment,
+			Position:   p.Position,
+			Text:       p.Text,
+		})
+	}
+	return passages
+}
+
+// parseSearchFilter constructs a search filter from the query parameters.
+func parseSearchFilter(r *http.Request) epublib.SearchFilter {
+	queryParams := r.URL.Query()
+	offset, _ := strconv.Atoi(queryParams.Get("offset"))
+	limit, _ := strconv.Atoi(queryParams.Get("limit"))
+	if limit <= 0 {
+		limit = 10
+	}
+	if limit > epublib.MaxSearchPageSize {
+		limit = epublib.MaxSearchPageSize
+	}
+	return epublib.SearchFilter{
+		Query:    strings.TrimSpace(queryParams.Get("q")),
+		Language: queryParams.Get("language"),
+		Offset:   offset,
+		Limit:    limit,
+	}
+}
+
+// handleSearch searches the content of every book the user may read.
+func (api *API) handleSearch(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	// Construct filter based on query parameters
+	filter := parseSearchFilter(r)
+	if filter.Query == "" {
+		api.httpGeneralWrite(http.StatusBadRequest, "q is required field", nil, w)
+		return
+	}
+	isAdmin, err := api.isAdmin(ctx)
+	if err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	if !isAdmin {
+		filter.Statuses = []epublib.BookStatus{epublib.PublishedBook}
+	}
+
+	// Retrieve hits from the service
+	hits, totalCount, err := api.SearchService.Search(ctx, filter)
+	if err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+
+	// Prepare the response
+	response := map[string]interface{}{
+		"hits":        hits,
+		"total_count": totalCount,
+	}
+
+	// Send the response
+	api.httpGeneralWrite(http.StatusOK, "Success", response, w)
+}
+
+// handleSearchBook searches the content of a single book, listing hits in
+// reading order.
+func (api *API) handleSearchBook(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	// Construct filter based on query parameters
+	filter := parseSearchFilter(r)
+	if filter.Query == "" {
+		api.httpGeneralWrite(http.StatusBadRequest, "q is required field", nil, w)
+		return
+	}
+
+	// Extract the book ID from the URL path
+	book, ok := api.findVisibleBook(w, r, mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+	filter.BookID = book.ID
+	filter.Language = ""
+
+	// Retrieve hits from the service
+	hits, totalCount, err := api.SearchService.Search(ctx, filter)
+	if err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+
+	// Prepare the response
+	response := map[string]interface{}{
+		"hits":        hits,
+		"total_count": totalCount,
+	}
+
+	// Send the response
+	api.httpGeneralWrite(http.StatusOK, "Success", response, w)
+}
+
+// handleIndexBookText extracts the text of a book from its EPUB file again
+// and replaces its search index, for instance for books uploaded before
+// search was supported.
+func (api *API) handleIndexBookText(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if !api.requireAdmin(w, r, "Only admin can manage books") {
+		return
+	}
+
+	// Extract the book ID from the URL path
+	book, err := api.BookService.FindBookByID(ctx, mux.Vars(r)["id"])
+	if err != nil {
+		if err == epublib.ErrNotFound {
+			api.httpGeneralWrite(http.StatusNotFound, "Book not found", nil, w)
+			return
+		}
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	if book.FileKey == "" {
+		api.httpGeneralWrite(http.StatusNotFound, "Book has no EPUB file", nil, w)
+		return
+	}
+	reader, closer, err := api.openBookEPUB(ctx, book)
+	if err != nil {
+		if err == epublib.ErrNotFound {
+			api.httpGeneralWrite(http.StatusNotFound, "EPUB file not found", nil, w)
+			return
+		}
+		if errors.Is(err, epub.ErrInvalidEPUB) {
+			api.httpGeneralWrite(http.StatusUnprocessableEntity, err.Error(), nil, w)
+			return
+		}
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	defer closer.Close()
+	passages := bookPassages(reader)
+
+	//Begin transaction
+	txCtx, err := postgres.BeginTx(ctx, api.db)
+	if err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	defer postgres.Rollback(txCtx)
+	if err := api.SearchService.IndexBookText(txCtx, book.ID, book.Language, passages); err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	if err := postgres.Commit(txCtx); err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+
+	// Prepare the response
+	response := map[string]interface{}{
+		"passage_count": len(passages),
+	}
+
+	// Send the response
+	api.httpGeneralWrite(http.StatusOK, "Book indexed successfully", response, w)
+}
@@ -0,0 +1,342 @@
+package http
+
+import (
+	"encoding/json"
+	epublib "epublib"
+	"epublib/postgres"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+func (api *API) handleGetSeries(w http.ResponseWriter, r *http.Request) {
+	// Construct filter based on query parameters
+	queryParams := r.URL.Query()
+	offset, _ := strconv.Atoi(queryParams.Get("offset"))
+	limit, _ := strconv.Atoi(queryParams.Get("limit"))
+	if limit <= 0 {
+		limit = 10
+	}
+	if limit > epublib.MaxSeriesPageSize {
+		limit = epublib.MaxSeriesPageSize
+	}
+	filter := epublib.SeriesFilter{
+		Name:   queryParams.Get("name"),
+		Offset: offset,
+		Limit:  limit,
+	}
+
+	// Retrieve series from the service
+	list, totalCount, err := api.SeriesService.FindSeries(r.Context(), filter)
+	if err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+
+	// Prepare the response
+	response := map[string]interface{}{
+		"series":      list,
+		"total_count": totalCount,
+	}
+
+	// Send the response
+	api.httpGeneralWrite(http.StatusOK, "Success", response, w)
+}
+
+// findSeries retrieves the series with the given ID and writes a not found
+// response if it does not exist.
+func (api *API) findSeries(w http.ResponseWriter, r *http.Request, id string) (*epublib.Series, bool) {
+	series, err := api.SeriesService.FindSeriesByID(r.Context(), id)
+	if err != nil {
+		if err == epublib.ErrNotFound {
+			api.httpGeneralWrite(http.StatusNotFound, "Series not found", nil, w)
+			return nil, false
+		}
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return nil, false
+	}
+	return series, true
+}
+
+// visibleStatuses returns the book statuses the current user may read, none
+// meaning all of them.
+func (api *API) visibleStatuses(r *http.Request) ([]epublib.BookStatus, error) {
+	isAdmin, err := api.isAdmin(r.Context())
+	if err != nil || isAdmin {
+		return nil, err
+	}
+	return []epublib.BookStatus{epublib.PublishedBook}, nil
+}
+
+// checkBookSeries writes a bad request response if a book is placed in a
+// series that does not exist.
+func (api *API) checkBookSeries(w http.ResponseWriter, r *http.Request, book *epublib.Book) bool {
+	if book.SeriesID == "" {
+		return true
+	}
+	if _, err := api.SeriesService.FindSeriesByID(r.Context(), book.SeriesID); err != nil {
+		if err == epublib.ErrNotFound {
+			api.httpGeneralWrite(http.StatusBadRequest, "series_id does not match any series", nil, w)
+			return false
+		}
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return false
+	}
+	return true
+}
+
+// handleGetSeriesByID sends a series with its volumes in reading order. Series
+// longer than a page of books are listed in full through
+// handleGetSeriesBooks.
+func (api *API) handleGetSeriesByID(w http.ResponseWriter, r *http.Request) {
+	// Extract series ID from the URL path
+	series, ok := api.findSeries(w, r, mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+
+	// Retrieve the volumes the user may read
+	statuses, err := api.visibleStatuses(r)
+	if err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	volumes, totalCount, err := api.BookService.FindBooks(r.Context(), epublib.BookFilter{
+		SeriesID: series.ID,
+		Statuses: statuses,
+		Limit:    epublib.MaxBookPageSize,
+	})
+	if err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	if volumes == nil {
+		volumes = []*epublib.Book{}
+	}
+
+	// Prepare the response
+	response := map[string]interface{}{
+		"series":       series,
+		"volumes":      volumes,
+		"volume_count": totalCount,
+	}
+
+	// Send the response
+	w.Header().Set("ETag", versionETag(series.Version))
+	api.httpGeneralWrite(http.StatusOK, "Success", response, w)
+}
+
+// handleGetSeriesBooks lists the volumes of a series by series position.
+func (api *API) handleGetSeriesBooks(w http.ResponseWriter, r *http.Request) {
+	// Extract series ID from the URL path
+	series, ok := api.findSeries(w, r, mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+
+	// Construct filter based on query parameters
+	filter := parseBookFilter(r)
+	filter.SeriesID = series.ID
+	api.writeBooks(w, r, filter)
+}
+
+// handleGetNextInSeries sends the volume following a book in its series,
+// skipping those the user may not read.
+func (api *API) handleGetNextInSeries(w http.ResponseWriter, r *http.Request) {
+	// Extract book ID from the URL path
+	book, ok := api.findVisibleBook(w, r, mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+	if book.SeriesID == "" {
+		api.httpGeneralWrite(http.StatusNotFound, "Book is not part of a series", nil, w)
+		return
+	}
+
+	// Retrieve the next volume
+	statuses, err := api.visibleStatuses(r)
+	if err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	next, err := api.SeriesService.FindNextInSeries(r.Context(), book.SeriesID, book.SeriesPosition, statuses)
+	if err != nil {
+		if err == epublib.ErrNotFound {
+			api.httpGeneralWrite(http.StatusNotFound, "Book is the last volume of its series", nil, w)
+			return
+		}
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+
+	// Prepare the response
+	response := map[string]interface{}{
+		"book": next,
+	}
+
+	// Send the response
+	api.httpGeneralWrite(http.StatusOK, "Success", response, w)
+}
+
+type CreateSeriesRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+func (api *API) handleCreateSeries(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if !api.requireAdmin(w, r, "Only admin can manage series") {
+		return
+	}
+
+	// Parse the JSON request body into a CreateSeriesRequest struct
+	var payload CreateSeriesRequest
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		api.httpGeneralWrite(http.StatusBadRequest, "Invalid JSON payload", nil, w)
+		return
+	}
+	series := &epublib.Series{
+		Name:        strings.TrimSpace(payload.Name),
+		Description: payload.Description,
+	}
+
+	// Validate the required fields
+	if err := series.Validate(); err != nil {
+		api.httpGeneralWrite(http.StatusBadRequest, err.Error(), nil, w)
+		return
+	}
+
+	// Create the series using the service
+	if err := api.SeriesService.CreateSeries(ctx, series); err != nil {
+		if err == epublib.ErrSeriesNameTaken {
+			api.httpGeneralWrite(http.StatusConflict, err.Error(), nil, w)
+			return
+		}
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+
+	// Prepare the response
+	response := map[string]interface{}{
+		"series": series,
+	}
+
+	// Send the response
+	w.Header().Set("ETag", versionETag(series.Version))
+	api.httpGeneralWrite(http.StatusCreated, "Series created successfully", response, w)
+}
+
+// PatchSeriesRequest holds the series fields a PATCH request may change.
+// Omitted fields keep their current value.
+type PatchSeriesRequest struct {
+	Name        *string `json:"name"`
+	Description *string `json:"description"`
+}
+
+func (api *API) handlePatchSeries(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if !api.requireAdmin(w, r, "Only admin can manage series") {
+		return
+	}
+	id := mux.Vars(r)["id"]
+	version, ok := api.requireIfMatch(w, r)
+	if !ok {
+		return
+	}
+	var patch PatchSeriesRequest
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		api.httpGeneralWrite(http.StatusBadRequest, "Invalid JSON payload", nil, w)
+		return
+	}
+
+	// Merge the patch onto the current series
+	series, ok := api.findSeries(w, r, id)
+	if !ok {
+		return
+	}
+	if version != 0 && version != series.Version {
+		api.httpGeneralWrite(http.StatusPreconditionFailed, "Series was modified by another request", nil, w)
+		return
+	}
+	if patch.Name != nil {
+		series.Name = strings.TrimSpace(*patch.Name)
+	}
+	if patch.Description != nil {
+		series.Description = *patch.Description
+	}
+	if err := series.Validate(); err != nil {
+		api.httpGeneralWrite(http.StatusBadRequest, err.Error(), nil, w)
+		return
+	}
+
+	// Update the series using the service
+	series, err := api.SeriesService.UpdateSeries(ctx, id, epublib.SeriesUpdate{
+		Name:        series.Name,
+		Description: series.Description,
+		Version:     series.Version,
+	})
+	if err != nil {
+		if err == epublib.ErrNotFound {
+			api.httpGeneralWrite(http.StatusNotFound, "Series not found", nil, w)
+			return
+		}
+		if err == epublib.ErrConflict {
+			api.httpGeneralWrite(http.StatusPreconditionFailed, "Series was modified by another request", nil, w)
+			return
+		}
+		if err == epublib.ErrSeriesNameTaken {
+			api.httpGeneralWrite(http.StatusConflict, err.Error(), nil, w)
+			return
+		}
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+
+	// Prepare the response
+	response := map[string]interface{}{
+		"series": series,
+	}
+
+	// Send the response
+	w.Header().Set("ETag", versionETag(series.Version))
+	api.httpGeneralWrite(http.StatusOK, "Series updated successfully", response, w)
+}
+
+// handleDeleteSeries deletes a series and removes its books from it.
+func (api *API) handleDeleteSeries(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if !api.requireAdmin(w, r, "Only admin can manage series") {
+		return
+	}
+	version, ok := api.requireIfMatch(w, r)
+	if !ok {
+		return
+	}
+
+	//Begin transaction
+	txCtx, err := postgres.BeginTx(ctx, api.db)
+	if err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	defer postgres.Rollback(txCtx)
+	if err := api.SeriesService.DeleteSeries(txCtx, mux.Vars(r)["id"], version); err != nil {
+		if err == epublib.ErrNotFound {
+			api.httpGeneralWrite(http.StatusNotFound, "Series not found", nil, w)
+			return
+		}
+		if err == epublib.ErrConflict {
+			api.httpGeneralWrite(http.StatusPreconditionFailed, "Series was modified by another request", nil, w)
+			return
+		}
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	if err := postgres.Commit(txCtx); err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	api.httpGeneralWrite(http.StatusOK, "Series deleted successfully", nil, w)
+}
@@ -12,10 +12,26 @@ type API struct {
 	db     *pgxpool.Pool
 	UseTLS bool
 
-	AuthService       epublib.AuthService
-	ResetTokenService epublib.ResetTokenService
-	UserService       epublib.UserService
-	MailerService     epublib.MailerService
+	AuthService              epublib.AuthService
+	ResetTokenService        epublib.ResetTokenService
+	UserService              epublib.UserService
+	MailerService            epublib.MailerService
+	ErasureService           epublib.ErasureService
+	SettingsService          epublib.SettingsService
+	BlobStore                epublib.BlobStore
+	PhoneVerificationService epublib.PhoneVerificationService
+	SMSService               epublib.SMSService
+	TenantService            epublib.TenantService
+	GroupService             epublib.GroupService
+	BookService              epublib.BookService
+	SearchService            epublib.SearchService
+	AuthorService            epublib.AuthorService
+	PublisherService         epublib.PublisherService
+	SeriesService            epublib.SeriesService
+	CategoryService          epublib.CategoryService
+	MetadataProvider         epublib.MetadataProvider
+	MetadataProposalService  epublib.MetadataProposalService
+	BookRevisionService      epublib.BookRevisionService
 }
 
 func NewAPI(router *mux.Router, db *pgxpool.Pool) *API {
@@ -0,0 +1,187 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	epublib "epublib"
+	"epublib/postgres"
+	"log"
+	"net/http"
+	"os"
+)
+
+// deploymentSettingDefaults returns the defaults configured for this
+// deployment through SETTINGS_DEFAULTS, a JSON object keyed by setting.
+// They override the built-in defaults and are overridden by the defaults
+// administrators store in the database.
+func deploymentSettingDefaults() map[string]interface{} {
+	raw := os.Getenv("SETTINGS_DEFAULTS")
+	if raw == "" {
+		return nil
+	}
+	var values map[string]interface{}
+	if err := json.Unmarshal([]byte(raw), &values); err != nil {
+		log.Printf("invalid SETTINGS_DEFAULTS: %v", err)
+		return nil
+	}
+	return values
+}
+
+// resolveDefaults returns the value every setting has for users that did not
+// set it themselves.
+func (api *API) resolveDefaults(ctx context.Context) (map[string]interface{}, error) {
+	defaults, err := api.SettingsService.FindSettingDefaults(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return epublib.ResolveSettings(deploymentSettingDefaults(), defaults), nil
+}
+
+// decodeSettings reads a JSON object of settings from the request body and
+// validates it against the settings schema.
+func decodeSettings(r *http.Request) (map[string]interface{}, string) {
+	var values map[string]interface{}
+	decoder := json.NewDecoder(r.Body)
+	decoder.UseNumber()
+	if err := decoder.Decode(&values); err != nil {
+		return nil, "Invalid JSON payload"
+	}
+	if len(values) == 0 {
+		return nil, "No settings to update"
+	}
+	values, err := epublib.ValidateSettings(values)
+	if err != nil {
+		return nil, err.Error()
+	}
+	return values, ""
+}
+
+func (api *API) handleGetSettingsSchema(w http.ResponseWriter, r *http.Request) {
+	response := map[string]interface{}{
+		"settings": epublib.SettingDefinitions,
+	}
+	api.httpGeneralWrite(http.StatusOK, "Success", response, w)
+}
+
+func (api *API) handleGetMySettings(w http.ResponseWriter, r *http.Request) {
+	api.writeMySettings(w, r, http.StatusOK, "Success")
+}
+
+func (api *API) handleUpdateMySettings(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	values, message := decodeSettings(r)
+	if message != "" {
+		api.httpGeneralWrite(http.StatusBadRequest, message, nil, w)
+		return
+	}
+
+	//Begin transaction
+	txCtx, err := postgres.BeginTx(ctx, api.db)
+	if err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	defer postgres.Rollback(txCtx)
+	if err := api.SettingsService.UpdateUserSettings(txCtx, epublib.UserIDFromContext(ctx), values); err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	if err := postgres.Commit(txCtx); err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	api.writeMySettings(w, r, http.StatusOK, "Settings updated successfully")
+}
+
+// writeMySettings responds with the effective settings of the current user
+// along with the values they set explicitly.
+func (api *API) writeMySettings(w http.ResponseWriter, r *http.Request, status int, message string) {
+	ctx := r.Context()
+	defaults, err := api.resolveDefaults(ctx)
+	if err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	values, err := api.SettingsService.FindUserSettings(ctx, epublib.UserIDFromContext(ctx))
+	if err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+
+	// Prepare the response
+	response := map[string]interface{}{
+		"settings":  epublib.ResolveSettings(defaults, values),
+		"overrides": values,
+	}
+
+	// Send the response
+	api.httpGeneralWrite(status, message, response, w)
+}
+
+func (api *API) handleGetSettingDefaults(w http.ResponseWriter, r *http.Request) {
+	isAdmin, err := api.isAdmin(r.Context())
+	if err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	if !isAdmin {
+		api.httpGeneralWrite(http.StatusForbidden, "Only admin can view setting defaults", nil, w)
+		return
+	}
+	api.writeSettingDefaults(w, r, http.StatusOK, "Success")
+}
+
+func (api *API) handleUpdateSettingDefaults(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	isAdmin, err := api.isAdmin(ctx)
+	if err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	if !isAdmin {
+		api.httpGeneralWrite(http.StatusForbidden, "Only admin can update setting defaults", nil, w)
+		return
+	}
+	values, message := decodeSettings(r)
+	if message != "" {
+		api.httpGeneralWrite(http.StatusBadRequest, message, nil, w)
+		return
+	}
+
+	//Begin transaction
+	txCtx, err := postgres.BeginTx(ctx, api.db)
+	if err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	defer postgres.Rollback(txCtx)
+	if err := api.SettingsService.UpdateSettingDefaults(txCtx, values); err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	if err := postgres.Commit(txCtx); err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	api.writeSettingDefaults(w, r, http.StatusOK, "Setting defaults updated successfully")
+}
+
+// writeSettingDefaults responds with the effective defaults along with the
+// values administrators set explicitly.
+func (api *API) writeSettingDefaults(w http.ResponseWriter, r *http.Request, status int, message string) {
+	ctx := r.Context()
+	values, err := api.SettingsService.FindSettingDefaults(ctx)
+	if err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+
+	// Prepare the response
+	response := map[string]interface{}{
+		"settings":  epublib.ResolveSettings(deploymentSettingDefaults(), values),
+		"overrides": values,
+	}
+
+	// Send the response
+	api.httpGeneralWrite(status, message, response, w)
+}
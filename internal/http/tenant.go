@@ -0,0 +1,378 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	epublib "epublib"
+	"epublib/postgres"
+	"epublib/util"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// libraryName returns the name the current tenant presents itself with.
+func libraryName(ctx context.Context) string {
+	tenant := epublib.TenantFromContext(ctx)
+	if tenant == nil {
+		return "Epublib"
+	}
+	if tenant.Branding.DisplayName != "" {
+		return tenant.Branding.DisplayName
+	}
+	return tenant.Name
+}
+
+// PublicTenant is what anyone may know about the tenant serving a request.
+type PublicTenant struct {
+	ID       string                 `json:"id"`
+	Slug     string                 `json:"slug"`
+	Name     string                 `json:"name"`
+	Branding epublib.TenantBranding `json:"branding"`
+
+	RegistrationDisabled bool `json:"registration_disabled"`
+}
+
+func (api *API) handleGetCurrentTenant(w http.ResponseWriter, r *http.Request) {
+	tenant := epublib.TenantFromContext(r.Context())
+
+	// Prepare the response
+	response := map[string]interface{}{
+		"tenant": PublicTenant{
+			ID:                   tenant.ID,
+			Slug:                 tenant.Slug,
+			Name:                 tenant.Name,
+			Branding:             tenant.Branding,
+			RegistrationDisabled: tenant.Config.RegistrationDisabled,
+		},
+	}
+
+	// Send the response
+	api.httpGeneralWrite(http.StatusOK, "Success", response, w)
+}
+
+// PatchTenantRequest holds the tenant fields a PATCH request may change.
+// Omitted fields keep their current value.
+type PatchTenantRequest struct {
+	Slug     *string                 `json:"slug"`
+	Name     *string                 `json:"name"`
+	Hosts    *[]string               `json:"hosts"`
+	Branding *epublib.TenantBranding `json:"branding"`
+	Config   *epublib.TenantConfig   `json:"config"`
+}
+
+// handlePatchCurrentTenant lets admins rebrand and configure their own
+// tenant. Slug and hosts decide how requests reach the tenant and are left
+// to super admins.
+func (api *API) handlePatchCurrentTenant(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	isAdmin, err := api.isAdmin(ctx)
+	if err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	if !isAdmin {
+		api.httpGeneralWrite(http.StatusForbidden, "Only admin can update the tenant", nil, w)
+		return
+	}
+
+	var patch PatchTenantRequest
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		api.httpGeneralWrite(http.StatusBadRequest, "Invalid JSON payload", nil, w)
+		return
+	}
+	if patch.Slug != nil || patch.Hosts != nil {
+		api.httpGeneralWrite(http.StatusForbidden, "Only super admin can change slug and hosts", nil, w)
+		return
+	}
+	api.patchTenant(w, r, epublib.TenantIDFromContext(ctx), patch)
+}
+
+func (api *API) handleGetTenants(w http.ResponseWriter, r *http.Request) {
+	if !api.requireSuperAdmin(w, r) {
+		return
+	}
+	tenants, err := api.TenantService.FindTenants(r.Context())
+	if err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	response := map[string]interface{}{
+		"tenants": tenants,
+	}
+	api.httpGeneralWrite(http.StatusOK, "Success", response, w)
+}
+
+func (api *API) handleGetTenantByID(w http.ResponseWriter, r *http.Request) {
+	if !api.requireSuperAdmin(w, r) {
+		return
+	}
+	tenant, err := api.TenantService.FindTenantByID(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		if err == epublib.ErrNotFound {
+			api.httpGeneralWrite(http.StatusNotFound, "Tenant not found", nil, w)
+			return
+		}
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	response := map[string]interface{}{
+		"tenant": tenant,
+	}
+	w.Header().Set("ETag", versionETag(tenant.Version))
+	api.httpGeneralWrite(http.StatusOK, "Success", response, w)
+}
+
+type CreateTenantRequest struct {
+	Slug     string                 `json:"slug"`
+	Name     string                 `json:"name"`
+	Hosts    []string               `json:"hosts"`
+	Branding epublib.TenantBranding `json:"branding"`
+	Config   epublib.TenantConfig   `json:"config"`
+
+	// First admin of the tenant.
+	Admin CreateUserRequest `json:"admin"`
+}
+
+func (api *API) handleCreateTenant(w http.ResponseWriter, r *http.Request) {
+	if !api.requireSuperAdmin(w, r) {
+		return
+	}
+
+	// Parse the JSON request body into a CreateTenantRequest struct
+	var payload CreateTenantRequest
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		api.httpGeneralWrite(http.StatusBadRequest, "Invalid JSON payload", nil, w)
+		return
+	}
+	tenant := &epublib.Tenant{
+		Slug:     payload.Slug,
+		Name:     payload.Name,
+		Hosts:    normalizeHosts(payload.Hosts),
+		Branding: payload.Branding,
+		Config:   payload.Config,
+	}
+
+	// Validate the required fields
+	if err := tenant.Validate(); err != nil {
+		api.httpGeneralWrite(http.StatusBadRequest, err.Error(), nil, w)
+		return
+	}
+	if err := epublib.ValidateUsername(payload.Admin.Username); err != nil {
+		api.httpGeneralWrite(http.StatusBadRequest, "admin "+err.Error(), nil, w)
+		return
+	}
+	if payload.Admin.Password == "" {
+		api.httpGeneralWrite(http.StatusBadRequest, "admin password is required field", nil, w)
+		return
+	}
+	if !util.IsValidEmail(payload.Admin.Email) {
+		api.httpGeneralWrite(http.StatusBadRequest, "Invalid admin email", nil, w)
+		return
+	}
+
+	// The admin is created as a record of the new tenant, so the whole
+	// transaction runs for it. Its ID is generated up front for that.
+	id, err := util.NewUUID()
+	if err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	tenant.ID = id
+	ctx := epublib.NewContextWithTenant(r.Context(), tenant)
+
+	//Begin transaction
+	ctx, err = postgres.BeginTx(ctx, api.db)
+	if err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	defer postgres.Rollback(ctx)
+	if err := api.TenantService.CreateTenant(ctx, tenant); err != nil {
+		if err == epublib.ErrTenantTaken {
+			api.httpGeneralWrite(http.StatusConflict, "Slug or host is already used by another tenant", nil, w)
+			return
+		}
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	user := epublib.User{
+		Name:      payload.Admin.Username,
+		Gender:    epublib.UnidentifiedGender,
+		BirthDate: time.Now(),
+	}
+	if err := api.UserService.CreateUser(ctx, &user); err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	auth := epublib.Auth{
+		UserID:   user.ID,
+		Username: payload.Admin.Username,
+		Password: payload.Admin.Password,
+		Email:    payload.Admin.Email,
+		Level:    epublib.AdminLevel,
+	}
+	if err := api.AuthService.CreateAuth(ctx, &auth); err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+
+	// Commit transaction
+	if err := postgres.Commit(ctx); err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+
+	// Prepare the response
+	response := map[string]interface{}{
+		"tenant": tenant,
+		"admin":  user,
+	}
+
+	// Send the response
+	w.Header().Set("ETag", versionETag(tenant.Version))
+	api.httpGeneralWrite(http.StatusCreated, "Tenant created successfully", response, w)
+}
+
+func (api *API) handlePatchTenant(w http.ResponseWriter, r *http.Request) {
+	if !api.requireSuperAdmin(w, r) {
+		return
+	}
+	var patch PatchTenantRequest
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		api.httpGeneralWrite(http.StatusBadRequest, "Invalid JSON payload", nil, w)
+		return
+	}
+	api.patchTenant(w, r, mux.Vars(r)["id"], patch)
+}
+
+// patchTenant merges patch onto the tenant with the given ID and writes the
+// updated tenant along with its new ETag.
+func (api *API) patchTenant(w http.ResponseWriter, r *http.Request, id string, patch PatchTenantRequest) {
+	ctx := r.Context()
+	version, ok := api.requireIfMatch(w, r)
+	if !ok {
+		return
+	}
+
+	// Merge the patch onto the current tenant
+	tenant, err := api.TenantService.FindTenantByID(ctx, id)
+	if err != nil {
+		if err == epublib.ErrNotFound {
+			api.httpGeneralWrite(http.StatusNotFound, "Tenant not found", nil, w)
+			return
+		}
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	if version != 0 && version != tenant.Version {
+		api.httpGeneralWrite(http.StatusPreconditionFailed, "Tenant was modified by another request", nil, w)
+		return
+	}
+	if patch.Slug != nil {
+		tenant.Slug = *patch.Slug
+	}
+	if patch.Name != nil {
+		tenant.Name = *patch.Name
+	}
+	if patch.Hosts != nil {
+		tenant.Hosts = normalizeHosts(*patch.Hosts)
+	}
+	if patch.Branding != nil {
+		tenant.Branding = *patch.Branding
+	}
+	if patch.Config != nil {
+		tenant.Config = *patch.Config
+	}
+	if err := tenant.Validate(); err != nil {
+		api.httpGeneralWrite(http.StatusBadRequest, err.Error(), nil, w)
+		return
+	}
+
+	// Update the tenant using the service
+	tenant, err = api.TenantService.UpdateTenant(ctx, id, epublib.TenantUpdate{
+		Slug:     tenant.Slug,
+		Name:     tenant.Name,
+		Hosts:    tenant.Hosts,
+		Branding: tenant.Branding,
+		Config:   tenant.Config,
+		Version:  tenant.Version,
+	})
+	if err != nil {
+		if err == epublib.ErrNotFound {
+			api.httpGeneralWrite(http.StatusNotFound, "Tenant not found", nil, w)
+			return
+		}
+		if err == epublib.ErrConflict {
+			api.httpGeneralWrite(http.StatusPreconditionFailed, "Tenant was modified by another request", nil, w)
+			return
+		}
+		if err == epublib.ErrTenantTaken {
+			api.httpGeneralWrite(http.StatusConflict, "Slug or host is already used by another tenant", nil, w)
+			return
+		}
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+
+	// Prepare the response
+	response := map[string]interface{}{
+		"tenant": tenant,
+	}
+
+	// Send the response
+	w.Header().Set("ETag", versionETag(tenant.Version))
+	api.httpGeneralWrite(http.StatusOK, "Tenant updated successfully", response, w)
+}
+
+func (api *API) handleDeleteTenant(w http.ResponseWriter, r *http.Request) {
+	if !api.requireSuperAdmin(w, r) {
+		return
+	}
+	id := mux.Vars(r)["id"]
+	if id == epublib.TenantIDFromContext(r.Context()) {
+		api.httpGeneralWrite(http.StatusBadRequest, "The tenant serving the request cannot be deleted", nil, w)
+		return
+	}
+	if err := api.TenantService.DeleteTenant(r.Context(), id); err != nil {
+		if err == epublib.ErrNotFound {
+			api.httpGeneralWrite(http.StatusNotFound, "Tenant not found", nil, w)
+			return
+		}
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	api.httpGeneralWrite(http.StatusOK, "Tenant deleted successfully", nil, w)
+}
+
+// requireSuperAdmin writes a forbidden response and returns false unless the
+// current user is a super admin.
+func (api *API) requireSuperAdmin(w http.ResponseWriter, r *http.Request) bool {
+	isSuperAdmin, err := api.isSuperAdmin(r.Context())
+	if err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return false
+	}
+	if !isSuperAdmin {
+		api.httpGeneralWrite(http.StatusForbidden, "Only super admin can manage tenants", nil, w)
+		return false
+	}
+	return true
+}
+
+// normalizeHosts lowercases hosts and drops empty and duplicate entries.
+func normalizeHosts(hosts []string) []string {
+	normalized := []string{}
+	seen := map[string]bool{}
+	for _, host := range hosts {
+		host = strings.ToLower(strings.TrimSpace(host))
+		if host == "" || seen[host] {
+			continue
+		}
+		seen[host] = true
+		normalized = append(normalized, host)
+	}
+	return normalized
+}
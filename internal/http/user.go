@@ -5,7 +5,10 @@ import (
 	epublib "epublib"
 	"epublib/postgres"
 	"epublib/util"
+	"fmt"
 	"net/http"
+	"net/url"
+	"os"
 	"strconv"
 	"time"
 
@@ -13,38 +16,127 @@ import (
 )
 
 func (api *API) handleGetUsers(w http.ResponseWriter, r *http.Request) {
-	// Parse query parameters
-	queryParams := r.URL.Query()
-	name := queryParams.Get("name")
-	offset, _ := strconv.Atoi(queryParams.Get("offset"))
-	limit, _ := strconv.Atoi(queryParams.Get("limit"))
-	includeDeleted := queryParams.Get("include_deleted") == "true"
-
 	// Construct filter based on query parameters
-	filter := epublib.UserFilter{
-		Name:           name,
-		Offset:         offset,
-		Limit:          limit,
-		IncludeDeleted: includeDeleted,
+	filter, err := parseUserFilter(r)
+	if err != nil {
+		api.httpGeneralWrite(http.StatusBadRequest, err.Error(), nil, w)
+		return
 	}
+	offset, limit, sort := filter.Offset, filter.Limit, filter.Sort
 
 	// Retrieve users from the service
 	users, totalCount, err := api.UserService.FindUsers(r.Context(), filter)
 	if err != nil {
+		if err == epublib.ErrInvalidCursor {
+			api.httpGeneralWrite(http.StatusBadRequest, "Invalid cursor", nil, w)
+			return
+		}
 		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
 		return
 	}
 
+	// A full page means there may be more results after the last user
+	nextCursor := ""
+	if len(users) == limit {
+		nextCursor = epublib.NewUserCursor(users[len(users)-1], sort)
+		next := api.absoluteURL(r)
+		nextQuery := next.Query()
+		nextQuery.Set("cursor", nextCursor)
+		nextQuery.Del("offset")
+		next.RawQuery = nextQuery.Encode()
+		w.Header().Add("Link", fmt.Sprintf(`<%s>; rel="next"`, next.String()))
+	}
+	if filter.After != "" || offset > 0 {
+		first := api.absoluteURL(r)
+		firstQuery := first.Query()
+		firstQuery.Del("cursor")
+		firstQuery.Del("offset")
+		first.RawQuery = firstQuery.Encode()
+		w.Header().Add("Link", fmt.Sprintf(`<%s>; rel="first"`, first.String()))
+	}
+
 	// Prepare the response
 	response := map[string]interface{}{
 		"users":       users,
 		"total_count": totalCount,
+		"next_cursor": nextCursor,
 	}
 
 	// Send the response
 	api.httpGeneralWrite(http.StatusOK, "Success", response, w)
 }
 
+// absoluteURL returns the URL r was requested at, including the scheme and
+// the host, for links clients follow as is.
+func (api *API) absoluteURL(r *http.Request) *url.URL {
+	u := *r.URL
+	u.Scheme = "http"
+	if api.UseTLS || r.TLS != nil {
+		u.Scheme = "https"
+	}
+	u.Host = r.Host
+	return &u
+}
+
+// parseUserFilter builds a UserFilter from the query parameters of r.
+func parseUserFilter(r *http.Request) (epublib.UserFilter, error) {
+	queryParams := r.URL.Query()
+	offset, _ := strconv.Atoi(queryParams.Get("offset"))
+	limit, _ := strconv.Atoi(queryParams.Get("limit"))
+	if limit <= 0 {
+		limit = 10
+	}
+	if limit > epublib.MaxUserPageSize {
+		limit = epublib.MaxUserPageSize
+	}
+	sort, err := epublib.ParseUserSort(queryParams.Get("sort"))
+	if err != nil {
+		return epublib.UserFilter{}, err
+	}
+
+	filter := epublib.UserFilter{
+		Name:           queryParams.Get("name"),
+		Email:          queryParams.Get("email"),
+		Level:          epublib.AuthLevel(queryParams.Get("level")),
+		Gender:         epublib.Gender(queryParams.Get("gender")),
+		IncludeDeleted: queryParams.Get("include_deleted") == "true",
+		OnlyDeleted:    queryParams.Get("only_deleted") == "true",
+		GroupID:        queryParams.Get("group_id"),
+		Sort:           sort,
+		After:          queryParams.Get("cursor"),
+		Offset:         offset,
+		Limit:          limit,
+	}
+	filter.IncludeSubgroups = filter.GroupID != "" && queryParams.Get("include_subgroups") == "true"
+	if filter.Level != "" && !filter.Level.IsValid() {
+		return epublib.UserFilter{}, fmt.Errorf("invalid user level")
+	}
+	if filter.Gender != "" && !filter.Gender.IsValid() {
+		return epublib.UserFilter{}, fmt.Errorf("invalid gender")
+	}
+	for param, dst := range map[string]*time.Time{
+		"created_after":  &filter.CreatedAfter,
+		"created_before": &filter.CreatedBefore,
+		"updated_after":  &filter.UpdatedAfter,
+		"updated_before": &filter.UpdatedBefore,
+	} {
+		if v := queryParams.Get(param); v != "" {
+			if *dst, err = parseQueryTime(v); err != nil {
+				return epublib.UserFilter{}, fmt.Errorf("invalid %s, expected RFC 3339 timestamp or YYYY-MM-DD date", param)
+			}
+		}
+	}
+	return filter, nil
+}
+
+// parseQueryTime parses an RFC 3339 timestamp or a YYYY-MM-DD date.
+func parseQueryTime(v string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", v)
+}
+
 func (api *API) handleGetUserByID(w http.ResponseWriter, r *http.Request) {
 	// Extract user ID from the URL path
 	vars := mux.Vars(r)
@@ -61,6 +153,14 @@ func (api *API) handleGetUserByID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Honour conditional requests so clients can revalidate cheaply
+	etag := versionETag(user.Version)
+	w.Header().Set("ETag", etag)
+	if inm := r.Header.Get("If-None-Match"); inm != "" && etagListMatches(inm, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
 	// Prepare the response
 	response := map[string]interface{}{
 		"user": user,
@@ -70,6 +170,113 @@ func (api *API) handleGetUserByID(w http.ResponseWriter, r *http.Request) {
 	api.httpGeneralWrite(http.StatusOK, "Success", response, w)
 }
 
+func (api *API) handleGetUserByUsername(w http.ResponseWriter, r *http.Request) {
+	// Extract username from the URL path
+	vars := mux.Vars(r)
+	username := vars["username"]
+
+	// Retrieve user by username from the service
+	user, err := api.UserService.FindUserByUsername(r.Context(), username)
+	if err != nil {
+		if err == epublib.ErrNotFound {
+			api.httpGeneralWrite(http.StatusNotFound, "User not found", nil, w)
+			return
+		}
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+
+	// Prepare the response
+	response := map[string]interface{}{
+		"user": user,
+	}
+
+	// Send the response
+	w.Header().Set("ETag", versionETag(user.Version))
+	api.httpGeneralWrite(http.StatusOK, "Success", response, w)
+}
+
+type ChangeUsernameRequest struct {
+	Username string `json:"username"`
+}
+
+// defaultUsernameReservationDays is used when USERNAME_RESERVATION_DAYS is not set.
+const defaultUsernameReservationDays = 30
+
+func (api *API) handleChangeUsername(w http.ResponseWriter, r *http.Request) {
+	// Extract user ID from the URL path
+	vars := mux.Vars(r)
+	id := vars["id"]
+	ctx := r.Context()
+
+	// Users may only rename themselves unless they are an admin
+	allowed, err := api.isSelfOrAdmin(ctx, id)
+	if err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	if !allowed {
+		api.httpGeneralWrite(http.StatusForbidden, "Only admin can change other user's username", nil, w)
+		return
+	}
+
+	var payload ChangeUsernameRequest
+	err = json.NewDecoder(r.Body).Decode(&payload)
+	if err != nil {
+		api.httpGeneralWrite(http.StatusBadRequest, "Invalid JSON payload", nil, w)
+		return
+	}
+	if err := epublib.ValidateUsername(payload.Username); err != nil {
+		api.httpGeneralWrite(http.StatusBadRequest, err.Error(), nil, w)
+		return
+	}
+
+	reservationDays := defaultUsernameReservationDays
+	if v, err := strconv.Atoi(os.Getenv("USERNAME_RESERVATION_DAYS")); err == nil && v >= 0 {
+		reservationDays = v
+	}
+
+	//Begin transaction
+	ctx, err = postgres.BeginTx(ctx, api.db)
+	if err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	defer postgres.Rollback(ctx)
+
+	auth, err := api.AuthService.FindAuthByUserID(ctx, id)
+	if err != nil {
+		if err == epublib.ErrNotFound {
+			api.httpGeneralWrite(http.StatusNotFound, "User not found", nil, w)
+			return
+		}
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	err = api.AuthService.ChangeUsername(ctx, auth.ID, payload.Username, time.Duration(reservationDays)*24*time.Hour)
+	if err != nil {
+		if err == epublib.ErrUsernameTaken {
+			api.httpGeneralWrite(http.StatusConflict, "Username is already taken", nil, w)
+			return
+		}
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+
+	// Commit transaction
+	err = postgres.Commit(ctx)
+	if err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+
+	// Send the response
+	response := map[string]interface{}{
+		"username": payload.Username,
+	}
+	api.httpGeneralWrite(http.StatusOK, "Username changed successfully", response, w)
+}
+
 type RegisterRequest struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
@@ -77,8 +284,13 @@ type RegisterRequest struct {
 }
 
 func (api *API) handleRegister(w http.ResponseWriter, r *http.Request) {
-	// Parse the JSON request body into a RegisterRequest struct
 	ctx := r.Context()
+	if tenant := epublib.TenantFromContext(ctx); tenant != nil && tenant.Config.RegistrationDisabled {
+		api.httpGeneralWrite(http.StatusForbidden, "Registration is disabled, please ask an admin for an account", nil, w)
+		return
+	}
+
+	// Parse the JSON request body into a RegisterRequest struct
 	var payload RegisterRequest
 	err := json.NewDecoder(r.Body).Decode(&payload)
 	if err != nil {
@@ -91,6 +303,10 @@ func (api *API) handleRegister(w http.ResponseWriter, r *http.Request) {
 		api.httpGeneralWrite(http.StatusBadRequest, "Username is required field", nil, w)
 		return
 	}
+	if err := epublib.ValidateUsername(payload.Username); err != nil {
+		api.httpGeneralWrite(http.StatusBadRequest, err.Error(), nil, w)
+		return
+	}
 	if payload.Password == "" {
 		api.httpGeneralWrite(http.StatusBadRequest, "Password is required field", nil, w)
 		return
@@ -146,6 +362,10 @@ func (api *API) handleRegister(w http.ResponseWriter, r *http.Request) {
 	}
 	err = api.AuthService.CreateAuth(ctx, &auth)
 	if err != nil {
+		if err == epublib.ErrUsernameTaken {
+			api.httpGeneralWrite(http.StatusConflict, "Username is already taken", nil, w)
+			return
+		}
 		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
 		return
 	}
@@ -161,7 +381,7 @@ func (api *API) handleRegister(w http.ResponseWriter, r *http.Request) {
 		Username: auth.Username,
 		Level:    auth.Level.String(),
 	}
-	response.Token, err = createJWT(auth.UserID, 24*time.Hour)
+	response.Token, err = createJWT(auth.UserID, epublib.TenantIDFromContext(ctx), 24*time.Hour)
 	if err != nil {
 		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
 		return
@@ -187,7 +407,7 @@ func (api *API) handleCreateUser(w http.ResponseWriter, r *http.Request) {
 		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
 		return
 	}
-	if currentUserAuth.Level != epublib.AdminLevel {
+	if !currentUserAuth.Level.IsAdmin() {
 		api.httpGeneralWrite(http.StatusForbidden, "Only admin can create user", nil, w)
 		return
 	}
@@ -205,6 +425,10 @@ func (api *API) handleCreateUser(w http.ResponseWriter, r *http.Request) {
 		api.httpGeneralWrite(http.StatusBadRequest, "username is required field", nil, w)
 		return
 	}
+	if err := epublib.ValidateUsername(payload.Username); err != nil {
+		api.httpGeneralWrite(http.StatusBadRequest, err.Error(), nil, w)
+		return
+	}
 	if payload.Password == "" {
 		api.httpGeneralWrite(http.StatusBadRequest, "password is required field", nil, w)
 		return
@@ -217,6 +441,10 @@ func (api *API) handleCreateUser(w http.ResponseWriter, r *http.Request) {
 		api.httpGeneralWrite(http.StatusBadRequest, "invalid user level", nil, w)
 		return
 	}
+	if payload.Level == epublib.SuperAdminLevel && currentUserAuth.Level != epublib.SuperAdminLevel {
+		api.httpGeneralWrite(http.StatusForbidden, "Only super admin can create super admin", nil, w)
+		return
+	}
 
 	// Check if the email is already registered
 	_, err = api.AuthService.FindAuthByEmail(ctx, payload.Email)
@@ -261,6 +489,10 @@ func (api *API) handleCreateUser(w http.ResponseWriter, r *http.Request) {
 	}
 	err = api.AuthService.CreateAuth(ctx, &auth)
 	if err != nil {
+		if err == epublib.ErrUsernameTaken {
+			api.httpGeneralWrite(http.StatusConflict, "Username is already taken", nil, w)
+			return
+		}
 		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
 		return
 	}
@@ -299,7 +531,111 @@ func (api *API) handleUpdateUser(w http.ResponseWriter, r *http.Request) {
 		api.httpGeneralWrite(http.StatusBadRequest, "Name is required fields", nil, w)
 		return
 	}
+	update.PhoneNumber, err = normalizePhoneNumber(update.PhoneNumber)
+	if err != nil {
+		api.httpGeneralWrite(http.StatusBadRequest, invalidPhoneNumberMessage, nil, w)
+		return
+	}
+
+	// Only apply the update on top of the version the client has seen
+	version, ok := api.requireIfMatch(w, r)
+	if !ok {
+		return
+	}
+	update.Version = version
+
+	api.writeUserUpdate(w, r, id, update)
+}
+
+// PatchUserRequest holds the user fields a PATCH request may change.
+// Omitted fields keep their current value.
+type PatchUserRequest struct {
+	Name        *string         `json:"name"`
+	Address     *string         `json:"address"`
+	PhoneNumber *string         `json:"phone_number"`
+	Gender      *epublib.Gender `json:"gender"`
+	BirthDate   *time.Time      `json:"birth_date"`
+	ImgProfile  *string         `json:"img_profile"`
+}
+
+func (api *API) handlePatchUser(w http.ResponseWriter, r *http.Request) {
+	// Extract user ID from the URL path
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	// Parse the JSON request body into a PatchUserRequest struct
+	var patch PatchUserRequest
+	err := json.NewDecoder(r.Body).Decode(&patch)
+	if err != nil {
+		api.httpGeneralWrite(http.StatusBadRequest, "Invalid JSON payload", nil, w)
+		return
+	}
+	if patch.Name != nil && *patch.Name == "" {
+		api.httpGeneralWrite(http.StatusBadRequest, "Name cannot be empty", nil, w)
+		return
+	}
+
+	version, ok := api.requireIfMatch(w, r)
+	if !ok {
+		return
+	}
 
+	// Merge the patch onto the current user
+	user, err := api.UserService.FindUserByID(r.Context(), id)
+	if err != nil {
+		if err == epublib.ErrNotFound {
+			api.httpGeneralWrite(http.StatusNotFound, "User not found", nil, w)
+			return
+		}
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	if version != 0 && version != user.Version {
+		api.httpGeneralWrite(http.StatusPreconditionFailed, "User was modified by another request", nil, w)
+		return
+	}
+	update := epublib.UserUpdate{
+		Name:        user.Name,
+		Address:     user.Address,
+		PhoneNumber: user.PhoneNumber,
+		Gender:      user.Gender,
+		BirthDate:   user.BirthDate,
+		ImgProfile:  user.ImgProfile,
+		Version:     user.Version,
+	}
+	if patch.Name != nil {
+		update.Name = *patch.Name
+	}
+	if patch.Address != nil {
+		update.Address = *patch.Address
+	}
+	if patch.PhoneNumber != nil {
+		update.PhoneNumber, err = normalizePhoneNumber(*patch.PhoneNumber)
+		if err != nil {
+			api.httpGeneralWrite(http.StatusBadRequest, invalidPhoneNumberMessage, nil, w)
+			return
+		}
+	}
+	if patch.Gender != nil {
+		if !patch.Gender.IsValid() {
+			api.httpGeneralWrite(http.StatusBadRequest, "Invalid gender", nil, w)
+			return
+		}
+		update.Gender = *patch.Gender
+	}
+	if patch.BirthDate != nil {
+		update.BirthDate = *patch.BirthDate
+	}
+	if patch.ImgProfile != nil {
+		update.ImgProfile = *patch.ImgProfile
+	}
+
+	api.writeUserUpdate(w, r, id, update)
+}
+
+// writeUserUpdate applies a versioned update and writes the updated user
+// along with its new ETag.
+func (api *API) writeUserUpdate(w http.ResponseWriter, r *http.Request, id string, update epublib.UserUpdate) {
 	// Update the user using the service
 	user, err := api.UserService.UpdateUser(r.Context(), id, update)
 	if err != nil {
@@ -307,6 +643,10 @@ func (api *API) handleUpdateUser(w http.ResponseWriter, r *http.Request) {
 			api.httpGeneralWrite(http.StatusNotFound, "User not found", nil, w)
 			return
 		}
+		if err == epublib.ErrConflict {
+			api.httpGeneralWrite(http.StatusPreconditionFailed, "User was modified by another request", nil, w)
+			return
+		}
 		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
 		return
 	}
@@ -317,6 +657,7 @@ func (api *API) handleUpdateUser(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Send the response
+	w.Header().Set("ETag", versionETag(user.Version))
 	api.httpGeneralWrite(http.StatusOK, "User updated successfully", response, w)
 }
 
@@ -326,6 +667,11 @@ func (api *API) handleDeleteUser(w http.ResponseWriter, r *http.Request) {
 	id := vars["id"]
 	ctx := r.Context()
 
+	version, ok := api.requireIfMatch(w, r)
+	if !ok {
+		return
+	}
+
 	//Begin transaction
 	ctx, err := postgres.BeginTx(ctx, api.db)
 	if err != nil {
@@ -334,12 +680,16 @@ func (api *API) handleDeleteUser(w http.ResponseWriter, r *http.Request) {
 	}
 	defer postgres.Rollback(ctx)
 	// Soft delete the user using the service
-	err = api.UserService.DeleteUser(r.Context(), id)
+	err = api.UserService.DeleteUser(ctx, id, version)
 	if err != nil {
 		if err == epublib.ErrNotFound {
 			api.httpGeneralWrite(http.StatusNotFound, "User not found", nil, w)
 			return
 		}
+		if err == epublib.ErrConflict {
+			api.httpGeneralWrite(http.StatusPreconditionFailed, "User was modified by another request", nil, w)
+			return
+		}
 		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
 		return
 	}
@@ -350,7 +700,7 @@ func (api *API) handleDeleteUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = api.AuthService.DeleteAuth(r.Context(), auth.ID)
+	err = api.AuthService.DeleteAuth(ctx, auth.ID)
 	if err != nil {
 		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
 		return
@@ -366,3 +716,98 @@ func (api *API) handleDeleteUser(w http.ResponseWriter, r *http.Request) {
 	// Send the response
 	api.httpGeneralWrite(http.StatusOK, "User deleted successfully", nil, w)
 }
+
+func (api *API) handleRestoreUser(w http.ResponseWriter, r *http.Request) {
+	// Extract user ID from the URL path
+	vars := mux.Vars(r)
+	id := vars["id"]
+	ctx := r.Context()
+
+	// Determine authorization
+	isAdmin, err := api.isAdmin(ctx)
+	if err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	if !isAdmin {
+		api.httpGeneralWrite(http.StatusForbidden, "Only admin can restore user", nil, w)
+		return
+	}
+
+	// Erased users only hold anonymized data, there is nothing to restore
+	erasures, err := api.ErasureService.FindErasureRequestsByUserID(ctx, id)
+	if err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	for _, erasure := range erasures {
+		if !erasure.CompletedAt.IsZero() {
+			api.httpGeneralWrite(http.StatusConflict, "User personal data has been erased", nil, w)
+			return
+		}
+	}
+
+	auth, err := api.AuthService.FindAuthByUserID(ctx, id)
+	if err != nil {
+		if err == epublib.ErrNotFound {
+			api.httpGeneralWrite(http.StatusNotFound, "User not found", nil, w)
+			return
+		}
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+
+	// The email may have been registered again since the user was deleted
+	if other, err := api.AuthService.FindAuthByEmail(ctx, auth.Email); err == nil && other.ID != auth.ID {
+		api.httpGeneralWrite(http.StatusConflict, "Email is already registered by another user", nil, w)
+		return
+	} else if err != nil && err != epublib.ErrNotFound {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+
+	//Begin transaction
+	ctx, err = postgres.BeginTx(ctx, api.db)
+	if err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	defer postgres.Rollback(ctx)
+
+	err = api.UserService.RestoreUser(ctx, id)
+	if err != nil {
+		if err == epublib.ErrNotFound {
+			api.httpGeneralWrite(http.StatusNotFound, "Deleted user not found", nil, w)
+			return
+		}
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	err = api.AuthService.RestoreAuth(ctx, auth.ID)
+	if err != nil && err != epublib.ErrNotFound {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+
+	// Commit transaction
+	err = postgres.Commit(ctx)
+	if err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+
+	user, err := api.UserService.FindUserByID(r.Context(), id)
+	if err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+
+	// Prepare the response
+	response := map[string]interface{}{
+		"user": user,
+	}
+
+	// Send the response
+	w.Header().Set("ETag", versionETag(user.Version))
+	api.httpGeneralWrite(http.StatusOK, "User restored successfully", response, w)
+}
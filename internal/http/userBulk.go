@@ -0,0 +1,524 @@
+package http
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	epublib "epublib"
+	"epublib/postgres"
+	"epublib/util"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// maxImportBytes caps the size of a bulk import request body.
+const maxImportBytes = 10 << 20
+
+// maxImportRows caps the number of users created by a single import.
+const maxImportRows = 5000
+
+// ImportUserRow represents a single user of a bulk import, either a JSON
+// object or a CSV record whose header row uses the same field names.
+type ImportUserRow struct {
+	Username    string `json:"username"`
+	Email       string `json:"email"`
+	Password    string `json:"password"`
+	Level       string `json:"level"`
+	Name        string `json:"name"`
+	Address     string `json:"address"`
+	PhoneNumber string `json:"phone_number"`
+	Gender      string `json:"gender"`
+	BirthDate   string `json:"birth_date"`
+}
+
+// ImportUserResult reports the outcome of a single import row. Row numbers
+// start at 1 and do not count the CSV header.
+type ImportUserResult struct {
+	Row      int      `json:"row"`
+	Username string   `json:"username"`
+	UserID   string   `json:"user_id,omitempty"`
+	Errors   []string `json:"errors,omitempty"`
+}
+
+// importUser is a validated import row ready to be created.
+type importUser struct {
+	user epublib.User
+	auth epublib.Auth
+}
+
+func (api *API) handleImportUsers(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	isAdmin, err := api.isAdmin(ctx)
+	if err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	if !isAdmin {
+		api.httpGeneralWrite(http.StatusForbidden, "Only admin can import users", nil, w)
+		return
+	}
+	dryRun := r.URL.Query().Get("dry_run") == "true"
+	invite := r.URL.Query().Get("invite") == "true"
+
+	// Parse the request body according to its content type
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportBytes)
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	var rows []ImportUserRow
+	switch mediaType {
+	case "text/csv":
+		rows, err = readImportCSV(r.Body)
+	case "application/json", "":
+		err = json.NewDecoder(r.Body).Decode(&rows)
+	default:
+		api.httpGeneralWrite(http.StatusUnsupportedMediaType, "Content-Type must be text/csv or application/json", nil, w)
+		return
+	}
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			api.httpGeneralWrite(http.StatusRequestEntityTooLarge, "Import file is too large", nil, w)
+			return
+		}
+		api.httpGeneralWrite(http.StatusBadRequest, "Invalid import file: "+err.Error(), nil, w)
+		return
+	}
+	if len(rows) == 0 {
+		api.httpGeneralWrite(http.StatusBadRequest, "Import file has no rows", nil, w)
+		return
+	}
+	if len(rows) > maxImportRows {
+		api.httpGeneralWrite(http.StatusRequestEntityTooLarge, fmt.Sprintf("Import is limited to %d rows", maxImportRows), nil, w)
+		return
+	}
+
+	// Validate every row up front so a bad file never creates anything
+	existing, err := api.findExistingLogins(ctx, rows)
+	if err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	results := make([]ImportUserResult, len(rows))
+	users := make([]importUser, len(rows))
+	seenUsernames := map[string]int{}
+	seenEmails := map[string]int{}
+	valid := true
+	for i, row := range rows {
+		results[i] = ImportUserResult{Row: i + 1, Username: row.Username}
+		users[i], results[i].Errors = validateImportRow(row, existing)
+		if prev, ok := seenUsernames[strings.ToLower(row.Username)]; ok && row.Username != "" {
+			results[i].Errors = append(results[i].Errors, fmt.Sprintf("username duplicates row %d", prev))
+		}
+		if prev, ok := seenEmails[strings.ToLower(row.Email)]; ok && row.Email != "" {
+			results[i].Errors = append(results[i].Errors, fmt.Sprintf("email duplicates row %d", prev))
+		}
+		seenUsernames[strings.ToLower(row.Username)] = i + 1
+		seenEmails[strings.ToLower(row.Email)] = i + 1
+		if len(results[i].Errors) > 0 {
+			valid = false
+		}
+	}
+	response := map[string]interface{}{
+		"dry_run": dryRun,
+		"results": results,
+	}
+	if !valid {
+		api.httpGeneralWrite(http.StatusUnprocessableEntity, "Import has invalid rows", response, w)
+		return
+	}
+	if dryRun {
+		api.httpGeneralWrite(http.StatusOK, "Import is valid", response, w)
+		return
+	}
+
+	//Begin transaction
+	ctx, err = postgres.BeginTx(ctx, api.db)
+	if err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	defer postgres.Rollback(ctx)
+
+	for i := range users {
+		err = api.UserService.CreateUser(ctx, &users[i].user)
+		if err != nil {
+			api.httpGeneralWrite(http.StatusInternalServerError, fmt.Sprintf("row %d: %s", i+1, err), nil, w)
+			return
+		}
+		users[i].auth.UserID = users[i].user.ID
+		err = api.AuthService.CreateAuth(ctx, &users[i].auth)
+		if err != nil {
+			if err == epublib.ErrUsernameTaken {
+				results[i].Errors = []string{"username is already taken"}
+				api.httpGeneralWrite(http.StatusConflict, "Import has invalid rows", response, w)
+				return
+			}
+			api.httpGeneralWrite(http.StatusInternalServerError, fmt.Sprintf("row %d: %s", i+1, err), nil, w)
+			return
+		}
+		results[i].UserID = users[i].user.ID
+	}
+
+	// Commit transaction
+	err = postgres.Commit(ctx)
+	if err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+
+	// Invitations let users pick their own password through the reset flow.
+	// Accounts are already created, so failures are reported per row.
+	if invite {
+		for i := range users {
+			if err := api.sendInvitation(r, &users[i].auth); err != nil {
+				results[i].Errors = append(results[i].Errors, "invitation not sent: "+err.Error())
+			}
+		}
+	}
+
+	api.httpGeneralWrite(http.StatusCreated, fmt.Sprintf("%d users imported successfully", len(users)), response, w)
+}
+
+// existingLogins holds the usernames, lowercased, and the emails of an
+// import that are already in use.
+type existingLogins struct {
+	usernames map[string]bool
+	emails    map[string]bool
+}
+
+// findExistingLogins looks up the usernames and emails of every import row
+// in a single query.
+func (api *API) findExistingLogins(ctx context.Context, rows []ImportUserRow) (existingLogins, error) {
+	existing := existingLogins{usernames: map[string]bool{}, emails: map[string]bool{}}
+	usernames := make([]string, 0, len(rows))
+	emails := make([]string, 0, len(rows))
+	for _, row := range rows {
+		usernames = append(usernames, row.Username)
+		emails = append(emails, row.Email)
+	}
+	auths, err := api.AuthService.FindAuthsByLogins(ctx, usernames, emails)
+	if err != nil {
+		return existing, err
+	}
+	for _, auth := range auths {
+		existing.usernames[strings.ToLower(auth.Username)] = true
+		existing.emails[auth.Email] = true
+	}
+	return existing, nil
+}
+
+// validateImportRow checks a single row and converts it into the user and
+// auth objects to create.
+func validateImportRow(row ImportUserRow, existing existingLogins) (importUser, []string) {
+	var errs []string
+	if err := epublib.ValidateUsername(row.Username); err != nil {
+		errs = append(errs, err.Error())
+	} else if existing.usernames[strings.ToLower(row.Username)] {
+		errs = append(errs, "username is already taken")
+	}
+	if !util.IsValidEmail(row.Email) {
+		errs = append(errs, "invalid email")
+	} else if existing.emails[row.Email] {
+		errs = append(errs, "email is already registered")
+	}
+
+	level := epublib.UserLevel
+	if row.Level != "" {
+		level = epublib.AuthLevel(row.Level)
+		if !level.IsValid() {
+			errs = append(errs, "invalid user level")
+		} else if level == epublib.SuperAdminLevel {
+			errs = append(errs, "super admins cannot be imported")
+		}
+	}
+	gender := epublib.UnidentifiedGender
+	if row.Gender != "" {
+		gender = epublib.Gender(row.Gender)
+		if !gender.IsValid() {
+			errs = append(errs, "invalid gender")
+		}
+	}
+	birthDate := time.Now()
+	if row.BirthDate != "" {
+		var err error
+		if birthDate, err = parseQueryTime(row.BirthDate); err != nil {
+			errs = append(errs, "invalid birth_date, expected YYYY-MM-DD")
+		}
+	}
+	phoneNumber, err := normalizePhoneNumber(row.PhoneNumber)
+	if err != nil {
+		errs = append(errs, "invalid phone_number, expected an international number")
+	}
+	name := row.Name
+	if name == "" {
+		name = row.Username
+	}
+
+	// Users without a password must set one through their invitation
+	password := row.Password
+	if password == "" {
+		random := make([]byte, 24)
+		if _, err := rand.Read(random); err != nil {
+			errs = append(errs, err.Error())
+		}
+		password = hex.EncodeToString(random)
+	}
+
+	return importUser{
+		user: epublib.User{
+			Name:        name,
+			Address:     row.Address,
+			PhoneNumber: phoneNumber,
+			Gender:      gender,
+			BirthDate:   birthDate,
+		},
+		auth: epublib.Auth{
+			Username: row.Username,
+			Password: password,
+			Email:    row.Email,
+			Level:    level,
+		},
+	}, errs
+}
+
+// readImportCSV reads import rows from CSV with a header row naming the
+// ImportUserRow JSON fields. Unknown columns are rejected.
+func readImportCSV(r io.Reader) ([]ImportUserRow, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	for i, column := range header {
+		header[i] = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(column, "\ufeff")))
+		if _, ok := importRowField(&ImportUserRow{}, header[i]); !ok {
+			return nil, fmt.Errorf("unknown column %q", column)
+		}
+	}
+	var rows []ImportUserRow
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		var row ImportUserRow
+		for i, value := range record {
+			field, _ := importRowField(&row, header[i])
+			*field = strings.TrimSpace(value)
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// importRowField returns the field of row named by a CSV column.
+func importRowField(row *ImportUserRow, column string) (*string, bool) {
+	switch column {
+	case "username":
+		return &row.Username, true
+	case "email":
+		return &row.Email, true
+	case "password":
+		return &row.Password, true
+	case "level":
+		return &row.Level, true
+	case "name":
+		return &row.Name, true
+	case "address":
+		return &row.Address, true
+	case "phone_number":
+		return &row.PhoneNumber, true
+	case "gender":
+		return &row.Gender, true
+	case "birth_date":
+		return &row.BirthDate, true
+	default:
+		return nil, false
+	}
+}
+
+// sendInvitation emails auth a reset token so they can choose a password.
+func (api *API) sendInvitation(r *http.Request, auth *epublib.Auth) error {
+	token, err := api.ResetTokenService.GenerateResetToken(r.Context(), auth)
+	if err != nil {
+		return err
+	}
+	mail, err := buildTokenMail(r.Context(), "INVITE_TEMPLATE_FILE_PATH", "Welcome to "+libraryName(r.Context()), auth, token)
+	if err != nil {
+		return err
+	}
+	return api.MailerService.SendMail(r.Context(), *mail)
+}
+
+// ExportUserRow represents a single user in a bulk export.
+type ExportUserRow struct {
+	ID          string            `json:"id"`
+	Username    string            `json:"username"`
+	Email       string            `json:"email"`
+	Level       epublib.AuthLevel `json:"level"`
+	Name        string            `json:"name"`
+	Address     string            `json:"address"`
+	PhoneNumber string            `json:"phone_number"`
+	Gender      epublib.Gender    `json:"gender"`
+	BirthDate   string            `json:"birth_date"`
+	CreatedAt   time.Time         `json:"created_at"`
+	UpdatedAt   time.Time         `json:"updated_at"`
+	DeletedAt   *time.Time        `json:"deleted_at"`
+}
+
+var exportUserColumns = []string{"id", "username", "email", "level", "name", "address", "phone_number", "gender", "birth_date", "created_at", "updated_at", "deleted_at"}
+
+func (row *ExportUserRow) csvRecord() []string {
+	deletedAt := ""
+	if row.DeletedAt != nil {
+		deletedAt = row.DeletedAt.Format(time.RFC3339)
+	}
+	return []string{
+		row.ID,
+		row.Username,
+		row.Email,
+		string(row.Level),
+		row.Name,
+		row.Address,
+		row.PhoneNumber,
+		string(row.Gender),
+		row.BirthDate,
+		row.CreatedAt.Format(time.RFC3339),
+		row.UpdatedAt.Format(time.RFC3339),
+		deletedAt,
+	}
+}
+
+func (api *API) handleExportUsers(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	isAdmin, err := api.isAdmin(ctx)
+	if err != nil {
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	if !isAdmin {
+		api.httpGeneralWrite(http.StatusForbidden, "Only admin can export users", nil, w)
+		return
+	}
+	filter, err := parseUserFilter(r)
+	if err != nil {
+		api.httpGeneralWrite(http.StatusBadRequest, err.Error(), nil, w)
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "csv"
+	}
+	if format != "csv" && format != "json" {
+		api.httpGeneralWrite(http.StatusBadRequest, "format must be csv or json", nil, w)
+		return
+	}
+
+	// Fetch the first page before writing anything so errors can still be
+	// reported as JSON
+	filter.Offset = 0
+	filter.Limit = epublib.MaxUserPageSize
+	users, _, err := api.UserService.FindUsers(ctx, filter)
+	if err != nil {
+		if err == epublib.ErrInvalidCursor {
+			api.httpGeneralWrite(http.StatusBadRequest, "Invalid cursor", nil, w)
+			return
+		}
+		api.httpGeneralWrite(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+
+	filename := "users-" + time.Now().Format("20060102-150405") + "." + format
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	var csvWriter *csv.Writer
+	if format == "csv" {
+		w.Header().Set("Content-Type", "text/csv")
+		csvWriter = csv.NewWriter(w)
+		csvWriter.Write(exportUserColumns)
+	} else {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, "[")
+	}
+
+	// Walk through every page using keyset pagination
+	first := true
+	for len(users) > 0 {
+		ids := make([]string, len(users))
+		for i, user := range users {
+			ids[i] = user.ID
+		}
+		auths, err := api.AuthService.FindAuthsByUserIDs(ctx, ids)
+		if err != nil {
+			// Headers are already sent, so the truncated body is all we can signal
+			log.Println(err)
+			return
+		}
+		for _, user := range users {
+			row := ExportUserRow{
+				ID:          user.ID,
+				Name:        user.Name,
+				Address:     user.Address,
+				PhoneNumber: user.PhoneNumber,
+				Gender:      user.Gender,
+				BirthDate:   user.BirthDate.Format("2006-01-02"),
+				CreatedAt:   user.CreatedAt,
+				UpdatedAt:   user.UpdatedAt,
+			}
+			if !user.DeletedAt.IsZero() {
+				deletedAt := user.DeletedAt
+				row.DeletedAt = &deletedAt
+			}
+			if auth, ok := auths[user.ID]; ok {
+				row.Username, row.Email, row.Level = auth.Username, auth.Email, auth.Level
+			}
+
+			if csvWriter != nil {
+				csvWriter.Write(row.csvRecord())
+				continue
+			}
+			if !first {
+				io.WriteString(w, ",")
+			}
+			first = false
+			if err := json.NewEncoder(w).Encode(row); err != nil {
+				log.Println(err)
+				return
+			}
+		}
+		if csvWriter != nil {
+			csvWriter.Flush()
+			if err := csvWriter.Error(); err != nil {
+				log.Println(err)
+				return
+			}
+		}
+		if flusher, ok := w.(http.Flusher); ok {
+			flusher.Flush()
+		}
+		if len(users) < filter.Limit {
+			break
+		}
+
+		filter.After = epublib.NewUserCursor(users[len(users)-1], filter.Sort)
+		users, _, err = api.UserService.FindUsers(ctx, filter)
+		if err != nil {
+			// Headers are already sent, so the truncated body is all we can signal
+			log.Println(err)
+			return
+		}
+	}
+	if csvWriter == nil {
+		io.WriteString(w, "]")
+	}
+}
@@ -0,0 +1,149 @@
+package metadata
+
+import (
+	"context"
+	"encoding/json"
+	epublib "epublib"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// OpenLibraryConfig configures an OpenLibraryProvider.
+type OpenLibraryConfig struct {
+	// Base URL of the catalog, defaults to "https://openlibrary.org". Tests
+	// point it at a local stub server.
+	URL string
+
+	// Defaults to 10 seconds.
+	Timeout time.Duration
+}
+
+// OpenLibraryProvider looks books up through the Open Library books API,
+// GET /api/books?bibkeys=ISBN:...&format=json&jscmd=data, or any catalog
+// answering the same way.
+type OpenLibraryProvider struct {
+	config OpenLibraryConfig
+	client *http.Client
+}
+
+// NewOpenLibraryProvider returns a new instance of OpenLibraryProvider.
+func NewOpenLibraryProvider(config OpenLibraryConfig) *OpenLibraryProvider {
+	if config.URL == "" {
+		config.URL = "https://openlibrary.org"
+	}
+	if config.Timeout == 0 {
+		config.Timeout = 10 * time.Second
+	}
+	return &OpenLibraryProvider{
+		config: config,
+		client: &http.Client{Timeout: config.Timeout},
+	}
+}
+
+func (p *OpenLibraryProvider) Name() string {
+	return "openlibrary"
+}
+
+type openLibraryName struct {
+	Name string `json:"name"`
+}
+
+type openLibraryBook struct {
+	Title         string            `json:"title"`
+	Subtitle      string            `json:"subtitle"`
+	Authors       []openLibraryName `json:"authors"`
+	Publishers    []openLibraryName `json:"publishers"`
+	PublishDate   string            `json:"publish_date"`
+	NumberOfPages int               `json:"number_of_pages"`
+	Subjects      []openLibraryName `json:"subjects"`
+}
+
+// maxSubjects caps the subjects taken from a record, catalogs tend to list
+// dozens of them.
+const maxSubjects = 20
+
+func (p *OpenLibraryProvider) LookupISBN(ctx context.Context, isbn string) (*epublib.BookMetadata, error) {
+	bibkey := "ISBN:" + isbn
+	query := url.Values{"bibkeys": {bibkey}, "format": {"json"}, "jscmd": {"data"}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(p.config.URL, "/")+"/api/books?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", "epublib")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		err := fmt.Errorf("open library responded %s", resp.Status)
+		log.Println(err)
+		return nil, err
+	}
+	var records map[string]openLibraryBook
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&records); err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	record, ok := records[bibkey]
+	if !ok {
+		return nil, epublib.ErrNotFound
+	}
+
+	m := &epublib.BookMetadata{
+		ISBN:            isbn,
+		Title:           strings.TrimSpace(record.Title),
+		Subtitle:        strings.TrimSpace(record.Subtitle),
+		PublicationDate: parsePublishDate(record.PublishDate),
+		PageCount:       record.NumberOfPages,
+		Creators:        []epublib.BookCreator{},
+		Subjects:        []string{},
+	}
+	if len(record.Publishers) > 0 {
+		m.Publisher = strings.TrimSpace(record.Publishers[0].Name)
+	}
+	for _, author := range record.Authors {
+		if name := strings.TrimSpace(author.Name); name != "" && len(name) <= 255 {
+			m.Creators = append(m.Creators, epublib.BookCreator{Name: name, Role: string(epublib.AuthorRole)})
+		}
+	}
+	for _, subject := range record.Subjects {
+		if name := strings.TrimSpace(subject.Name); name != "" && len(m.Subjects) < maxSubjects {
+			m.Subjects = append(m.Subjects, name)
+		}
+	}
+	return m, nil
+}
+
+// publishDateLayouts lists the ways Open Library records spell publication
+// dates, most precise first.
+var publishDateLayouts = []string{
+	"2006-01-02",
+	"January 2, 2006",
+	"Jan 2, 2006",
+	"2 January 2006",
+	"January 2006",
+	"Jan 2006",
+	"2006-01",
+	"2006",
+}
+
+// parsePublishDate parses a publication date as far as it is precise. The
+// zero time is returned if it cannot be parsed.
+func parsePublishDate(value string) time.Time {
+	value = strings.TrimSpace(value)
+	for _, layout := range publishDateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,120 @@
+package metadata
+
+import (
+	"context"
+	epublib "epublib"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// openLibraryStub answers the books API from records keyed by bibkey.
+func openLibraryStub(t *testing.T, records map[string]string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if r.URL.Path != "/api/books" || query.Get("format") != "json" || query.Get("jscmd") != "data" {
+			t.Errorf("unexpected request %s", r.URL)
+		}
+		bibkey := query.Get("bibkeys")
+		record, ok := records[bibkey]
+		if !ok {
+			io.WriteString(w, "{}")
+			return
+		}
+		io.WriteString(w, `{"`+bibkey+`": `+record+`}`)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestLookupISBN(t *testing.T) {
+	server := openLibraryStub(t, map[string]string{
+		"ISBN:9780306406157": `{
+			"title": " The Book ",
+			"subtitle": "A Subtitle",
+			"authors": [{"name": "Jane Doe"}, {"name": " "}, {"name": "John Roe"}],
+			"publishers": [{"name": "Gramedia"}, {"name": "Other"}],
+			"publish_date": "March 5, 2001",
+			"number_of_pages": 320,
+			"subjects": [{"name": "Fiction"}, {"name": ""}, {"name": "History"}]
+		}`,
+	})
+	provider := NewOpenLibraryProvider(OpenLibraryConfig{URL: server.URL + "/"})
+
+	m, err := provider.LookupISBN(context.Background(), "9780306406157")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.ISBN != "9780306406157" || m.Title != "The Book" || m.Subtitle != "A Subtitle" || m.Publisher != "Gramedia" || m.PageCount != 320 {
+		t.Errorf("unexpected metadata %+v", m)
+	}
+	if want := time.Date(2001, 3, 5, 0, 0, 0, 0, time.UTC); !m.PublicationDate.Equal(want) {
+		t.Errorf("publication date = %v, want %v", m.PublicationDate, want)
+	}
+	if len(m.Creators) != 2 || m.Creators[0].Name != "Jane Doe" || m.Creators[1].Name != "John Roe" || m.Creators[0].Role != string(epublib.AuthorRole) {
+		t.Errorf("unexpected creators %+v", m.Creators)
+	}
+	if len(m.Subjects) != 2 || m.Subjects[0] != "Fiction" || m.Subjects[1] != "History" {
+		t.Errorf("unexpected subjects %v", m.Subjects)
+	}
+}
+
+func TestLookupISBNNotFound(t *testing.T) {
+	server := openLibraryStub(t, nil)
+	provider := NewOpenLibraryProvider(OpenLibraryConfig{URL: server.URL})
+
+	if _, err := provider.LookupISBN(context.Background(), "9780306406157"); err != epublib.ErrNotFound {
+		t.Errorf("got %v, want ErrNotFound", err)
+	}
+}
+
+func TestLookupISBNErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+	}{
+		{"server error", func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		}},
+		{"not found status", func(w http.ResponseWriter, r *http.Request) {
+			http.NotFound(w, r)
+		}},
+		{"malformed body", func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, "<html>")
+		}},
+	}
+	for _, tt := range tests {
+		server := httptest.NewServer(tt.handler)
+		provider := NewOpenLibraryProvider(OpenLibraryConfig{URL: server.URL})
+		_, err := provider.LookupISBN(context.Background(), "9780306406157")
+		if err == nil || err == epublib.ErrNotFound {
+			t.Errorf("%s: got %v, want an error other than ErrNotFound", tt.name, err)
+		}
+		server.Close()
+	}
+}
+
+func TestParsePublishDate(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Time
+	}{
+		{"2001-03-05", time.Date(2001, 3, 5, 0, 0, 0, 0, time.UTC)},
+		{"March 5, 2001", time.Date(2001, 3, 5, 0, 0, 0, 0, time.UTC)},
+		{"Mar 5, 2001", time.Date(2001, 3, 5, 0, 0, 0, 0, time.UTC)},
+		{"5 March 2001", time.Date(2001, 3, 5, 0, 0, 0, 0, time.UTC)},
+		{"March 2001", time.Date(2001, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{"Mar 2001", time.Date(2001, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{"2001-03", time.Date(2001, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{" 2001 ", time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"circa 2001", time.Time{}},
+		{"", time.Time{}},
+	}
+	for _, tt := range tests {
+		if got := parsePublishDate(tt.value); !got.Equal(tt.want) {
+			t.Errorf("parsePublishDate(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
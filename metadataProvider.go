@@ -0,0 +1,153 @@
+package epublib
+
+import (
+	"context"
+	"time"
+)
+
+// BookMetadata is what an external catalog knows about a book. Fields the
+// catalog does not hold are left empty.
+type BookMetadata struct {
+	ISBN            string        `json:"isbn"`
+	Title           string        `json:"title"`
+	Subtitle        string        `json:"subtitle"`
+	Language        string        `json:"language"`
+	Description     string        `json:"description"`
+	PublicationDate time.Time     `json:"publication_date"`
+	Publisher       string        `json:"publisher"`
+	PageCount       int           `json:"page_count"`
+	Creators        []BookCreator `json:"creators"`
+	Subjects        []string      `json:"subjects"`
+}
+
+// MetadataProvider represents an external catalog books are looked up in
+// to fill their missing metadata.
+type MetadataProvider interface {
+	// Name of the catalog, recorded on the proposals made from it.
+	Name() string
+
+	// Looks up a book by ISBN-13. Returns ErrNotFound if the catalog does
+	// not know it.
+	LookupISBN(ctx context.Context, isbn string) (*BookMetadata, error)
+}
+
+// MissingMetadataFields returns the fields of book, named like its JSON
+// fields, that are empty and that m has a value for.
+func MissingMetadataFields(book *Book, m *BookMetadata) []string {
+	fields := []string{}
+	add := func(field string, missing bool) {
+		if missing {
+			fields = append(fields, field)
+		}
+	}
+	add("subtitle", book.Subtitle == "" && m.Subtitle != "")
+	add("language", book.Language == "" && IsLanguageTag(m.Language))
+	add("description", book.Description == "" && m.Description != "")
+	add("publication_date", book.PublicationDate.IsZero() && !m.PublicationDate.IsZero())
+	add("publisher", book.Publisher == "" && m.Publisher != "")
+	add("page_count", book.PageCount == 0 && m.PageCount > 0)
+	add("creators", len(book.Creators) == 0 && len(m.Creators) > 0)
+	add("subjects", len(book.Subjects) == 0 && len(m.Subjects) > 0)
+	return fields
+}
+
+// ApplyMetadata copies the given fields, as returned by
+// MissingMetadataFields, from m onto book.
+func ApplyMetadata(book *Book, m *BookMetadata, fields []string) {
+	for _, field := range fields {
+		switch field {
+		case "subtitle":
+			book.Subtitle = m.Subtitle
+		case "language":
+			book.Language = m.Language
+		case "description":
+			book.Description = m.Description
+		case "publication_date":
+			book.PublicationDate = m.PublicationDate
+		case "publisher":
+			book.Publisher = m.Publisher
+		case "page_count":
+			book.PageCount = m.PageCount
+		case "creators":
+			book.Creators = m.Creators
+		case "subjects":
+			book.Subjects = m.Subjects
+		}
+	}
+}
+
+type ProposalStatus string
+
+const (
+	// PendingProposal awaits the review of an admin.
+	PendingProposal  ProposalStatus = "pending"
+	AppliedProposal  ProposalStatus = "applied"
+	RejectedProposal ProposalStatus = "rejected"
+)
+
+// IsValid checks if a ProposalStatus is valid
+func (s ProposalStatus) IsValid() bool {
+	switch s {
+	case PendingProposal, AppliedProposal, RejectedProposal:
+		return true
+	default:
+		return false
+	}
+}
+
+// MetadataProposal holds the metadata a provider found for a book until an
+// admin applies or rejects it.
+type MetadataProposal struct {
+	ID       string         `json:"id"`
+	BookID   string         `json:"book_id"`
+	Provider string         `json:"provider"`
+	Status   ProposalStatus `json:"status"`
+
+	// Fields of the book the proposal fills, see MissingMetadataFields.
+	// Once applied, only the fields the admin accepted.
+	Fields []string `json:"fields"`
+
+	// Metadata found by the provider, only Fields are applied.
+	Metadata BookMetadata `json:"metadata"`
+
+	// Admin who applied or rejected the proposal, empty while pending.
+	ReviewerID string    `json:"reviewer_id"`
+	ReviewedAt time.Time `json:"reviewed_at"`
+
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// MetadataProposalService represents a service for managing the metadata
+// proposals of books.
+type MetadataProposalService interface {
+	// Retrieves a proposal by ID.
+	FindMetadataProposalByID(ctx context.Context, id string) (*MetadataProposal, error)
+
+	// Retrieves a list of proposals by filter, newest first. Also returns
+	// total count of matching proposals which may differ from returned
+	// results if filter.Limit is specified.
+	FindMetadataProposals(ctx context.Context, filter MetadataProposalFilter) ([]*MetadataProposal, int, error)
+
+	// Creates a pending proposal, replacing the pending proposal of the
+	// book if any.
+	CreateMetadataProposal(ctx context.Context, proposal *MetadataProposal) error
+
+	// Marks a pending proposal as applied, with the fields that were, or as
+	// rejected. Returns ErrProposalReviewed if it is no longer pending.
+	ReviewMetadataProposal(ctx context.Context, id string, status ProposalStatus, fields []string, reviewerID string) (*MetadataProposal, error)
+}
+
+// MaxMetadataProposalPageSize caps MetadataProposalFilter.Limit.
+const MaxMetadataProposalPageSize = 100
+
+// MetadataProposalFilter represents a filter passed to
+// FindMetadataProposals().
+type MetadataProposalFilter struct {
+	// Filtering fields.
+	BookID string         `json:"book_id"`
+	Status ProposalStatus `json:"status"`
+
+	// Restrict to subset of results.
+	Offset int `json:"offset"`
+	Limit  int `json:"limit"`
+}
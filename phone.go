@@ -0,0 +1,33 @@
+package epublib
+
+import (
+	"regexp"
+	"strings"
+)
+
+// e164Pattern matches a phone number in E.164 format: a plus sign followed
+// by a country code and subscriber number of at most 15 digits in total.
+var e164Pattern = regexp.MustCompile(`^\+[1-9][0-9]{6,14}$`)
+
+// NormalizePhoneNumber converts a phone number to E.164. Spaces, dots,
+// dashes and parentheses are ignored, a leading 00 is read as the
+// international prefix and a leading 0 as a national number of
+// defaultCountryCode, e.g. "62". An empty number stays empty.
+func NormalizePhoneNumber(number, defaultCountryCode string) (string, error) {
+	number = strings.NewReplacer(" ", "", ".", "", "-", "", "(", "", ")", "").Replace(strings.TrimSpace(number))
+	switch {
+	case number == "":
+		return "", nil
+	case strings.HasPrefix(number, "+"):
+	case strings.HasPrefix(number, "00"):
+		number = "+" + number[2:]
+	case strings.HasPrefix(number, "0") && defaultCountryCode != "":
+		number = "+" + strings.TrimPrefix(defaultCountryCode, "+") + number[1:]
+	default:
+		return "", ErrInvalidPhoneNumber
+	}
+	if !e164Pattern.MatchString(number) {
+		return "", ErrInvalidPhoneNumber
+	}
+	return number, nil
+}
@@ -0,0 +1,49 @@
+package epublib
+
+import (
+	"context"
+	"time"
+)
+
+// MaxPhoneVerificationAttempts is how many wrong codes a verification
+// accepts before it stops being pending.
+const MaxPhoneVerificationAttempts = 5
+
+type PhoneVerification struct {
+	ID          string    `json:"id"`
+	UserID      string    `json:"user_id"`
+	PhoneNumber string    `json:"phone_number"`
+	Attempts    int       `json:"attempts"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	VerifiedAt  time.Time `json:"verified_at"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+
+	// One-time code sent to the phone number. Only set on creation, the
+	// stored code is hashed.
+	Code string `json:"-"`
+}
+
+// PhoneVerificationService represents a service for verifying phone numbers
+// with one-time codes.
+type PhoneVerificationService interface {
+	// Creates a new verification and cancels any pending one of the user.
+	CreatePhoneVerification(ctx context.Context, v *PhoneVerification) error
+
+	// Retrieves the unexpired, unverified verification of a user that still
+	// accepts attempts.
+	FindPendingPhoneVerification(ctx context.Context, userID string) (*PhoneVerification, error)
+
+	// Retrieves the most recent verification of a user, whatever its state.
+	FindLatestPhoneVerification(ctx context.Context, userID string) (*PhoneVerification, error)
+
+	// Counts the verifications created since the given time for the user
+	// or for the phone number.
+	CountPhoneVerificationsSince(ctx context.Context, userID, phoneNumber string, since time.Time) (int, error)
+
+	// Counts an attempt against a pending verification and, if code matches,
+	// marks it and the user's phone number as verified. Returns ErrNotFound
+	// if the verification is no longer pending or the user's phone number
+	// has changed since it was created.
+	VerifyPhone(ctx context.Context, id, code string) (bool, error)
+}
@@ -5,9 +5,13 @@ import (
 	"crypto/sha256"
 	"database/sql"
 	epublib "epublib"
+	"errors"
 	"fmt"
 	"log"
+	"strings"
+	"time"
 
+	"github.com/jackc/pgconn"
 	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 )
@@ -19,6 +23,7 @@ type Auth struct {
 	Password  string       `json:"password"`
 	Email     string       `json:"email"`
 	Level     string       `json:"level"`
+	Version   int          `json:"version"`
 	CreatedAt sql.NullTime `json:"created_at"`
 	UpdatedAt sql.NullTime `json:"updated_at"`
 	DeletedAt sql.NullTime `json:"deleted_at"`
@@ -32,12 +37,32 @@ func (auth *Auth) toEpublibAuth() *epublib.Auth {
 		Password:  auth.Password,
 		Email:     auth.Email,
 		Level:     epublib.AuthLevel(auth.Level),
+		Version:   auth.Version,
 		CreatedAt: auth.CreatedAt.Time,
 		UpdatedAt: auth.UpdatedAt.Time,
 		DeletedAt: auth.DeletedAt.Time,
 	}
 }
 
+// authColumns lists the auth columns in the order expected by scanAuth.
+const authColumns = "id, user_id, username, password, email, level, version, created_at, updated_at, deleted_at"
+
+// scanAuth scans a single row selected with authColumns into auth.
+func scanAuth(row pgx.Row, auth *Auth) error {
+	return row.Scan(
+		&auth.ID,
+		&auth.UserID,
+		&auth.Username,
+		&auth.Password,
+		&auth.Email,
+		&auth.Level,
+		&auth.Version,
+		&auth.CreatedAt,
+		&auth.UpdatedAt,
+		&auth.DeletedAt,
+	)
+}
+
 // AuthService represents a service for managing OAuth authentication.
 type AuthService struct {
 	db epublib.Conn
@@ -50,17 +75,7 @@ func NewAuthService(db *pgxpool.Pool) *AuthService {
 
 func (svc *AuthService) FindAuthByEmail(ctx context.Context, email string) (*epublib.Auth, error) {
 	auth := &Auth{}
-	err := svc.db.QueryRow(ctx, "SELECT * FROM auth WHERE email = $1 AND deleted_at IS NULL", email).Scan(
-		&auth.ID,
-		&auth.UserID,
-		&auth.Username,
-		&auth.Password,
-		&auth.Email,
-		&auth.Level,
-		&auth.CreatedAt,
-		&auth.UpdatedAt,
-		&auth.DeletedAt,
-	)
+	err := scanAuth(svc.db.QueryRow(ctx, "SELECT "+authColumns+" FROM auth WHERE email = $1 AND deleted_at IS NULL", email), auth)
 	if err != nil {
 		if err == pgx.ErrNoRows {
 			return nil, epublib.ErrNotFound
@@ -74,17 +89,7 @@ func (svc *AuthService) FindAuthByEmail(ctx context.Context, email string) (*epu
 func (svc *AuthService) FindAuthByEmailPass(ctx context.Context, email, password string) (*epublib.Auth, error) {
 	auth := &Auth{}
 	encrypted := encryptPass(password, email)
-	err := svc.db.QueryRow(ctx, "SELECT * FROM auth WHERE email = $1 AND password = $2", email, encrypted).Scan(
-		&auth.ID,
-		&auth.UserID,
-		&auth.Username,
-		&auth.Password,
-		&auth.Email,
-		&auth.Level,
-		&auth.CreatedAt,
-		&auth.UpdatedAt,
-		&auth.DeletedAt,
-	)
+	err := scanAuth(svc.db.QueryRow(ctx, "SELECT "+authColumns+" FROM auth WHERE email = $1 AND password = $2", email, encrypted), auth)
 	if err != nil {
 		if err == pgx.ErrNoRows {
 			return nil, epublib.ErrNotFound
@@ -99,17 +104,7 @@ func (svc *AuthService) FindAuthByEmailPass(ctx context.Context, email, password
 // Returns ENOTFOUND if ID does not exist.
 func (svc *AuthService) FindAuthByID(ctx context.Context, id string) (*epublib.Auth, error) {
 	auth := &Auth{}
-	err := svc.db.QueryRow(ctx, "SELECT * FROM auth WHERE id = $1", id).Scan(
-		&auth.ID,
-		&auth.UserID,
-		&auth.Username,
-		&auth.Password,
-		&auth.Email,
-		&auth.Level,
-		&auth.CreatedAt,
-		&auth.UpdatedAt,
-		&auth.DeletedAt,
-	)
+	err := scanAuth(svc.db.QueryRow(ctx, "SELECT "+authColumns+" FROM auth WHERE id = $1", id), auth)
 	if err != nil {
 		if err == pgx.ErrNoRows {
 			return nil, epublib.ErrNotFound
@@ -124,17 +119,7 @@ func (svc *AuthService) FindAuthByID(ctx context.Context, id string) (*epublib.A
 // Returns ENOTFOUND if ID does not exist.
 func (svc *AuthService) FindAuthByUserID(ctx context.Context, id string) (*epublib.Auth, error) {
 	auth := &Auth{}
-	err := svc.db.QueryRow(ctx, "SELECT * FROM auth WHERE user_id = $1", id).Scan(
-		&auth.ID,
-		&auth.UserID,
-		&auth.Username,
-		&auth.Password,
-		&auth.Email,
-		&auth.Level,
-		&auth.CreatedAt,
-		&auth.UpdatedAt,
-		&auth.DeletedAt,
-	)
+	err := scanAuth(svc.db.QueryRow(ctx, "SELECT "+authColumns+" FROM auth WHERE user_id = $1", id), auth)
 	if err != nil {
 		if err == pgx.ErrNoRows {
 			return nil, epublib.ErrNotFound
@@ -145,6 +130,60 @@ func (svc *AuthService) FindAuthByUserID(ctx context.Context, id string) (*epubl
 	return auth.toEpublibAuth(), nil
 }
 
+func (svc *AuthService) FindAuthsByUserIDs(ctx context.Context, ids []string) (map[string]*epublib.Auth, error) {
+	// Order by creation so the latest authentication object of a user wins
+	auths, err := svc.findAuths(ctx, "SELECT "+authColumns+" FROM auth WHERE user_id = ANY($1) ORDER BY created_at", ids)
+	if err != nil {
+		return nil, err
+	}
+	byUserID := make(map[string]*epublib.Auth, len(auths))
+	for _, auth := range auths {
+		byUserID[auth.UserID] = auth
+	}
+	return byUserID, nil
+}
+
+func (svc *AuthService) FindAuthsByLogins(ctx context.Context, usernames, emails []string) ([]*epublib.Auth, error) {
+	lowered := make([]string, len(usernames))
+	for i, username := range usernames {
+		lowered[i] = strings.ToLower(username)
+	}
+	return svc.findAuths(
+		ctx,
+		"SELECT "+authColumns+" FROM auth WHERE (lower(username) = ANY($1) OR email = ANY($2)) AND deleted_at IS NULL",
+		lowered,
+		emails,
+	)
+}
+
+// findAuths runs a query selecting authColumns.
+func (svc *AuthService) findAuths(ctx context.Context, query string, args ...interface{}) ([]*epublib.Auth, error) {
+	db := svc.db
+	if tx := epublib.TxFromContext(ctx); tx != nil {
+		db = tx
+	}
+	rows, err := db.Query(ctx, query, args...)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer rows.Close()
+	auths := []*epublib.Auth{}
+	for rows.Next() {
+		auth := &Auth{}
+		if err := scanAuth(rows, auth); err != nil {
+			log.Println(err)
+			return nil, err
+		}
+		auths = append(auths, auth.toEpublibAuth())
+	}
+	if err := rows.Err(); err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	return auths, nil
+}
+
 // Creates a new authentication object
 // On success, the auth.ID is set to the new authentication ID.
 func (svc *AuthService) CreateAuth(ctx context.Context, auth *epublib.Auth) error {
@@ -152,8 +191,15 @@ func (svc *AuthService) CreateAuth(ctx context.Context, auth *epublib.Auth) erro
 	if tx := epublib.TxFromContext(ctx); tx != nil {
 		db = tx
 	}
+	reserved, err := usernameReserved(ctx, db, auth.Username, auth.UserID)
+	if err != nil {
+		return err
+	}
+	if reserved {
+		return epublib.ErrUsernameTaken
+	}
 	encrypted := encryptPass(auth.Password, auth.Email)
-	err := db.QueryRow(
+	err = db.QueryRow(
 		ctx,
 		"INSERT INTO auth (user_id, username, password, email, level, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id",
 		auth.UserID,
@@ -168,12 +214,115 @@ func (svc *AuthService) CreateAuth(ctx context.Context, auth *epublib.Auth) erro
 		if err == pgx.ErrNoRows {
 			return epublib.ErrNotFound
 		}
+		if isUniqueViolation(err, "auth_username_lower_idx") {
+			return epublib.ErrUsernameTaken
+		}
 		log.Println(err)
 		return err
 	}
 	return nil
 }
 
+func (svc *AuthService) FindAuthByUsername(ctx context.Context, username string) (*epublib.Auth, error) {
+	db := svc.db
+	if tx := epublib.TxFromContext(ctx); tx != nil {
+		db = tx
+	}
+	auth := &Auth{}
+	err := scanAuth(db.QueryRow(ctx, "SELECT "+authColumns+" FROM auth WHERE lower(username) = lower($1) AND deleted_at IS NULL", username), auth)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, epublib.ErrNotFound
+		}
+		log.Println(err)
+		return nil, err
+	}
+	return auth.toEpublibAuth(), nil
+}
+
+// Renames the authentication object and reserves the previous username.
+// Should run inside a transaction so the rename and reservation are atomic.
+func (svc *AuthService) ChangeUsername(ctx context.Context, id, username string, reserveFor time.Duration) error {
+	db := svc.db
+	if tx := epublib.TxFromContext(ctx); tx != nil {
+		db = tx
+	}
+	var userID, previous string
+	err := db.QueryRow(ctx, "SELECT user_id, username FROM auth WHERE id = $1 FOR UPDATE", id).Scan(&userID, &previous)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return epublib.ErrNotFound
+		}
+		log.Println(err)
+		return err
+	}
+	if previous == username {
+		return nil
+	}
+
+	reserved, err := usernameReserved(ctx, db, username, userID)
+	if err != nil {
+		return err
+	}
+	if reserved {
+		return epublib.ErrUsernameTaken
+	}
+	_, err = db.Exec(ctx, "UPDATE auth SET username = $1, version = version + 1, updated_at = current_timestamp WHERE id = $2", username, id)
+	if err != nil {
+		if isUniqueViolation(err, "auth_username_lower_idx") {
+			return epublib.ErrUsernameTaken
+		}
+		log.Println(err)
+		return err
+	}
+
+	// Hold on to the previous name unless only its case changed, and release
+	// any reservation the user had on the new one.
+	_, err = db.Exec(ctx, "DELETE FROM username_reservation WHERE lower(username) = lower($1) AND user_id = $2", username, userID)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	if strings.EqualFold(previous, username) {
+		return nil
+	}
+	_, err = db.Exec(
+		ctx,
+		`INSERT INTO username_reservation (username, user_id, reserved_until) VALUES (lower($1), $2, $3)
+		ON CONFLICT (tenant_id, username) DO UPDATE SET user_id = EXCLUDED.user_id, reserved_until = EXCLUDED.reserved_until`,
+		previous,
+		userID,
+		time.Now().Add(reserveFor),
+	)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	return nil
+}
+
+// usernameReserved reports whether username is reserved for a user other than userID.
+func usernameReserved(ctx context.Context, db epublib.Conn, username, userID string) (bool, error) {
+	var reserved bool
+	err := db.QueryRow(
+		ctx,
+		"SELECT EXISTS (SELECT 1 FROM username_reservation WHERE username = lower($1) AND reserved_until > current_timestamp AND ($2 = '' OR user_id::text <> $2))",
+		username,
+		userID,
+	).Scan(&reserved)
+	if err != nil {
+		log.Println(err)
+		return false, err
+	}
+	return reserved, nil
+}
+
+// isUniqueViolation reports whether err is a unique violation of constraint.
+func isUniqueViolation(err error, constraint string) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505" && pgErr.ConstraintName == constraint
+}
+
 func (svc *AuthService) ResetAuthPassword(ctx context.Context, id, email, password string) error {
 	db := svc.db
 	if tx := epublib.TxFromContext(ctx); tx != nil {
@@ -182,7 +331,7 @@ func (svc *AuthService) ResetAuthPassword(ctx context.Context, id, email, passwo
 	encrypted := encryptPass(password, email)
 	_, err := db.Exec(
 		ctx,
-		"UPDATE auth SET password = $1, updated_at = current_timestamp WHERE id = $2",
+		"UPDATE auth SET password = $1, version = version + 1, updated_at = current_timestamp WHERE id = $2",
 		encrypted,
 		id,
 	)
@@ -200,7 +349,7 @@ func (svc *AuthService) DeleteAuth(ctx context.Context, id string) error {
 	if tx := epublib.TxFromContext(ctx); tx != nil {
 		db = tx
 	}
-	_, err := db.Exec(ctx, "UPDATE auth SET deleted_at = current_timestamp WHERE id = $1", id)
+	_, err := db.Exec(ctx, "UPDATE auth SET deleted_at = current_timestamp, version = version + 1 WHERE id = $1", id)
 	if err != nil {
 		log.Println(err)
 		return err
@@ -208,6 +357,22 @@ func (svc *AuthService) DeleteAuth(ctx context.Context, id string) error {
 	return nil
 }
 
+func (svc *AuthService) RestoreAuth(ctx context.Context, id string) error {
+	db := svc.db
+	if tx := epublib.TxFromContext(ctx); tx != nil {
+		db = tx
+	}
+	tag, err := db.Exec(ctx, "UPDATE auth SET deleted_at = NULL, version = version + 1, updated_at = current_timestamp WHERE id = $1 AND deleted_at IS NOT NULL", id)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return epublib.ErrNotFound
+	}
+	return nil
+}
+
 func encryptPass(pass string, salt string) string {
 	h := sha256.New()
 	h.Write([]byte(pass + "|" + salt))
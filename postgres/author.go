@@ -0,0 +1,477 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	epublib "epublib"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+type Author struct {
+	ID        string       `json:"id"`
+	Name      string       `json:"name"`
+	SortName  string       `json:"sort_name"`
+	Aliases   []string     `json:"aliases"`
+	Bio       string       `json:"bio"`
+	PhotoKey  string       `json:"photo_key"`
+	Version   int          `json:"version"`
+	CreatedAt sql.NullTime `json:"created_at"`
+	UpdatedAt sql.NullTime `json:"updated_at"`
+	DeletedAt sql.NullTime `json:"deleted_at"`
+}
+
+func (a *Author) toEpublibAuthor() *epublib.Author {
+	return &epublib.Author{
+		ID:        a.ID,
+		Name:      a.Name,
+		SortName:  a.SortName,
+		Aliases:   nonNilStrings(a.Aliases),
+		Bio:       a.Bio,
+		PhotoKey:  a.PhotoKey,
+		HasPhoto:  a.PhotoKey != "",
+		Version:   a.Version,
+		CreatedAt: a.CreatedAt.Time,
+		UpdatedAt: a.UpdatedAt.Time,
+		DeletedAt: a.DeletedAt.Time,
+	}
+}
+
+// authorColumns lists the author columns in the order expected by
+// scanAuthor.
+const authorColumns = "id, name, sort_name, aliases, bio, photo_key, version, created_at, updated_at, deleted_at"
+
+// scanAuthor scans a single row selected with authorColumns.
+func scanAuthor(row pgx.Row) (*epublib.Author, error) {
+	a := &Author{}
+	err := row.Scan(&a.ID, &a.Name, &a.SortName, &a.Aliases, &a.Bio, &a.PhotoKey, &a.Version, &a.CreatedAt, &a.UpdatedAt, &a.DeletedAt)
+	if err != nil {
+		return nil, err
+	}
+	return a.toEpublibAuthor(), nil
+}
+
+// nameKeys returns the distinct non-empty keys of a name and its aliases,
+// computed with key.
+func nameKeys(key func(string) string, name string, aliases []string) []string {
+	keys := []string{}
+	seen := map[string]bool{}
+	for _, n := range append([]string{name}, aliases...) {
+		if k := key(n); k != "" && !seen[k] {
+			seen[k] = true
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+// mergeAliases adds names to aliases, skipping those whose key matches the
+// name or an alias already.
+func mergeAliases(key func(string) string, name string, aliases []string, names []string) []string {
+	seen := map[string]bool{key(name): true}
+	merged := []string{}
+	for _, alias := range append(aliases, names...) {
+		alias = strings.TrimSpace(alias)
+		if k := key(alias); k != "" && !seen[k] {
+			seen[k] = true
+			merged = append(merged, alias)
+		}
+	}
+	return merged
+}
+
+// distinctIDs returns the distinct IDs other than except.
+func distinctIDs(ids []string, except string) []string {
+	distinct := []string{}
+	seen := map[string]bool{except: true}
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			distinct = append(distinct, id)
+		}
+	}
+	return distinct
+}
+
+// AuthorService represents a service for managing authors.
+type AuthorService struct {
+	db epublib.Conn
+}
+
+// NewAuthorService returns a new instance of AuthorService attached to DB.
+func NewAuthorService(db *pgxpool.Pool) *AuthorService {
+	return &AuthorService{db: db}
+}
+
+func (svc *AuthorService) FindAuthorByID(ctx context.Context, id string) (*epublib.Author, error) {
+	db := svc.db
+	if tx := epublib.TxFromContext(ctx); tx != nil {
+		db = tx
+	}
+	author, err := scanAuthor(db.QueryRow(ctx, "SELECT "+authorColumns+" FROM author WHERE id = $1 AND deleted_at IS NULL", id))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, epublib.ErrNotFound
+		}
+		log.Println(err)
+		return nil, err
+	}
+	return author, nil
+}
+
+func (svc *AuthorService) FindAuthors(ctx context.Context, filter epublib.AuthorFilter) ([]*epublib.Author, int, error) {
+	db := svc.db
+	if tx := epublib.TxFromContext(ctx); tx != nil {
+		db = tx
+	}
+	if filter.Limit <= 0 {
+		filter.Limit = 10
+	}
+	if filter.Limit > epublib.MaxAuthorPageSize {
+		filter.Limit = epublib.MaxAuthorPageSize
+	}
+
+	// Build the SQL query based on the filter criteria.
+	filterQuery := " WHERE deleted_at IS NULL"
+	args := []interface{}{}
+	if filter.Name != "" {
+		args = append(args, "%"+escapeLike(filter.Name)+"%")
+		filterQuery += fmt.Sprintf(" AND (name ILIKE $%d OR EXISTS (SELECT 1 FROM unnest(aliases) AS alias WHERE alias ILIKE $%d))", len(args), len(args))
+	}
+
+	// Count the total number of matching authors.
+	var totalCount int
+	err := db.QueryRow(ctx, "SELECT COUNT(*) FROM author"+filterQuery, args...).Scan(&totalCount)
+	if err != nil {
+		log.Println(err)
+		return nil, 0, err
+	}
+
+	query := "SELECT " + authorColumns + " FROM author" + filterQuery + fmt.Sprintf(" ORDER BY lower(sort_name), id OFFSET %d LIMIT %d", filter.Offset, filter.Limit)
+	authors, err := svc.queryAuthors(ctx, db, query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	return authors, totalCount, nil
+}
+
+func (svc *AuthorService) queryAuthors(ctx context.Context, db epublib.Conn, query string, args ...interface{}) ([]*epublib.Author, error) {
+	rows, err := db.Query(ctx, query, args...)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	authors := []*epublib.Author{}
+	for rows.Next() {
+		author, err := scanAuthor(rows)
+		if err != nil {
+			log.Println(err)
+			return nil, err
+		}
+		authors = append(authors, author)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	return authors, nil
+}
+
+// nameTaken reports whether one of keys is the name key of another author
+// than the one with the given ID.
+func (svc *AuthorService) nameTaken(ctx context.Context, db epublib.Conn, keys []string, id string) (bool, error) {
+	var taken bool
+	err := db.QueryRow(
+		ctx,
+		"SELECT EXISTS (SELECT 1 FROM author WHERE name_keys && $1 AND id::text <> $2 AND deleted_at IS NULL)",
+		keys,
+		id,
+	).Scan(&taken)
+	if err != nil {
+		log.Println(err)
+	}
+	return taken, err
+}
+
+func (svc *AuthorService) CreateAuthor(ctx context.Context, author *epublib.Author) error {
+	db := svc.db
+	if tx := epublib.TxFromContext(ctx); tx != nil {
+		db = tx
+	}
+	author.Aliases = mergeAliases(epublib.AuthorNameKey, author.Name, nil, author.Aliases)
+	keys := nameKeys(epublib.AuthorNameKey, author.Name, author.Aliases)
+	taken, err := svc.nameTaken(ctx, db, keys, "")
+	if err != nil {
+		return err
+	}
+	if taken {
+		return epublib.ErrAuthorNameTaken
+	}
+	err = db.QueryRow(
+		ctx,
+		`INSERT INTO author (name, sort_name, aliases, name_keys, match_key, bio, photo_key)
+		VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id, version, created_at, updated_at`,
+		author.Name,
+		author.SortName,
+		author.Aliases,
+		keys,
+		epublib.AuthorMatchKey(author.Name),
+		author.Bio,
+		author.PhotoKey,
+	).Scan(&author.ID, &author.Version, &author.CreatedAt, &author.UpdatedAt)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	return nil
+}
+
+func (svc *AuthorService) UpdateAuthor(ctx context.Context, id string, upd epublib.AuthorUpdate) (*epublib.Author, error) {
+	db := svc.db
+	if tx := epublib.TxFromContext(ctx); tx != nil {
+		db = tx
+	}
+	aliases := mergeAliases(epublib.AuthorNameKey, upd.Name, nil, upd.Aliases)
+	keys := nameKeys(epublib.AuthorNameKey, upd.Name, aliases)
+	taken, err := svc.nameTaken(ctx, db, keys, id)
+	if err != nil {
+		return nil, err
+	}
+	if taken {
+		return nil, epublib.ErrAuthorNameTaken
+	}
+	tag, err := db.Exec(
+		ctx,
+		`UPDATE author SET name = $1, sort_name = $2, aliases = $3, name_keys = $4, match_key = $5, bio = $6,
+		version = version + 1, updated_at = current_timestamp
+		WHERE id = $7 AND deleted_at IS NULL AND ($8 = 0 OR version = $8)`,
+		upd.Name,
+		upd.SortName,
+		aliases,
+		keys,
+		epublib.AuthorMatchKey(upd.Name),
+		upd.Bio,
+		id,
+		upd.Version,
+	)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	if tag.RowsAffected() == 0 {
+		return nil, svc.missingOrConflict(ctx, id)
+	}
+
+	// Retrieve the updated author for response.
+	return svc.FindAuthorByID(ctx, id)
+}
+
+func (svc *AuthorService) DeleteAuthor(ctx context.Context, id string, version int) error {
+	db := svc.db
+	if tx := epublib.TxFromContext(ctx); tx != nil {
+		db = tx
+	}
+	tag, err := db.Exec(
+		ctx,
+		"UPDATE author SET deleted_at = current_timestamp, version = version + 1, updated_at = current_timestamp WHERE id = $1 AND deleted_at IS NULL AND ($2 = 0 OR version = $2)",
+		id,
+		version,
+	)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return svc.missingOrConflict(ctx, id)
+	}
+	if _, err := db.Exec(ctx, "DELETE FROM book_contributor WHERE author_id = $1", id); err != nil {
+		log.Println(err)
+		return err
+	}
+	return nil
+}
+
+// missingOrConflict tells apart why a versioned write touched no rows: the
+// author either does not exist or has been modified since it was read.
+func (svc *AuthorService) missingOrConflict(ctx context.Context, id string) error {
+	if _, err := svc.FindAuthorByID(ctx, id); err != nil {
+		return err
+	}
+	return epublib.ErrConflict
+}
+
+func (svc *AuthorService) SetAuthorPhoto(ctx context.Context, id, photoKey string) (*epublib.Author, error) {
+	db := svc.db
+	if tx := epublib.TxFromContext(ctx); tx != nil {
+		db = tx
+	}
+	tag, err := db.Exec(
+		ctx,
+		"UPDATE author SET photo_key = $1, version = version + 1, updated_at = current_timestamp WHERE id = $2 AND deleted_at IS NULL",
+		photoKey,
+		id,
+	)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	if tag.RowsAffected() == 0 {
+		return nil, epublib.ErrNotFound
+	}
+	return svc.FindAuthorByID(ctx, id)
+}
+
+func (svc *AuthorService) MergeAuthors(ctx context.Context, id string, otherIDs []string) (*epublib.Author, error) {
+	db := svc.db
+	if tx := epublib.TxFromContext(ctx); tx != nil {
+		db = tx
+	}
+	author, err := svc.FindAuthorByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Delete the other authors, keeping their names
+	others, err := svc.queryAuthors(
+		ctx,
+		db,
+		`UPDATE author SET deleted_at = current_timestamp, version = version + 1, updated_at = current_timestamp
+		WHERE id = ANY($1) AND id <> $2 AND deleted_at IS NULL RETURNING `+authorColumns,
+		otherIDs,
+		id,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if len(others) == 0 || len(others) != len(distinctIDs(otherIDs, id)) {
+		return nil, epublib.ErrNotFound
+	}
+	names := []string{}
+	for _, other := range others {
+		names = append(names, other.Name)
+		names = append(names, other.Aliases...)
+	}
+
+	// Move their contributions, dropping those the author already has in
+	// the same role
+	_, err = db.Exec(ctx, "UPDATE book_contributor SET author_id = $1 WHERE author_id = ANY($2)", id, otherIDs)
+	if err == nil {
+		_, err = db.Exec(
+			ctx,
+			`DELETE FROM book_contributor c USING book_contributor d
+			WHERE c.author_id = $1 AND d.author_id = $1 AND c.book_id = d.book_id AND c.role = d.role AND c.position > d.position`,
+			id,
+		)
+	}
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	aliases := mergeAliases(epublib.AuthorNameKey, author.Name, author.Aliases, names)
+	_, err = db.Exec(
+		ctx,
+		"UPDATE author SET aliases = $1, name_keys = $2, version = version + 1, updated_at = current_timestamp WHERE id = $3",
+		aliases,
+		nameKeys(epublib.AuthorNameKey, author.Name, aliases),
+		id,
+	)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	return svc.FindAuthorByID(ctx, id)
+}
+
+func (svc *AuthorService) FindDuplicateAuthors(ctx context.Context) ([][]*epublib.Author, error) {
+	db := svc.db
+	if tx := epublib.TxFromContext(ctx); tx != nil {
+		db = tx
+	}
+	authors, err := svc.queryAuthors(
+		ctx,
+		db,
+		`SELECT `+authorColumns+` FROM author WHERE deleted_at IS NULL AND match_key IN (
+			SELECT match_key FROM author WHERE deleted_at IS NULL AND match_key <> '' GROUP BY match_key HAVING COUNT(*) > 1
+		) ORDER BY match_key, lower(sort_name), id`,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// Rows come ordered by match key, so each group is a run
+	groups := [][]*epublib.Author{}
+	for i, author := range authors {
+		if i == 0 || epublib.AuthorMatchKey(author.Name) != epublib.AuthorMatchKey(authors[i-1].Name) {
+			groups = append(groups, nil)
+		}
+		groups[len(groups)-1] = append(groups[len(groups)-1], author)
+	}
+	return groups, nil
+}
+
+func (svc *AuthorService) LinkBookContributors(ctx context.Context, bookID string, creators []epublib.BookCreator) error {
+	db := svc.db
+	if tx := epublib.TxFromContext(ctx); tx != nil {
+		db = tx
+	}
+	if _, err := db.Exec(ctx, "DELETE FROM book_contributor WHERE book_id = $1", bookID); err != nil {
+		log.Println(err)
+		return err
+	}
+	for position, creator := range creators {
+		key := epublib.AuthorNameKey(creator.Name)
+		if key == "" {
+			continue
+		}
+		role := epublib.ContributorRole(creator.Role)
+		if role == "" {
+			role = epublib.AuthorRole
+		}
+
+		// Link to the oldest author with a matching name or alias, or to a
+		// new one
+		var authorID string
+		err := db.QueryRow(
+			ctx,
+			"SELECT id FROM author WHERE name_keys @> ARRAY[$1::text] AND deleted_at IS NULL ORDER BY created_at, id LIMIT 1",
+			key,
+		).Scan(&authorID)
+		if err == pgx.ErrNoRows {
+			author := &epublib.Author{Name: strings.TrimSpace(creator.Name), SortName: strings.TrimSpace(creator.FileAs)}
+			if author.SortName == "" {
+				author.SortName = epublib.AuthorSortName(author.Name)
+			}
+			err = svc.CreateAuthor(ctx, author)
+			authorID = author.ID
+		}
+		if err != nil {
+			log.Println(err)
+			return err
+		}
+
+		_, err = db.Exec(
+			ctx,
+			"INSERT INTO book_contributor (book_id, position, author_id, role) VALUES ($1, $2, $3, $4)",
+			bookID,
+			position,
+			authorID,
+			role,
+		)
+		if err != nil {
+			log.Println(err)
+			return err
+		}
+	}
+	if _, err := db.Exec(ctx, "UPDATE book SET entities_linked = true WHERE id = $1", bookID); err != nil {
+		log.Println(err)
+		return err
+	}
+	return nil
+}
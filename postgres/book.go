@@ -0,0 +1,521 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	epublib "epublib"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+type Book struct {
+	ID              string         `json:"id"`
+	Title           string         `json:"title"`
+	Subtitle        string         `json:"subtitle"`
+	Language        string         `json:"language"`
+	Description     string         `json:"description"`
+	ISBNs           []string       `json:"isbns"`
+	PublicationDate sql.NullTime   `json:"publication_date"`
+	Publisher       string         `json:"publisher"`
+	PageCount       int            `json:"page_count"`
+	Status          string         `json:"status"`
+	PublisherID     sql.NullString `json:"publisher_id"`
+	Creators        []byte         `json:"creators"`
+	Contributors    []byte         `json:"contributors"`
+	SeriesID        sql.NullString `json:"series_id"`
+	SeriesName      sql.NullString `json:"series_name"`
+	SeriesPosition  float64        `json:"series_position"`
+	Categories      []byte         `json:"categories"`
+	Identifiers     []byte         `json:"identifiers"`
+	Subjects        []string       `json:"subjects"`
+	Rights          string         `json:"rights"`
+	AllowScripts    bool           `json:"allow_scripts"`
+	FileKey         string         `json:"file_key"`
+	FileSize        int64          `json:"file_size"`
+	RevisionID      sql.NullString `json:"revision_id"`
+	CoverKey        string         `json:"cover_key"`
+	Version         int            `json:"version"`
+	CreatedAt       sql.NullTime   `json:"created_at"`
+	UpdatedAt       sql.NullTime   `json:"updated_at"`
+	DeletedAt       sql.NullTime   `json:"deleted_at"`
+}
+
+func (b *Book) toEpublibBook() (*epublib.Book, error) {
+	book := &epublib.Book{
+		ID:              b.ID,
+		Title:           b.Title,
+		Subtitle:        b.Subtitle,
+		Language:        b.Language,
+		Description:     b.Description,
+		ISBNs:           nonNilStrings(b.ISBNs),
+		PublicationDate: b.PublicationDate.Time,
+		Publisher:       b.Publisher,
+		PageCount:       b.PageCount,
+		Status:          epublib.BookStatus(b.Status),
+		PublisherID:     b.PublisherID.String,
+		SeriesID:        b.SeriesID.String,
+		SeriesName:      b.SeriesName.String,
+		SeriesPosition:  b.SeriesPosition,
+		Subjects:        nonNilStrings(b.Subjects),
+		Rights:          b.Rights,
+		AllowScripts:    b.AllowScripts,
+		FileKey:         b.FileKey,
+		FileSize:        b.FileSize,
+		RevisionID:      b.RevisionID.String,
+		CoverKey:        b.CoverKey,
+		HasCover:        b.CoverKey != "",
+		Version:         b.Version,
+		CreatedAt:       b.CreatedAt.Time,
+		UpdatedAt:       b.UpdatedAt.Time,
+		DeletedAt:       b.DeletedAt.Time,
+	}
+	if err := json.Unmarshal(b.Creators, &book.Creators); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b.Identifiers, &book.Identifiers); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b.Contributors, &book.Contributors); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b.Categories, &book.Categories); err != nil {
+		return nil, err
+	}
+	return book, nil
+}
+
+// nonNilStrings returns values, or an empty slice if it is nil, so arrays
+// are never encoded as null.
+func nonNilStrings(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
+
+// bookColumns lists the book columns in the order expected by scanBook.
+const bookColumns = `id, title, subtitle, language, description, isbns, publication_date, publisher, page_count, status, publisher_id,
+	creators, ` + bookContributorsColumn + `, series_id, ` + bookSeriesNameColumn + `, series_position,
+	` + bookCategoriesColumn + `, identifiers, subjects, rights, allow_scripts, file_key, file_size, revision_id, cover_key, version, created_at,
+	updated_at, deleted_at`
+
+// bookContributorsColumn selects the authors linked to a book as a JSON
+// array of epublib.BookContributor.
+const bookContributorsColumn = `(SELECT coalesce(jsonb_agg(jsonb_build_object('author_id', a.id, 'name', a.name, 'sort_name', a.sort_name, 'role', c.role)
+	ORDER BY c.position), '[]') FROM book_contributor c JOIN author a ON a.id = c.author_id WHERE c.book_id = book.id AND a.deleted_at IS NULL)`
+
+// bookSeriesNameColumn selects the name of the series of a book.
+const bookSeriesNameColumn = `(SELECT s.name FROM series s WHERE s.id = book.series_id AND s.deleted_at IS NULL)`
+
+// bookCategoriesColumn selects the categories of a book as a JSON array of
+// epublib.BookCategory.
+const bookCategoriesColumn = `(SELECT coalesce(jsonb_agg(jsonb_build_object('id', cat.id, 'name', cat.name) ORDER BY lower(cat.name)), '[]')
+	FROM book_category bc JOIN category cat ON cat.id = bc.category_id WHERE bc.book_id = book.id AND cat.deleted_at IS NULL)`
+
+// scanBook scans a single row selected with bookColumns.
+func scanBook(row pgx.Row) (*epublib.Book, error) {
+	book := &Book{}
+	err := row.Scan(
+		&book.ID,
+		&book.Title,
+		&book.Subtitle,
+		&book.Language,
+		&book.Description,
+		&book.ISBNs,
+		&book.PublicationDate,
+		&book.Publisher,
+		&book.PageCount,
+		&book.Status,
+		&book.PublisherID,
+		&book.Creators,
+		&book.Contributors,
+		&book.SeriesID,
+		&book.SeriesName,
+		&book.SeriesPosition,
+		&book.Categories,
+		&book.Identifiers,
+		&book.Subjects,
+		&book.Rights,
+		&book.AllowScripts,
+		&book.FileKey,
+		&book.FileSize,
+		&book.RevisionID,
+		&book.CoverKey,
+		&book.Version,
+		&book.CreatedAt,
+		&book.UpdatedAt,
+		&book.DeletedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return book.toEpublibBook()
+}
+
+// marshalBookJSON encodes the jsonb columns of a book.
+func marshalBookJSON(creators []epublib.BookCreator, identifiers []epublib.BookIdentifier) ([]byte, []byte, error) {
+	if creators == nil {
+		creators = []epublib.BookCreator{}
+	}
+	if identifiers == nil {
+		identifiers = []epublib.BookIdentifier{}
+	}
+	creatorsJSON, err := json.Marshal(creators)
+	if err != nil {
+		return nil, nil, err
+	}
+	identifiersJSON, err := json.Marshal(identifiers)
+	if err != nil {
+		return nil, nil, err
+	}
+	return creatorsJSON, identifiersJSON, nil
+}
+
+// nullString maps the empty string to NULL for nullable columns like
+// foreign keys.
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// nullDate maps the zero time to NULL for nullable date columns.
+func nullDate(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
+
+// BookService represents a service for managing books.
+type BookService struct {
+	db epublib.Conn
+}
+
+// NewBookService returns a new instance of BookService attached to DB.
+func NewBookService(db *pgxpool.Pool) *BookService {
+	return &BookService{db: db}
+}
+
+func (svc *BookService) FindBookByID(ctx context.Context, id string) (*epublib.Book, error) {
+	db := svc.db
+	if tx := epublib.TxFromContext(ctx); tx != nil {
+		db = tx
+	}
+	book, err := scanBook(db.QueryRow(ctx, "SELECT "+bookColumns+" FROM book WHERE id = $1 AND deleted_at IS NULL", id))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, epublib.ErrNotFound
+		}
+		log.Println(err)
+		return nil, err
+	}
+	return book, nil
+}
+
+func (svc *BookService) FindBooks(ctx context.Context, filter epublib.BookFilter) ([]*epublib.Book, int, error) {
+	db := svc.db
+	if tx := epublib.TxFromContext(ctx); tx != nil {
+		db = tx
+	}
+	if filter.Limit <= 0 {
+		filter.Limit = 10
+	}
+	if filter.Limit > epublib.MaxBookPageSize {
+		filter.Limit = epublib.MaxBookPageSize
+	}
+
+	// Build the SQL query based on the filter criteria.
+	filterQuery := " WHERE deleted_at IS NULL"
+	args := []interface{}{}
+	if filter.Title != "" {
+		args = append(args, "%"+escapeLike(filter.Title)+"%")
+		filterQuery += fmt.Sprintf(" AND (title ILIKE $%d OR subtitle ILIKE $%d)", len(args), len(args))
+	}
+	if filter.Language != "" {
+		args = append(args, filter.Language)
+		filterQuery += fmt.Sprintf(" AND lower(language) = lower($%d)", len(args))
+	}
+	if filter.Publisher != "" {
+		args = append(args, "%"+escapeLike(filter.Publisher)+"%")
+		filterQuery += fmt.Sprintf(" AND publisher ILIKE $%d", len(args))
+	}
+	if filter.ISBN != "" {
+		args = append(args, []string{filter.ISBN, epublib.ISBN10(filter.ISBN)})
+		filterQuery += fmt.Sprintf(" AND isbns && $%d::text[]", len(args))
+	}
+	if len(filter.Statuses) > 0 {
+		statuses := make([]string, len(filter.Statuses))
+		for i, status := range filter.Statuses {
+			statuses[i] = string(status)
+		}
+		args = append(args, statuses)
+		filterQuery += fmt.Sprintf(" AND status::text = ANY($%d)", len(args))
+	}
+	if filter.AuthorID != "" {
+		args = append(args, filter.AuthorID, string(filter.Role))
+		filterQuery += fmt.Sprintf(" AND EXISTS (SELECT 1 FROM book_contributor c WHERE c.book_id = book.id AND c.author_id = $%d AND ($%d = '' OR c.role = $%d))", len(args)-1, len(args), len(args))
+	}
+	if filter.PublisherID != "" {
+		args = append(args, filter.PublisherID)
+		filterQuery += fmt.Sprintf(" AND publisher_id = $%d", len(args))
+	}
+	if filter.SeriesID != "" {
+		args = append(args, filter.SeriesID)
+		filterQuery += fmt.Sprintf(" AND series_id = $%d", len(args))
+	}
+	if filter.CategoryID != "" {
+		args = append(args, filter.CategoryID)
+		filterQuery += fmt.Sprintf(" AND EXISTS (SELECT 1 FROM book_category bc WHERE bc.book_id = book.id AND bc.category_id IN (%s))", categorySubtree(fmt.Sprintf("$%d", len(args))))
+	}
+	if filter.Unlinked {
+		filterQuery += " AND NOT entities_linked"
+	}
+
+	// Count the total number of matching books.
+	var totalCount int
+	err := db.QueryRow(ctx, "SELECT COUNT(*) FROM book"+filterQuery, args...).Scan(&totalCount)
+	if err != nil {
+		log.Println(err)
+		return nil, 0, err
+	}
+
+	order := "lower(title), id"
+	if filter.SeriesID != "" {
+		order = "series_position, " + order
+	}
+	query := "SELECT " + bookColumns + " FROM book" + filterQuery + fmt.Sprintf(" ORDER BY %s OFFSET %d LIMIT %d", order, filter.Offset, filter.Limit)
+	rows, err := db.Query(ctx, query, args...)
+	if err != nil {
+		log.Println(err)
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var books []*epublib.Book
+	for rows.Next() {
+		book, err := scanBook(rows)
+		if err != nil {
+			log.Println(err)
+			return nil, 0, err
+		}
+		books = append(books, book)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println(err)
+		return nil, 0, err
+	}
+	return books, totalCount, nil
+}
+
+func (svc *BookService) CreateBook(ctx context.Context, book *epublib.Book) error {
+	db := svc.db
+	if tx := epublib.TxFromContext(ctx); tx != nil {
+		db = tx
+	}
+	book.ISBNs = nonNilStrings(book.ISBNs)
+	book.Subjects = nonNilStrings(book.Subjects)
+	creators, identifiers, err := marshalBookJSON(book.Creators, book.Identifiers)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	err = db.QueryRow(
+		ctx,
+		`INSERT INTO book (title, subtitle, language, description, isbns, publication_date, publisher, page_count, status,
+		creators, identifiers, subjects, rights, allow_scripts, file_key, file_size, cover_key, series_id, series_position)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19) RETURNING id, version, created_at, updated_at`,
+		book.Title,
+		book.Subtitle,
+		book.Language,
+		book.Description,
+		book.ISBNs,
+		nullDate(book.PublicationDate),
+		book.Publisher,
+		book.PageCount,
+		book.Status,
+		creators,
+		identifiers,
+		book.Subjects,
+		book.Rights,
+		book.AllowScripts,
+		book.FileKey,
+		book.FileSize,
+		book.CoverKey,
+		nullString(book.SeriesID),
+		book.SeriesPosition,
+	).Scan(&book.ID, &book.Version, &book.CreatedAt, &book.UpdatedAt)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	return nil
+}
+
+func (svc *BookService) UpdateBook(ctx context.Context, id string, upd epublib.BookUpdate) (*epublib.Book, error) {
+	db := svc.db
+	if tx := epublib.TxFromContext(ctx); tx != nil {
+		db = tx
+	}
+	creators, identifiers, err := marshalBookJSON(upd.Creators, upd.Identifiers)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	tag, err := db.Exec(
+		ctx,
+		`UPDATE book SET title = $1, subtitle = $2, language = $3, description = $4, isbns = $5, publication_date = $6, publisher = $7,
+		page_count = $8, status = $9, creators = $10, identifiers = $11, subjects = $12, rights = $13, allow_scripts = $14,
+		series_id = $15, series_position = $16, version = version + 1, updated_at = current_timestamp
+		WHERE id = $17 AND deleted_at IS NULL AND ($18 = 0 OR version = $18)`,
+		upd.Title,
+		upd.Subtitle,
+		upd.Language,
+		upd.Description,
+		nonNilStrings(upd.ISBNs),
+		nullDate(upd.PublicationDate),
+		upd.Publisher,
+		upd.PageCount,
+		upd.Status,
+		creators,
+		identifiers,
+		nonNilStrings(upd.Subjects),
+		upd.Rights,
+		upd.AllowScripts,
+		nullString(upd.SeriesID),
+		upd.SeriesPosition,
+		id,
+		upd.Version,
+	)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	if tag.RowsAffected() == 0 {
+		return nil, svc.missingOrConflict(ctx, id)
+	}
+
+	// Retrieve the updated book for response.
+	return svc.FindBookByID(ctx, id)
+}
+
+func (svc *BookService) SetBookCover(ctx context.Context, id, coverKey string) (*epublib.Book, error) {
+	db := svc.db
+	if tx := epublib.TxFromContext(ctx); tx != nil {
+		db = tx
+	}
+	tag, err := db.Exec(
+		ctx,
+		"UPDATE book SET cover_key = $1, version = version + 1, updated_at = current_timestamp WHERE id = $2 AND deleted_at IS NULL",
+		coverKey,
+		id,
+	)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	if tag.RowsAffected() == 0 {
+		return nil, epublib.ErrNotFound
+	}
+	return svc.FindBookByID(ctx, id)
+}
+
+func (svc *BookService) DeleteBook(ctx context.Context, id string, version int) error {
+	db := svc.db
+	if tx := epublib.TxFromContext(ctx); tx != nil {
+		db = tx
+	}
+	tag, err := db.Exec(
+		ctx,
+		"UPDATE book SET deleted_at = current_timestamp, version = version + 1, updated_at = current_timestamp WHERE id = $1 AND deleted_at IS NULL AND ($2 = 0 OR version = $2)",
+		id,
+		version,
+	)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return svc.missingOrConflict(ctx, id)
+	}
+	return nil
+}
+
+// missingOrConflict tells apart why a versioned write touched no rows: the
+// book either does not exist or has been modified since it was read.
+func (svc *BookService) missingOrConflict(ctx context.Context, id string) error {
+	if _, err := svc.FindBookByID(ctx, id); err != nil {
+		return err
+	}
+	return epublib.ErrConflict
+}
+
+func (svc *BookService) FindValidationReport(ctx context.Context, bookID string) (*epublib.ValidationReport, error) {
+	db := svc.db
+	if tx := epublib.TxFromContext(ctx); tx != nil {
+		db = tx
+	}
+	report := &epublib.ValidationReport{}
+	var messages []byte
+	err := db.QueryRow(
+		ctx,
+		"SELECT book_id, valid, error_count, warning_count, messages, created_at FROM book_validation WHERE book_id = $1",
+		bookID,
+	).Scan(&report.BookID, &report.Valid, &report.ErrorCount, &report.WarningCount, &messages, &report.CreatedAt)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, epublib.ErrNotFound
+		}
+		log.Println(err)
+		return nil, err
+	}
+	if err := json.Unmarshal(messages, &report.Messages); err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	return report, nil
+}
+
+func (svc *BookService) SaveValidationReport(ctx context.Context, report *epublib.ValidationReport) error {
+	db := svc.db
+	if tx := epublib.TxFromContext(ctx); tx != nil {
+		db = tx
+	}
+	if report.Messages == nil {
+		report.Messages = []epublib.ValidationMessage{}
+	}
+	messages, err := json.Marshal(report.Messages)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	err = db.QueryRow(
+		ctx,
+		`INSERT INTO book_validation (book_id, valid, error_count, warning_count, messages) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (book_id) DO UPDATE SET valid = EXCLUDED.valid, error_count = EXCLUDED.error_count,
+		warning_count = EXCLUDED.warning_count, messages = EXCLUDED.messages, created_at = current_timestamp
+		RETURNING created_at`,
+		report.BookID,
+		report.Valid,
+		report.ErrorCount,
+		report.WarningCount,
+		messages,
+	).Scan(&report.CreatedAt)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	// Keep the report with the revision of the file it is about
+	data, err := json.Marshal(report)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	_, err = db.Exec(ctx, "UPDATE book_revision SET validation = $1 WHERE id = (SELECT revision_id FROM book WHERE id = $2)", data, report.BookID)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,281 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	epublib "epublib"
+	"fmt"
+	"log"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+type BookRevision struct {
+	ID         string         `json:"id"`
+	BookID     string         `json:"book_id"`
+	Number     int            `json:"number"`
+	Active     bool           `json:"active"`
+	FileKey    string         `json:"file_key"`
+	FileSize   int64          `json:"file_size"`
+	Checksum   string         `json:"checksum"`
+	UploaderID sql.NullString `json:"uploader_id"`
+	Note       string         `json:"note"`
+	Snapshot   []byte         `json:"snapshot"`
+	Validation []byte         `json:"validation"`
+	CreatedAt  sql.NullTime   `json:"created_at"`
+}
+
+func (r *BookRevision) toEpublibBookRevision() (*epublib.BookRevision, error) {
+	revision := &epublib.BookRevision{
+		ID:         r.ID,
+		BookID:     r.BookID,
+		Number:     r.Number,
+		Active:     r.Active,
+		FileKey:    r.FileKey,
+		FileSize:   r.FileSize,
+		Checksum:   r.Checksum,
+		UploaderID: r.UploaderID.String,
+		Note:       r.Note,
+		CreatedAt:  r.CreatedAt.Time,
+	}
+	if r.Snapshot != nil {
+		if err := json.Unmarshal(r.Snapshot, &revision.Snapshot); err != nil {
+			return nil, err
+		}
+	}
+	if r.Validation != nil {
+		if err := json.Unmarshal(r.Validation, &revision.Validation); err != nil {
+			return nil, err
+		}
+	}
+	return revision, nil
+}
+
+// bookRevisionColumns lists the book_revision columns in the order expected
+// by scanBookRevision.
+const bookRevisionColumns = `id, book_id, number, EXISTS (SELECT 1 FROM book WHERE book.revision_id = book_revision.id), file_key, file_size,
+	checksum, uploader_id, note, snapshot, validation, created_at`
+
+// scanBookRevision scans a single row selected with bookRevisionColumns.
+func scanBookRevision(row pgx.Row) (*epublib.BookRevision, error) {
+	r := &BookRevision{}
+	err := row.Scan(&r.ID, &r.BookID, &r.Number, &r.Active, &r.FileKey, &r.FileSize, &r.Checksum, &r.UploaderID, &r.Note, &r.Snapshot, &r.Validation, &r.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return r.toEpublibBookRevision()
+}
+
+// BookRevisionService represents a service for managing book revisions.
+type BookRevisionService struct {
+	db epublib.Conn
+}
+
+// NewBookRevisionService returns a new instance of BookRevisionService
+// attached to DB.
+func NewBookRevisionService(db *pgxpool.Pool) *BookRevisionService {
+	return &BookRevisionService{db: db}
+}
+
+func (svc *BookRevisionService) FindBookRevision(ctx context.Context, bookID string, number int) (*epublib.BookRevision, error) {
+	db := svc.db
+	if tx := epublib.TxFromContext(ctx); tx != nil {
+		db = tx
+	}
+	revision, err := scanBookRevision(db.QueryRow(
+		ctx,
+		`SELECT `+bookRevisionColumns+` FROM book_revision WHERE book_id = $1 AND number = $2
+		AND EXISTS (SELECT 1 FROM book WHERE book.id = book_revision.book_id AND book.deleted_at IS NULL)`,
+		bookID,
+		number,
+	))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, epublib.ErrNotFound
+		}
+		log.Println(err)
+		return nil, err
+	}
+	return revision, nil
+}
+
+func (svc *BookRevisionService) FindBookRevisions(ctx context.Context, filter epublib.BookRevisionFilter) ([]*epublib.BookRevision, int, error) {
+	db := svc.db
+	if tx := epublib.TxFromContext(ctx); tx != nil {
+		db = tx
+	}
+	if filter.Limit <= 0 {
+		filter.Limit = 10
+	}
+	if filter.Limit > epublib.MaxBookRevisionPageSize {
+		filter.Limit = epublib.MaxBookRevisionPageSize
+	}
+
+	// Build the SQL query based on the filter criteria.
+	filterQuery := " WHERE EXISTS (SELECT 1 FROM book WHERE book.id = book_revision.book_id AND book.deleted_at IS NULL)"
+	args := []interface{}{}
+	if filter.BookID != "" {
+		args = append(args, filter.BookID)
+		filterQuery += fmt.Sprintf(" AND book_id = $%d", len(args))
+	}
+	if filter.Active {
+		filterQuery += " AND EXISTS (SELECT 1 FROM book WHERE book.revision_id = book_revision.id)"
+	}
+	if filter.Uncomputed {
+		filterQuery += " AND snapshot IS NULL"
+	}
+
+	// Count the total number of matching revisions.
+	var totalCount int
+	err := db.QueryRow(ctx, "SELECT COUNT(*) FROM book_revision"+filterQuery, args...).Scan(&totalCount)
+	if err != nil {
+		log.Println(err)
+		return nil, 0, err
+	}
+
+	query := "SELECT " + bookRevisionColumns + " FROM book_revision" + filterQuery + fmt.Sprintf(" ORDER BY number DESC, created_at DESC, id OFFSET %d LIMIT %d", filter.Offset, filter.Limit)
+	rows, err := db.Query(ctx, query, args...)
+	if err != nil {
+		log.Println(err)
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	revisions := []*epublib.BookRevision{}
+	for rows.Next() {
+		revision, err := scanBookRevision(rows)
+		if err != nil {
+			log.Println(err)
+			return nil, 0, err
+		}
+		revisions = append(revisions, revision)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println(err)
+		return nil, 0, err
+	}
+	return revisions, totalCount, nil
+}
+
+func (svc *BookRevisionService) CreateBookRevision(ctx context.Context, revision *epublib.BookRevision) error {
+	db := svc.db
+	if tx := epublib.TxFromContext(ctx); tx != nil {
+		db = tx
+	}
+
+	// Lock the book so concurrent revisions get distinct numbers
+	var bookID string
+	err := db.QueryRow(ctx, "SELECT id FROM book WHERE id = $1 AND deleted_at IS NULL FOR UPDATE", revision.BookID).Scan(&bookID)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return epublib.ErrNotFound
+		}
+		log.Println(err)
+		return err
+	}
+	var snapshot []byte
+	if revision.Snapshot != nil {
+		if snapshot, err = json.Marshal(revision.Snapshot); err != nil {
+			log.Println(err)
+			return err
+		}
+	}
+	err = db.QueryRow(
+		ctx,
+		`INSERT INTO book_revision (book_id, number, file_key, file_size, checksum, uploader_id, note, snapshot)
+		VALUES ($1, (SELECT coalesce(max(number), 0) + 1 FROM book_revision WHERE book_id = $1), $2, $3, $4, NULLIF($5, '')::uuid, $6, $7)
+		RETURNING id, number, created_at`,
+		revision.BookID,
+		revision.FileKey,
+		revision.FileSize,
+		revision.Checksum,
+		revision.UploaderID,
+		revision.Note,
+		snapshot,
+	).Scan(&revision.ID, &revision.Number, &revision.CreatedAt)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	_, err = db.Exec(
+		ctx,
+		"UPDATE book SET file_key = $1, file_size = $2, revision_id = $3, version = version + 1, updated_at = current_timestamp WHERE id = $4",
+		revision.FileKey,
+		revision.FileSize,
+		revision.ID,
+		revision.BookID,
+	)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	revision.Active = true
+	return nil
+}
+
+func (svc *BookRevisionService) ActivateBookRevision(ctx context.Context, bookID string, number int, version int) (*epublib.Book, error) {
+	db := svc.db
+	if tx := epublib.TxFromContext(ctx); tx != nil {
+		db = tx
+	}
+	revision, err := svc.FindBookRevision(ctx, bookID, number)
+	if err != nil {
+		return nil, err
+	}
+	tag, err := db.Exec(
+		ctx,
+		`UPDATE book SET file_key = $1, file_size = $2, revision_id = $3, version = version + 1, updated_at = current_timestamp
+		WHERE id = $4 AND deleted_at IS NULL AND ($5 = 0 OR version = $5)`,
+		revision.FileKey,
+		revision.FileSize,
+		revision.ID,
+		bookID,
+		version,
+	)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	books := &BookService{db: svc.db}
+	if tag.RowsAffected() == 0 {
+		if _, err := books.FindBookByID(ctx, bookID); err != nil {
+			return nil, err
+		}
+		return nil, epublib.ErrConflict
+	}
+
+	// The book reports on the file it reads
+	if revision.Validation != nil {
+		revision.Validation.BookID = bookID
+		if err := books.SaveValidationReport(ctx, revision.Validation); err != nil {
+			return nil, err
+		}
+	} else if _, err := db.Exec(ctx, "DELETE FROM book_validation WHERE book_id = $1", bookID); err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	return books.FindBookByID(ctx, bookID)
+}
+
+func (svc *BookRevisionService) SetBookRevisionContent(ctx context.Context, id, checksum string, snapshot *epublib.RevisionSnapshot) error {
+	db := svc.db
+	if tx := epublib.TxFromContext(ctx); tx != nil {
+		db = tx
+	}
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	tag, err := db.Exec(ctx, "UPDATE book_revision SET checksum = $1, snapshot = $2 WHERE id = $3", checksum, data, id)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return epublib.ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,357 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	epublib "epublib"
+	"log"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+type Category struct {
+	ID          string         `json:"id"`
+	ParentID    sql.NullString `json:"parent_id"`
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	Codes       []byte         `json:"codes"`
+	Version     int            `json:"version"`
+	CreatedAt   sql.NullTime   `json:"created_at"`
+	UpdatedAt   sql.NullTime   `json:"updated_at"`
+	DeletedAt   sql.NullTime   `json:"deleted_at"`
+}
+
+func (c *Category) toEpublibCategory() (*epublib.Category, error) {
+	category := &epublib.Category{
+		ID:          c.ID,
+		ParentID:    c.ParentID.String,
+		Name:        c.Name,
+		Description: c.Description,
+		Version:     c.Version,
+		CreatedAt:   c.CreatedAt.Time,
+		UpdatedAt:   c.UpdatedAt.Time,
+		DeletedAt:   c.DeletedAt.Time,
+	}
+	if err := json.Unmarshal(c.Codes, &category.Codes); err != nil {
+		return nil, err
+	}
+	return category, nil
+}
+
+// categoryColumns lists the category columns in the order expected by
+// scanCategory.
+const categoryColumns = "id, parent_id, name, description, codes, version, created_at, updated_at, deleted_at"
+
+// scanCategory scans a single row selected with categoryColumns.
+func scanCategory(row pgx.Row) (*epublib.Category, error) {
+	c := &Category{}
+	err := row.Scan(&c.ID, &c.ParentID, &c.Name, &c.Description, &c.Codes, &c.Version, &c.CreatedAt, &c.UpdatedAt, &c.DeletedAt)
+	if err != nil {
+		return nil, err
+	}
+	return c.toEpublibCategory()
+}
+
+// categorySubtree returns a query selecting the IDs of the category passed
+// as param and of all its non-deleted subcategories. UNION stops at cycles.
+func categorySubtree(param string) string {
+	return `WITH RECURSIVE subtree AS (
+		SELECT id FROM category WHERE id = ` + param + ` AND deleted_at IS NULL
+		UNION
+		SELECT category.id FROM category JOIN subtree ON category.parent_id = subtree.id WHERE category.deleted_at IS NULL
+	) SELECT id FROM subtree`
+}
+
+// marshalCategoryCodes encodes the codes column of a category.
+func marshalCategoryCodes(codes []epublib.CategoryCode) ([]byte, error) {
+	if codes == nil {
+		codes = []epublib.CategoryCode{}
+	}
+	return json.Marshal(codes)
+}
+
+// CategoryService represents a service for managing categories.
+type CategoryService struct {
+	db epublib.Conn
+}
+
+// NewCategoryService returns a new instance of CategoryService attached to DB.
+func NewCategoryService(db *pgxpool.Pool) *CategoryService {
+	return &CategoryService{db: db}
+}
+
+func (svc *CategoryService) FindCategoryByID(ctx context.Context, id string) (*epublib.Category, error) {
+	db := svc.db
+	if tx := epublib.TxFromContext(ctx); tx != nil {
+		db = tx
+	}
+	category, err := scanCategory(db.QueryRow(ctx, "SELECT "+categoryColumns+" FROM category WHERE id = $1 AND deleted_at IS NULL", id))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, epublib.ErrNotFound
+		}
+		log.Println(err)
+		return nil, err
+	}
+	return category, nil
+}
+
+func (svc *CategoryService) FindCategories(ctx context.Context, statuses []epublib.BookStatus) ([]*epublib.Category, error) {
+	db := svc.db
+	if tx := epublib.TxFromContext(ctx); tx != nil {
+		db = tx
+	}
+	rows, err := db.Query(ctx, "SELECT "+categoryColumns+" FROM category WHERE deleted_at IS NULL ORDER BY lower(name), id")
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	categories := []*epublib.Category{}
+	byID := map[string]*epublib.Category{}
+	for rows.Next() {
+		category, err := scanCategory(rows)
+		if err != nil {
+			log.Println(err)
+			return nil, err
+		}
+		categories = append(categories, category)
+		byID[category.ID] = category
+	}
+	if err := rows.Err(); err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	// Count the books of each subtree, once even if they are classified in
+	// several of its categories
+	names := make([]string, len(statuses))
+	for i, status := range statuses {
+		names[i] = string(status)
+	}
+	rows, err = db.Query(
+		ctx,
+		`WITH RECURSIVE tree AS (
+			SELECT id AS root_id, id FROM category WHERE deleted_at IS NULL
+			UNION
+			SELECT tree.root_id, category.id FROM category JOIN tree ON category.parent_id = tree.id WHERE category.deleted_at IS NULL
+		)
+		SELECT tree.root_id, COUNT(DISTINCT book.id) FROM tree
+		JOIN book_category bc ON bc.category_id = tree.id
+		JOIN book ON book.id = bc.book_id AND book.deleted_at IS NULL AND (cardinality($1::text[]) = 0 OR book.status::text = ANY($1))
+		GROUP BY tree.root_id`,
+		names,
+	)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id string
+		var count int
+		if err := rows.Scan(&id, &count); err != nil {
+			log.Println(err)
+			return nil, err
+		}
+		if category := byID[id]; category != nil {
+			category.BookCount = count
+		}
+	}
+	if err := rows.Err(); err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	return categories, nil
+}
+
+// nameTaken reports whether a category other than the one with the given ID
+// has the given parent and a name with the same key.
+func (svc *CategoryService) nameTaken(ctx context.Context, db epublib.Conn, parentID, name, id string) (bool, error) {
+	var taken bool
+	err := db.QueryRow(
+		ctx,
+		`SELECT EXISTS (SELECT 1 FROM category WHERE parent_id IS NOT DISTINCT FROM NULLIF($1, '')::uuid AND name_key = $2
+		AND id::text <> $3 AND deleted_at IS NULL)`,
+		parentID,
+		epublib.CategoryNameKey(name),
+		id,
+	).Scan(&taken)
+	if err != nil {
+		log.Println(err)
+	}
+	return taken, err
+}
+
+func (svc *CategoryService) CreateCategory(ctx context.Context, category *epublib.Category) error {
+	db := svc.db
+	if tx := epublib.TxFromContext(ctx); tx != nil {
+		db = tx
+	}
+	if category.ParentID != "" {
+		if _, err := svc.FindCategoryByID(ctx, category.ParentID); err != nil {
+			return err
+		}
+	}
+	taken, err := svc.nameTaken(ctx, db, category.ParentID, category.Name, "")
+	if err != nil {
+		return err
+	}
+	if taken {
+		return epublib.ErrCategoryNameTaken
+	}
+	codes, err := marshalCategoryCodes(category.Codes)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	err = db.QueryRow(
+		ctx,
+		`INSERT INTO category (parent_id, name, name_key, description, codes) VALUES (NULLIF($1, '')::uuid, $2, $3, $4, $5)
+		RETURNING id, version, created_at, updated_at`,
+		category.ParentID,
+		category.Name,
+		epublib.CategoryNameKey(category.Name),
+		category.Description,
+		codes,
+	).Scan(&category.ID, &category.Version, &category.CreatedAt, &category.UpdatedAt)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	return nil
+}
+
+func (svc *CategoryService) UpdateCategory(ctx context.Context, id string, upd epublib.CategoryUpdate) (*epublib.Category, error) {
+	db := svc.db
+	if tx := epublib.TxFromContext(ctx); tx != nil {
+		db = tx
+	}
+	if upd.ParentID != "" {
+		if _, err := svc.FindCategoryByID(ctx, upd.ParentID); err != nil {
+			return nil, err
+		}
+		var cycle bool
+		err := db.QueryRow(ctx, "SELECT $2::uuid IN ("+categorySubtree("$1")+")", id, upd.ParentID).Scan(&cycle)
+		if err != nil {
+			log.Println(err)
+			return nil, err
+		}
+		if cycle {
+			return nil, epublib.ErrCategoryCycle
+		}
+	}
+	taken, err := svc.nameTaken(ctx, db, upd.ParentID, upd.Name, id)
+	if err != nil {
+		return nil, err
+	}
+	if taken {
+		return nil, epublib.ErrCategoryNameTaken
+	}
+	codes, err := marshalCategoryCodes(upd.Codes)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	tag, err := db.Exec(
+		ctx,
+		`UPDATE category SET parent_id = NULLIF($1, '')::uuid, name = $2, name_key = $3, description = $4, codes = $5,
+		version = version + 1, updated_at = current_timestamp
+		WHERE id = $6 AND deleted_at IS NULL AND ($7 = 0 OR version = $7)`,
+		upd.ParentID,
+		upd.Name,
+		epublib.CategoryNameKey(upd.Name),
+		upd.Description,
+		codes,
+		id,
+		upd.Version,
+	)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	if tag.RowsAffected() == 0 {
+		return nil, svc.missingOrConflict(ctx, id)
+	}
+
+	// Retrieve the updated category for response.
+	return svc.FindCategoryByID(ctx, id)
+}
+
+func (svc *CategoryService) DeleteCategory(ctx context.Context, id string, version int) error {
+	db := svc.db
+	if tx := epublib.TxFromContext(ctx); tx != nil {
+		db = tx
+	}
+	var hasSubcategories bool
+	err := db.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM category WHERE parent_id = $1 AND deleted_at IS NULL)", id).Scan(&hasSubcategories)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	if hasSubcategories {
+		return epublib.ErrCategoryHasSubcategories
+	}
+	tag, err := db.Exec(
+		ctx,
+		"UPDATE category SET deleted_at = current_timestamp, version = version + 1, updated_at = current_timestamp WHERE id = $1 AND deleted_at IS NULL AND ($2 = 0 OR version = $2)",
+		id,
+		version,
+	)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return svc.missingOrConflict(ctx, id)
+	}
+	if _, err := db.Exec(ctx, "DELETE FROM book_category WHERE category_id = $1", id); err != nil {
+		log.Println(err)
+		return err
+	}
+	return nil
+}
+
+// missingOrConflict tells apart why a versioned write touched no rows: the
+// category either does not exist or has been modified since it was read.
+func (svc *CategoryService) missingOrConflict(ctx context.Context, id string) error {
+	if _, err := svc.FindCategoryByID(ctx, id); err != nil {
+		return err
+	}
+	return epublib.ErrConflict
+}
+
+func (svc *CategoryService) SetBookCategories(ctx context.Context, bookID string, categoryIDs []string) error {
+	db := svc.db
+	if tx := epublib.TxFromContext(ctx); tx != nil {
+		db = tx
+	}
+	categoryIDs = distinctIDs(categoryIDs, "")
+	var found int
+	err := db.QueryRow(ctx, "SELECT COUNT(*) FROM category WHERE id = ANY($1) AND deleted_at IS NULL", categoryIDs).Scan(&found)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	if found != len(categoryIDs) {
+		return epublib.ErrNotFound
+	}
+	if _, err := db.Exec(ctx, "DELETE FROM book_category WHERE book_id = $1", bookID); err != nil {
+		log.Println(err)
+		return err
+	}
+	_, err = db.Exec(
+		ctx,
+		"INSERT INTO book_category (book_id, category_id) SELECT $1, unnest($2::uuid[])",
+		bookID,
+		categoryIDs,
+	)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	return nil
+}
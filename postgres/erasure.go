@@ -0,0 +1,201 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	epublib "epublib"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+type ErasureRequest struct {
+	ID           string       `json:"id"`
+	UserID       string       `json:"user_id"`
+	RequestedBy  string       `json:"requested_by"`
+	Reason       string       `json:"reason"`
+	ScheduledFor sql.NullTime `json:"scheduled_for"`
+	CancelledAt  sql.NullTime `json:"cancelled_at"`
+	CompletedAt  sql.NullTime `json:"completed_at"`
+	CreatedAt    sql.NullTime `json:"created_at"`
+	UpdatedAt    sql.NullTime `json:"updated_at"`
+}
+
+func (r *ErasureRequest) toEpublibErasureRequest() *epublib.ErasureRequest {
+	return &epublib.ErasureRequest{
+		ID:           r.ID,
+		UserID:       r.UserID,
+		RequestedBy:  r.RequestedBy,
+		Reason:       r.Reason,
+		ScheduledFor: r.ScheduledFor.Time,
+		CancelledAt:  r.CancelledAt.Time,
+		CompletedAt:  r.CompletedAt.Time,
+		CreatedAt:    r.CreatedAt.Time,
+		UpdatedAt:    r.UpdatedAt.Time,
+	}
+}
+
+// erasureRequestColumns lists the erasure_request columns in the order
+// expected by scanErasureRequest.
+const erasureRequestColumns = "id, user_id, COALESCE(requested_by::text, ''), reason, scheduled_for, cancelled_at, completed_at, created_at, updated_at"
+
+func scanErasureRequest(row pgx.Row, r *ErasureRequest) error {
+	return row.Scan(
+		&r.ID,
+		&r.UserID,
+		&r.RequestedBy,
+		&r.Reason,
+		&r.ScheduledFor,
+		&r.CancelledAt,
+		&r.CompletedAt,
+		&r.CreatedAt,
+		&r.UpdatedAt,
+	)
+}
+
+// ErasureService represents a service for managing personal data erasure.
+type ErasureService struct {
+	db epublib.Conn
+}
+
+// NewErasureService returns a new instance of ErasureService attached to DB.
+func NewErasureService(db *pgxpool.Pool) *ErasureService {
+	return &ErasureService{db: db}
+}
+
+func (svc *ErasureService) CreateErasureRequest(ctx context.Context, req *epublib.ErasureRequest) error {
+	db := svc.db
+	if tx := epublib.TxFromContext(ctx); tx != nil {
+		db = tx
+	}
+	err := db.QueryRow(
+		ctx,
+		"INSERT INTO erasure_request (user_id, requested_by, reason, scheduled_for) VALUES ($1, NULLIF($2, '')::uuid, $3, $4) RETURNING id, created_at, updated_at",
+		req.UserID,
+		req.RequestedBy,
+		req.Reason,
+		req.ScheduledFor,
+	).Scan(&req.ID, &req.CreatedAt, &req.UpdatedAt)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	return nil
+}
+
+func (svc *ErasureService) FindErasureRequestsByUserID(ctx context.Context, userID string) ([]*epublib.ErasureRequest, error) {
+	return svc.findErasureRequests(ctx, "WHERE user_id = $1 ORDER BY created_at DESC", userID)
+}
+
+func (svc *ErasureService) FindPendingErasureRequest(ctx context.Context, userID string) (*epublib.ErasureRequest, error) {
+	reqs, err := svc.findErasureRequests(ctx, "WHERE user_id = $1 AND cancelled_at IS NULL AND completed_at IS NULL ORDER BY created_at DESC LIMIT 1", userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(reqs) == 0 {
+		return nil, epublib.ErrNotFound
+	}
+	return reqs[0], nil
+}
+
+func (svc *ErasureService) FindDueErasureRequests(ctx context.Context, t time.Time) ([]*epublib.ErasureRequest, error) {
+	return svc.findErasureRequests(ctx, "WHERE scheduled_for <= $1 AND cancelled_at IS NULL AND completed_at IS NULL ORDER BY scheduled_for", t)
+}
+
+func (svc *ErasureService) findErasureRequests(ctx context.Context, where string, args ...interface{}) ([]*epublib.ErasureRequest, error) {
+	db := svc.db
+	if tx := epublib.TxFromContext(ctx); tx != nil {
+		db = tx
+	}
+	rows, err := db.Query(ctx, "SELECT "+erasureRequestColumns+" FROM erasure_request "+where, args...)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reqs []*epublib.ErasureRequest
+	for rows.Next() {
+		req := &ErasureRequest{}
+		if err := scanErasureRequest(rows, req); err != nil {
+			log.Println(err)
+			return nil, err
+		}
+		reqs = append(reqs, req.toEpublibErasureRequest())
+	}
+	if err := rows.Err(); err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	return reqs, nil
+}
+
+func (svc *ErasureService) CancelErasureRequest(ctx context.Context, id string) error {
+	db := svc.db
+	if tx := epublib.TxFromContext(ctx); tx != nil {
+		db = tx
+	}
+	tag, err := db.Exec(
+		ctx,
+		"UPDATE erasure_request SET cancelled_at = current_timestamp, updated_at = current_timestamp WHERE id = $1 AND cancelled_at IS NULL AND completed_at IS NULL",
+		id,
+	)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return epublib.ErrNotFound
+	}
+	return nil
+}
+
+// Anonymizes the request's user. Should run inside a transaction so a
+// failure never leaves a half erased user behind.
+func (svc *ErasureService) EraseUser(ctx context.Context, requestID string) error {
+	db := svc.db
+	if tx := epublib.TxFromContext(ctx); tx != nil {
+		db = tx
+	}
+	var userID string
+	err := db.QueryRow(
+		ctx,
+		"UPDATE erasure_request SET completed_at = current_timestamp, updated_at = current_timestamp WHERE id = $1 AND cancelled_at IS NULL AND completed_at IS NULL RETURNING user_id",
+		requestID,
+	).Scan(&userID)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return epublib.ErrNotFound
+		}
+		log.Println(err)
+		return err
+	}
+
+	// Rows are anonymized rather than deleted so foreign references remain
+	// valid. Identifiers are derived from the row ID to keep them unique.
+	for _, query := range erasureQueries {
+		if _, err := db.Exec(ctx, query, userID); err != nil {
+			log.Println(err)
+			return err
+		}
+	}
+	return nil
+}
+
+// erasureQueries remove or anonymize every piece of personal data of the
+// user passed as $1.
+var erasureQueries = []string{
+	`UPDATE users SET name = 'Deleted user', address = '', phone_number = '', phone_verified_at = NULL, gender = 'U', birth_date = '1900-01-01',
+		img_profile = '', version = version + 1, updated_at = current_timestamp, deleted_at = COALESCE(deleted_at, current_timestamp)
+		WHERE id = $1`,
+	`UPDATE auth SET username = 'deleted-' || left(replace(id::text, '-', ''), 17), email = 'deleted+' || id::text || '@invalid',
+		password = '', version = version + 1, updated_at = current_timestamp, deleted_at = COALESCE(deleted_at, current_timestamp)
+		WHERE user_id = $1`,
+	`DELETE FROM username_reservation WHERE user_id = $1`,
+	`DELETE FROM reset_token WHERE user_id = $1`,
+	`DELETE FROM user_setting WHERE user_id = $1`,
+	`DELETE FROM phone_verification WHERE user_id = $1`,
+	`DELETE FROM group_member WHERE user_id = $1`,
+}
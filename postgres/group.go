@@ -0,0 +1,445 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	epublib "epublib"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+type Group struct {
+	ID          string         `json:"id"`
+	ParentID    sql.NullString `json:"parent_id"`
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	Kind        string         `json:"kind"`
+	MemberCount int            `json:"member_count"`
+	Version     int            `json:"version"`
+	CreatedAt   sql.NullTime   `json:"created_at"`
+	UpdatedAt   sql.NullTime   `json:"updated_at"`
+	DeletedAt   sql.NullTime   `json:"deleted_at"`
+}
+
+func (g *Group) toEpublibGroup() *epublib.Group {
+	return &epublib.Group{
+		ID:          g.ID,
+		ParentID:    g.ParentID.String,
+		Name:        g.Name,
+		Description: g.Description,
+		Kind:        epublib.GroupKind(g.Kind),
+		MemberCount: g.MemberCount,
+		Version:     g.Version,
+		CreatedAt:   g.CreatedAt.Time,
+		UpdatedAt:   g.UpdatedAt.Time,
+		DeletedAt:   g.DeletedAt.Time,
+	}
+}
+
+// groupColumns lists the user_group columns in the order expected by
+// scanGroup. The member count only includes direct members.
+const groupColumns = `user_group.id, user_group.parent_id, user_group.name, user_group.description, user_group.kind,
+	(SELECT COUNT(*) FROM group_member WHERE group_member.group_id = user_group.id), user_group.version,
+	user_group.created_at, user_group.updated_at, user_group.deleted_at`
+
+func scanGroup(row pgx.Row, g *Group) error {
+	return row.Scan(
+		&g.ID,
+		&g.ParentID,
+		&g.Name,
+		&g.Description,
+		&g.Kind,
+		&g.MemberCount,
+		&g.Version,
+		&g.CreatedAt,
+		&g.UpdatedAt,
+		&g.DeletedAt,
+	)
+}
+
+// groupSubtree returns a query selecting the IDs of the group passed as
+// param and of all its non-deleted subgroups. UNION stops at cycles.
+func groupSubtree(param string) string {
+	return `WITH RECURSIVE subtree AS (
+		SELECT id FROM user_group WHERE id = ` + param + ` AND deleted_at IS NULL
+		UNION
+		SELECT user_group.id FROM user_group JOIN subtree ON user_group.parent_id = subtree.id WHERE user_group.deleted_at IS NULL
+	) SELECT id FROM subtree`
+}
+
+// GroupService represents a service for managing groups.
+type GroupService struct {
+	db epublib.Conn
+}
+
+// NewGroupService returns a new instance of GroupService attached to DB.
+func NewGroupService(db *pgxpool.Pool) *GroupService {
+	return &GroupService{db: db}
+}
+
+func (svc *GroupService) FindGroupByID(ctx context.Context, id string) (*epublib.Group, error) {
+	db := svc.db
+	if tx := epublib.TxFromContext(ctx); tx != nil {
+		db = tx
+	}
+	group := &Group{}
+	err := scanGroup(db.QueryRow(ctx, "SELECT "+groupColumns+" FROM user_group WHERE id = $1 AND deleted_at IS NULL", id), group)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, epublib.ErrNotFound
+		}
+		log.Println(err)
+		return nil, err
+	}
+	return group.toEpublibGroup(), nil
+}
+
+func (svc *GroupService) FindGroups(ctx context.Context, filter epublib.GroupFilter) ([]*epublib.Group, int, error) {
+	db := svc.db
+	if tx := epublib.TxFromContext(ctx); tx != nil {
+		db = tx
+	}
+	if filter.Limit <= 0 {
+		filter.Limit = 10
+	}
+	if filter.Limit > epublib.MaxGroupPageSize {
+		filter.Limit = epublib.MaxGroupPageSize
+	}
+
+	// Build the SQL query based on the filter criteria.
+	filterQuery := " WHERE deleted_at IS NULL"
+	args := []interface{}{}
+	if filter.Name != "" {
+		args = append(args, "%"+escapeLike(filter.Name)+"%")
+		filterQuery += fmt.Sprintf(" AND name ILIKE $%d", len(args))
+	}
+	if filter.Kind != "" {
+		args = append(args, filter.Kind)
+		filterQuery += fmt.Sprintf(" AND kind = $%d", len(args))
+	}
+	if filter.ParentID != "" {
+		args = append(args, filter.ParentID)
+		filterQuery += fmt.Sprintf(" AND parent_id = $%d", len(args))
+	} else if filter.RootOnly {
+		filterQuery += " AND parent_id IS NULL"
+	}
+
+	// Count the total number of matching groups.
+	var totalCount int
+	err := db.QueryRow(ctx, "SELECT COUNT(*) FROM user_group"+filterQuery, args...).Scan(&totalCount)
+	if err != nil {
+		log.Println(err)
+		return nil, 0, err
+	}
+
+	query := "SELECT " + groupColumns + " FROM user_group" + filterQuery + fmt.Sprintf(" ORDER BY name, id OFFSET %d LIMIT %d", filter.Offset, filter.Limit)
+	rows, err := db.Query(ctx, query, args...)
+	if err != nil {
+		log.Println(err)
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var groups []*epublib.Group
+	for rows.Next() {
+		group := &Group{}
+		if err := scanGroup(rows, group); err != nil {
+			log.Println(err)
+			return nil, 0, err
+		}
+		groups = append(groups, group.toEpublibGroup())
+	}
+	if err := rows.Err(); err != nil {
+		log.Println(err)
+		return nil, 0, err
+	}
+	return groups, totalCount, nil
+}
+
+func (svc *GroupService) CreateGroup(ctx context.Context, group *epublib.Group) error {
+	db := svc.db
+	if tx := epublib.TxFromContext(ctx); tx != nil {
+		db = tx
+	}
+	if group.ParentID != "" {
+		if _, err := svc.FindGroupByID(ctx, group.ParentID); err != nil {
+			return err
+		}
+	}
+	err := db.QueryRow(
+		ctx,
+		"INSERT INTO user_group (parent_id, name, description, kind) VALUES (NULLIF($1, '')::uuid, $2, $3, $4) RETURNING id, version, created_at, updated_at",
+		group.ParentID,
+		group.Name,
+		group.Description,
+		group.Kind,
+	).Scan(&group.ID, &group.Version, &group.CreatedAt, &group.UpdatedAt)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	return nil
+}
+
+func (svc *GroupService) UpdateGroup(ctx context.Context, id string, upd epublib.GroupUpdate) (*epublib.Group, error) {
+	db := svc.db
+	if tx := epublib.TxFromContext(ctx); tx != nil {
+		db = tx
+	}
+	if upd.ParentID != "" {
+		if _, err := svc.FindGroupByID(ctx, upd.ParentID); err != nil {
+			return nil, err
+		}
+		var cycle bool
+		err := db.QueryRow(ctx, "SELECT $2::uuid IN ("+groupSubtree("$1")+")", id, upd.ParentID).Scan(&cycle)
+		if err != nil {
+			log.Println(err)
+			return nil, err
+		}
+		if cycle {
+			return nil, epublib.ErrGroupCycle
+		}
+	}
+	tag, err := db.Exec(
+		ctx,
+		`UPDATE user_group SET parent_id = NULLIF($1, '')::uuid, name = $2, description = $3, kind = $4, version = version + 1, updated_at = current_timestamp
+		WHERE id = $5 AND deleted_at IS NULL AND ($6 = 0 OR version = $6)`,
+		upd.ParentID,
+		upd.Name,
+		upd.Description,
+		upd.Kind,
+		id,
+		upd.Version,
+	)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	if tag.RowsAffected() == 0 {
+		return nil, svc.missingOrConflict(ctx, id)
+	}
+
+	// Retrieve the updated group for response.
+	return svc.FindGroupByID(ctx, id)
+}
+
+func (svc *GroupService) DeleteGroup(ctx context.Context, id string, version int) error {
+	db := svc.db
+	if tx := epublib.TxFromContext(ctx); tx != nil {
+		db = tx
+	}
+	var hasSubgroups bool
+	err := db.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM user_group WHERE parent_id = $1 AND deleted_at IS NULL)", id).Scan(&hasSubgroups)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	if hasSubgroups {
+		return epublib.ErrGroupHasSubgroups
+	}
+	tag, err := db.Exec(
+		ctx,
+		"UPDATE user_group SET deleted_at = current_timestamp, version = version + 1, updated_at = current_timestamp WHERE id = $1 AND deleted_at IS NULL AND ($2 = 0 OR version = $2)",
+		id,
+		version,
+	)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return svc.missingOrConflict(ctx, id)
+	}
+	if _, err := db.Exec(ctx, "DELETE FROM group_member WHERE group_id = $1", id); err != nil {
+		log.Println(err)
+		return err
+	}
+	return nil
+}
+
+func (svc *GroupService) FindGroupMembers(ctx context.Context, groupID string, recursive bool) ([]*epublib.GroupMember, error) {
+	db := svc.db
+	if tx := epublib.TxFromContext(ctx); tx != nil {
+		db = tx
+	}
+	groups := "SELECT $1::uuid"
+	if recursive {
+		groups = groupSubtree("$1")
+	}
+
+	// Keep one row per user, preferring the admin role and then the
+	// membership of the group itself over that of a subgroup
+	rows, err := db.Query(
+		ctx,
+		`SELECT * FROM (
+			SELECT DISTINCT ON (m.user_id) m.group_id, m.user_id, m.role, m.created_at, m.updated_at, `+prefixColumns("u", userColumns)+`
+			FROM group_member m JOIN users u ON u.id = m.user_id
+			WHERE m.group_id IN (`+groups+`) AND u.deleted_at IS NULL
+			ORDER BY m.user_id, m.role = 'admin' DESC, m.group_id = $1 DESC
+		) members ORDER BY name, user_id`,
+		groupID,
+	)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var members []*epublib.GroupMember
+	for rows.Next() {
+		member := &epublib.GroupMember{}
+		user := &User{}
+		var role string
+		var createdAt, updatedAt sql.NullTime
+		err := rows.Scan(
+			&member.GroupID, &member.UserID, &role, &createdAt, &updatedAt,
+			&user.ID, &user.Name, &user.Address, &user.PhoneNumber, &user.Gender, &user.BirthDate, &user.ImgProfile,
+			&user.Version, &user.CreatedAt, &user.UpdatedAt, &user.DeletedAt, &user.PhoneVerifiedAt,
+		)
+		if err != nil {
+			log.Println(err)
+			return nil, err
+		}
+		member.Role = epublib.GroupRole(role)
+		member.CreatedAt = createdAt.Time
+		member.UpdatedAt = updatedAt.Time
+		member.User = user.toEpublibUser()
+		members = append(members, member)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	return members, nil
+}
+
+func (svc *GroupService) FindUserGroups(ctx context.Context, userID string) ([]*epublib.GroupMember, error) {
+	db := svc.db
+	if tx := epublib.TxFromContext(ctx); tx != nil {
+		db = tx
+	}
+	rows, err := db.Query(
+		ctx,
+		`SELECT group_member.group_id, group_member.user_id, group_member.role, group_member.created_at, group_member.updated_at, `+groupColumns+`
+		FROM group_member JOIN user_group ON user_group.id = group_member.group_id
+		WHERE group_member.user_id = $1 AND user_group.deleted_at IS NULL
+		ORDER BY user_group.name, user_group.id`,
+		userID,
+	)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var memberships []*epublib.GroupMember
+	for rows.Next() {
+		member := &epublib.GroupMember{}
+		group := &Group{}
+		var role string
+		var createdAt, updatedAt sql.NullTime
+		err := rows.Scan(
+			&member.GroupID, &member.UserID, &role, &createdAt, &updatedAt,
+			&group.ID, &group.ParentID, &group.Name, &group.Description, &group.Kind, &group.MemberCount,
+			&group.Version, &group.CreatedAt, &group.UpdatedAt, &group.DeletedAt,
+		)
+		if err != nil {
+			log.Println(err)
+			return nil, err
+		}
+		member.Role = epublib.GroupRole(role)
+		member.CreatedAt = createdAt.Time
+		member.UpdatedAt = updatedAt.Time
+		member.Group = group.toEpublibGroup()
+		memberships = append(memberships, member)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	return memberships, nil
+}
+
+func (svc *GroupService) SetGroupMember(ctx context.Context, member *epublib.GroupMember) error {
+	db := svc.db
+	if tx := epublib.TxFromContext(ctx); tx != nil {
+		db = tx
+	}
+	err := db.QueryRow(
+		ctx,
+		`INSERT INTO group_member (group_id, user_id, role) VALUES ($1, $2, $3)
+		ON CONFLICT (group_id, user_id) DO UPDATE SET role = EXCLUDED.role, updated_at = current_timestamp
+		RETURNING created_at, updated_at`,
+		member.GroupID,
+		member.UserID,
+		member.Role,
+	).Scan(&member.CreatedAt, &member.UpdatedAt)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	return nil
+}
+
+func (svc *GroupService) RemoveGroupMember(ctx context.Context, groupID, userID string) error {
+	db := svc.db
+	if tx := epublib.TxFromContext(ctx); tx != nil {
+		db = tx
+	}
+	tag, err := db.Exec(ctx, "DELETE FROM group_member WHERE group_id = $1 AND user_id = $2", groupID, userID)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return epublib.ErrNotFound
+	}
+	return nil
+}
+
+func (svc *GroupService) IsGroupAdmin(ctx context.Context, groupID, userID string) (bool, error) {
+	db := svc.db
+	if tx := epublib.TxFromContext(ctx); tx != nil {
+		db = tx
+	}
+	var isAdmin bool
+	err := db.QueryRow(
+		ctx,
+		`WITH RECURSIVE ancestors AS (
+			SELECT id, parent_id FROM user_group WHERE id = $1 AND deleted_at IS NULL
+			UNION
+			SELECT user_group.id, user_group.parent_id FROM user_group JOIN ancestors ON user_group.id = ancestors.parent_id WHERE user_group.deleted_at IS NULL
+		)
+		SELECT EXISTS (SELECT 1 FROM group_member WHERE user_id = $2 AND role = 'admin' AND group_id IN (SELECT id FROM ancestors))`,
+		groupID,
+		userID,
+	).Scan(&isAdmin)
+	if err != nil {
+		log.Println(err)
+		return false, err
+	}
+	return isAdmin, nil
+}
+
+// missingOrConflict tells apart why a versioned write touched no rows: the
+// group either does not exist or has been modified since it was read.
+func (svc *GroupService) missingOrConflict(ctx context.Context, id string) error {
+	if _, err := svc.FindGroupByID(ctx, id); err != nil {
+		return err
+	}
+	return epublib.ErrConflict
+}
+
+// prefixColumns qualifies every column of a comma separated column list
+// with table.
+func prefixColumns(table, columns string) string {
+	list := strings.Split(columns, ", ")
+	for i, column := range list {
+		list[i] = table + "." + column
+	}
+	return strings.Join(list, ", ")
+}
@@ -0,0 +1,200 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	epublib "epublib"
+	"fmt"
+	"log"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+type MetadataProposal struct {
+	ID         string         `json:"id"`
+	BookID     string         `json:"book_id"`
+	Provider   string         `json:"provider"`
+	Status     string         `json:"status"`
+	Fields     []string       `json:"fields"`
+	Metadata   []byte         `json:"metadata"`
+	ReviewerID sql.NullString `json:"reviewer_id"`
+	ReviewedAt sql.NullTime   `json:"reviewed_at"`
+	CreatedAt  sql.NullTime   `json:"created_at"`
+}
+
+func (p *MetadataProposal) toEpublibMetadataProposal() (*epublib.MetadataProposal, error) {
+	proposal := &epublib.MetadataProposal{
+		ID:         p.ID,
+		BookID:     p.BookID,
+		Provider:   p.Provider,
+		Status:     epublib.ProposalStatus(p.Status),
+		Fields:     nonNilStrings(p.Fields),
+		ReviewerID: p.ReviewerID.String,
+		ReviewedAt: p.ReviewedAt.Time,
+		CreatedAt:  p.CreatedAt.Time,
+	}
+	if err := json.Unmarshal(p.Metadata, &proposal.Metadata); err != nil {
+		return nil, err
+	}
+	return proposal, nil
+}
+
+// metadataProposalColumns lists the metadata_proposal columns in the order
+// expected by scanMetadataProposal.
+const metadataProposalColumns = "id, book_id, provider, status, fields, metadata, reviewer_id, reviewed_at, created_at"
+
+// scanMetadataProposal scans a single row selected with
+// metadataProposalColumns.
+func scanMetadataProposal(row pgx.Row) (*epublib.MetadataProposal, error) {
+	p := &MetadataProposal{}
+	err := row.Scan(&p.ID, &p.BookID, &p.Provider, &p.Status, &p.Fields, &p.Metadata, &p.ReviewerID, &p.ReviewedAt, &p.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return p.toEpublibMetadataProposal()
+}
+
+// MetadataProposalService represents a service for managing metadata
+// proposals.
+type MetadataProposalService struct {
+	db epublib.Conn
+}
+
+// NewMetadataProposalService returns a new instance of
+// MetadataProposalService attached to DB.
+func NewMetadataProposalService(db *pgxpool.Pool) *MetadataProposalService {
+	return &MetadataProposalService{db: db}
+}
+
+func (svc *MetadataProposalService) FindMetadataProposalByID(ctx context.Context, id string) (*epublib.MetadataProposal, error) {
+	db := svc.db
+	if tx := epublib.TxFromContext(ctx); tx != nil {
+		db = tx
+	}
+	proposal, err := scanMetadataProposal(db.QueryRow(ctx, "SELECT "+metadataProposalColumns+" FROM metadata_proposal WHERE id = $1", id))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, epublib.ErrNotFound
+		}
+		log.Println(err)
+		return nil, err
+	}
+	return proposal, nil
+}
+
+func (svc *MetadataProposalService) FindMetadataProposals(ctx context.Context, filter epublib.MetadataProposalFilter) ([]*epublib.MetadataProposal, int, error) {
+	db := svc.db
+	if tx := epublib.TxFromContext(ctx); tx != nil {
+		db = tx
+	}
+	if filter.Limit <= 0 {
+		filter.Limit = 10
+	}
+	if filter.Limit > epublib.MaxMetadataProposalPageSize {
+		filter.Limit = epublib.MaxMetadataProposalPageSize
+	}
+
+	// Build the SQL query based on the filter criteria.
+	filterQuery := " WHERE EXISTS (SELECT 1 FROM book WHERE book.id = metadata_proposal.book_id AND book.deleted_at IS NULL)"
+	args := []interface{}{}
+	if filter.BookID != "" {
+		args = append(args, filter.BookID)
+		filterQuery += fmt.Sprintf(" AND book_id = $%d", len(args))
+	}
+	if filter.Status != "" {
+		args = append(args, filter.Status)
+		filterQuery += fmt.Sprintf(" AND status = $%d", len(args))
+	}
+
+	// Count the total number of matching proposals.
+	var totalCount int
+	err := db.QueryRow(ctx, "SELECT COUNT(*) FROM metadata_proposal"+filterQuery, args...).Scan(&totalCount)
+	if err != nil {
+		log.Println(err)
+		return nil, 0, err
+	}
+
+	query := "SELECT " + metadataProposalColumns + " FROM metadata_proposal" + filterQuery + fmt.Sprintf(" ORDER BY created_at DESC, id OFFSET %d LIMIT %d", filter.Offset, filter.Limit)
+	rows, err := db.Query(ctx, query, args...)
+	if err != nil {
+		log.Println(err)
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	proposals := []*epublib.MetadataProposal{}
+	for rows.Next() {
+		proposal, err := scanMetadataProposal(rows)
+		if err != nil {
+			log.Println(err)
+			return nil, 0, err
+		}
+		proposals = append(proposals, proposal)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println(err)
+		return nil, 0, err
+	}
+	return proposals, totalCount, nil
+}
+
+func (svc *MetadataProposalService) CreateMetadataProposal(ctx context.Context, proposal *epublib.MetadataProposal) error {
+	db := svc.db
+	if tx := epublib.TxFromContext(ctx); tx != nil {
+		db = tx
+	}
+	metadata, err := json.Marshal(proposal.Metadata)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	if _, err := db.Exec(ctx, "DELETE FROM metadata_proposal WHERE book_id = $1 AND status = 'pending'", proposal.BookID); err != nil {
+		log.Println(err)
+		return err
+	}
+	proposal.Status = epublib.PendingProposal
+	proposal.Fields = nonNilStrings(proposal.Fields)
+	err = db.QueryRow(
+		ctx,
+		"INSERT INTO metadata_proposal (book_id, provider, status, fields, metadata) VALUES ($1, $2, $3, $4, $5) RETURNING id, created_at",
+		proposal.BookID,
+		proposal.Provider,
+		proposal.Status,
+		proposal.Fields,
+		metadata,
+	).Scan(&proposal.ID, &proposal.CreatedAt)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	return nil
+}
+
+func (svc *MetadataProposalService) ReviewMetadataProposal(ctx context.Context, id string, status epublib.ProposalStatus, fields []string, reviewerID string) (*epublib.MetadataProposal, error) {
+	db := svc.db
+	if tx := epublib.TxFromContext(ctx); tx != nil {
+		db = tx
+	}
+	tag, err := db.Exec(
+		ctx,
+		`UPDATE metadata_proposal SET status = $1, fields = $2, reviewer_id = NULLIF($3, '')::uuid, reviewed_at = current_timestamp
+		WHERE id = $4 AND status = 'pending'`,
+		status,
+		nonNilStrings(fields),
+		reviewerID,
+		id,
+	)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	if tag.RowsAffected() == 0 {
+		if _, err := svc.FindMetadataProposalByID(ctx, id); err != nil {
+			return nil, err
+		}
+		return nil, epublib.ErrProposalReviewed
+	}
+	return svc.FindMetadataProposalByID(ctx, id)
+}
@@ -0,0 +1 @@
+ALTER TYPE user_level_type ADD VALUE IF NOT EXISTS 'SuperAdmin' BEFORE 'Admin';
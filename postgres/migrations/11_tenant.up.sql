@@ -0,0 +1,76 @@
+CREATE TABLE tenant (
+    id UUID NOT NULL PRIMARY KEY DEFAULT gen_random_uuid(),
+    slug varchar(50) NOT NULL,
+    name varchar(100) NOT NULL,
+    hosts text[] NOT NULL DEFAULT '{}',
+    branding jsonb NOT NULL DEFAULT '{}',
+    config jsonb NOT NULL DEFAULT '{}',
+    version integer NOT NULL DEFAULT 1,
+    created_at timestamptz NOT NULL DEFAULT current_timestamp,
+    updated_at timestamptz NOT NULL DEFAULT current_timestamp,
+    deleted_at timestamptz
+);
+
+CREATE UNIQUE INDEX tenant_slug_idx ON tenant (slug);
+CREATE INDEX tenant_hosts_idx ON tenant USING gin (hosts);
+
+-- Every record that existed before tenants were introduced belongs to the
+-- default tenant.
+INSERT INTO tenant (id, slug, name) VALUES ('00000000-0000-0000-0000-000000000001', 'default', 'Epublib');
+
+-- The application sets app.tenant_id on every connection it uses for a
+-- tenant, see postgres.InitDb.
+CREATE FUNCTION current_tenant_id() RETURNS uuid LANGUAGE sql STABLE AS $$
+    SELECT NULLIF(current_setting('app.tenant_id', true), '')::uuid
+$$;
+
+-- Connections serving a tenant switch to this role. It is subject to the row
+-- level security policies while the owner of the tables is not, which keeps
+-- maintenance and migrations unrestricted.
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_roles WHERE rolname = 'epublib_tenant') THEN
+        CREATE ROLE epublib_tenant NOLOGIN;
+    END IF;
+END
+$$;
+GRANT epublib_tenant TO CURRENT_USER;
+GRANT SELECT, INSERT, UPDATE, DELETE ON ALL TABLES IN SCHEMA public TO epublib_tenant;
+ALTER DEFAULT PRIVILEGES IN SCHEMA public GRANT SELECT, INSERT, UPDATE, DELETE ON TABLES TO epublib_tenant;
+
+-- enable_tenant_isolation scopes a table to tenants. Existing rows are
+-- assigned to the default tenant, new rows to the tenant of the connection.
+-- Later migrations call it for every table they create.
+CREATE FUNCTION enable_tenant_isolation(t text) RETURNS void LANGUAGE plpgsql AS $$
+BEGIN
+    EXECUTE format('ALTER TABLE %I ADD COLUMN tenant_id UUID NOT NULL DEFAULT %L REFERENCES tenant (id)', t, '00000000-0000-0000-0000-000000000001');
+    EXECUTE format('ALTER TABLE %I ALTER COLUMN tenant_id SET DEFAULT current_tenant_id()', t);
+    EXECUTE format('CREATE INDEX %I ON %I (tenant_id)', t || '_tenant_id_idx', t);
+    EXECUTE format('ALTER TABLE %I ENABLE ROW LEVEL SECURITY', t);
+    EXECUTE format('CREATE POLICY tenant_isolation ON %I USING (tenant_id = current_tenant_id())', t);
+END
+$$;
+
+SELECT enable_tenant_isolation(t) FROM unnest(ARRAY[
+    'users',
+    'auth',
+    'reset_token',
+    'username_reservation',
+    'erasure_request',
+    'user_setting',
+    'setting_default',
+    'phone_verification'
+]) AS t;
+
+-- Uniqueness now only holds within a tenant.
+DROP INDEX auth_username_lower_idx;
+CREATE UNIQUE INDEX auth_username_lower_idx ON auth (tenant_id, lower(username));
+
+ALTER TABLE username_reservation DROP CONSTRAINT username_reservation_pkey;
+ALTER TABLE username_reservation ADD PRIMARY KEY (tenant_id, username);
+
+ALTER TABLE setting_default DROP CONSTRAINT setting_default_pkey;
+ALTER TABLE setting_default ADD PRIMARY KEY (tenant_id, key);
+
+-- The seeded admin operates the deployment and can create the other tenants.
+UPDATE auth SET level = 'SuperAdmin' WHERE id = '459e4118-6d02-45d0-94a7-db5375dbc86d';
@@ -0,0 +1,30 @@
+CREATE TYPE group_kind_type AS ENUM ('class', 'department', 'reading_circle', 'other');
+CREATE TYPE group_role_type AS ENUM ('admin', 'member');
+
+CREATE TABLE user_group (
+    id UUID NOT NULL PRIMARY KEY DEFAULT gen_random_uuid(),
+    parent_id UUID REFERENCES user_group (id),
+    name varchar(100) NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    kind group_kind_type NOT NULL DEFAULT 'other',
+    version integer NOT NULL DEFAULT 1,
+    created_at timestamptz NOT NULL DEFAULT current_timestamp,
+    updated_at timestamptz NOT NULL DEFAULT current_timestamp,
+    deleted_at timestamptz
+);
+
+CREATE INDEX user_group_parent_id_idx ON user_group (parent_id);
+
+CREATE TABLE group_member (
+    group_id UUID NOT NULL REFERENCES user_group (id),
+    user_id UUID NOT NULL,
+    role group_role_type NOT NULL DEFAULT 'member',
+    created_at timestamptz NOT NULL DEFAULT current_timestamp,
+    updated_at timestamptz NOT NULL DEFAULT current_timestamp,
+    PRIMARY KEY (group_id, user_id)
+);
+
+CREATE INDEX group_member_user_id_idx ON group_member (user_id);
+
+SELECT enable_tenant_isolation('user_group');
+SELECT enable_tenant_isolation('group_member');
@@ -0,0 +1,23 @@
+CREATE TYPE book_status_type AS ENUM ('draft', 'published', 'archived');
+
+CREATE TABLE book (
+    id UUID NOT NULL PRIMARY KEY DEFAULT gen_random_uuid(),
+    title varchar(255) NOT NULL,
+    subtitle varchar(255) NOT NULL DEFAULT '',
+    language varchar(35) NOT NULL DEFAULT '',
+    description TEXT NOT NULL DEFAULT '',
+    isbns TEXT[] NOT NULL DEFAULT '{}',
+    publication_date date,
+    publisher varchar(255) NOT NULL DEFAULT '',
+    page_count integer NOT NULL DEFAULT 0,
+    status book_status_type NOT NULL DEFAULT 'draft',
+    version integer NOT NULL DEFAULT 1,
+    created_at timestamptz NOT NULL DEFAULT current_timestamp,
+    updated_at timestamptz NOT NULL DEFAULT current_timestamp,
+    deleted_at timestamptz
+);
+
+CREATE INDEX book_title_idx ON book (lower(title));
+CREATE INDEX book_isbns_idx ON book USING GIN (isbns);
+
+SELECT enable_tenant_isolation('book');
@@ -0,0 +1,7 @@
+ALTER TABLE book
+    ADD COLUMN creators jsonb NOT NULL DEFAULT '[]',
+    ADD COLUMN identifiers jsonb NOT NULL DEFAULT '[]',
+    ADD COLUMN subjects TEXT[] NOT NULL DEFAULT '{}',
+    ADD COLUMN rights TEXT NOT NULL DEFAULT '',
+    ADD COLUMN file_key TEXT NOT NULL DEFAULT '',
+    ADD COLUMN file_size bigint NOT NULL DEFAULT 0;
@@ -0,0 +1,10 @@
+CREATE TABLE book_validation (
+    book_id UUID NOT NULL PRIMARY KEY REFERENCES book (id),
+    valid boolean NOT NULL,
+    error_count integer NOT NULL DEFAULT 0,
+    warning_count integer NOT NULL DEFAULT 0,
+    messages jsonb NOT NULL DEFAULT '[]',
+    created_at timestamptz NOT NULL DEFAULT current_timestamp
+);
+
+SELECT enable_tenant_isolation('book_validation');
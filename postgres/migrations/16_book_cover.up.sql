@@ -0,0 +1 @@
+ALTER TABLE book ADD COLUMN cover_key text NOT NULL DEFAULT '';
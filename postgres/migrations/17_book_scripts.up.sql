@@ -0,0 +1 @@
+ALTER TABLE book ADD COLUMN allow_scripts boolean NOT NULL DEFAULT false;
@@ -0,0 +1,15 @@
+CREATE TABLE book_text (
+    book_id UUID NOT NULL REFERENCES book (id),
+    position integer NOT NULL,
+    spine_index integer NOT NULL,
+    path TEXT NOT NULL,
+    fragment TEXT NOT NULL DEFAULT '',
+    content TEXT NOT NULL,
+    config regconfig NOT NULL DEFAULT 'simple',
+    tsv tsvector NOT NULL,
+    PRIMARY KEY (book_id, position)
+);
+
+CREATE INDEX book_text_tsv_idx ON book_text USING GIN (tsv);
+
+SELECT enable_tenant_isolation('book_text');
@@ -0,0 +1,62 @@
+CREATE TABLE author (
+    id UUID NOT NULL PRIMARY KEY DEFAULT gen_random_uuid(),
+    name varchar(255) NOT NULL,
+    sort_name varchar(255) NOT NULL DEFAULT '',
+    aliases TEXT[] NOT NULL DEFAULT '{}',
+    name_keys TEXT[] NOT NULL DEFAULT '{}',
+    match_key TEXT NOT NULL DEFAULT '',
+    bio TEXT NOT NULL DEFAULT '',
+    photo_key TEXT NOT NULL DEFAULT '',
+    version integer NOT NULL DEFAULT 1,
+    created_at timestamptz NOT NULL DEFAULT current_timestamp,
+    updated_at timestamptz NOT NULL DEFAULT current_timestamp,
+    deleted_at timestamptz
+);
+
+CREATE INDEX author_sort_name_idx ON author (lower(sort_name));
+CREATE INDEX author_name_keys_idx ON author USING GIN (name_keys);
+CREATE INDEX author_match_key_idx ON author (match_key);
+
+CREATE TABLE publisher (
+    id UUID NOT NULL PRIMARY KEY DEFAULT gen_random_uuid(),
+    name varchar(255) NOT NULL,
+    sort_name varchar(255) NOT NULL DEFAULT '',
+    aliases TEXT[] NOT NULL DEFAULT '{}',
+    name_keys TEXT[] NOT NULL DEFAULT '{}',
+    match_key TEXT NOT NULL DEFAULT '',
+    description TEXT NOT NULL DEFAULT '',
+    website TEXT NOT NULL DEFAULT '',
+    logo_key TEXT NOT NULL DEFAULT '',
+    version integer NOT NULL DEFAULT 1,
+    created_at timestamptz NOT NULL DEFAULT current_timestamp,
+    updated_at timestamptz NOT NULL DEFAULT current_timestamp,
+    deleted_at timestamptz
+);
+
+CREATE INDEX publisher_sort_name_idx ON publisher (lower(sort_name));
+CREATE INDEX publisher_name_keys_idx ON publisher USING GIN (name_keys);
+CREATE INDEX publisher_match_key_idx ON publisher (match_key);
+
+-- Creators of a book linked to authors, in display order. The same author
+-- may contribute in several roles.
+CREATE TABLE book_contributor (
+    book_id UUID NOT NULL REFERENCES book (id),
+    position integer NOT NULL,
+    author_id UUID NOT NULL REFERENCES author (id),
+    role varchar(3) NOT NULL DEFAULT 'aut',
+    PRIMARY KEY (book_id, position)
+);
+
+CREATE INDEX book_contributor_author_id_idx ON book_contributor (author_id);
+
+-- Existing books are linked by a background job, see entities_linked.
+ALTER TABLE book
+    ADD COLUMN publisher_id UUID REFERENCES publisher (id),
+    ADD COLUMN entities_linked boolean NOT NULL DEFAULT false;
+
+CREATE INDEX book_publisher_id_idx ON book (publisher_id);
+CREATE INDEX book_unlinked_idx ON book (id) WHERE NOT entities_linked AND deleted_at IS NULL;
+
+SELECT enable_tenant_isolation('author');
+SELECT enable_tenant_isolation('publisher');
+SELECT enable_tenant_isolation('book_contributor');
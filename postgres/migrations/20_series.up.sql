@@ -0,0 +1,23 @@
+CREATE TABLE series (
+    id UUID NOT NULL PRIMARY KEY DEFAULT gen_random_uuid(),
+    name varchar(255) NOT NULL,
+    name_key TEXT NOT NULL DEFAULT '',
+    description TEXT NOT NULL DEFAULT '',
+    version integer NOT NULL DEFAULT 1,
+    created_at timestamptz NOT NULL DEFAULT current_timestamp,
+    updated_at timestamptz NOT NULL DEFAULT current_timestamp,
+    deleted_at timestamptz
+);
+
+CREATE INDEX series_name_idx ON series (lower(name));
+CREATE INDEX series_name_key_idx ON series (name_key);
+
+-- Positions are fractional so volumes can be slotted in between, like a
+-- novella at 1.5. Zero when unknown.
+ALTER TABLE book
+    ADD COLUMN series_id UUID REFERENCES series (id),
+    ADD COLUMN series_position double precision NOT NULL DEFAULT 0;
+
+CREATE INDEX book_series_idx ON book (series_id, series_position);
+
+SELECT enable_tenant_isolation('series');
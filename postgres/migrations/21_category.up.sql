@@ -0,0 +1,25 @@
+CREATE TABLE category (
+    id UUID NOT NULL PRIMARY KEY DEFAULT gen_random_uuid(),
+    parent_id UUID REFERENCES category (id),
+    name varchar(255) NOT NULL,
+    name_key TEXT NOT NULL DEFAULT '',
+    description TEXT NOT NULL DEFAULT '',
+    codes JSONB NOT NULL DEFAULT '[]',
+    version integer NOT NULL DEFAULT 1,
+    created_at timestamptz NOT NULL DEFAULT current_timestamp,
+    updated_at timestamptz NOT NULL DEFAULT current_timestamp,
+    deleted_at timestamptz
+);
+
+CREATE INDEX category_parent_id_idx ON category (parent_id);
+
+CREATE TABLE book_category (
+    book_id UUID NOT NULL REFERENCES book (id),
+    category_id UUID NOT NULL REFERENCES category (id),
+    PRIMARY KEY (book_id, category_id)
+);
+
+CREATE INDEX book_category_category_id_idx ON book_category (category_id);
+
+SELECT enable_tenant_isolation('category');
+SELECT enable_tenant_isolation('book_category');
@@ -0,0 +1,20 @@
+CREATE TYPE proposal_status_type AS ENUM ('pending', 'applied', 'rejected');
+
+-- Metadata found for a book in an external catalog, waiting for an admin to
+-- apply or reject it. A book has at most one pending proposal.
+CREATE TABLE metadata_proposal (
+    id UUID NOT NULL PRIMARY KEY DEFAULT gen_random_uuid(),
+    book_id UUID NOT NULL REFERENCES book (id),
+    provider TEXT NOT NULL,
+    status proposal_status_type NOT NULL DEFAULT 'pending',
+    fields TEXT[] NOT NULL DEFAULT '{}',
+    metadata JSONB NOT NULL,
+    reviewer_id UUID,
+    reviewed_at timestamptz,
+    created_at timestamptz NOT NULL DEFAULT current_timestamp
+);
+
+CREATE INDEX metadata_proposal_book_id_idx ON metadata_proposal (book_id);
+CREATE INDEX metadata_proposal_status_idx ON metadata_proposal (status, created_at);
+
+SELECT enable_tenant_isolation('metadata_proposal');
@@ -0,0 +1,33 @@
+CREATE TABLE book_revision (
+    id UUID NOT NULL PRIMARY KEY DEFAULT gen_random_uuid(),
+    book_id UUID NOT NULL REFERENCES book (id),
+    number integer NOT NULL,
+    file_key TEXT NOT NULL,
+    file_size bigint NOT NULL DEFAULT 0,
+    checksum TEXT NOT NULL DEFAULT '',
+    uploader_id UUID,
+    note TEXT NOT NULL DEFAULT '',
+    snapshot jsonb,
+    validation jsonb,
+    created_at timestamptz NOT NULL DEFAULT current_timestamp,
+    UNIQUE (book_id, number)
+);
+
+SELECT enable_tenant_isolation('book_revision');
+
+CREATE INDEX book_revision_uncomputed_idx ON book_revision (id) WHERE snapshot IS NULL;
+
+ALTER TABLE book ADD COLUMN revision_id UUID REFERENCES book_revision (id);
+
+-- Files uploaded so far become the first revision of their book, along
+-- with their validation report. Checksums and snapshots are computed by a
+-- background job.
+INSERT INTO book_revision (tenant_id, book_id, number, file_key, file_size, validation, created_at)
+SELECT book.tenant_id, book.id, 1, book.file_key, book.file_size,
+    (SELECT jsonb_build_object('book_id', v.book_id, 'valid', v.valid, 'error_count', v.error_count,
+        'warning_count', v.warning_count, 'messages', v.messages, 'created_at', v.created_at)
+    FROM book_validation v WHERE v.book_id = book.id),
+    book.created_at
+FROM book WHERE book.file_key <> '';
+
+UPDATE book SET revision_id = r.id FROM book_revision r WHERE r.book_id = book.id;
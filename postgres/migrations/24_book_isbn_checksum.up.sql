@@ -0,0 +1,55 @@
+-- ISBN check digits are validated since books store them. Stored ISBNs are
+-- converted to ISBN-13 like new ones, and those with a wrong check digit
+-- are moved to the identifiers so the books remain editable without losing
+-- them.
+CREATE FUNCTION isbn_check_digit(digits text) RETURNS text LANGUAGE plpgsql IMMUTABLE AS $$
+DECLARE
+    total integer := 0;
+BEGIN
+    IF length(digits) = 9 THEN
+        FOR i IN 1..9 LOOP
+            total := total + substr(digits, i, 1)::integer * (11 - i);
+        END LOOP;
+        total := (11 - total % 11) % 11;
+        RETURN CASE WHEN total = 10 THEN 'X' ELSE total::text END;
+    END IF;
+    FOR i IN 1..12 LOOP
+        total := total + substr(digits, i, 1)::integer * CASE WHEN i % 2 = 0 THEN 3 ELSE 1 END;
+    END LOOP;
+    RETURN ((10 - total % 10) % 10)::text;
+END
+$$;
+
+-- isbn13 returns the ISBN-13 of a valid ISBN-10 or ISBN-13, or NULL.
+CREATE FUNCTION isbn13(isbn text) RETURNS text LANGUAGE plpgsql IMMUTABLE AS $$
+BEGIN
+    IF isbn ~ '^[0-9]{9}[0-9X]$' AND isbn_check_digit(left(isbn, 9)) = right(isbn, 1) THEN
+        RETURN '978' || left(isbn, 9) || isbn_check_digit('978' || left(isbn, 9));
+    END IF;
+    IF isbn ~ '^97[89][0-9]{10}$' AND isbn_check_digit(left(isbn, 12)) = right(isbn, 1) THEN
+        RETURN isbn;
+    END IF;
+    RETURN NULL;
+END
+$$;
+
+UPDATE book SET
+    isbns = coalesce((
+        SELECT array_agg(v.isbn ORDER BY v.position)
+        FROM (
+            SELECT isbn13(u.isbn) AS isbn, min(u.position) AS position
+            FROM unnest(book.isbns) WITH ORDINALITY AS u (isbn, position)
+            WHERE isbn13(u.isbn) IS NOT NULL
+            GROUP BY 1
+        ) v
+    ), '{}'),
+    identifiers = identifiers || coalesce((
+        SELECT jsonb_agg(jsonb_build_object('scheme', 'ISBN', 'value', u.isbn))
+        FROM unnest(book.isbns) AS u (isbn)
+        WHERE isbn13(u.isbn) IS NULL
+        AND NOT book.identifiers @> jsonb_build_array(jsonb_build_object('value', u.isbn))
+    ), '[]')
+WHERE isbns <> '{}';
+
+DROP FUNCTION isbn13(text);
+DROP FUNCTION isbn_check_digit(text);
@@ -0,0 +1,21 @@
+-- Phone numbers are stored in E.164 since phone verification. Numbers
+-- entered before are normalized like new ones, national numbers taking the
+-- built-in default country code, and numbers that cannot be normalized are
+-- cleared so users can enter them again.
+WITH legacy AS (
+    SELECT id, regexp_replace(btrim(phone_number), '[ .()-]', '', 'g') AS number
+    FROM users
+    WHERE phone_number <> '' AND phone_number !~ '^\+[1-9][0-9]{6,14}$'
+), normalized AS (
+    SELECT id, CASE
+        WHEN number LIKE '+%' THEN number
+        WHEN number LIKE '00%' THEN '+' || substr(number, 3)
+        WHEN number LIKE '0%' THEN '+62' || substr(number, 2)
+    END AS number
+    FROM legacy
+)
+UPDATE users SET
+    phone_number = CASE WHEN normalized.number ~ '^\+[1-9][0-9]{6,14}$' THEN normalized.number ELSE '' END,
+    phone_verified_at = NULL
+FROM normalized
+WHERE users.id = normalized.id;
@@ -0,0 +1,2 @@
+-- Daily limits count the codes sent to a phone number.
+CREATE INDEX phone_verification_phone_number_idx ON phone_verification (phone_number, created_at);
@@ -0,0 +1,2 @@
+ALTER TABLE users ADD COLUMN version integer NOT NULL DEFAULT 1;
+ALTER TABLE auth ADD COLUMN version integer NOT NULL DEFAULT 1;
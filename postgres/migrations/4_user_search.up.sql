@@ -0,0 +1,9 @@
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE INDEX users_name_trgm_idx ON users USING gin (name gin_trgm_ops);
+CREATE INDEX users_created_at_id_idx ON users (created_at, id);
+CREATE INDEX users_updated_at_id_idx ON users (updated_at, id);
+CREATE INDEX users_deleted_at_idx ON users (deleted_at);
+
+CREATE INDEX auth_user_id_idx ON auth (user_id);
+CREATE INDEX auth_email_trgm_idx ON auth USING gin (email gin_trgm_ops);
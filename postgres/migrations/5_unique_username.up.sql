@@ -0,0 +1,18 @@
+-- Disambiguate usernames that only differ by case before enforcing uniqueness.
+UPDATE auth SET username = left(username, 16) || '_' || left(id::text, 8)
+WHERE id IN (
+    SELECT id FROM (
+        SELECT id, row_number() OVER (PARTITION BY lower(username) ORDER BY created_at, id) AS n FROM auth
+    ) ranked WHERE n > 1
+);
+
+CREATE UNIQUE INDEX auth_username_lower_idx ON auth (lower(username));
+
+-- Usernames given up through a rename stay reserved for their previous owner
+-- until reserved_until so they cannot be taken over right away.
+CREATE TABLE username_reservation (
+    username varchar(25) NOT NULL PRIMARY KEY,
+    user_id UUID NOT NULL,
+    reserved_until timestamptz NOT NULL,
+    created_at timestamptz NOT NULL DEFAULT current_timestamp
+);
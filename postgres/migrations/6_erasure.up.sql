@@ -0,0 +1,18 @@
+ALTER TABLE reset_token ADD COLUMN user_id UUID;
+CREATE INDEX reset_token_user_id_idx ON reset_token (user_id);
+
+-- Erasure requests are kept after completion as the audit trail of who asked
+-- for a user's personal data to be removed and when it happened.
+CREATE TABLE erasure_request (
+    id UUID NOT NULL PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL,
+    requested_by UUID NOT NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    scheduled_for timestamptz NOT NULL,
+    cancelled_at timestamptz,
+    completed_at timestamptz,
+    created_at timestamptz NOT NULL DEFAULT current_timestamp,
+    updated_at timestamptz NOT NULL DEFAULT current_timestamp
+);
+CREATE INDEX erasure_request_user_id_idx ON erasure_request (user_id);
+CREATE INDEX erasure_request_due_idx ON erasure_request (scheduled_for) WHERE cancelled_at IS NULL AND completed_at IS NULL;
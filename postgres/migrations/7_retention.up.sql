@@ -0,0 +1,4 @@
+-- Erasures started by the retention job have no requesting user.
+ALTER TABLE erasure_request ALTER COLUMN requested_by DROP NOT NULL;
+
+CREATE INDEX reset_token_deleted_at_idx ON reset_token (deleted_at);
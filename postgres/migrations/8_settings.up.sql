@@ -0,0 +1,15 @@
+CREATE TABLE user_setting (
+    user_id UUID NOT NULL,
+    key varchar(100) NOT NULL,
+    value jsonb NOT NULL,
+    created_at timestamptz NOT NULL DEFAULT current_timestamp,
+    updated_at timestamptz NOT NULL DEFAULT current_timestamp,
+    PRIMARY KEY (user_id, key)
+);
+
+CREATE TABLE setting_default (
+    key varchar(100) NOT NULL PRIMARY KEY,
+    value jsonb NOT NULL,
+    created_at timestamptz NOT NULL DEFAULT current_timestamp,
+    updated_at timestamptz NOT NULL DEFAULT current_timestamp
+);
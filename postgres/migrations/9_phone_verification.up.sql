@@ -0,0 +1,18 @@
+-- E.164 numbers are up to 15 digits after the plus sign.
+ALTER TABLE users ALTER COLUMN phone_number TYPE varchar(16);
+ALTER TABLE users ADD COLUMN phone_verified_at timestamptz;
+
+CREATE TABLE phone_verification (
+    id UUID NOT NULL PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL,
+    phone_number varchar(16) NOT NULL,
+    code_hash TEXT NOT NULL,
+    attempts integer NOT NULL DEFAULT 0,
+    expires_at timestamptz NOT NULL,
+    cancelled_at timestamptz,
+    verified_at timestamptz,
+    created_at timestamptz NOT NULL DEFAULT current_timestamp,
+    updated_at timestamptz NOT NULL DEFAULT current_timestamp
+);
+
+CREATE INDEX phone_verification_user_id_idx ON phone_verification (user_id);
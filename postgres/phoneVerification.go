@@ -0,0 +1,200 @@
+package postgres
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	epublib "epublib"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+type PhoneVerification struct {
+	ID          string       `json:"id"`
+	UserID      string       `json:"user_id"`
+	PhoneNumber string       `json:"phone_number"`
+	Attempts    int          `json:"attempts"`
+	ExpiresAt   sql.NullTime `json:"expires_at"`
+	VerifiedAt  sql.NullTime `json:"verified_at"`
+	CreatedAt   sql.NullTime `json:"created_at"`
+	UpdatedAt   sql.NullTime `json:"updated_at"`
+}
+
+func (v *PhoneVerification) toEpublibPhoneVerification() *epublib.PhoneVerification {
+	return &epublib.PhoneVerification{
+		ID:          v.ID,
+		UserID:      v.UserID,
+		PhoneNumber: v.PhoneNumber,
+		Attempts:    v.Attempts,
+		ExpiresAt:   v.ExpiresAt.Time,
+		VerifiedAt:  v.VerifiedAt.Time,
+		CreatedAt:   v.CreatedAt.Time,
+		UpdatedAt:   v.UpdatedAt.Time,
+	}
+}
+
+// PhoneVerificationService represents a service for verifying phone numbers.
+type PhoneVerificationService struct {
+	db epublib.Conn
+}
+
+// NewPhoneVerificationService returns a new instance of PhoneVerificationService attached to DB.
+func NewPhoneVerificationService(db *pgxpool.Pool) *PhoneVerificationService {
+	return &PhoneVerificationService{db: db}
+}
+
+func (svc *PhoneVerificationService) CreatePhoneVerification(ctx context.Context, v *epublib.PhoneVerification) error {
+	db := svc.db
+	if tx := epublib.TxFromContext(ctx); tx != nil {
+		db = tx
+	}
+	_, err := db.Exec(
+		ctx,
+		"UPDATE phone_verification SET cancelled_at = current_timestamp, updated_at = current_timestamp WHERE user_id = $1 AND cancelled_at IS NULL AND verified_at IS NULL",
+		v.UserID,
+	)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	// The row ID salts the hash, so it is generated before hashing
+	err = db.QueryRow(ctx, "SELECT gen_random_uuid()").Scan(&v.ID)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	err = db.QueryRow(
+		ctx,
+		"INSERT INTO phone_verification (id, user_id, phone_number, code_hash, expires_at) VALUES ($1, $2, $3, $4, $5) RETURNING created_at, updated_at",
+		v.ID,
+		v.UserID,
+		v.PhoneNumber,
+		encryptPass(v.Code, v.ID),
+		v.ExpiresAt,
+	).Scan(&v.CreatedAt, &v.UpdatedAt)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	return nil
+}
+
+func (svc *PhoneVerificationService) FindPendingPhoneVerification(ctx context.Context, userID string) (*epublib.PhoneVerification, error) {
+	db := svc.db
+	if tx := epublib.TxFromContext(ctx); tx != nil {
+		db = tx
+	}
+	v := &PhoneVerification{}
+	err := db.QueryRow(
+		ctx,
+		`SELECT id, user_id, phone_number, attempts, expires_at, verified_at, created_at, updated_at FROM phone_verification
+		WHERE user_id = $1 AND cancelled_at IS NULL AND verified_at IS NULL AND expires_at > current_timestamp AND attempts < $2
+		ORDER BY created_at DESC LIMIT 1`,
+		userID,
+		epublib.MaxPhoneVerificationAttempts,
+	).Scan(&v.ID, &v.UserID, &v.PhoneNumber, &v.Attempts, &v.ExpiresAt, &v.VerifiedAt, &v.CreatedAt, &v.UpdatedAt)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, epublib.ErrNotFound
+		}
+		log.Println(err)
+		return nil, err
+	}
+	return v.toEpublibPhoneVerification(), nil
+}
+
+func (svc *PhoneVerificationService) FindLatestPhoneVerification(ctx context.Context, userID string) (*epublib.PhoneVerification, error) {
+	db := svc.db
+	if tx := epublib.TxFromContext(ctx); tx != nil {
+		db = tx
+	}
+	v := &PhoneVerification{}
+	err := db.QueryRow(
+		ctx,
+		`SELECT id, user_id, phone_number, attempts, expires_at, verified_at, created_at, updated_at FROM phone_verification
+		WHERE user_id = $1
+		ORDER BY created_at DESC LIMIT 1`,
+		userID,
+	).Scan(&v.ID, &v.UserID, &v.PhoneNumber, &v.Attempts, &v.ExpiresAt, &v.VerifiedAt, &v.CreatedAt, &v.UpdatedAt)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, epublib.ErrNotFound
+		}
+		log.Println(err)
+		return nil, err
+	}
+	return v.toEpublibPhoneVerification(), nil
+}
+
+func (svc *PhoneVerificationService) CountPhoneVerificationsSince(ctx context.Context, userID, phoneNumber string, since time.Time) (int, error) {
+	db := svc.db
+	if tx := epublib.TxFromContext(ctx); tx != nil {
+		db = tx
+	}
+	var count int
+	err := db.QueryRow(
+		ctx,
+		"SELECT count(*) FROM phone_verification WHERE (user_id = $1 OR phone_number = $2) AND created_at > $3",
+		userID,
+		phoneNumber,
+		since,
+	).Scan(&count)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	return count, nil
+}
+
+func (svc *PhoneVerificationService) VerifyPhone(ctx context.Context, id, code string) (bool, error) {
+	db := svc.db
+	if tx := epublib.TxFromContext(ctx); tx != nil {
+		db = tx
+	}
+
+	// Count the attempt before comparing so concurrent guesses cannot
+	// exceed the limit
+	var userID, phoneNumber, codeHash string
+	err := db.QueryRow(
+		ctx,
+		`UPDATE phone_verification SET attempts = attempts + 1, updated_at = current_timestamp
+		WHERE id = $1 AND cancelled_at IS NULL AND verified_at IS NULL AND expires_at > current_timestamp AND attempts < $2
+		RETURNING user_id, phone_number, code_hash`,
+		id,
+		epublib.MaxPhoneVerificationAttempts,
+	).Scan(&userID, &phoneNumber, &codeHash)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return false, epublib.ErrNotFound
+		}
+		log.Println(err)
+		return false, err
+	}
+	if subtle.ConstantTimeCompare([]byte(encryptPass(code, id)), []byte(codeHash)) != 1 {
+		return false, nil
+	}
+
+	tag, err := db.Exec(
+		ctx,
+		"UPDATE users SET phone_verified_at = current_timestamp, version = version + 1, updated_at = current_timestamp WHERE id = $1 AND phone_number = $2",
+		userID,
+		phoneNumber,
+	)
+	if err != nil {
+		log.Println(err)
+		return false, err
+	}
+	if tag.RowsAffected() == 0 {
+		return false, epublib.ErrNotFound
+	}
+	_, err = db.Exec(ctx, "UPDATE phone_verification SET verified_at = current_timestamp, updated_at = current_timestamp WHERE id = $1", id)
+	if err != nil {
+		log.Println(err)
+		return false, err
+	}
+	return true, nil
+}
@@ -4,8 +4,10 @@ import (
 	"context"
 	epublib "epublib"
 	"fmt"
+	"log"
 	"os"
 	"strconv"
+	"sync"
 
 	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
@@ -32,13 +34,80 @@ func InitDb() (*pgxpool.Pool, error) {
 	}
 
 	connStr := fmt.Sprintf("postgres://%s:%s@%s:%d/%s", dbUser, dbPass, dbHost, port, dbName)
-	dbConnPool, err := pgxpool.Connect(ctx, connStr)
+	config, err := pgxpool.ParseConfig(connStr)
 	if err != nil {
 		panic(err)
 	}
+	config.BeforeAcquire = scopeConnToTenant
+	config.AfterRelease = unscopeConn
+	dbConnPool, err := pgxpool.ConnectConfig(ctx, config)
+	if err != nil {
+		panic(err)
+	}
+
+	// Fail early rather than on every acquire if the tenant role is missing
+	conn, err := dbConnPool.Acquire(ctx)
+	if err != nil {
+		panic(err)
+	}
+	defer conn.Release()
+	if _, err := conn.Exec(ctx, "SET ROLE "+tenantRole+"; RESET ROLE"); err != nil {
+		panic(err)
+	}
 	return dbConnPool, nil
 }
 
+// tenantRole is the database role subject to the tenant isolation policies,
+// see migration 11_tenant.
+const tenantRole = "epublib_tenant"
+
+// scopedConns holds the connections currently scoped to a tenant.
+var scopedConns sync.Map
+
+// scopeConnToTenant restricts a connection acquired with a tenant in ctx to
+// the tenant's rows. Connections acquired without a tenant, like those of
+// maintenance jobs and tenant administration, stay unrestricted.
+func scopeConnToTenant(ctx context.Context, conn *pgx.Conn) bool {
+	tenantID := epublib.TenantIDFromContext(ctx)
+	if tenantID == "" {
+		return true
+	}
+	_, err := conn.Exec(ctx, "SELECT set_config('app.tenant_id', $1, false)", tenantID)
+	if err == nil {
+		_, err = conn.Exec(ctx, "SET ROLE "+tenantRole)
+	}
+	if err != nil {
+		// Discarding the connection makes the pool try another one
+		log.Println(err)
+		return false
+	}
+	scopedConns.Store(conn, true)
+	return true
+}
+
+// unscopeConn lifts the tenant restriction before a connection goes back to
+// the pool.
+func unscopeConn(conn *pgx.Conn) bool {
+	// The pool destroys expired and broken connections without calling
+	// AfterRelease, forget those here
+	scopedConns.Range(func(key, _ interface{}) bool {
+		if key.(*pgx.Conn).IsClosed() {
+			scopedConns.Delete(key)
+		}
+		return true
+	})
+
+	if _, ok := scopedConns.LoadAndDelete(conn); !ok {
+		return true
+	}
+	_, err := conn.Exec(context.Background(), "RESET ROLE; SET app.tenant_id = ''")
+	if err != nil {
+		log.Println(err)
+		return false
+	}
+	return true
+}
+
 func BeginTx(ctx context.Context, db *pgxpool.Pool) (context.Context, error) {
 	tx, err := db.Begin(ctx)
 	if err != nil {
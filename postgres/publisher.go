@@ -0,0 +1,408 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	epublib "epublib"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+type Publisher struct {
+	ID          string       `json:"id"`
+	Name        string       `json:"name"`
+	SortName    string       `json:"sort_name"`
+	Aliases     []string     `json:"aliases"`
+	Description string       `json:"description"`
+	Website     string       `json:"website"`
+	LogoKey     string       `json:"logo_key"`
+	Version     int          `json:"version"`
+	CreatedAt   sql.NullTime `json:"created_at"`
+	UpdatedAt   sql.NullTime `json:"updated_at"`
+	DeletedAt   sql.NullTime `json:"deleted_at"`
+}
+
+func (p *Publisher) toEpublibPublisher() *epublib.Publisher {
+	return &epublib.Publisher{
+		ID:          p.ID,
+		Name:        p.Name,
+		SortName:    p.SortName,
+		Aliases:     nonNilStrings(p.Aliases),
+		Description: p.Description,
+		Website:     p.Website,
+		LogoKey:     p.LogoKey,
+		HasLogo:     p.LogoKey != "",
+		Version:     p.Version,
+		CreatedAt:   p.CreatedAt.Time,
+		UpdatedAt:   p.UpdatedAt.Time,
+		DeletedAt:   p.DeletedAt.Time,
+	}
+}
+
+// publisherColumns lists the publisher columns in the order expected by
+// scanPublisher.
+const publisherColumns = "id, name, sort_name, aliases, description, website, logo_key, version, created_at, updated_at, deleted_at"
+
+// scanPublisher scans a single row selected with publisherColumns.
+func scanPublisher(row pgx.Row) (*epublib.Publisher, error) {
+	p := &Publisher{}
+	err := row.Scan(&p.ID, &p.Name, &p.SortName, &p.Aliases, &p.Description, &p.Website, &p.LogoKey, &p.Version, &p.CreatedAt, &p.UpdatedAt, &p.DeletedAt)
+	if err != nil {
+		return nil, err
+	}
+	return p.toEpublibPublisher(), nil
+}
+
+// PublisherService represents a service for managing publishers.
+type PublisherService struct {
+	db epublib.Conn
+}
+
+// NewPublisherService returns a new instance of PublisherService attached to DB.
+func NewPublisherService(db *pgxpool.Pool) *PublisherService {
+	return &PublisherService{db: db}
+}
+
+func (svc *PublisherService) FindPublisherByID(ctx context.Context, id string) (*epublib.Publisher, error) {
+	db := svc.db
+	if tx := epublib.TxFromContext(ctx); tx != nil {
+		db = tx
+	}
+	publisher, err := scanPublisher(db.QueryRow(ctx, "SELECT "+publisherColumns+" FROM publisher WHERE id = $1 AND deleted_at IS NULL", id))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, epublib.ErrNotFound
+		}
+		log.Println(err)
+		return nil, err
+	}
+	return publisher, nil
+}
+
+func (svc *PublisherService) FindPublishers(ctx context.Context, filter epublib.PublisherFilter) ([]*epublib.Publisher, int, error) {
+	db := svc.db
+	if tx := epublib.TxFromContext(ctx); tx != nil {
+		db = tx
+	}
+	if filter.Limit <= 0 {
+		filter.Limit = 10
+	}
+	if filter.Limit > epublib.MaxPublisherPageSize {
+		filter.Limit = epublib.MaxPublisherPageSize
+	}
+
+	// Build the SQL query based on the filter criteria.
+	filterQuery := " WHERE deleted_at IS NULL"
+	args := []interface{}{}
+	if filter.Name != "" {
+		args = append(args, "%"+escapeLike(filter.Name)+"%")
+		filterQuery += fmt.Sprintf(" AND (name ILIKE $%d OR EXISTS (SELECT 1 FROM unnest(aliases) AS alias WHERE alias ILIKE $%d))", len(args), len(args))
+	}
+
+	// Count the total number of matching publishers.
+	var totalCount int
+	err := db.QueryRow(ctx, "SELECT COUNT(*) FROM publisher"+filterQuery, args...).Scan(&totalCount)
+	if err != nil {
+		log.Println(err)
+		return nil, 0, err
+	}
+
+	query := "SELECT " + publisherColumns + " FROM publisher" + filterQuery + fmt.Sprintf(" ORDER BY lower(sort_name), id OFFSET %d LIMIT %d", filter.Offset, filter.Limit)
+	publishers, err := svc.queryPublishers(ctx, db, query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	return publishers, totalCount, nil
+}
+
+func (svc *PublisherService) queryPublishers(ctx context.Context, db epublib.Conn, query string, args ...interface{}) ([]*epublib.Publisher, error) {
+	rows, err := db.Query(ctx, query, args...)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	publishers := []*epublib.Publisher{}
+	for rows.Next() {
+		publisher, err := scanPublisher(rows)
+		if err != nil {
+			log.Println(err)
+			return nil, err
+		}
+		publishers = append(publishers, publisher)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	return publishers, nil
+}
+
+// nameTaken reports whether one of keys is the name key of another publisher
+// than the one with the given ID.
+func (svc *PublisherService) nameTaken(ctx context.Context, db epublib.Conn, keys []string, id string) (bool, error) {
+	var taken bool
+	err := db.QueryRow(
+		ctx,
+		"SELECT EXISTS (SELECT 1 FROM publisher WHERE name_keys && $1 AND id::text <> $2 AND deleted_at IS NULL)",
+		keys,
+		id,
+	).Scan(&taken)
+	if err != nil {
+		log.Println(err)
+	}
+	return taken, err
+}
+
+func (svc *PublisherService) CreatePublisher(ctx context.Context, publisher *epublib.Publisher) error {
+	db := svc.db
+	if tx := epublib.TxFromContext(ctx); tx != nil {
+		db = tx
+	}
+	publisher.Aliases = mergeAliases(epublib.PublisherNameKey, publisher.Name, nil, publisher.Aliases)
+	keys := nameKeys(epublib.PublisherNameKey, publisher.Name, publisher.Aliases)
+	taken, err := svc.nameTaken(ctx, db, keys, "")
+	if err != nil {
+		return err
+	}
+	if taken {
+		return epublib.ErrPublisherNameTaken
+	}
+	err = db.QueryRow(
+		ctx,
+		`INSERT INTO publisher (name, sort_name, aliases, name_keys, match_key, description, website, logo_key)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id, version, created_at, updated_at`,
+		publisher.Name,
+		publisher.SortName,
+		publisher.Aliases,
+		keys,
+		epublib.PublisherMatchKey(publisher.Name),
+		publisher.Description,
+		publisher.Website,
+		publisher.LogoKey,
+	).Scan(&publisher.ID, &publisher.Version, &publisher.CreatedAt, &publisher.UpdatedAt)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	return nil
+}
+
+func (svc *PublisherService) UpdatePublisher(ctx context.Context, id string, upd epublib.PublisherUpdate) (*epublib.Publisher, error) {
+	db := svc.db
+	if tx := epublib.TxFromContext(ctx); tx != nil {
+		db = tx
+	}
+	aliases := mergeAliases(epublib.PublisherNameKey, upd.Name, nil, upd.Aliases)
+	keys := nameKeys(epublib.PublisherNameKey, upd.Name, aliases)
+	taken, err := svc.nameTaken(ctx, db, keys, id)
+	if err != nil {
+		return nil, err
+	}
+	if taken {
+		return nil, epublib.ErrPublisherNameTaken
+	}
+	tag, err := db.Exec(
+		ctx,
+		`UPDATE publisher SET name = $1, sort_name = $2, aliases = $3, name_keys = $4, match_key = $5, description = $6,
+		website = $7, version = version + 1, updated_at = current_timestamp
+		WHERE id = $8 AND deleted_at IS NULL AND ($9 = 0 OR version = $9)`,
+		upd.Name,
+		upd.SortName,
+		aliases,
+		keys,
+		epublib.PublisherMatchKey(upd.Name),
+		upd.Description,
+		upd.Website,
+		id,
+		upd.Version,
+	)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	if tag.RowsAffected() == 0 {
+		return nil, svc.missingOrConflict(ctx, id)
+	}
+
+	// Retrieve the updated publisher for response.
+	return svc.FindPublisherByID(ctx, id)
+}
+
+func (svc *PublisherService) DeletePublisher(ctx context.Context, id string, version int) error {
+	db := svc.db
+	if tx := epublib.TxFromContext(ctx); tx != nil {
+		db = tx
+	}
+	tag, err := db.Exec(
+		ctx,
+		"UPDATE publisher SET deleted_at = current_timestamp, version = version + 1, updated_at = current_timestamp WHERE id = $1 AND deleted_at IS NULL AND ($2 = 0 OR version = $2)",
+		id,
+		version,
+	)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return svc.missingOrConflict(ctx, id)
+	}
+	if _, err := db.Exec(ctx, "UPDATE book SET publisher_id = NULL WHERE publisher_id = $1", id); err != nil {
+		log.Println(err)
+		return err
+	}
+	return nil
+}
+
+// missingOrConflict tells apart why a versioned write touched no rows: the
+// publisher either does not exist or has been modified since it was read.
+func (svc *PublisherService) missingOrConflict(ctx context.Context, id string) error {
+	if _, err := svc.FindPublisherByID(ctx, id); err != nil {
+		return err
+	}
+	return epublib.ErrConflict
+}
+
+func (svc *PublisherService) SetPublisherLogo(ctx context.Context, id, logoKey string) (*epublib.Publisher, error) {
+	db := svc.db
+	if tx := epublib.TxFromContext(ctx); tx != nil {
+		db = tx
+	}
+	tag, err := db.Exec(
+		ctx,
+		"UPDATE publisher SET logo_key = $1, version = version + 1, updated_at = current_timestamp WHERE id = $2 AND deleted_at IS NULL",
+		logoKey,
+		id,
+	)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	if tag.RowsAffected() == 0 {
+		return nil, epublib.ErrNotFound
+	}
+	return svc.FindPublisherByID(ctx, id)
+}
+
+func (svc *PublisherService) MergePublishers(ctx context.Context, id string, otherIDs []string) (*epublib.Publisher, error) {
+	db := svc.db
+	if tx := epublib.TxFromContext(ctx); tx != nil {
+		db = tx
+	}
+	publisher, err := svc.FindPublisherByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Delete the other publishers, keeping their names
+	others, err := svc.queryPublishers(
+		ctx,
+		db,
+		`UPDATE publisher SET deleted_at = current_timestamp, version = version + 1, updated_at = current_timestamp
+		WHERE id = ANY($1) AND id <> $2 AND deleted_at IS NULL RETURNING `+publisherColumns,
+		otherIDs,
+		id,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if len(others) == 0 || len(others) != len(distinctIDs(otherIDs, id)) {
+		return nil, epublib.ErrNotFound
+	}
+	names := []string{}
+	for _, other := range others {
+		names = append(names, other.Name)
+		names = append(names, other.Aliases...)
+	}
+
+	// Move their books
+	if _, err := db.Exec(ctx, "UPDATE book SET publisher_id = $1 WHERE publisher_id = ANY($2)", id, otherIDs); err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	aliases := mergeAliases(epublib.PublisherNameKey, publisher.Name, publisher.Aliases, names)
+	_, err = db.Exec(
+		ctx,
+		"UPDATE publisher SET aliases = $1, name_keys = $2, version = version + 1, updated_at = current_timestamp WHERE id = $3",
+		aliases,
+		nameKeys(epublib.PublisherNameKey, publisher.Name, aliases),
+		id,
+	)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	return svc.FindPublisherByID(ctx, id)
+}
+
+func (svc *PublisherService) FindDuplicatePublishers(ctx context.Context) ([][]*epublib.Publisher, error) {
+	db := svc.db
+	if tx := epublib.TxFromContext(ctx); tx != nil {
+		db = tx
+	}
+	publishers, err := svc.queryPublishers(
+		ctx,
+		db,
+		`SELECT `+publisherColumns+` FROM publisher WHERE deleted_at IS NULL AND match_key IN (
+			SELECT match_key FROM publisher WHERE deleted_at IS NULL AND match_key <> '' GROUP BY match_key HAVING COUNT(*) > 1
+		) ORDER BY match_key, lower(sort_name), id`,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// Rows come ordered by match key, so each group is a run
+	groups := [][]*epublib.Publisher{}
+	for i, publisher := range publishers {
+		if i == 0 || epublib.PublisherMatchKey(publisher.Name) != epublib.PublisherMatchKey(publishers[i-1].Name) {
+			groups = append(groups, nil)
+		}
+		groups[len(groups)-1] = append(groups[len(groups)-1], publisher)
+	}
+	return groups, nil
+}
+
+func (svc *PublisherService) LinkBookPublisher(ctx context.Context, bookID, name string) error {
+	db := svc.db
+	if tx := epublib.TxFromContext(ctx); tx != nil {
+		db = tx
+	}
+	key := epublib.PublisherNameKey(name)
+	if key == "" {
+		if _, err := db.Exec(ctx, "UPDATE book SET publisher_id = NULL WHERE id = $1", bookID); err != nil {
+			log.Println(err)
+			return err
+		}
+		return nil
+	}
+
+	// Link to the oldest publisher with a matching name or alias, or to a
+	// new one
+	var publisherID string
+	err := db.QueryRow(
+		ctx,
+		"SELECT id FROM publisher WHERE name_keys @> ARRAY[$1::text] AND deleted_at IS NULL ORDER BY created_at, id LIMIT 1",
+		key,
+	).Scan(&publisherID)
+	if err == pgx.ErrNoRows {
+		publisher := &epublib.Publisher{Name: strings.TrimSpace(name)}
+		publisher.SortName = epublib.PublisherSortName(publisher.Name)
+		err = svc.CreatePublisher(ctx, publisher)
+		publisherID = publisher.ID
+	}
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	if _, err := db.Exec(ctx, "UPDATE book SET publisher_id = $1 WHERE id = $2", publisherID, bookID); err != nil {
+		log.Println(err)
+		return err
+	}
+	return nil
+}
@@ -16,6 +16,7 @@ import (
 
 type ResetToken struct {
 	ID        string       `json:"id"`
+	UserID    string       `json:"user_id"`
 	Token     string       `json:"token"`
 	Used      bool         `json:"used"`
 	CreatedAt sql.NullTime `json:"created_at"`
@@ -26,6 +27,7 @@ type ResetToken struct {
 func (r *ResetToken) toEpublibResetToken() *epublib.ResetToken {
 	return &epublib.ResetToken{
 		ID:        r.ID,
+		UserID:    r.UserID,
 		Token:     r.Token,
 		Used:      r.Used,
 		CreatedAt: r.CreatedAt.Time,
@@ -34,6 +36,9 @@ func (r *ResetToken) toEpublibResetToken() *epublib.ResetToken {
 	}
 }
 
+// resetTokenLifetime is how long a generated Reset Token stays valid.
+const resetTokenLifetime = 24 * time.Hour
+
 // ResetTokenService represents a service for managing reset tokens.
 type ResetTokenService struct {
 	db epublib.Conn
@@ -47,8 +52,8 @@ func NewResetTokenService(db *pgxpool.Pool) *ResetTokenService {
 // Generates new Reset Token based on auth.
 func (r *ResetTokenService) GenerateResetToken(ctx context.Context, auth *epublib.Auth) (*epublib.ResetToken, error) {
 	var err error
-	token := &ResetToken{}
-	token.Token, err = createJWT(auth, 24*time.Hour)
+	token := &ResetToken{UserID: auth.UserID}
+	token.Token, err = createJWT(auth, resetTokenLifetime)
 	if err != nil {
 		log.Println(err)
 		return nil, err
@@ -59,8 +64,9 @@ func (r *ResetTokenService) GenerateResetToken(ctx context.Context, auth *epubli
 	}
 	err = db.QueryRow(
 		ctx,
-		"INSERT INTO reset_token (token) VALUES ($1) RETURNING id",
+		"INSERT INTO reset_token (token, user_id) VALUES ($1, $2) RETURNING id",
 		token.Token,
+		token.UserID,
 	).Scan(&token.ID)
 	if err != nil {
 		if err == pgx.ErrNoRows {
@@ -81,7 +87,7 @@ func (r *ResetTokenService) ValidateResetToken(ctx context.Context, id, token st
 	used := false
 	err := db.QueryRow(
 		ctx,
-		"SELECT used FROM reset_token WHERE id = $1 AND token = $2",
+		"SELECT used FROM reset_token WHERE id = $1 AND token = $2 AND deleted_at IS NULL",
 		id,
 		token,
 	).Scan(&used)
@@ -103,7 +109,7 @@ func (r *ResetTokenService) UseResetToken(ctx context.Context, id string, token
 	}
 	_, err := db.Exec(
 		ctx,
-		"UPDATE reset_token SET used = true WHERE id = $1",
+		"UPDATE reset_token SET used = true, updated_at = current_timestamp WHERE id = $1",
 		id,
 	)
 	if err != nil {
@@ -125,6 +131,38 @@ func (r *ResetTokenService) UseResetToken(ctx context.Context, id string, token
 	return &claims.Auth, nil
 }
 
+// Soft deletes used and expired Reset Tokens.
+func (r *ResetTokenService) ExpireResetTokens(ctx context.Context) (int64, error) {
+	db := r.db
+	if tx := epublib.TxFromContext(ctx); tx != nil {
+		db = tx
+	}
+	tag, err := db.Exec(
+		ctx,
+		"UPDATE reset_token SET deleted_at = current_timestamp, updated_at = current_timestamp WHERE deleted_at IS NULL AND (used OR created_at < $1)",
+		time.Now().Add(-resetTokenLifetime),
+	)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// Permanently deletes Reset Tokens soft deleted before t.
+func (r *ResetTokenService) PurgeResetTokens(ctx context.Context, t time.Time) (int64, error) {
+	db := r.db
+	if tx := epublib.TxFromContext(ctx); tx != nil {
+		db = tx
+	}
+	tag, err := db.Exec(ctx, "DELETE FROM reset_token WHERE deleted_at < $1", t)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
 type ResetTokenClaims struct {
 	jwt.RegisteredClaims
 	Auth epublib.Auth `json:"auth"`
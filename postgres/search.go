@@ -0,0 +1,235 @@
+package postgres
+
+import (
+	"context"
+	epublib "epublib"
+	"fmt"
+	"html"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// textSearchConfigs maps the primary subtag of a book language to the
+// Postgres text search configuration with its stemming rules. Other
+// languages use the simple configuration, which only lowercases.
+var textSearchConfigs = map[string]string{
+	"ar": "arabic",
+	"da": "danish",
+	"de": "german",
+	"el": "greek",
+	"en": "english",
+	"es": "spanish",
+	"fi": "finnish",
+	"fr": "french",
+	"hu": "hungarian",
+	"id": "indonesian",
+	"it": "italian",
+	"nb": "norwegian",
+	"nl": "dutch",
+	"nn": "norwegian",
+	"no": "norwegian",
+	"pt": "portuguese",
+	"ro": "romanian",
+	"ru": "russian",
+	"sv": "swedish",
+	"tr": "turkish",
+}
+
+// textSearchConfig returns the text search configuration for a language
+// tag.
+func textSearchConfig(language string) string {
+	primary := strings.ToLower(strings.SplitN(language, "-", 2)[0])
+	if config, ok := textSearchConfigs[primary]; ok {
+		return config
+	}
+	return "simple"
+}
+
+// searchMatch matches the indexed passages against the query in $1 with the
+// configuration each was indexed with. Spelling out every configuration,
+// rather than passing the column to websearch_to_tsquery, keeps the GIN
+// index usable.
+var searchMatch = func() string {
+	seen := map[string]bool{"simple": true}
+	configs := []string{"simple"}
+	for _, config := range textSearchConfigs {
+		if !seen[config] {
+			seen[config] = true
+			configs = append(configs, config)
+		}
+	}
+	sort.Strings(configs)
+	conditions := make([]string, len(configs))
+	for i, config := range configs {
+		conditions[i] = fmt.Sprintf("(t.config = '%s'::regconfig AND t.tsv @@ websearch_to_tsquery('%s', $1))", config, config)
+	}
+	return "(" + strings.Join(conditions, " OR ") + ")"
+}()
+
+// Snippet highlighting uses control characters that cannot occur in the
+// indexed text, so the snippet can be escaped before marking the matches.
+const (
+	snippetStart   = "\x02"
+	snippetStop    = "\x03"
+	snippetOptions = "StartSel=" + snippetStart + ", StopSel=" + snippetStop + ", MinWords=15, MaxWords=35, MaxFragments=2, FragmentDelimiter=\" … \""
+)
+
+// SearchService represents a service for full-text search in book content.
+type SearchService struct {
+	db epublib.Conn
+}
+
+// NewSearchService returns a new instance of SearchService attached to DB.
+func NewSearchService(db *pgxpool.Pool) *SearchService {
+	return &SearchService{db: db}
+}
+
+func (svc *SearchService) IndexBookText(ctx context.Context, bookID, language string, passages []epublib.TextPassage) error {
+	db := svc.db
+	if tx := epublib.TxFromContext(ctx); tx != nil {
+		db = tx
+	}
+	if _, err := db.Exec(ctx, "DELETE FROM book_text WHERE book_id = $1", bookID); err != nil {
+		log.Println(err)
+		return err
+	}
+	if len(passages) == 0 {
+		return nil
+	}
+	positions := make([]int, len(passages))
+	spineIndexes := make([]int, len(passages))
+	paths := make([]string, len(passages))
+	fragments := make([]string, len(passages))
+	contents := make([]string, len(passages))
+	for i, p := range passages {
+		positions[i] = p.Position
+		spineIndexes[i] = p.SpineIndex
+		paths[i] = p.Path
+		fragments[i] = p.Fragment
+		contents[i] = strings.NewReplacer(snippetStart, "", snippetStop, "").Replace(p.Text)
+	}
+	_, err := db.Exec(
+		ctx,
+		`INSERT INTO book_text (book_id, position, spine_index, path, fragment, content, config, tsv)
+		SELECT $1, p.position, p.spine_index, p.path, p.fragment, p.content, $2::regconfig, to_tsvector($2::regconfig, p.content)
+		FROM unnest($3::int[], $4::int[], $5::text[], $6::text[], $7::text[]) AS p (position, spine_index, path, fragment, content)`,
+		bookID,
+		textSearchConfig(language),
+		positions,
+		spineIndexes,
+		paths,
+		fragments,
+		contents,
+	)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	return nil
+}
+
+func (svc *SearchService) SetBookTextLanguage(ctx context.Context, bookID, language string) error {
+	db := svc.db
+	if tx := epublib.TxFromContext(ctx); tx != nil {
+		db = tx
+	}
+	_, err := db.Exec(
+		ctx,
+		"UPDATE book_text SET config = $2::regconfig, tsv = to_tsvector($2::regconfig, content) WHERE book_id = $1 AND config <> $2::regconfig",
+		bookID,
+		textSearchConfig(language),
+	)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	return nil
+}
+
+func (svc *SearchService) Search(ctx context.Context, filter epublib.SearchFilter) ([]*epublib.SearchHit, int, error) {
+	db := svc.db
+	if tx := epublib.TxFromContext(ctx); tx != nil {
+		db = tx
+	}
+	if filter.Limit <= 0 {
+		filter.Limit = 10
+	}
+	if filter.Limit > epublib.MaxSearchPageSize {
+		filter.Limit = epublib.MaxSearchPageSize
+	}
+
+	// Build the SQL query based on the filter criteria.
+	args := []interface{}{filter.Query}
+	filterQuery := " FROM book_text t JOIN book b ON b.id = t.book_id WHERE b.deleted_at IS NULL AND " + searchMatch
+	if filter.BookID != "" {
+		args = append(args, filter.BookID)
+		filterQuery += fmt.Sprintf(" AND t.book_id = $%d", len(args))
+	}
+	if filter.Language != "" {
+		args = append(args, filter.Language)
+		filterQuery += fmt.Sprintf(" AND lower(b.language) = lower($%d)", len(args))
+	}
+	if len(filter.Statuses) > 0 {
+		statuses := make([]string, len(filter.Statuses))
+		for i, status := range filter.Statuses {
+			statuses[i] = string(status)
+		}
+		args = append(args, statuses)
+		filterQuery += fmt.Sprintf(" AND b.status::text = ANY($%d)", len(args))
+	}
+
+	// Count the total number of matching passages.
+	var totalCount int
+	err := db.QueryRow(ctx, "SELECT COUNT(*)"+filterQuery, args...).Scan(&totalCount)
+	if err != nil {
+		log.Println(err)
+		return nil, 0, err
+	}
+
+	// Hits within a book are listed in reading order, across books by rank.
+	order := " ORDER BY rank DESC, lower(b.title), t.book_id, t.position"
+	if filter.BookID != "" {
+		order = " ORDER BY t.position"
+	}
+	args = append(args, snippetOptions)
+	query := fmt.Sprintf(
+		`SELECT t.book_id, b.title, t.spine_index, t.path, t.fragment, t.position,
+		ts_headline(t.config, t.content, websearch_to_tsquery(t.config, $1), $%d),
+		ts_rank(t.tsv, websearch_to_tsquery(t.config, $1)) AS rank`,
+		len(args),
+	) + filterQuery + order + fmt.Sprintf(" OFFSET %d LIMIT %d", filter.Offset, filter.Limit)
+	rows, err := db.Query(ctx, query, args...)
+	if err != nil {
+		log.Println(err)
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	hits := []*epublib.SearchHit{}
+	for rows.Next() {
+		hit := &epublib.SearchHit{}
+		var rank float32
+		err := rows.Scan(&hit.BookID, &hit.BookTitle, &hit.SpineIndex, &hit.Path, &hit.Fragment, &hit.Position, &hit.Snippet, &rank)
+		if err != nil {
+			log.Println(err)
+			return nil, 0, err
+		}
+		hit.Rank = float64(rank)
+		hit.Snippet = markSnippet(hit.Snippet)
+		hits = append(hits, hit)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println(err)
+		return nil, 0, err
+	}
+	return hits, totalCount, nil
+}
+
+// markSnippet escapes a headline and turns its match delimiters into mark
+// elements.
+func markSnippet(headline string) string {
+	return strings.NewReplacer(snippetStart, "<mark>", snippetStop, "</mark>").Replace(html.EscapeString(headline))
+}
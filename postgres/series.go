@@ -0,0 +1,306 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	epublib "epublib"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+type Series struct {
+	ID          string       `json:"id"`
+	Name        string       `json:"name"`
+	Description string       `json:"description"`
+	Version     int          `json:"version"`
+	CreatedAt   sql.NullTime `json:"created_at"`
+	UpdatedAt   sql.NullTime `json:"updated_at"`
+	DeletedAt   sql.NullTime `json:"deleted_at"`
+}
+
+func (s *Series) toEpublibSeries() *epublib.Series {
+	return &epublib.Series{
+		ID:          s.ID,
+		Name:        s.Name,
+		Description: s.Description,
+		Version:     s.Version,
+		CreatedAt:   s.CreatedAt.Time,
+		UpdatedAt:   s.UpdatedAt.Time,
+		DeletedAt:   s.DeletedAt.Time,
+	}
+}
+
+// seriesColumns lists the series columns in the order expected by
+// scanSeries.
+const seriesColumns = "id, name, description, version, created_at, updated_at, deleted_at"
+
+// scanSeries scans a single row selected with seriesColumns.
+func scanSeries(row pgx.Row) (*epublib.Series, error) {
+	s := &Series{}
+	err := row.Scan(&s.ID, &s.Name, &s.Description, &s.Version, &s.CreatedAt, &s.UpdatedAt, &s.DeletedAt)
+	if err != nil {
+		return nil, err
+	}
+	return s.toEpublibSeries(), nil
+}
+
+// SeriesService represents a service for managing series.
+type SeriesService struct {
+	db epublib.Conn
+}
+
+// NewSeriesService returns a new instance of SeriesService attached to DB.
+func NewSeriesService(db *pgxpool.Pool) *SeriesService {
+	return &SeriesService{db: db}
+}
+
+func (svc *SeriesService) FindSeriesByID(ctx context.Context, id string) (*epublib.Series, error) {
+	db := svc.db
+	if tx := epublib.TxFromContext(ctx); tx != nil {
+		db = tx
+	}
+	series, err := scanSeries(db.QueryRow(ctx, "SELECT "+seriesColumns+" FROM series WHERE id = $1 AND deleted_at IS NULL", id))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, epublib.ErrNotFound
+		}
+		log.Println(err)
+		return nil, err
+	}
+	return series, nil
+}
+
+func (svc *SeriesService) FindSeries(ctx context.Context, filter epublib.SeriesFilter) ([]*epublib.Series, int, error) {
+	db := svc.db
+	if tx := epublib.TxFromContext(ctx); tx != nil {
+		db = tx
+	}
+	if filter.Limit <= 0 {
+		filter.Limit = 10
+	}
+	if filter.Limit > epublib.MaxSeriesPageSize {
+		filter.Limit = epublib.MaxSeriesPageSize
+	}
+
+	// Build the SQL query based on the filter criteria.
+	filterQuery := " WHERE deleted_at IS NULL"
+	args := []interface{}{}
+	if filter.Name != "" {
+		args = append(args, "%"+escapeLike(filter.Name)+"%")
+		filterQuery += fmt.Sprintf(" AND name ILIKE $%d", len(args))
+	}
+
+	// Count the total number of matching series.
+	var totalCount int
+	err := db.QueryRow(ctx, "SELECT COUNT(*) FROM series"+filterQuery, args...).Scan(&totalCount)
+	if err != nil {
+		log.Println(err)
+		return nil, 0, err
+	}
+
+	query := "SELECT " + seriesColumns + " FROM series" + filterQuery + fmt.Sprintf(" ORDER BY lower(name), id OFFSET %d LIMIT %d", filter.Offset, filter.Limit)
+	rows, err := db.Query(ctx, query, args...)
+	if err != nil {
+		log.Println(err)
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	list := []*epublib.Series{}
+	for rows.Next() {
+		series, err := scanSeries(rows)
+		if err != nil {
+			log.Println(err)
+			return nil, 0, err
+		}
+		list = append(list, series)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println(err)
+		return nil, 0, err
+	}
+	return list, totalCount, nil
+}
+
+// nameTaken reports whether key is the name key of another series than the
+// one with the given ID.
+func (svc *SeriesService) nameTaken(ctx context.Context, db epublib.Conn, key, id string) (bool, error) {
+	var taken bool
+	err := db.QueryRow(
+		ctx,
+		"SELECT EXISTS (SELECT 1 FROM series WHERE name_key = $1 AND id::text <> $2 AND deleted_at IS NULL)",
+		key,
+		id,
+	).Scan(&taken)
+	if err != nil {
+		log.Println(err)
+	}
+	return taken, err
+}
+
+func (svc *SeriesService) CreateSeries(ctx context.Context, series *epublib.Series) error {
+	db := svc.db
+	if tx := epublib.TxFromContext(ctx); tx != nil {
+		db = tx
+	}
+	key := epublib.SeriesNameKey(series.Name)
+	taken, err := svc.nameTaken(ctx, db, key, "")
+	if err != nil {
+		return err
+	}
+	if taken {
+		return epublib.ErrSeriesNameTaken
+	}
+	err = db.QueryRow(
+		ctx,
+		"INSERT INTO series (name, name_key, description) VALUES ($1, $2, $3) RETURNING id, version, created_at, updated_at",
+		series.Name,
+		key,
+		series.Description,
+	).Scan(&series.ID, &series.Version, &series.CreatedAt, &series.UpdatedAt)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	return nil
+}
+
+func (svc *SeriesService) UpdateSeries(ctx context.Context, id string, upd epublib.SeriesUpdate) (*epublib.Series, error) {
+	db := svc.db
+	if tx := epublib.TxFromContext(ctx); tx != nil {
+		db = tx
+	}
+	key := epublib.SeriesNameKey(upd.Name)
+	taken, err := svc.nameTaken(ctx, db, key, id)
+	if err != nil {
+		return nil, err
+	}
+	if taken {
+		return nil, epublib.ErrSeriesNameTaken
+	}
+	tag, err := db.Exec(
+		ctx,
+		`UPDATE series SET name = $1, name_key = $2, description = $3, version = version + 1, updated_at = current_timestamp
+		WHERE id = $4 AND deleted_at IS NULL AND ($5 = 0 OR version = $5)`,
+		upd.Name,
+		key,
+		upd.Description,
+		id,
+		upd.Version,
+	)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	if tag.RowsAffected() == 0 {
+		return nil, svc.missingOrConflict(ctx, id)
+	}
+
+	// Retrieve the updated series for response.
+	return svc.FindSeriesByID(ctx, id)
+}
+
+func (svc *SeriesService) DeleteSeries(ctx context.Context, id string, version int) error {
+	db := svc.db
+	if tx := epublib.TxFromContext(ctx); tx != nil {
+		db = tx
+	}
+	tag, err := db.Exec(
+		ctx,
+		"UPDATE series SET deleted_at = current_timestamp, version = version + 1, updated_at = current_timestamp WHERE id = $1 AND deleted_at IS NULL AND ($2 = 0 OR version = $2)",
+		id,
+		version,
+	)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return svc.missingOrConflict(ctx, id)
+	}
+	_, err = db.Exec(
+		ctx,
+		"UPDATE book SET series_id = NULL, series_position = 0, version = version + 1, updated_at = current_timestamp WHERE series_id = $1",
+		id,
+	)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	return nil
+}
+
+// missingOrConflict tells apart why a versioned write touched no rows: the
+// series either does not exist or has been modified since it was read.
+func (svc *SeriesService) missingOrConflict(ctx context.Context, id string) error {
+	if _, err := svc.FindSeriesByID(ctx, id); err != nil {
+		return err
+	}
+	return epublib.ErrConflict
+}
+
+func (svc *SeriesService) LinkBookSeries(ctx context.Context, bookID, name string, position float64) error {
+	db := svc.db
+	if tx := epublib.TxFromContext(ctx); tx != nil {
+		db = tx
+	}
+	key := epublib.SeriesNameKey(name)
+	if key == "" {
+		return nil
+	}
+
+	// Place the book in the oldest series with a matching name, or in a new
+	// one
+	var seriesID string
+	err := db.QueryRow(
+		ctx,
+		"SELECT id FROM series WHERE name_key = $1 AND deleted_at IS NULL ORDER BY created_at, id LIMIT 1",
+		key,
+	).Scan(&seriesID)
+	if err == pgx.ErrNoRows {
+		series := &epublib.Series{Name: strings.TrimSpace(name)}
+		err = svc.CreateSeries(ctx, series)
+		seriesID = series.ID
+	}
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	if _, err := db.Exec(ctx, "UPDATE book SET series_id = $1, series_position = $2 WHERE id = $3", seriesID, position, bookID); err != nil {
+		log.Println(err)
+		return err
+	}
+	return nil
+}
+
+func (svc *SeriesService) FindNextInSeries(ctx context.Context, seriesID string, position float64, statuses []epublib.BookStatus) (*epublib.Book, error) {
+	db := svc.db
+	if tx := epublib.TxFromContext(ctx); tx != nil {
+		db = tx
+	}
+	names := make([]string, len(statuses))
+	for i, status := range statuses {
+		names[i] = string(status)
+	}
+	book, err := scanBook(db.QueryRow(
+		ctx,
+		`SELECT `+bookColumns+` FROM book WHERE series_id = $1 AND series_position > $2 AND deleted_at IS NULL
+		AND (cardinality($3::text[]) = 0 OR status::text = ANY($3))
+		ORDER BY series_position, lower(title), id LIMIT 1`,
+		seriesID,
+		position,
+		names,
+	))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, epublib.ErrNotFound
+		}
+		log.Println(err)
+		return nil, err
+	}
+	return book, nil
+}
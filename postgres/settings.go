@@ -0,0 +1,113 @@
+package postgres
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	epublib "epublib"
+	"log"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// SettingsService represents a service for managing user settings.
+type SettingsService struct {
+	db epublib.Conn
+}
+
+// NewSettingsService returns a new instance of SettingsService attached to DB.
+func NewSettingsService(db *pgxpool.Pool) *SettingsService {
+	return &SettingsService{db: db}
+}
+
+func (svc *SettingsService) FindUserSettings(ctx context.Context, userID string) (map[string]interface{}, error) {
+	return svc.findSettings(ctx, "SELECT key, value FROM user_setting WHERE user_id = $1", userID)
+}
+
+func (svc *SettingsService) UpdateUserSettings(ctx context.Context, userID string, values map[string]interface{}) error {
+	return svc.updateSettings(
+		ctx,
+		values,
+		`INSERT INTO user_setting (user_id, key, value) VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, key) DO UPDATE SET value = EXCLUDED.value, updated_at = current_timestamp`,
+		"DELETE FROM user_setting WHERE user_id = $1 AND key = $2",
+		userID,
+	)
+}
+
+func (svc *SettingsService) FindSettingDefaults(ctx context.Context) (map[string]interface{}, error) {
+	return svc.findSettings(ctx, "SELECT key, value FROM setting_default")
+}
+
+func (svc *SettingsService) UpdateSettingDefaults(ctx context.Context, values map[string]interface{}) error {
+	return svc.updateSettings(
+		ctx,
+		values,
+		`INSERT INTO setting_default (key, value) VALUES ($1, $2)
+		ON CONFLICT (tenant_id, key) DO UPDATE SET value = EXCLUDED.value, updated_at = current_timestamp`,
+		"DELETE FROM setting_default WHERE key = $1",
+	)
+}
+
+// findSettings runs a query selecting key and value columns into a map.
+func (svc *SettingsService) findSettings(ctx context.Context, query string, args ...interface{}) (map[string]interface{}, error) {
+	db := svc.db
+	if tx := epublib.TxFromContext(ctx); tx != nil {
+		db = tx
+	}
+	rows, err := db.Query(ctx, query, args...)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	values := map[string]interface{}{}
+	for rows.Next() {
+		var key string
+		var raw []byte
+		if err := rows.Scan(&key, &raw); err != nil {
+			log.Println(err)
+			return nil, err
+		}
+		var value interface{}
+		decoder := json.NewDecoder(bytes.NewReader(raw))
+		decoder.UseNumber()
+		if err := decoder.Decode(&value); err != nil {
+			log.Println(err)
+			return nil, err
+		}
+		values[key] = value
+	}
+	if err := rows.Err(); err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	return values, nil
+}
+
+// updateSettings upserts non-nil values and deletes nil ones. The owner
+// arguments are passed ahead of the key and value placeholders.
+func (svc *SettingsService) updateSettings(ctx context.Context, values map[string]interface{}, upsert, remove string, owner ...interface{}) error {
+	db := svc.db
+	if tx := epublib.TxFromContext(ctx); tx != nil {
+		db = tx
+	}
+	for key, value := range values {
+		args := append(append([]interface{}{}, owner...), key)
+		query := remove
+		if value != nil {
+			raw, err := json.Marshal(value)
+			if err != nil {
+				return err
+			}
+			args = append(args, raw)
+			query = upsert
+		}
+		if _, err := db.Exec(ctx, query, args...); err != nil {
+			log.Println(err)
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,264 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	epublib "epublib"
+	"log"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+type Tenant struct {
+	ID        string       `json:"id"`
+	Slug      string       `json:"slug"`
+	Name      string       `json:"name"`
+	Hosts     []string     `json:"hosts"`
+	Branding  []byte       `json:"branding"`
+	Config    []byte       `json:"config"`
+	Version   int          `json:"version"`
+	CreatedAt sql.NullTime `json:"created_at"`
+	UpdatedAt sql.NullTime `json:"updated_at"`
+	DeletedAt sql.NullTime `json:"deleted_at"`
+}
+
+func (t *Tenant) toEpublibTenant() (*epublib.Tenant, error) {
+	tenant := &epublib.Tenant{
+		ID:        t.ID,
+		Slug:      t.Slug,
+		Name:      t.Name,
+		Hosts:     t.Hosts,
+		Version:   t.Version,
+		CreatedAt: t.CreatedAt.Time,
+		UpdatedAt: t.UpdatedAt.Time,
+		DeletedAt: t.DeletedAt.Time,
+	}
+	if err := json.Unmarshal(t.Branding, &tenant.Branding); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(t.Config, &tenant.Config); err != nil {
+		return nil, err
+	}
+	return tenant, nil
+}
+
+// tenantColumns lists the tenant columns in the order expected by scanTenant.
+const tenantColumns = "id, slug, name, hosts, branding, config, version, created_at, updated_at, deleted_at"
+
+func scanTenant(row pgx.Row) (*epublib.Tenant, error) {
+	t := &Tenant{}
+	err := row.Scan(
+		&t.ID,
+		&t.Slug,
+		&t.Name,
+		&t.Hosts,
+		&t.Branding,
+		&t.Config,
+		&t.Version,
+		&t.CreatedAt,
+		&t.UpdatedAt,
+		&t.DeletedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return t.toEpublibTenant()
+}
+
+// TenantService represents a service for managing tenants.
+type TenantService struct {
+	db epublib.Conn
+}
+
+// NewTenantService returns a new instance of TenantService attached to DB.
+func NewTenantService(db *pgxpool.Pool) *TenantService {
+	return &TenantService{db: db}
+}
+
+func (svc *TenantService) FindTenantByID(ctx context.Context, id string) (*epublib.Tenant, error) {
+	return svc.findTenant(ctx, "id = $1", id)
+}
+
+func (svc *TenantService) FindTenantBySlug(ctx context.Context, slug string) (*epublib.Tenant, error) {
+	return svc.findTenant(ctx, "slug = $1", slug)
+}
+
+func (svc *TenantService) FindTenantByHost(ctx context.Context, host string) (*epublib.Tenant, error) {
+	return svc.findTenant(ctx, "$1 = ANY(hosts)", host)
+}
+
+func (svc *TenantService) findTenant(ctx context.Context, where string, args ...interface{}) (*epublib.Tenant, error) {
+	db := svc.db
+	if tx := epublib.TxFromContext(ctx); tx != nil {
+		db = tx
+	}
+	tenant, err := scanTenant(db.QueryRow(ctx, "SELECT "+tenantColumns+" FROM tenant WHERE deleted_at IS NULL AND "+where, args...))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, epublib.ErrNotFound
+		}
+		log.Println(err)
+		return nil, err
+	}
+	return tenant, nil
+}
+
+func (svc *TenantService) FindTenants(ctx context.Context) ([]*epublib.Tenant, error) {
+	db := svc.db
+	if tx := epublib.TxFromContext(ctx); tx != nil {
+		db = tx
+	}
+	rows, err := db.Query(ctx, "SELECT "+tenantColumns+" FROM tenant WHERE deleted_at IS NULL ORDER BY slug")
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tenants []*epublib.Tenant
+	for rows.Next() {
+		tenant, err := scanTenant(rows)
+		if err != nil {
+			log.Println(err)
+			return nil, err
+		}
+		tenants = append(tenants, tenant)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	return tenants, nil
+}
+
+func (svc *TenantService) CreateTenant(ctx context.Context, tenant *epublib.Tenant) error {
+	db := svc.db
+	if tx := epublib.TxFromContext(ctx); tx != nil {
+		db = tx
+	}
+	if tenant.Hosts == nil {
+		tenant.Hosts = []string{}
+	}
+	if err := svc.checkTenantTaken(ctx, db, tenant.ID, tenant.Slug, tenant.Hosts); err != nil {
+		return err
+	}
+	branding, config, err := marshalTenantSettings(tenant.Branding, tenant.Config)
+	if err != nil {
+		return err
+	}
+	err = db.QueryRow(
+		ctx,
+		`INSERT INTO tenant (id, slug, name, hosts, branding, config) VALUES (COALESCE(NULLIF($1, '')::uuid, gen_random_uuid()), $2, $3, $4, $5, $6)
+		RETURNING id, version, created_at, updated_at`,
+		tenant.ID,
+		tenant.Slug,
+		tenant.Name,
+		tenant.Hosts,
+		branding,
+		config,
+	).Scan(&tenant.ID, &tenant.Version, &tenant.CreatedAt, &tenant.UpdatedAt)
+	if err != nil {
+		if isUniqueViolation(err, "tenant_slug_idx") {
+			return epublib.ErrTenantTaken
+		}
+		log.Println(err)
+		return err
+	}
+	return nil
+}
+
+func (svc *TenantService) UpdateTenant(ctx context.Context, id string, upd epublib.TenantUpdate) (*epublib.Tenant, error) {
+	db := svc.db
+	if tx := epublib.TxFromContext(ctx); tx != nil {
+		db = tx
+	}
+	if upd.Hosts == nil {
+		upd.Hosts = []string{}
+	}
+	if err := svc.checkTenantTaken(ctx, db, id, upd.Slug, upd.Hosts); err != nil {
+		return nil, err
+	}
+	branding, config, err := marshalTenantSettings(upd.Branding, upd.Config)
+	if err != nil {
+		return nil, err
+	}
+	tag, err := db.Exec(
+		ctx,
+		`UPDATE tenant SET slug = $1, name = $2, hosts = $3, branding = $4, config = $5, version = version + 1, updated_at = current_timestamp
+		WHERE id = $6 AND deleted_at IS NULL AND ($7 = 0 OR version = $7)`,
+		upd.Slug,
+		upd.Name,
+		upd.Hosts,
+		branding,
+		config,
+		id,
+		upd.Version,
+	)
+	if err != nil {
+		if isUniqueViolation(err, "tenant_slug_idx") {
+			return nil, epublib.ErrTenantTaken
+		}
+		log.Println(err)
+		return nil, err
+	}
+	if tag.RowsAffected() == 0 {
+		if _, err := svc.FindTenantByID(ctx, id); err != nil {
+			return nil, err
+		}
+		return nil, epublib.ErrConflict
+	}
+
+	// Retrieve the updated tenant for response.
+	return svc.FindTenantByID(ctx, id)
+}
+
+func (svc *TenantService) DeleteTenant(ctx context.Context, id string) error {
+	db := svc.db
+	if tx := epublib.TxFromContext(ctx); tx != nil {
+		db = tx
+	}
+	tag, err := db.Exec(ctx, "UPDATE tenant SET deleted_at = current_timestamp, version = version + 1, updated_at = current_timestamp WHERE id = $1 AND deleted_at IS NULL", id)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return epublib.ErrNotFound
+	}
+	return nil
+}
+
+// checkTenantTaken returns ErrTenantTaken if another tenant than id already
+// uses slug or serves one of hosts.
+func (svc *TenantService) checkTenantTaken(ctx context.Context, db epublib.Conn, id, slug string, hosts []string) error {
+	var taken bool
+	err := db.QueryRow(
+		ctx,
+		"SELECT EXISTS (SELECT 1 FROM tenant WHERE id::text <> $1 AND (slug = $2 OR (deleted_at IS NULL AND hosts && $3)))",
+		id,
+		slug,
+		hosts,
+	).Scan(&taken)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	if taken {
+		return epublib.ErrTenantTaken
+	}
+	return nil
+}
+
+func marshalTenantSettings(branding epublib.TenantBranding, config epublib.TenantConfig) ([]byte, []byte, error) {
+	brandingJSON, err := json.Marshal(branding)
+	if err != nil {
+		return nil, nil, err
+	}
+	configJSON, err := json.Marshal(config)
+	if err != nil {
+		return nil, nil, err
+	}
+	return brandingJSON, configJSON, nil
+}
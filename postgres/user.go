@@ -6,6 +6,7 @@ import (
 	epublib "epublib"
 	"fmt"
 	"log"
+	"strings"
 
 	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
@@ -19,9 +20,12 @@ type User struct {
 	Gender      string       `json:"gender"`
 	BirthDate   sql.NullTime `json:"birth_date"`
 	ImgProfile  string       `json:"img_profile"`
+	Version     int          `json:"version"`
 	CreatedAt   sql.NullTime `json:"created_at"`
 	UpdatedAt   sql.NullTime `json:"updated_at"`
 	DeletedAt   sql.NullTime `json:"deleted_at"`
+
+	PhoneVerifiedAt sql.NullTime `json:"phone_verified_at"`
 }
 
 func (user *User) toEpublibUser() *epublib.User {
@@ -33,12 +37,36 @@ func (user *User) toEpublibUser() *epublib.User {
 		Gender:      epublib.Gender(user.Gender),
 		BirthDate:   user.BirthDate.Time,
 		ImgProfile:  user.ImgProfile,
+		Version:     user.Version,
 		CreatedAt:   user.CreatedAt.Time,
 		UpdatedAt:   user.UpdatedAt.Time,
 		DeletedAt:   user.DeletedAt.Time,
+
+		PhoneVerifiedAt: user.PhoneVerifiedAt.Time,
 	}
 }
 
+// userColumns lists the users columns in the order expected by scanUser.
+const userColumns = "id, name, address, phone_number, gender, birth_date, img_profile, version, created_at, updated_at, deleted_at, phone_verified_at"
+
+// scanUser scans a single row selected with userColumns into user.
+func scanUser(row pgx.Row, user *User) error {
+	return row.Scan(
+		&user.ID,
+		&user.Name,
+		&user.Address,
+		&user.PhoneNumber,
+		&user.Gender,
+		&user.BirthDate,
+		&user.ImgProfile,
+		&user.Version,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+		&user.DeletedAt,
+		&user.PhoneVerifiedAt,
+	)
+}
+
 // UserService represents a service for managing users.
 type UserService struct {
 	db epublib.Conn
@@ -55,18 +83,7 @@ func (svc *UserService) FindUserByID(ctx context.Context, id string) (*epublib.U
 		db = tx
 	}
 	user := &User{}
-	err := db.QueryRow(ctx, "SELECT * FROM users WHERE id = $1", id).Scan(
-		&user.ID,
-		&user.Name,
-		&user.Address,
-		&user.PhoneNumber,
-		&user.Gender,
-		&user.BirthDate,
-		&user.ImgProfile,
-		&user.CreatedAt,
-		&user.UpdatedAt,
-		&user.DeletedAt,
-	)
+	err := scanUser(db.QueryRow(ctx, "SELECT "+userColumns+" FROM users WHERE id = $1", id), user)
 	if err != nil {
 		if err == pgx.ErrNoRows {
 			return nil, epublib.ErrNotFound
@@ -83,18 +100,11 @@ func (svc *UserService) FindUserByUsername(ctx context.Context, username string)
 		db = tx
 	}
 	user := &User{}
-	err := db.QueryRow(ctx, "SELECT * FROM users WHERE username = $1", username).Scan(
-		&user.ID,
-		&user.Name,
-		&user.Address,
-		&user.PhoneNumber,
-		&user.Gender,
-		&user.BirthDate,
-		&user.ImgProfile,
-		&user.CreatedAt,
-		&user.UpdatedAt,
-		&user.DeletedAt,
-	)
+	err := scanUser(db.QueryRow(
+		ctx,
+		"SELECT "+userColumns+" FROM users WHERE id = (SELECT user_id FROM auth WHERE lower(username) = lower($1) AND deleted_at IS NULL)",
+		username,
+	), user)
 	if err != nil {
 		if err == pgx.ErrNoRows {
 			return nil, epublib.ErrNotFound
@@ -105,29 +115,86 @@ func (svc *UserService) FindUserByUsername(ctx context.Context, username string)
 	return user.toEpublibUser(), nil
 }
 
+// userSortColumns maps sort fields onto columns and the type their cursor
+// values are cast to.
+var userSortColumns = map[epublib.UserSortField][2]string{
+	epublib.UserSortName:      {"name", "text"},
+	epublib.UserSortBirthDate: {"birth_date", "date"},
+	epublib.UserSortCreatedAt: {"created_at", "timestamptz"},
+	epublib.UserSortUpdatedAt: {"updated_at", "timestamptz"},
+}
+
 func (svc *UserService) FindUsers(ctx context.Context, filter epublib.UserFilter) ([]*epublib.User, int, error) {
 	db := svc.db
 	if tx := epublib.TxFromContext(ctx); tx != nil {
 		db = tx
 	}
-	if filter.Limit == 0 {
+	if filter.Limit <= 0 {
 		filter.Limit = 10
 	}
+	if filter.Limit > epublib.MaxUserPageSize {
+		filter.Limit = epublib.MaxUserPageSize
+	}
 	var users []*epublib.User
 	var totalCount int
 
 	// Build the SQL query based on the filter criteria.
-	query := "SELECT * FROM users WHERE true"
+	query := "SELECT " + userColumns + " FROM users WHERE true"
 	filterQuery := ""
 	args := []interface{}{}
 
 	if filter.Name != "" {
-		args = append(args, "%"+filter.Name+"%")
-		filterQuery += fmt.Sprintf(" AND name LIKE $%d", len(args))
+		args = append(args, "%"+escapeLike(filter.Name)+"%")
+		filterQuery += fmt.Sprintf(" AND name ILIKE $%d", len(args))
+	}
+	if filter.Email != "" {
+		args = append(args, "%"+escapeLike(filter.Email)+"%")
+		filterQuery += fmt.Sprintf(" AND EXISTS (SELECT 1 FROM auth WHERE auth.user_id = users.id AND auth.email ILIKE $%d)", len(args))
+	}
+	if filter.Level != "" {
+		args = append(args, filter.Level)
+		filterQuery += fmt.Sprintf(" AND EXISTS (SELECT 1 FROM auth WHERE auth.user_id = users.id AND auth.level = $%d)", len(args))
+	}
+	if filter.Gender != "" {
+		args = append(args, filter.Gender)
+		filterQuery += fmt.Sprintf(" AND gender = $%d", len(args))
+	}
+	if !filter.CreatedAfter.IsZero() {
+		args = append(args, filter.CreatedAfter)
+		filterQuery += fmt.Sprintf(" AND created_at >= $%d", len(args))
+	}
+	if !filter.CreatedBefore.IsZero() {
+		args = append(args, filter.CreatedBefore)
+		filterQuery += fmt.Sprintf(" AND created_at < $%d", len(args))
+	}
+	if !filter.UpdatedAfter.IsZero() {
+		args = append(args, filter.UpdatedAfter)
+		filterQuery += fmt.Sprintf(" AND updated_at >= $%d", len(args))
+	}
+	if !filter.UpdatedBefore.IsZero() {
+		args = append(args, filter.UpdatedBefore)
+		filterQuery += fmt.Sprintf(" AND updated_at < $%d", len(args))
+	}
+	if !filter.DeletedBefore.IsZero() {
+		args = append(args, filter.DeletedBefore)
+		filterQuery += fmt.Sprintf(" AND deleted_at < $%d", len(args))
+	}
+	if filter.GroupID != "" {
+		args = append(args, filter.GroupID)
+		groups := fmt.Sprintf("$%d::uuid", len(args))
+		if filter.IncludeSubgroups {
+			groups = groupSubtree(fmt.Sprintf("$%d::uuid", len(args)))
+		}
+		filterQuery += " AND EXISTS (SELECT 1 FROM group_member WHERE group_member.user_id = users.id AND group_member.group_id IN (" + groups + "))"
 	}
-	if !filter.IncludeDeleted {
+	if filter.OnlyDeleted {
+		filterQuery += " AND deleted_at IS NOT NULL"
+	} else if !filter.IncludeDeleted {
 		filterQuery += " AND deleted_at IS NULL"
 	}
+	if filter.NotErased {
+		filterQuery += " AND NOT EXISTS (SELECT 1 FROM erasure_request WHERE erasure_request.user_id = users.id AND erasure_request.completed_at IS NOT NULL)"
+	}
 
 	// Count the total number of matching users.
 	err := db.QueryRow(ctx, "SELECT COUNT(*) FROM users WHERE true"+filterQuery, args...).Scan(&totalCount)
@@ -139,10 +206,60 @@ func (svc *UserService) FindUsers(ctx context.Context, filter epublib.UserFilter
 		return nil, 0, err
 	}
 
-	// Apply filter & pagination using OFFSET and LIMIT.
-	query += filterQuery + fmt.Sprintf(" OFFSET %d LIMIT %d", filter.Offset, filter.Limit)
+	// Build the ordering, always ending with id so keyset pagination is stable.
+	columns := make([]string, 0, len(filter.Sort)+1)
+	casts := make([]string, 0, len(filter.Sort)+1)
+	descs := make([]bool, 0, len(filter.Sort)+1)
+	for _, sort := range filter.Sort {
+		column, ok := userSortColumns[sort.Field]
+		if !ok {
+			return nil, 0, fmt.Errorf("invalid sort field %q", sort.Field)
+		}
+		columns = append(columns, column[0])
+		casts = append(casts, column[1])
+		descs = append(descs, sort.Desc)
+	}
+	columns = append(columns, "id")
+	casts = append(casts, "uuid")
+	descs = append(descs, false)
 
-	rows, err := svc.db.Query(ctx, query, args...)
+	// Continue after the cursor instead of skipping rows when one is given.
+	pageQuery := filterQuery
+	if filter.After != "" {
+		values, err := epublib.ParseUserCursor(filter.After, filter.Sort)
+		if err != nil {
+			return nil, 0, err
+		}
+		var or []string
+		for i := range columns {
+			var and []string
+			for j := 0; j < i; j++ {
+				args = append(args, values[j])
+				and = append(and, fmt.Sprintf("%s = $%d::%s", columns[j], len(args), casts[j]))
+			}
+			op := ">"
+			if descs[i] {
+				op = "<"
+			}
+			args = append(args, values[i])
+			and = append(and, fmt.Sprintf("%s %s $%d::%s", columns[i], op, len(args), casts[i]))
+			or = append(or, "("+strings.Join(and, " AND ")+")")
+		}
+		pageQuery += " AND (" + strings.Join(or, " OR ") + ")"
+		filter.Offset = 0
+	}
+	orderBy := make([]string, len(columns))
+	for i, column := range columns {
+		orderBy[i] = column
+		if descs[i] {
+			orderBy[i] += " DESC"
+		}
+	}
+
+	// Apply filter, ordering & pagination using OFFSET and LIMIT.
+	query += pageQuery + " ORDER BY " + strings.Join(orderBy, ", ") + fmt.Sprintf(" OFFSET %d LIMIT %d", filter.Offset, filter.Limit)
+
+	rows, err := db.Query(ctx, query, args...)
 	if err != nil {
 		log.Println(err)
 		return nil, 0, err
@@ -151,28 +268,26 @@ func (svc *UserService) FindUsers(ctx context.Context, filter epublib.UserFilter
 
 	for rows.Next() {
 		user := &User{}
-		err := rows.Scan(
-			&user.ID,
-			&user.Name,
-			&user.Address,
-			&user.PhoneNumber,
-			&user.Gender,
-			&user.BirthDate,
-			&user.ImgProfile,
-			&user.CreatedAt,
-			&user.UpdatedAt,
-			&user.DeletedAt,
-		)
+		err := scanUser(rows, user)
 		if err != nil {
 			log.Println(err)
 			return nil, 0, err
 		}
 		users = append(users, user.toEpublibUser())
 	}
+	if err := rows.Err(); err != nil {
+		log.Println(err)
+		return nil, 0, err
+	}
 
 	return users, totalCount, nil
 }
 
+// escapeLike escapes the LIKE wildcards in s so it is matched literally.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
 func (svc *UserService) CreateUser(ctx context.Context, user *epublib.User) error {
 	db := svc.db
 	if tx := epublib.TxFromContext(ctx); tx != nil {
@@ -203,9 +318,9 @@ func (svc *UserService) UpdateUser(ctx context.Context, id string, upd epublib.U
 	if tx := epublib.TxFromContext(ctx); tx != nil {
 		db = tx
 	}
-	_, err := db.Exec(
+	tag, err := db.Exec(
 		ctx,
-		"UPDATE users SET name=$1, address=$2, phone_number=$3, gender=$4, birth_date=$5, img_profile=$6, updated_at = current_timestamp WHERE id=$7",
+		"UPDATE users SET name=$1, address=$2, phone_number=$3, phone_verified_at = CASE WHEN phone_number = $3 THEN phone_verified_at END, gender=$4, birth_date=$5, img_profile=$6, version = version + 1, updated_at = current_timestamp WHERE id=$7 AND ($8 = 0 OR version = $8)",
 		upd.Name,
 		upd.Address,
 		upd.PhoneNumber,
@@ -213,25 +328,91 @@ func (svc *UserService) UpdateUser(ctx context.Context, id string, upd epublib.U
 		upd.BirthDate,
 		upd.ImgProfile,
 		id,
+		upd.Version,
 	)
 	if err != nil {
 		log.Println(err)
 		return nil, err
 	}
+	if tag.RowsAffected() == 0 {
+		return nil, svc.missingOrConflict(ctx, id)
+	}
 
 	// Retrieve the updated user for response.
 	return svc.FindUserByID(ctx, id)
 }
 
-func (svc *UserService) DeleteUser(ctx context.Context, id string) error {
+func (svc *UserService) DeleteUser(ctx context.Context, id string, version int) error {
+	db := svc.db
+	if tx := epublib.TxFromContext(ctx); tx != nil {
+		db = tx
+	}
+	tag, err := db.Exec(ctx, "UPDATE users SET deleted_at=current_timestamp, version = version + 1 WHERE id=$1 AND ($2 = 0 OR version = $2)", id, version)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return svc.missingOrConflict(ctx, id)
+	}
+	return nil
+}
+
+func (svc *UserService) RestoreUser(ctx context.Context, id string) error {
+	db := svc.db
+	if tx := epublib.TxFromContext(ctx); tx != nil {
+		db = tx
+	}
+	tag, err := db.Exec(ctx, "UPDATE users SET deleted_at = NULL, version = version + 1, updated_at = current_timestamp WHERE id = $1 AND deleted_at IS NOT NULL", id)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return epublib.ErrNotFound
+	}
+	return nil
+}
+
+// Permanently deletes a soft deleted user. Should run inside a transaction
+// so the user never outlives its auth or the other way around.
+func (svc *UserService) PurgeUser(ctx context.Context, id string) error {
 	db := svc.db
 	if tx := epublib.TxFromContext(ctx); tx != nil {
 		db = tx
 	}
-	_, err := db.Exec(ctx, "UPDATE users SET deleted_at=current_timestamp WHERE id=$1", id)
+	tag, err := db.Exec(ctx, "DELETE FROM users WHERE id = $1 AND deleted_at IS NOT NULL", id)
 	if err != nil {
 		log.Println(err)
 		return err
 	}
+	if tag.RowsAffected() == 0 {
+		return epublib.ErrNotFound
+	}
+	for _, query := range purgeUserQueries {
+		if _, err := db.Exec(ctx, query, id); err != nil {
+			log.Println(err)
+			return err
+		}
+	}
 	return nil
 }
+
+// purgeUserQueries delete the records that only reference the user passed as $1.
+var purgeUserQueries = []string{
+	`DELETE FROM auth WHERE user_id = $1`,
+	`DELETE FROM username_reservation WHERE user_id = $1`,
+	`DELETE FROM reset_token WHERE user_id = $1`,
+	`DELETE FROM user_setting WHERE user_id = $1`,
+	`DELETE FROM phone_verification WHERE user_id = $1`,
+	`DELETE FROM group_member WHERE user_id = $1`,
+}
+
+// missingOrConflict tells apart why a versioned write touched no rows: the
+// user either does not exist or has been modified since it was read.
+func (svc *UserService) missingOrConflict(ctx context.Context, id string) error {
+	if _, err := svc.FindUserByID(ctx, id); err != nil {
+		return err
+	}
+	return epublib.ErrConflict
+}
@@ -0,0 +1,166 @@
+package epublib
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Publisher is a publishing house. Books are linked to the publisher whose
+// name or aliases match their publisher, see PublisherNameKey.
+type Publisher struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+
+	// Name used to sort publishers, like "Penguin Press" for "The Penguin
+	// Press".
+	SortName string `json:"sort_name"`
+
+	// Other spellings of the name, like imprints or former names.
+	Aliases []string `json:"aliases"`
+
+	Description string `json:"description"`
+	Website     string `json:"website"`
+
+	// Blob key prefix of the logo thumbnails, empty if none was uploaded.
+	LogoKey string `json:"-"`
+	HasLogo bool   `json:"has_logo"`
+
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+// Validate checks the fields of a publisher that clients may set.
+func (p *Publisher) Validate() error {
+	if p.Name == "" || len(p.Name) > 255 {
+		return fmt.Errorf("name must be between 1 and 255 characters")
+	}
+	if PublisherNameKey(p.Name) == "" {
+		return fmt.Errorf("name must contain letters or digits")
+	}
+	if len(p.SortName) > 255 {
+		return fmt.Errorf("sort_name must be at most 255 characters")
+	}
+	for _, alias := range p.Aliases {
+		if PublisherNameKey(alias) == "" || len(alias) > 255 {
+			return fmt.Errorf("aliases must be between 1 and 255 characters")
+		}
+	}
+	if len(p.Description) > 10000 {
+		return fmt.Errorf("description must be at most 10000 characters")
+	}
+	if p.Website != "" && !strings.HasPrefix(p.Website, "https://") && !strings.HasPrefix(p.Website, "http://") {
+		return fmt.Errorf("website must be an http or https URL")
+	}
+	return nil
+}
+
+// PublisherNameKey returns the key matching spellings of the same publisher
+// name regardless of case, spacing and punctuation. It is empty for names
+// without letters or digits.
+func PublisherNameKey(name string) string {
+	return strings.Join(nameTokens(name), " ")
+}
+
+// publisherSuffixes are words publisher names are often given with or
+// without, like "Ltd" or "Books".
+var publisherSuffixes = map[string]bool{
+	"books": true, "co": true, "company": true, "corp": true, "gmbh": true, "group": true,
+	"inc": true, "llc": true, "ltd": true, "press": true, "publisher": true,
+	"publishers": true, "publishing": true, "verlag": true,
+}
+
+// PublisherMatchKey returns a looser key than PublisherNameKey, without a
+// leading article and the usual suffixes, for finding publishers that may
+// be duplicates, like "Penguin Books Ltd" and "Penguin".
+func PublisherMatchKey(name string) string {
+	tokens := nameTokens(name)
+	if len(tokens) > 1 && tokens[0] == "the" {
+		tokens = tokens[1:]
+	}
+	for len(tokens) > 1 && publisherSuffixes[tokens[len(tokens)-1]] {
+		tokens = tokens[:len(tokens)-1]
+	}
+	return strings.Join(tokens, " ")
+}
+
+// PublisherSortName derives the sort name of a publisher from the name,
+// dropping a leading article.
+func PublisherSortName(name string) string {
+	name = strings.Join(strings.Fields(name), " ")
+	if len(name) > 4 && strings.EqualFold(name[:4], "the ") {
+		return name[4:]
+	}
+	return name
+}
+
+// PublisherService represents a service for managing publishers and the
+// links of books to them.
+type PublisherService interface {
+	// Retrieves a non-deleted publisher by ID.
+	FindPublisherByID(ctx context.Context, id string) (*Publisher, error)
+
+	// Retrieves a list of publishers by filter, by sort name. Also returns
+	// total count of matching publishers which may differ from returned
+	// results if filter.Limit is specified.
+	FindPublishers(ctx context.Context, filter PublisherFilter) ([]*Publisher, int, error)
+
+	// Creates a new publisher. Returns ErrPublisherNameTaken if the name or
+	// an alias matches another publisher.
+	CreatePublisher(ctx context.Context, publisher *Publisher) error
+
+	// Updates a publisher. If upd.Version is set, the update is only applied
+	// when it matches the current version, otherwise ErrConflict is
+	// returned. Returns ErrPublisherNameTaken if the name or an alias
+	// matches another publisher.
+	UpdatePublisher(ctx context.Context, id string, upd PublisherUpdate) (*Publisher, error)
+
+	// Soft deletes a publisher and unlinks it from its books.
+	DeletePublisher(ctx context.Context, id string, version int) error
+
+	// Points a publisher at new logo thumbnails, or at none if logoKey is
+	// empty.
+	SetPublisherLogo(ctx context.Context, id, logoKey string) (*Publisher, error)
+
+	// Merges other publishers into a publisher: their books are linked to
+	// it, their names and aliases become its aliases and they are deleted.
+	MergePublishers(ctx context.Context, id string, otherIDs []string) (*Publisher, error)
+
+	// Retrieves groups of publishers that may be duplicates, sharing a
+	// PublisherMatchKey.
+	FindDuplicatePublishers(ctx context.Context) ([][]*Publisher, error)
+
+	// Links a book to the publisher matching name, creating it if missing,
+	// or unlinks it if name is empty.
+	LinkBookPublisher(ctx context.Context, bookID, name string) error
+}
+
+// MaxPublisherPageSize caps PublisherFilter.Limit.
+const MaxPublisherPageSize = 100
+
+// PublisherFilter represents a filter passed to FindPublishers().
+type PublisherFilter struct {
+	// Filtering fields. Name matches case-insensitive substrings of the name
+	// and aliases.
+	Name string `json:"name"`
+
+	// Restrict to subset of results.
+	Offset int `json:"offset"`
+	Limit  int `json:"limit"`
+}
+
+// PublisherUpdate represents a set of fields to be updated via
+// UpdatePublisher().
+type PublisherUpdate struct {
+	Name        string   `json:"name"`
+	SortName    string   `json:"sort_name"`
+	Aliases     []string `json:"aliases"`
+	Description string   `json:"description"`
+	Website     string   `json:"website"`
+
+	// Expected current version of the publisher, zero skips the check.
+	Version int `json:"-"`
+}
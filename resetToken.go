@@ -7,6 +7,7 @@ import (
 
 type ResetToken struct {
 	ID        string    `json:"id"`
+	UserID    string    `json:"user_id"`
 	Token     string    `json:"token"`
 	Used      bool      `json:"used"`
 	CreatedAt time.Time `json:"created_at"`
@@ -14,7 +15,7 @@ type ResetToken struct {
 	DeletedAt time.Time `json:"deleted_at"`
 }
 
-// AuthService represents a service for managing auths.
+// ResetTokenService represents a service for managing reset tokens.
 type ResetTokenService interface {
 
 	// Generates new Reset Token based on auth.
@@ -25,4 +26,10 @@ type ResetTokenService interface {
 
 	// Marks Reset Token as used and returns decoded auth in token.
 	UseResetToken(ctx context.Context, id string, token string) (*Auth, error)
+
+	// Soft deletes used and expired Reset Tokens, returns how many were deleted.
+	ExpireResetTokens(ctx context.Context) (int64, error)
+
+	// Permanently deletes Reset Tokens soft deleted before t, returns how many were purged.
+	PurgeResetTokens(ctx context.Context, t time.Time) (int64, error)
 }
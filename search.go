@@ -0,0 +1,62 @@
+package epublib
+
+import "context"
+
+// TextPassage is a run of text of a book, the unit full-text search
+// indexes. SpineIndex, Path and Fragment locate it in the EPUB, Position
+// orders the passages of the book.
+type TextPassage struct {
+	SpineIndex int    `json:"spine_index"`
+	Path       string `json:"path"`
+	Fragment   string `json:"fragment,omitempty"`
+	Position   int    `json:"position"`
+	Text       string `json:"text"`
+}
+
+// SearchHit is a passage matching a search.
+type SearchHit struct {
+	BookID     string `json:"book_id"`
+	BookTitle  string `json:"book_title"`
+	SpineIndex int    `json:"spine_index"`
+	Path       string `json:"path"`
+	Fragment   string `json:"fragment,omitempty"`
+	Position   int    `json:"position"`
+
+	// Snippet is an HTML escaped excerpt of the passage with the matches
+	// wrapped in mark elements.
+	Snippet string  `json:"snippet"`
+	Rank    float64 `json:"rank"`
+}
+
+// SearchService represents a service for full-text search in book content.
+type SearchService interface {
+	// Replaces the indexed text of a book. The language tag picks the
+	// stemming rules.
+	IndexBookText(ctx context.Context, bookID, language string, passages []TextPassage) error
+
+	// Re-indexes the text of a book after its language changed.
+	SetBookTextLanguage(ctx context.Context, bookID, language string) error
+
+	// Retrieves the passages matching a query, best first or, within a
+	// single book, in reading order. Also returns the total count.
+	Search(ctx context.Context, filter SearchFilter) ([]*SearchHit, int, error)
+}
+
+// MaxSearchPageSize caps SearchFilter.Limit.
+const MaxSearchPageSize = 50
+
+// SearchFilter represents a filter passed to Search().
+type SearchFilter struct {
+	// Query uses web search syntax: quoted phrases, OR and -excluded
+	// words.
+	Query string `json:"query"`
+
+	// Filtering fields. Language matches the book language.
+	BookID   string       `json:"book_id"`
+	Language string       `json:"language"`
+	Statuses []BookStatus `json:"statuses"`
+
+	// Restrict to subset of results.
+	Offset int `json:"offset"`
+	Limit  int `json:"limit"`
+}
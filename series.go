@@ -0,0 +1,98 @@
+package epublib
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Series is a sequence of books, like the volumes of a saga. Books are
+// placed in it by their series position, see Book.SeriesPosition.
+type Series struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+// Validate checks the fields of a series that clients may set.
+func (s *Series) Validate() error {
+	if s.Name == "" || len(s.Name) > 255 {
+		return fmt.Errorf("name must be between 1 and 255 characters")
+	}
+	if SeriesNameKey(s.Name) == "" {
+		return fmt.Errorf("name must contain letters or digits")
+	}
+	if len(s.Description) > 10000 {
+		return fmt.Errorf("description must be at most 10000 characters")
+	}
+	return nil
+}
+
+// SeriesNameKey returns the key matching spellings of the same series name
+// regardless of case, spacing and punctuation. It is empty for names
+// without letters or digits.
+func SeriesNameKey(name string) string {
+	return strings.Join(nameTokens(name), " ")
+}
+
+// SeriesService represents a service for managing series and the books
+// placed in them.
+type SeriesService interface {
+	// Retrieves a non-deleted series by ID.
+	FindSeriesByID(ctx context.Context, id string) (*Series, error)
+
+	// Retrieves a list of series by filter, by name. Also returns total count
+	// of matching series which may differ from returned results if
+	// filter.Limit is specified.
+	FindSeries(ctx context.Context, filter SeriesFilter) ([]*Series, int, error)
+
+	// Creates a new series. Returns ErrSeriesNameTaken if the name matches
+	// another series.
+	CreateSeries(ctx context.Context, series *Series) error
+
+	// Updates a series. If upd.Version is set, the update is only applied
+	// when it matches the current version, otherwise ErrConflict is
+	// returned. Returns ErrSeriesNameTaken if the name matches another
+	// series.
+	UpdateSeries(ctx context.Context, id string, upd SeriesUpdate) (*Series, error)
+
+	// Soft deletes a series and removes its books from it.
+	DeleteSeries(ctx context.Context, id string, version int) error
+
+	// Places a book in the series matching name at the given position,
+	// creating the series if missing.
+	LinkBookSeries(ctx context.Context, bookID, name string, position float64) error
+
+	// Retrieves the book following position in a series, the first one
+	// with a greater position and one of statuses if any are given. Returns
+	// ErrNotFound if there is none.
+	FindNextInSeries(ctx context.Context, seriesID string, position float64, statuses []BookStatus) (*Book, error)
+}
+
+// MaxSeriesPageSize caps SeriesFilter.Limit.
+const MaxSeriesPageSize = 100
+
+// SeriesFilter represents a filter passed to FindSeries().
+type SeriesFilter struct {
+	// Filtering fields. Name matches case-insensitive substrings of the name.
+	Name string `json:"name"`
+
+	// Restrict to subset of results.
+	Offset int `json:"offset"`
+	Limit  int `json:"limit"`
+}
+
+// SeriesUpdate represents a set of fields to be updated via UpdateSeries().
+type SeriesUpdate struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+
+	// Expected current version of the series, zero skips the check.
+	Version int `json:"-"`
+}
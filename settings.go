@@ -0,0 +1,181 @@
+package epublib
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+)
+
+type SettingType string
+
+const (
+	BoolSetting   SettingType = "bool"
+	IntSetting    SettingType = "int"
+	StringSetting SettingType = "string"
+	EnumSetting   SettingType = "enum"
+)
+
+// SettingDefinition describes a user setting, its type, allowed values and
+// built-in default value.
+type SettingDefinition struct {
+	Key         string      `json:"key"`
+	Type        SettingType `json:"type"`
+	Description string      `json:"description"`
+	Default     interface{} `json:"default"`
+
+	// Allowed values of EnumSetting.
+	Values []string `json:"values,omitempty"`
+
+	// Inclusive bounds of IntSetting.
+	Min int `json:"min,omitempty"`
+	Max int `json:"max,omitempty"`
+
+	// Maximum length of StringSetting.
+	MaxLength int `json:"max_length,omitempty"`
+}
+
+// SettingDefinitions is the schema of every supported user setting.
+var SettingDefinitions = []SettingDefinition{
+	{Key: "ui.language", Type: EnumSetting, Values: []string{"en", "id"}, Default: "id", Description: "Language of the user interface"},
+	{Key: "reading.theme", Type: EnumSetting, Values: []string{"light", "dark", "sepia"}, Default: "light", Description: "Color theme of the reader"},
+	{Key: "reading.font_size", Type: IntSetting, Min: 8, Max: 48, Default: 16, Description: "Font size of the reader in pixels"},
+	{Key: "reading.font_family", Type: StringSetting, MaxLength: 100, Default: "", Description: "Font family of the reader, empty uses the publisher's font"},
+	{Key: "notifications.email", Type: BoolSetting, Default: true, Description: "Receive notifications by email"},
+	{Key: "notifications.push", Type: BoolSetting, Default: false, Description: "Receive push notifications"},
+	{Key: "download.format", Type: EnumSetting, Values: []string{"epub", "pdf"}, Default: "epub", Description: "Default format of downloaded books"},
+}
+
+// FindSettingDefinition returns the definition of the setting named key.
+func FindSettingDefinition(key string) (*SettingDefinition, bool) {
+	for i := range SettingDefinitions {
+		if SettingDefinitions[i].Key == key {
+			return &SettingDefinitions[i], true
+		}
+	}
+	return nil, false
+}
+
+// Validate checks value against the definition and returns it normalized to
+// bool, int or string. JSON numbers are accepted for IntSetting as long as
+// they hold a whole number.
+func (d *SettingDefinition) Validate(value interface{}) (interface{}, error) {
+	switch d.Type {
+	case BoolSetting:
+		if v, ok := value.(bool); ok {
+			return v, nil
+		}
+		return nil, fmt.Errorf("%s must be a boolean", d.Key)
+	case IntSetting:
+		var n float64
+		switch v := value.(type) {
+		case int:
+			n = float64(v)
+		case float64:
+			n = v
+		case json.Number:
+			f, err := v.Float64()
+			if err != nil {
+				return nil, fmt.Errorf("%s must be an integer", d.Key)
+			}
+			n = f
+		default:
+			return nil, fmt.Errorf("%s must be an integer", d.Key)
+		}
+		if n != math.Trunc(n) {
+			return nil, fmt.Errorf("%s must be an integer", d.Key)
+		}
+		if n < float64(d.Min) || n > float64(d.Max) {
+			return nil, fmt.Errorf("%s must be between %d and %d", d.Key, d.Min, d.Max)
+		}
+		return int(n), nil
+	case StringSetting:
+		v, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s must be a string", d.Key)
+		}
+		if d.MaxLength > 0 && len(v) > d.MaxLength {
+			return nil, fmt.Errorf("%s must be at most %d characters", d.Key, d.MaxLength)
+		}
+		return v, nil
+	case EnumSetting:
+		v, ok := value.(string)
+		if ok {
+			for _, allowed := range d.Values {
+				if v == allowed {
+					return v, nil
+				}
+			}
+		}
+		return nil, fmt.Errorf("%s must be one of %v", d.Key, d.Values)
+	default:
+		return nil, fmt.Errorf("%s has unknown type %s", d.Key, d.Type)
+	}
+}
+
+// ValidateSettings validates and normalizes every value. Nil values are kept
+// as they are since they reset a setting to its default.
+func ValidateSettings(values map[string]interface{}) (map[string]interface{}, error) {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	normalized := make(map[string]interface{}, len(values))
+	for _, key := range keys {
+		def, ok := FindSettingDefinition(key)
+		if !ok {
+			return nil, fmt.Errorf("unknown setting %s", key)
+		}
+		if values[key] == nil {
+			normalized[key] = nil
+			continue
+		}
+		v, err := def.Validate(values[key])
+		if err != nil {
+			return nil, err
+		}
+		normalized[key] = v
+	}
+	return normalized, nil
+}
+
+// ResolveSettings returns the effective value of every setting, starting
+// from the built-in defaults and applying layers in order. Unknown keys and
+// values that no longer pass validation are ignored.
+func ResolveSettings(layers ...map[string]interface{}) map[string]interface{} {
+	resolved := make(map[string]interface{}, len(SettingDefinitions))
+	for _, def := range SettingDefinitions {
+		resolved[def.Key] = def.Default
+		for _, layer := range layers {
+			value, ok := layer[def.Key]
+			if !ok || value == nil {
+				continue
+			}
+			if v, err := def.Validate(value); err == nil {
+				resolved[def.Key] = v
+			}
+		}
+	}
+	return resolved
+}
+
+// SettingsService represents a service for managing user settings and the
+// defaults administrators define for them.
+type SettingsService interface {
+	// Retrieves the settings a user has explicitly set.
+	FindUserSettings(ctx context.Context, userID string) (map[string]interface{}, error)
+
+	// Stores validated settings of a user. Nil values remove the user's
+	// value so the default applies again.
+	UpdateUserSettings(ctx context.Context, userID string, values map[string]interface{}) error
+
+	// Retrieves the defaults defined by administrators.
+	FindSettingDefaults(ctx context.Context) (map[string]interface{}, error)
+
+	// Stores validated administrator defaults. Nil values remove the
+	// default so the deployment or built-in default applies again.
+	UpdateSettingDefaults(ctx context.Context, values map[string]interface{}) error
+}
@@ -0,0 +1,16 @@
+package epublib
+
+import (
+	"context"
+)
+
+type SMS struct {
+	To   string `json:"to"`
+	Body string `json:"body"`
+}
+
+// SMSService represents a service for sending text messages.
+type SMSService interface {
+	// Send a text message to an E.164 phone number.
+	SendSMS(ctx context.Context, sms SMS) error
+}
@@ -0,0 +1,100 @@
+package sms
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	epublib "epublib"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// HTTPConfig configures an HTTPService.
+type HTTPConfig struct {
+	// URL messages are posted to, e.g. "https://sms.example.com/v1/messages".
+	URL string
+
+	// Sent as a bearer token when not empty.
+	Token string
+
+	// Sender ID or number messages are sent from.
+	Sender string
+
+	// Defaults to 10 seconds.
+	Timeout time.Duration
+}
+
+// HTTPService sends text messages through a provider accepting JSON
+// requests of the form {"from": "...", "to": "+62...", "body": "..."}.
+// Any 2xx response is treated as accepted.
+type HTTPService struct {
+	config HTTPConfig
+	client *http.Client
+}
+
+// NewHTTPService returns a new instance of HTTPService.
+func NewHTTPService(config HTTPConfig) *HTTPService {
+	if config.Timeout == 0 {
+		config.Timeout = 10 * time.Second
+	}
+	return &HTTPService{
+		config: config,
+		client: &http.Client{Timeout: config.Timeout},
+	}
+}
+
+type httpMessage struct {
+	From string `json:"from,omitempty"`
+	To   string `json:"to"`
+	Body string `json:"body"`
+}
+
+func (svc *HTTPService) SendSMS(ctx context.Context, sms epublib.SMS) error {
+	body, err := json.Marshal(httpMessage{
+		From: svc.config.Sender,
+		To:   sms.To,
+		Body: sms.Body,
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, svc.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if svc.config.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+svc.config.Token)
+	}
+
+	resp, err := svc.client.Do(req)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		// Providers may echo the message, so codes are kept out of the error
+		err := fmt.Errorf("sms provider responded %s: %s", resp.Status, redactCodes(string(bytes.TrimSpace(message))))
+		log.Println(err)
+		return err
+	}
+	log.Println("sent sms to", maskNumber(sms.To))
+	return nil
+}
+
+// codePattern matches the numeric codes sent in verification messages.
+var codePattern = regexp.MustCompile(`\d{4,}`)
+
+// redactCodes replaces the numeric codes of a message body.
+func redactCodes(body string) string {
+	return codePattern.ReplaceAllStringFunc(body, func(code string) string {
+		return strings.Repeat("*", len(code))
+	})
+}
@@ -0,0 +1,33 @@
+package sms
+
+import (
+	"context"
+	epublib "epublib"
+	"log"
+	"strings"
+)
+
+// LogService writes text messages to the log instead of sending them.
+// Meant for development where no SMS provider is available, it is only
+// used when SMS_PROVIDER is explicitly set to "log". Messages are logged
+// as is so verification codes can be read from the log.
+type LogService struct {
+}
+
+// NewLogService returns a new instance of LogService.
+func NewLogService() *LogService {
+	return &LogService{}
+}
+
+func (svc *LogService) SendSMS(ctx context.Context, sms epublib.SMS) error {
+	log.Printf("sms to %s: %s", maskNumber(sms.To), sms.Body)
+	return nil
+}
+
+// maskNumber hides all but the last two digits of a phone number.
+func maskNumber(number string) string {
+	if len(number) <= 2 {
+		return strings.Repeat("*", len(number))
+	}
+	return strings.Repeat("*", len(number)-2) + number[len(number)-2:]
+}
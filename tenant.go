@@ -0,0 +1,113 @@
+package epublib
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// Tenant is an organization hosted by the deployment. Every other record
+// belongs to exactly one tenant.
+type Tenant struct {
+	ID       string         `json:"id"`
+	Slug     string         `json:"slug"`
+	Name     string         `json:"name"`
+	Hosts    []string       `json:"hosts"`
+	Branding TenantBranding `json:"branding"`
+	Config   TenantConfig   `json:"config"`
+
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+// TenantBranding holds what clients need to present the library as the
+// tenant's own.
+type TenantBranding struct {
+	DisplayName  string `json:"display_name"`
+	LogoURL      string `json:"logo_url"`
+	PrimaryColor string `json:"primary_color"`
+	AccentColor  string `json:"accent_color"`
+}
+
+// TenantConfig holds the behavior a tenant may change for its users.
+type TenantConfig struct {
+	// Address mails are sent from, empty uses SMTP_SENDER_ADDR.
+	MailSender string `json:"mail_sender"`
+
+	// Disables self registration, users are then created by admins only.
+	RegistrationDisabled bool `json:"registration_disabled"`
+}
+
+var (
+	tenantSlugPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,48}[a-z0-9]$`)
+	hexColorPattern   = regexp.MustCompile(`^#[0-9A-Fa-f]{6}$`)
+	hostPattern       = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]*[a-z0-9])?(\.[a-z0-9]([a-z0-9-]*[a-z0-9])?)*$`)
+)
+
+// Validate checks the fields of a tenant that clients may set.
+func (t *Tenant) Validate() error {
+	if !tenantSlugPattern.MatchString(t.Slug) {
+		return fmt.Errorf("slug must be 2 to 50 lowercase letters, digits or '-' and may not start or end with '-'")
+	}
+	if t.Name == "" || len(t.Name) > 100 {
+		return fmt.Errorf("name must be between 1 and 100 characters")
+	}
+	for _, host := range t.Hosts {
+		if len(host) > 253 || !hostPattern.MatchString(host) {
+			return fmt.Errorf("invalid host %q, hosts are lowercase names without port", host)
+		}
+	}
+	return t.Branding.Validate()
+}
+
+// Validate checks that colors are given as #RRGGBB.
+func (b *TenantBranding) Validate() error {
+	for _, color := range []string{b.PrimaryColor, b.AccentColor} {
+		if color != "" && !hexColorPattern.MatchString(color) {
+			return fmt.Errorf("invalid color %q, expected #RRGGBB", color)
+		}
+	}
+	return nil
+}
+
+// TenantService represents a service for managing tenants. Tenants are not
+// scoped to the tenant of the context.
+type TenantService interface {
+	// Retrieves a non-deleted tenant by ID.
+	FindTenantByID(ctx context.Context, id string) (*Tenant, error)
+
+	// Retrieves a non-deleted tenant by slug.
+	FindTenantBySlug(ctx context.Context, slug string) (*Tenant, error)
+
+	// Retrieves the non-deleted tenant serving a host name.
+	FindTenantByHost(ctx context.Context, host string) (*Tenant, error)
+
+	// Retrieves every non-deleted tenant ordered by slug.
+	FindTenants(ctx context.Context) ([]*Tenant, error)
+
+	// Creates a new tenant. The ID is generated unless already set.
+	// Returns ErrTenantTaken if the slug or one of the hosts is in use.
+	CreateTenant(ctx context.Context, tenant *Tenant) error
+
+	// Updates a tenant. If upd.Version is set, the update is only applied
+	// when it matches the current version, otherwise ErrConflict is returned.
+	UpdateTenant(ctx context.Context, id string, upd TenantUpdate) (*Tenant, error)
+
+	// Soft deletes a tenant, its records are kept but no longer served.
+	DeleteTenant(ctx context.Context, id string) error
+}
+
+// TenantUpdate represents a set of fields to be updated via UpdateTenant().
+type TenantUpdate struct {
+	Slug     string         `json:"slug"`
+	Name     string         `json:"name"`
+	Hosts    []string       `json:"hosts"`
+	Branding TenantBranding `json:"branding"`
+	Config   TenantConfig   `json:"config"`
+
+	// Expected current version of the tenant, zero skips the check.
+	Version int `json:"-"`
+}
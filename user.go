@@ -2,6 +2,9 @@ package epublib
 
 import (
 	"context"
+	"fmt"
+	"regexp"
+	"strings"
 	"time"
 )
 
@@ -13,6 +16,16 @@ const (
 	FemaleGender       Gender = "F"
 )
 
+// IsValid checks if a Gender is valid
+func (g Gender) IsValid() bool {
+	switch g {
+	case UnidentifiedGender, MaleGender, FemaleGender:
+		return true
+	default:
+		return false
+	}
+}
+
 type User struct {
 	ID          string    `json:"id"`
 	Name        string    `json:"name"`
@@ -21,9 +34,14 @@ type User struct {
 	Gender      Gender    `json:"gender"`
 	BirthDate   time.Time `json:"birth_date"`
 	ImgProfile  string    `json:"img_profile"`
+	Version     int       `json:"version"`
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
 	DeletedAt   time.Time `json:"deleted_at"`
+
+	// Set once the phone number is confirmed with a one-time code, cleared
+	// whenever the phone number changes.
+	PhoneVerifiedAt time.Time `json:"phone_verified_at"`
 }
 
 // UserService represents a service for managing users.
@@ -31,7 +49,7 @@ type UserService interface {
 	// Retrieves a user by ID.
 	FindUserByID(ctx context.Context, id string) (*User, error)
 
-	// Retrieves a user by username.
+	// Retrieves a non-deleted user by username, ignoring case.
 	FindUserByUsername(ctx context.Context, username string) (*User, error)
 
 	// Retrieves a list of users by filter. Also returns total count of matching
@@ -41,24 +59,166 @@ type UserService interface {
 	// Creates a new user.
 	CreateUser(ctx context.Context, user *User) error
 
-	// Updates a user object.
+	// Updates a user object. If upd.Version is set, the update is only applied
+	// when it matches the current version, otherwise ErrConflict is returned.
 	UpdateUser(ctx context.Context, id string, upd UserUpdate) (*User, error)
 
-	// Soft deletes a user.
-	DeleteUser(ctx context.Context, id string) error
+	// Soft deletes a user. If version is non-zero, the delete is only applied
+	// when it matches the current version, otherwise ErrConflict is returned.
+	DeleteUser(ctx context.Context, id string, version int) error
+
+	// Restores a soft deleted user.
+	// Returns ErrNotFound if no deleted user has the given ID.
+	RestoreUser(ctx context.Context, id string) error
+
+	// Permanently deletes a soft deleted user along with its auth and the
+	// records that only reference it. Audit records are kept.
+	PurgeUser(ctx context.Context, id string) error
 }
 
+// MaxUserPageSize caps UserFilter.Limit.
+const MaxUserPageSize = 100
+
 // UserFilter represents a filter passed to FindUsers().
 type UserFilter struct {
-	// Filtering fields.
-	Name           string `json:"name"`
-	IncludeDeleted bool   `json:"include_deleted"`
+	// Filtering fields. Name and Email match case-insensitive substrings.
+	Name           string    `json:"name"`
+	Email          string    `json:"email"`
+	Level          AuthLevel `json:"level"`
+	Gender         Gender    `json:"gender"`
+	CreatedAfter   time.Time `json:"created_after"`
+	CreatedBefore  time.Time `json:"created_before"`
+	UpdatedAfter   time.Time `json:"updated_after"`
+	UpdatedBefore  time.Time `json:"updated_before"`
+	DeletedBefore  time.Time `json:"deleted_before"`
+	IncludeDeleted bool      `json:"include_deleted"`
+	OnlyDeleted    bool      `json:"only_deleted"`
+
+	// NotErased excludes users whose erasure has been completed.
+	NotErased bool `json:"not_erased"`
+
+	// Restricts to members of the group, and of its subgroups if
+	// IncludeSubgroups is set.
+	GroupID          string `json:"group_id"`
+	IncludeSubgroups bool   `json:"include_subgroups"`
+
+	// Result ordering, ID is always appended as the final tiebreaker.
+	Sort []UserSort `json:"sort"`
+
+	// Opaque cursor returned by NewUserCursor(). When set, results start
+	// right after the user it was created from and Offset is ignored.
+	After string `json:"after"`
 
 	// Restrict to subset of results.
 	Offset int `json:"offset"`
 	Limit  int `json:"limit"`
 }
 
+// UserSortField is a user field FindUsers() can order by.
+type UserSortField string
+
+const (
+	UserSortName      UserSortField = "name"
+	UserSortBirthDate UserSortField = "birth_date"
+	UserSortCreatedAt UserSortField = "created_at"
+	UserSortUpdatedAt UserSortField = "updated_at"
+)
+
+// IsValid checks if a UserSortField is valid
+func (f UserSortField) IsValid() bool {
+	switch f {
+	case UserSortName, UserSortBirthDate, UserSortCreatedAt, UserSortUpdatedAt:
+		return true
+	default:
+		return false
+	}
+}
+
+// UserSort represents a single ordering term of FindUsers().
+type UserSort struct {
+	Field UserSortField `json:"field"`
+	Desc  bool          `json:"desc"`
+}
+
+// ParseUserSort parses a comma separated list of sort fields where a leading
+// "-" requests descending order, e.g. "-created_at,name".
+func ParseUserSort(s string) ([]UserSort, error) {
+	var sorts []UserSort
+	for _, term := range strings.Split(s, ",") {
+		term = strings.TrimSpace(term)
+		if term == "" {
+			continue
+		}
+		sort := UserSort{Field: UserSortField(strings.TrimPrefix(term, "-")), Desc: strings.HasPrefix(term, "-")}
+		if !sort.Field.IsValid() {
+			return nil, fmt.Errorf("invalid sort field %q", sort.Field)
+		}
+		sorts = append(sorts, sort)
+	}
+	return sorts, nil
+}
+
+// userSortString returns sorts in the format accepted by ParseUserSort.
+func userSortString(sorts []UserSort) string {
+	terms := make([]string, len(sorts))
+	for i, sort := range sorts {
+		terms[i] = string(sort.Field)
+		if sort.Desc {
+			terms[i] = "-" + terms[i]
+		}
+	}
+	return strings.Join(terms, ",")
+}
+
+// NewUserCursor returns an opaque cursor pointing right after user in a
+// listing ordered by sorts.
+func NewUserCursor(user *User, sorts []UserSort) string {
+	values := make([]string, 0, len(sorts)+1)
+	for _, sort := range sorts {
+		switch sort.Field {
+		case UserSortName:
+			values = append(values, user.Name)
+		case UserSortBirthDate:
+			values = append(values, user.BirthDate.Format("2006-01-02"))
+		case UserSortCreatedAt:
+			values = append(values, user.CreatedAt.Format(time.RFC3339Nano))
+		case UserSortUpdatedAt:
+			values = append(values, user.UpdatedAt.Format(time.RFC3339Nano))
+		}
+	}
+	values = append(values, user.ID)
+	return encodeCursor(userSortString(sorts), values)
+}
+
+// uuidPattern matches the UUIDs users are identified by.
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// ParseUserCursor decodes a cursor created by NewUserCursor() and returns
+// one value per sort term followed by the user ID. Returns ErrInvalidCursor
+// if the cursor is malformed, holds values that do not fit their sort
+// field or was created for a different ordering.
+func ParseUserCursor(cursor string, sorts []UserSort) ([]string, error) {
+	values, err := decodeCursor(cursor, userSortString(sorts))
+	if err != nil {
+		return nil, err
+	}
+	if len(values) != len(sorts)+1 || !uuidPattern.MatchString(values[len(sorts)]) {
+		return nil, ErrInvalidCursor
+	}
+	for i, sort := range sorts {
+		switch sort.Field {
+		case UserSortBirthDate:
+			_, err = time.Parse("2006-01-02", values[i])
+		case UserSortCreatedAt, UserSortUpdatedAt:
+			_, err = time.Parse(time.RFC3339Nano, values[i])
+		}
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+	}
+	return values, nil
+}
+
 // UserUpdate represents a set of fields to be updated via UpdateUser().
 type UserUpdate struct {
 	Name        string    `json:"name"`
@@ -67,4 +227,7 @@ type UserUpdate struct {
 	Gender      Gender    `json:"gender"`
 	BirthDate   time.Time `json:"birth_date"`
 	ImgProfile  string    `json:"img_profile"`
+
+	// Expected current version of the user, zero skips the check.
+	Version int `json:"-"`
 }
@@ -0,0 +1,36 @@
+package epublib
+
+import "time"
+
+type ValidationSeverity string
+
+const (
+	// FatalSeverity findings prevent the file from being read at all.
+	FatalSeverity   ValidationSeverity = "fatal"
+	ErrorSeverity   ValidationSeverity = "error"
+	WarningSeverity ValidationSeverity = "warning"
+	InfoSeverity    ValidationSeverity = "info"
+)
+
+// ValidationMessage is a conformance finding about an EPUB file.
+type ValidationMessage struct {
+	Severity ValidationSeverity `json:"severity"`
+	Code     string             `json:"code"`
+	Message  string             `json:"message"`
+	Path     string             `json:"path,omitempty"`
+	Line     int                `json:"line,omitempty"`
+}
+
+// ValidationReport is the outcome of validating the EPUB file of a book.
+// Books whose report is not valid cannot be published unless blocking is
+// disabled.
+type ValidationReport struct {
+	BookID string `json:"book_id"`
+
+	// Valid is set when there are no fatal or error messages.
+	Valid        bool                `json:"valid"`
+	ErrorCount   int                 `json:"error_count"`
+	WarningCount int                 `json:"warning_count"`
+	Messages     []ValidationMessage `json:"messages"`
+	CreatedAt    time.Time           `json:"created_at"`
+}